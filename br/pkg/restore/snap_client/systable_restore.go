@@ -71,6 +71,9 @@ var unRecoverableTable = map[string]map[string]struct{}{
 		"tidb_mdl_view": {},
 
 		"tidb_pitr_id_map": {},
+
+		// the analyze outcomes are keyed by the table IDs of the cluster, which are meaningless after restore.
+		"analyze_outcomes": {},
 	},
 	"sys": {
 		// replace into view is not supported now
@@ -22,6 +22,7 @@ import (
 var (
 	AutoAnalyzeHistogram      prometheus.Histogram
 	AutoAnalyzeCounter        *prometheus.CounterVec
+	AutoAnalyzeJobCounter     *prometheus.CounterVec
 	StatsInaccuracyRate       prometheus.Histogram
 	PseudoEstimation          *prometheus.CounterVec
 	SyncLoadCounter           prometheus.Counter
@@ -59,6 +60,14 @@ func InitStatsMetrics() {
 			Help:      "Counter of auto analyze.",
 		}, []string{LblType})
 
+	AutoAnalyzeJobCounter = NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb",
+			Subsystem: "statistics",
+			Name:      "auto_analyze_job_total",
+			Help:      "Counter of auto analyze jobs by the analyze type and the result.",
+		}, []string{LblType, LblResult})
+
 	StatsInaccuracyRate = NewHistogram(
 		prometheus.HistogramOpts{
 			Namespace: "tidb",
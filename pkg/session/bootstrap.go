@@ -759,6 +759,18 @@ const (
         status varchar(128),
         description text,
         primary key(module, name))`
+
+	// CreateAnalyzeOutcomesTable stores the outcome counters of the auto analyze jobs of each table,
+	// which are used to restore the circuit breakers of the auto analyze queue after the owner changes.
+	CreateAnalyzeOutcomesTable = `CREATE TABLE IF NOT EXISTS mysql.analyze_outcomes (
+		table_id BIGINT(64) NOT NULL,
+		success_count BIGINT(64) NOT NULL DEFAULT 0,
+		failure_count BIGINT(64) NOT NULL DEFAULT 0,
+		consecutive_failures BIGINT(64) NOT NULL DEFAULT 0,
+		last_failure_time TIMESTAMP NULL DEFAULT NULL,
+		update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (table_id) CLUSTERED
+	);`
 )
 
 // CreateTimers is a table to store all timers for tidb
@@ -1196,12 +1208,16 @@ const (
 	// [version219, version238] is the version range reserved for patches of 8.5.x
 	// ...
 
-	// next version should start with 239
+	// version 239
+	// add mysql.analyze_outcomes table
+	version239 = 239
+
+	// next version should start with 240
 )
 
 // currentBootstrapVersion is defined as a variable, so we can modify its value for testing.
 // please make sure this is the largest version
-var currentBootstrapVersion int64 = version218
+var currentBootstrapVersion int64 = version239
 
 // DDL owner key's expired time is ManagerSessionTTL seconds, we should wait the time and give more time to have a chance to finish it.
 var internalSQLTimeout = owner.ManagerSessionTTL + 15
@@ -1375,6 +1391,7 @@ var (
 		upgradeToVer216,
 		upgradeToVer217,
 		upgradeToVer218,
+		upgradeToVer239,
 	}
 )
 
@@ -3272,6 +3289,13 @@ func upgradeToVer218(_ sessiontypes.Session, ver int64) {
 	// empty, just make lint happy.
 }
 
+func upgradeToVer239(s sessiontypes.Session, ver int64) {
+	if ver >= version239 {
+		return
+	}
+	mustExecute(s, CreateAnalyzeOutcomesTable)
+}
+
 // initGlobalVariableIfNotExists initialize a global variable with specific val if it does not exist.
 func initGlobalVariableIfNotExists(s sessiontypes.Session, name string, val any) {
 	ctx := kv.WithInternalSourceType(context.Background(), kv.InternalTxnBootstrap)
@@ -3426,6 +3450,8 @@ func doDDLWorks(s sessiontypes.Session) {
 	mustExecute(s, CreateIndexAdvisorTable)
 	// create mysql.tidb_kernel_options
 	mustExecute(s, CreateKernelOptionsTable)
+	// create mysql.analyze_outcomes
+	mustExecute(s, CreateAnalyzeOutcomesTable)
 }
 
 // doBootstrapSQLFile executes SQL commands in a file as the last stage of bootstrap.
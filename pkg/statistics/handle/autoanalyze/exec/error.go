@@ -0,0 +1,159 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/kv"
+	"github.com/pingcap/tidb/pkg/parser/terror"
+	storeerr "github.com/pingcap/tidb/pkg/store/driver/error"
+	"github.com/pingcap/tidb/pkg/table"
+	"github.com/pingcap/tidb/pkg/util/dbterror/exeerrors"
+	"github.com/pingcap/tidb/pkg/util/dbterror/plannererrors"
+)
+
+// AnalyzeFailureKind is the kind of the failure of an auto analyze statement.
+type AnalyzeFailureKind int
+
+const (
+	// AnalyzeFailureUnknown means the failure does not belong to any known kind.
+	AnalyzeFailureUnknown AnalyzeFailureKind = iota
+	// AnalyzeFailurePermission means the analyze statement is denied by the privilege check.
+	AnalyzeFailurePermission
+	// AnalyzeFailureResource means the cluster is short of resources, e.g. memory quota or a busy server.
+	AnalyzeFailureResource
+	// AnalyzeFailureTableGone means the database, table or partition no longer exists.
+	AnalyzeFailureTableGone
+	// AnalyzeFailureConflict means the analyze statement conflicts with other transactions
+	// or times out waiting for the storage, e.g. a lock wait timeout or an unavailable region.
+	AnalyzeFailureConflict
+)
+
+// String implements fmt.Stringer interface.
+func (k AnalyzeFailureKind) String() string {
+	switch k {
+	case AnalyzeFailurePermission:
+		return "permission denied"
+	case AnalyzeFailureResource:
+		return "insufficient resource"
+	case AnalyzeFailureTableGone:
+		return "table gone"
+	case AnalyzeFailureConflict:
+		return "conflict or timeout"
+	default:
+		return "unknown"
+	}
+}
+
+// IsTransient checks whether the failure is likely to disappear by itself, so that the statement is worth retrying.
+func (k AnalyzeFailureKind) IsTransient() bool {
+	return k == AnalyzeFailureResource || k == AnalyzeFailureConflict
+}
+
+var failureKindErrors = map[AnalyzeFailureKind][]*terror.Error{
+	AnalyzeFailurePermission: {
+		plannererrors.ErrPrivilegeCheckFail,
+		plannererrors.ErrDBaccessDenied,
+		plannererrors.ErrTableaccessDenied,
+		plannererrors.ErrSpecificAccessDenied,
+	},
+	AnalyzeFailureResource: {
+		exeerrors.ErrMemoryExceedForQuery,
+		exeerrors.ErrMemoryExceedForInstance,
+		storeerr.ErrTiKVServerBusy,
+		storeerr.ErrTiFlashServerBusy,
+		storeerr.ErrTokenLimit,
+		storeerr.ErrResourceGroupThrottled,
+	},
+	AnalyzeFailureTableGone: {
+		infoschema.ErrDatabaseNotExists,
+		infoschema.ErrTableNotExists,
+		table.ErrUnknownPartition,
+	},
+	AnalyzeFailureConflict: {
+		kv.ErrTxnRetryable,
+		kv.ErrWriteConflict,
+		kv.ErrWriteConflictInTiDB,
+		storeerr.ErrLockWaitTimeout,
+		storeerr.ErrResolveLockTimeout,
+		storeerr.ErrTiKVServerTimeout,
+		storeerr.ErrTiFlashServerTimeout,
+		storeerr.ErrPDServerTimeout,
+		storeerr.ErrRegionUnavailable,
+	},
+}
+
+// AnalyzeError is the error returned when an auto analyze statement fails.
+// It keeps the original error as its cause, so the error can still be checked by terror.Error.Equal.
+type AnalyzeError struct {
+	err error
+	// SQL is the escaped analyze statement. It is empty if the statement cannot be escaped.
+	SQL  string
+	Kind AnalyzeFailureKind
+}
+
+// NewAnalyzeError creates a new AnalyzeError and classifies the error.
+func NewAnalyzeError(err error, sql string) *AnalyzeError {
+	return &AnalyzeError{
+		err:  err,
+		SQL:  sql,
+		Kind: classifyAnalyzeError(err),
+	}
+}
+
+// Error implements error interface.
+func (e *AnalyzeError) Error() string {
+	if e.Kind == AnalyzeFailureUnknown {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.err.Error())
+}
+
+// Cause returns the original error.
+func (e *AnalyzeError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the original error.
+func (e *AnalyzeError) Unwrap() error {
+	return e.err
+}
+
+// GetAnalyzeFailureKind returns the failure kind of the error returned by RunAutoAnalyze.
+// If the error is not an AnalyzeError, it classifies the error directly.
+func GetAnalyzeFailureKind(err error) AnalyzeFailureKind {
+	if err == nil {
+		return AnalyzeFailureUnknown
+	}
+	var analyzeErr *AnalyzeError
+	if errors.As(err, &analyzeErr) {
+		return analyzeErr.Kind
+	}
+	return classifyAnalyzeError(err)
+}
+
+func classifyAnalyzeError(err error) AnalyzeFailureKind {
+	for kind, kindErrors := range failureKindErrors {
+		for _, kindErr := range kindErrors {
+			if kindErr.Equal(err) {
+				return kind
+			}
+		}
+	}
+	return AnalyzeFailureUnknown
+}
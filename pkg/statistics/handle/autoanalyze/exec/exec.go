@@ -42,7 +42,8 @@ var execOptionForAnalyze = map[int]sqlexec.OptionFuncAlias{
 	statistics.Version2: sqlexec.ExecOptionAnalyzeVer2,
 }
 
-// AutoAnalyze executes the auto analyze task.
+// AutoAnalyze executes the auto analyze task and only reports whether it succeeds.
+// Use RunAutoAnalyze to get the failure details.
 func AutoAnalyze(
 	sctx sessionctx.Context,
 	statsHandle statstypes.StatsHandle,
@@ -51,6 +52,19 @@ func AutoAnalyze(
 	sql string,
 	params ...any,
 ) bool {
+	return RunAutoAnalyze(sctx, statsHandle, sysProcTracker, statsVer, sql, params...) == nil
+}
+
+// RunAutoAnalyze executes the auto analyze task.
+// If it fails, the returned error is an *AnalyzeError which tells the kind of the failure.
+func RunAutoAnalyze(
+	sctx sessionctx.Context,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+	statsVer int,
+	sql string,
+	params ...any,
+) error {
 	startTime := time.Now()
 	_, _, err := RunAnalyzeStmt(sctx, statsHandle, sysProcTracker, statsVer, sql, params...)
 	dur := time.Since(startTime)
@@ -60,17 +74,19 @@ func AutoAnalyze(
 		if err1 != nil {
 			escaped = ""
 		}
+		analyzeErr := NewAnalyzeError(err, escaped)
 		statslogutil.StatsLogger().Error(
 			"auto analyze failed",
 			zap.String("sql", escaped),
+			zap.Stringer("failure_kind", analyzeErr.Kind),
 			zap.Duration("cost_time", dur),
 			zap.Error(err),
 		)
 		metrics.AutoAnalyzeCounter.WithLabelValues("failed").Inc()
-		return false
+		return analyzeErr
 	}
 	metrics.AutoAnalyzeCounter.WithLabelValues("succ").Inc()
-	return true
+	return nil
 }
 
 // RunAnalyzeStmt executes the analyze statement.
@@ -20,11 +20,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
 	"github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/exec"
+	storeerr "github.com/pingcap/tidb/pkg/store/driver/error"
 	"github.com/pingcap/tidb/pkg/testkit"
 	"github.com/pingcap/tidb/pkg/util"
+	"github.com/pingcap/tidb/pkg/util/dbterror/exeerrors"
+	"github.com/pingcap/tidb/pkg/util/dbterror/plannererrors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -86,3 +91,57 @@ func TestKillInWindows(t *testing.T) {
 	close(exitCh)
 	wg.Wait()
 }
+
+func TestRunAutoAnalyzeFailureKind(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	sctx := tk.Session().(sessionctx.Context)
+	handle := dom.StatsHandle()
+
+	err := exec.RunAutoAnalyze(sctx, handle, dom.SysProcTracker(), 2, "analyze table %n.%n", "test", "t_not_exist")
+	var analyzeErr *exec.AnalyzeError
+	require.ErrorAs(t, err, &analyzeErr)
+	require.Equal(t, exec.AnalyzeFailureTableGone, analyzeErr.Kind)
+	require.Equal(t, "analyze table `test`.`t_not_exist`", analyzeErr.SQL)
+	require.ErrorContains(t, err, "table gone: ")
+	require.True(t, infoschema.ErrTableNotExists.Equal(err))
+
+	require.NoError(t, exec.RunAutoAnalyze(sctx, handle, dom.SysProcTracker(), 2, "analyze table %n.%n", "test", "t"))
+	require.True(t, exec.AutoAnalyze(sctx, handle, dom.SysProcTracker(), 2, "analyze table %n.%n", "test", "t"))
+	require.False(t, exec.AutoAnalyze(sctx, handle, dom.SysProcTracker(), 2, "analyze table %n.%n", "test", "t_not_exist"))
+}
+
+func TestGetAnalyzeFailureKind(t *testing.T) {
+	require.Equal(t, exec.AnalyzeFailureUnknown, exec.GetAnalyzeFailureKind(nil))
+	require.Equal(t, exec.AnalyzeFailureUnknown, exec.GetAnalyzeFailureKind(errors.New("mock error")))
+	require.Equal(
+		t,
+		exec.AnalyzeFailurePermission,
+		exec.GetAnalyzeFailureKind(plannererrors.ErrTableaccessDenied.GenWithStackByArgs("SELECT", "u", "%", "t")),
+	)
+	require.Equal(
+		t,
+		exec.AnalyzeFailureResource,
+		exec.GetAnalyzeFailureKind(exeerrors.ErrMemoryExceedForQuery.GenWithStackByArgs(1)),
+	)
+	require.Equal(
+		t,
+		exec.AnalyzeFailureTableGone,
+		exec.GetAnalyzeFailureKind(errors.Trace(infoschema.ErrDatabaseNotExists.GenWithStackByArgs("test"))),
+	)
+	require.Equal(t, exec.AnalyzeFailureConflict, exec.GetAnalyzeFailureKind(errors.Trace(storeerr.ErrLockWaitTimeout)))
+	require.True(t, exec.AnalyzeFailureConflict.IsTransient())
+	require.True(t, exec.AnalyzeFailureResource.IsTransient())
+	require.False(t, exec.AnalyzeFailureTableGone.IsTransient())
+	require.False(t, exec.AnalyzeFailureUnknown.IsTransient())
+
+	// The original error message is kept for the unknown failures.
+	err := exec.NewAnalyzeError(errors.New("mock error"), "analyze table t")
+	require.Equal(t, "mock error", err.Error())
+	err = exec.NewAnalyzeError(storeerr.ErrTiKVServerBusy, "analyze table t")
+	require.Equal(t, exec.AnalyzeFailureResource, err.Kind)
+	require.Equal(t, "insufficient resource: "+storeerr.ErrTiKVServerBusy.Error(), err.Error())
+	require.True(t, storeerr.ErrTiKVServerBusy.Equal(err))
+}
@@ -15,9 +15,18 @@
 package priorityqueue
 
 import (
+	"cmp"
+	"context"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
 	"time"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
 	"github.com/pingcap/tidb/pkg/meta/model"
+	pmodel "github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/statistics"
 	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
@@ -77,16 +86,20 @@ func (f *AnalysisJobFactory) CreateNonPartitionedTableAnalysisJob(
 		return nil
 	}
 
-	return NewNonPartitionedTableAnalysisJob(
+	job := NewNonPartitionedTableAnalysisJob(
 		tableSchema,
 		tblInfo.Name.O,
 		tblInfo.ID,
 		indexes,
+		nil,
 		tableStatsVer,
 		changePercentage,
 		tableSize,
 		lastAnalysisDuration,
 	)
+	job.LastAnalyzeTime = f.lastAnalyzeTime(lastAnalysisDuration)
+	job.EstimatedRows = tblStats.RealtimeCount
+	return job
 }
 
 // CreateStaticPartitionAnalysisJob creates a job for static partitions.
@@ -107,7 +120,9 @@ func (f *AnalysisJobFactory) CreateStaticPartitionAnalysisJob(
 	changePercentage := f.CalculateChangePercentage(partitionStats)
 	tableSize := f.CalculateTableSize(partitionStats)
 	lastAnalysisDuration := f.GetTableLastAnalyzeDuration(partitionStats)
-	indexes := f.CheckIndexesNeedAnalyze(globalTblInfo, partitionStats)
+	globalIndexes := f.CheckGlobalIndexesNeedAnalyze(globalTblInfo, tableStatsVer)
+	// The stats of the global indexes never exist in the partition, so they are not newly added indexes of the partition.
+	indexes := withoutIndexes(f.CheckIndexesNeedAnalyze(globalTblInfo, partitionStats), globalIndexes)
 
 	// No need to analyze.
 	// We perform a separate check because users may set the auto analyze ratio to 0,
@@ -116,18 +131,189 @@ func (f *AnalysisJobFactory) CreateStaticPartitionAnalysisJob(
 		return nil
 	}
 
-	return NewStaticPartitionTableAnalysisJob(
+	job := NewStaticPartitionTableAnalysisJob(
 		tableSchema,
 		globalTblInfo.Name.O,
 		globalTblInfo.ID,
 		partitionName,
 		partitionID,
 		indexes,
+		nil,
 		tableStatsVer,
 		changePercentage,
 		tableSize,
 		lastAnalysisDuration,
 	)
+	job.GlobalIndexes = globalIndexes
+	job.IndexLastAnalyzedAt = f.FindIndexLastAnalyzeTimes(globalTblInfo, partitionStats)
+	job.LastAnalyzeTime = f.lastAnalyzeTime(lastAnalysisDuration)
+	job.EstimatedRows = partitionStats.RealtimeCount
+	return job
+}
+
+// CreateQuickStaticPartitionAnalysisJob creates a quick analysis job for a newly created static partition,
+// which has no stats at all. The partition is treated as an unanalyzed one whose size is not known yet.
+func (f *AnalysisJobFactory) CreateQuickStaticPartitionAnalysisJob(
+	tableSchema string,
+	globalTblInfo *model.TableInfo,
+	partitionID int64,
+	partitionName string,
+) *StaticPartitionedTableAnalysisJob {
+	lastAnalysisDuration := -unanalyzedTableDefaultLastUpdateDuration
+	job := NewStaticPartitionTableAnalysisJob(
+		tableSchema,
+		globalTblInfo.Name.O,
+		globalTblInfo.ID,
+		partitionName,
+		partitionID,
+		nil,
+		nil,
+		f.sctx.GetSessionVars().AnalyzeVersion,
+		unanalyzedTableDefaultChangePercentage,
+		0,
+		lastAnalysisDuration,
+	)
+	job.Quick = true
+	job.LastAnalyzeTime = f.lastAnalyzeTime(lastAnalysisDuration)
+	return job
+}
+
+// CreateStaticPartitionAnalysisJobs creates jobs for the static partitions of a table.
+// Every partition is checked against the auto analyze ratio with its own indicators instead of
+// the indicators of the whole table, so only the hot partitions and the partitions with indexes
+// to analyze get a job, and the cold partitions of the table are skipped.
+// The jobs are ordered by the partition ID.
+func (f *AnalysisJobFactory) CreateStaticPartitionAnalysisJobs(
+	tableSchema string,
+	globalTblInfo *model.TableInfo,
+	partitionStats map[PartitionIDAndName]*statistics.Table,
+) []AnalysisJob {
+	partitions := slices.SortedFunc(maps.Keys(partitionStats), func(a, b PartitionIDAndName) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	jobs := make([]AnalysisJob, 0, len(partitions))
+	for _, partition := range partitions {
+		job := f.CreateStaticPartitionAnalysisJob(
+			tableSchema,
+			globalTblInfo,
+			partition.ID,
+			partition.Name,
+			partitionStats[partition],
+		)
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// StaticPartitionPattern selects the static partitions of a table whose names match a pattern.
+type StaticPartitionPattern struct {
+	TableSchema string
+	TableName   string
+	// Pattern is matched against the whole partition name.
+	// It is a shell glob, such as `p2024*`, see path.Match for the syntax.
+	// If IsRegexp is set, it is a regular expression instead.
+	Pattern  string
+	IsRegexp bool
+}
+
+// compile returns the function to check whether a partition name matches the pattern.
+func (p StaticPartitionPattern) compile() (func(name string) bool, error) {
+	if p.IsRegexp {
+		re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid partition pattern %q", p.Pattern)
+		}
+		return re.MatchString, nil
+	}
+	// Check the syntax of the pattern once, so that the errors can be ignored below.
+	if _, err := path.Match(p.Pattern, ""); err != nil {
+		return nil, errors.Annotatef(err, "invalid partition pattern %q", p.Pattern)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(p.Pattern, name)
+		return matched
+	}, nil
+}
+
+// CreateStaticPartitionAnalysisJobsByPattern creates a job for each partition of the table whose name matches the pattern.
+// The partitions are resolved against the given info schema, so the dropped partitions are never included.
+// Unlike CreateStaticPartitionAnalysisJob, the matching partitions are analyzed even if they do not meet
+// the auto analyze ratio, because they are chosen by the user explicitly.
+// The global indexes of the table are analyzed only once, by the job of the first matching partition.
+func (f *AnalysisJobFactory) CreateStaticPartitionAnalysisJobsByPattern(
+	is infoschema.InfoSchema,
+	statsHandle statstypes.StatsHandle,
+	pattern StaticPartitionPattern,
+) ([]*StaticPartitionedTableAnalysisJob, error) {
+	match, err := pattern.compile()
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := is.TableByName(context.Background(), pmodel.NewCIStr(pattern.TableSchema), pmodel.NewCIStr(pattern.TableName))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tblInfo := tbl.Meta()
+	pi := tblInfo.GetPartitionInfo()
+	if pi == nil {
+		return nil, errors.Errorf("table %s.%s is not partitioned", pattern.TableSchema, pattern.TableName)
+	}
+
+	jobs := make([]*StaticPartitionedTableAnalysisJob, 0, len(pi.Definitions))
+	globalIndexesAttached := false
+	for _, def := range pi.Definitions {
+		if !match(def.Name.O) {
+			continue
+		}
+		tableStatsVer := f.sctx.GetSessionVars().AnalyzeVersion
+		var (
+			lastAnalyzeTime      time.Time
+			changePercentage     float64
+			tableSize            float64
+			estimatedRows        int64
+			lastAnalysisDuration time.Duration
+			indexes              []string
+			indexLastAnalyzedAt  map[string]time.Time
+		)
+		// The stats may not be loaded yet, then the indicators are left as zero values.
+		if stats := statsHandle.GetPartitionStatsForAutoAnalyze(tblInfo, def.ID); stats != nil {
+			statistics.CheckAnalyzeVerOnTable(stats, &tableStatsVer)
+			changePercentage = f.CalculateChangePercentage(stats)
+			tableSize = f.CalculateTableSize(stats)
+			estimatedRows = stats.RealtimeCount
+			lastAnalysisDuration = f.GetTableLastAnalyzeDuration(stats)
+			lastAnalyzeTime = f.lastAnalyzeTime(lastAnalysisDuration)
+			indexes = withoutIndexes(
+				f.CheckIndexesNeedAnalyze(tblInfo, stats),
+				f.CheckGlobalIndexesNeedAnalyze(tblInfo, tableStatsVer),
+			)
+			indexLastAnalyzedAt = f.FindIndexLastAnalyzeTimes(tblInfo, stats)
+		}
+		job := NewStaticPartitionTableAnalysisJob(
+			pattern.TableSchema,
+			tblInfo.Name.O,
+			tblInfo.ID,
+			def.Name.O,
+			def.ID,
+			indexes,
+			nil,
+			tableStatsVer,
+			changePercentage,
+			tableSize,
+			lastAnalysisDuration,
+		)
+		if !globalIndexesAttached {
+			job.GlobalIndexes = f.CheckGlobalIndexesNeedAnalyze(tblInfo, tableStatsVer)
+			globalIndexesAttached = true
+		}
+		job.IndexLastAnalyzedAt = indexLastAnalyzedAt
+		job.LastAnalyzeTime = lastAnalyzeTime
+		job.EstimatedRows = estimatedRows
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
 }
 
 // CreateDynamicPartitionedTableAnalysisJob creates a job for dynamic partitioned tables.
@@ -155,7 +341,7 @@ func (f *AnalysisJobFactory) CreateDynamicPartitionedTableAnalysisJob(
 		return nil
 	}
 
-	return NewDynamicPartitionedTableAnalysisJob(
+	job := NewDynamicPartitionedTableAnalysisJob(
 		tableSchema,
 		globalTblInfo.Name.O,
 		globalTblInfo.ID,
@@ -166,6 +352,12 @@ func (f *AnalysisJobFactory) CreateDynamicPartitionedTableAnalysisJob(
 		avgSize,
 		minLastAnalyzeDuration,
 	)
+	job.LastAnalyzeTime = f.lastAnalyzeTime(minLastAnalyzeDuration)
+	// Like TableSize, the estimated rows are the average of the partitions to analyze.
+	if cols := globalTblStats.ColAndIdxExistenceMap.ColNum(); cols > 0 {
+		job.EstimatedRows = int64(avgSize / float64(cols))
+	}
+	return job
 }
 
 // CalculateChangePercentage calculates the change percentage of the table
@@ -212,6 +404,12 @@ func (f *AnalysisJobFactory) GetTableLastAnalyzeDuration(tblStats *statistics.Ta
 	return currentTime.Sub(lastTime)
 }
 
+// lastAnalyzeTime converts the duration since the last analysis back to the time of the last analysis.
+// It is used to fill Indicators.LastAnalyzeTime consistently with Indicators.LastAnalysisDuration.
+func (f *AnalysisJobFactory) lastAnalyzeTime(lastAnalysisDuration time.Duration) time.Time {
+	return oracle.GetTimeFromTS(f.currentTs).Add(-lastAnalysisDuration)
+}
+
 // FindLastAnalyzeTime finds the last analyze time of the table.
 // It uses `LastUpdateVersion` to find the last analyze time.
 // The `LastUpdateVersion` is the version of the transaction that updates the statistics.
@@ -224,6 +422,25 @@ func (f *AnalysisJobFactory) FindLastAnalyzeTime(tblStats *statistics.Table) tim
 	return oracle.GetTimeFromTS(tblStats.LastAnalyzeVersion)
 }
 
+// FindIndexLastAnalyzeTimes finds the last analyze time of each analyzed index of the table, keyed by the index name,
+// see StaticPartitionedTableAnalysisJob.IndexLastAnalyzedAt.
+// Like FindLastAnalyzeTime, it uses the `LastUpdateVersion` of the index stats.
+// It returns nil if no index is analyzed.
+func (*AnalysisJobFactory) FindIndexLastAnalyzeTimes(tblInfo *model.TableInfo, tblStats *statistics.Table) map[string]time.Time {
+	var lastAnalyzedAt map[string]time.Time
+	for _, idx := range tblInfo.Indices {
+		idxStats := tblStats.GetIdx(idx.ID)
+		if idxStats == nil || !idxStats.IsAnalyzed() || idxStats.LastUpdateVersion == 0 {
+			continue
+		}
+		if lastAnalyzedAt == nil {
+			lastAnalyzedAt = make(map[string]time.Time, len(tblInfo.Indices))
+		}
+		lastAnalyzedAt[idx.Name.O] = oracle.GetTimeFromTS(idxStats.LastUpdateVersion)
+	}
+	return lastAnalyzedAt
+}
+
 // CheckIndexesNeedAnalyze checks if the indexes need to be analyzed.
 func (*AnalysisJobFactory) CheckIndexesNeedAnalyze(tblInfo *model.TableInfo, tblStats *statistics.Table) []string {
 	// If table is not analyzed, we need to analyze whole table.
@@ -247,6 +464,33 @@ func (*AnalysisJobFactory) CheckIndexesNeedAnalyze(tblInfo *model.TableInfo, tbl
 	return indexes
 }
 
+// CheckGlobalIndexesNeedAnalyze returns the global indexes of the partitioned table whose stats are not refreshed
+// by analyzing the partitions with the given statistics version, so they have to be analyzed on the whole table.
+// For version 1, the partitions never collect the stats of a global index.
+// For version 2, only the special global indexes are left out, see util.IsSpecialGlobalIndex.
+func (*AnalysisJobFactory) CheckGlobalIndexesNeedAnalyze(tblInfo *model.TableInfo, statsVer int) []string {
+	var indexes []string
+	for _, idx := range tblInfo.Indices {
+		if !idx.Global || idx.State != model.StatePublic || idx.VectorInfo != nil {
+			continue
+		}
+		if statsVer == statistics.Version1 || util.IsSpecialGlobalIndex(idx, tblInfo) {
+			indexes = append(indexes, idx.Name.O)
+		}
+	}
+	return indexes
+}
+
+// withoutIndexes returns the indexes that are not in excluded.
+func withoutIndexes(indexes, excluded []string) []string {
+	if len(excluded) == 0 {
+		return indexes
+	}
+	return slices.DeleteFunc(indexes, func(index string) bool {
+		return slices.Contains(excluded, index)
+	})
+}
+
 // CalculateIndicatorsForPartitions calculates the average change percentage,
 // average size and average last analyze duration for the partitions that meet the threshold.
 // Change percentage is the ratio of the number of modified rows to the total number of rows.
@@ -333,7 +577,7 @@ func (*AnalysisJobFactory) CheckNewlyAddedIndexesNeedAnalyzeForPartitionedTable(
 }
 
 // PartitionIDAndName is a struct that contains the ID and name of a partition.
-// Exported for testing purposes. Do not use it in other packages.
+// It is also used to list the partitions of StaticPartitionedTableIndexAnalysisJob.
 type PartitionIDAndName struct {
 	Name string
 	ID   int64
@@ -368,10 +612,17 @@ func GetPartitionStats(
 	return partitionStats
 }
 
+// OutsideAnalyzeWindowReason is the reason returned by AutoAnalysisTimeWindow.IsValidToAnalyze
+// when the current time is not in the time window.
+const OutsideAnalyzeWindowReason = "outside analyze window"
+
 // AutoAnalysisTimeWindow is a struct that contains the start and end time of the auto analyze time window.
 type AutoAnalysisTimeWindow struct {
 	start time.Time
 	end   time.Time
+	// weekdays is a bit mask of the allowed weekdays, the i-th bit stands for time.Weekday(i).
+	// 0 means every day is allowed.
+	weekdays uint8
 }
 
 // NewAutoAnalysisTimeWindow creates a new AutoAnalysisTimeWindow.
@@ -388,5 +639,43 @@ func (a AutoAnalysisTimeWindow) IsWithinTimeWindow(currentTime time.Time) bool {
 	if a.start.IsZero() || a.end.IsZero() {
 		return false
 	}
-	return timeutil.WithinDayTimePeriod(a.start, a.end, currentTime)
+	return timeutil.WithinDayTimePeriod(a.start, a.end, currentTime) && a.isAllowedWeekday(currentTime)
+}
+
+// WithWeekdays returns a copy of the time window that is only open on the given weekdays.
+// A window that crosses midnight belongs to the day it starts on,
+// e.g. a window from 22:00 to 06:00 on Friday also covers 02:00 on Saturday.
+func (a AutoAnalysisTimeWindow) WithWeekdays(weekdays ...time.Weekday) AutoAnalysisTimeWindow {
+	a.weekdays = 0
+	for _, weekday := range weekdays {
+		a.weekdays |= 1 << weekday
+	}
+	return a
+}
+
+// IsValidToAnalyze checks whether a job can be executed at the current time.
+// It returns false and OutsideAnalyzeWindowReason if the current time is not in the time window.
+func (a AutoAnalysisTimeWindow) IsValidToAnalyze(currentTime time.Time) (bool, string) {
+	if !a.IsWithinTimeWindow(currentTime) {
+		return false, OutsideAnalyzeWindowReason
+	}
+	return true, ""
+}
+
+func (a AutoAnalysisTimeWindow) isAllowedWeekday(currentTime time.Time) bool {
+	if a.weekdays == 0 {
+		return true
+	}
+	// The weekday is decided in the time zone of the time window.
+	now := currentTime.In(a.start.Location())
+	weekday := now.Weekday()
+	if minuteOfDay(a.end) < minuteOfDay(a.start) && minuteOfDay(now) <= minuteOfDay(a.end) {
+		// The window started yesterday.
+		weekday = (weekday + 6) % 7
+	}
+	return a.weekdays&(1<<weekday) != 0
+}
+
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
 }
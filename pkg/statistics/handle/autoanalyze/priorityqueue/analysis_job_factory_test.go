@@ -23,6 +23,7 @@ import (
 	pmodel "github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/statistics"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/pingcap/tidb/pkg/testkit"
 	"github.com/stretchr/testify/require"
 	"github.com/tikv/client-go/v2/oracle"
 )
@@ -390,6 +391,102 @@ func TestCalculateIndicatorsForPartitions(t *testing.T) {
 	}
 }
 
+func TestCreateStaticPartitionAnalysisJobsOnlyForHotPartitions(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	currentTs := oracle.GoTimeToTS(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	lastUpdateTs := oracle.GoTimeToTS(time.Date(2023, 12, 31, 10, 0, 0, 0, time.UTC))
+	analyzedMap := statistics.NewColAndIndexExistenceMap(1, 0)
+	analyzedMap.InsertCol(1, true)
+	newPartitionStats := func(modifyCount int64) *statistics.Table {
+		return &statistics.Table{
+			HistColl: *statistics.NewHistCollWithColsAndIdxs(0, false, statistics.AutoAnalyzeMinCnt+1, modifyCount, map[int64]*statistics.Column{
+				1: {
+					StatsVer: 2,
+					Histogram: statistics.Histogram{
+						LastUpdateVersion: lastUpdateTs,
+					},
+				},
+			}, nil),
+			Version:               currentTs,
+			ColAndIdxExistenceMap: analyzedMap,
+			LastAnalyzeVersion:    lastUpdateTs,
+		}
+	}
+	tblInfo := &model.TableInfo{
+		ID:   100,
+		Name: pmodel.NewCIStr("t"),
+	}
+	// Only p1 and p3 change more than the auto analyze ratio.
+	partitionStats := map[priorityqueue.PartitionIDAndName]*statistics.Table{
+		priorityqueue.NewPartitionIDAndName("p0", 101): newPartitionStats(0),
+		priorityqueue.NewPartitionIDAndName("p1", 102): newPartitionStats((statistics.AutoAnalyzeMinCnt + 1) * 2),
+		priorityqueue.NewPartitionIDAndName("p2", 103): newPartitionStats(1),
+		priorityqueue.NewPartitionIDAndName("p3", 104): newPartitionStats(statistics.AutoAnalyzeMinCnt + 1),
+	}
+
+	factory := priorityqueue.NewAnalysisJobFactory(tk.Session(), 0.5, currentTs)
+	jobs := factory.CreateStaticPartitionAnalysisJobs("test", tblInfo, partitionStats)
+	require.Len(t, jobs, 2)
+	require.Equal(t, int64(102), jobs[0].GetTableID())
+	require.Equal(t, "p1", jobs[0].(*priorityqueue.StaticPartitionedTableAnalysisJob).StaticPartitionName)
+	require.Equal(t, float64(2), jobs[0].GetIndicators().ChangePercentage)
+	require.Equal(t, statistics.AutoAnalyzeMinCnt+1, jobs[0].GetIndicators().EstimatedRows)
+	require.Equal(t, int64(104), jobs[1].GetTableID())
+	require.Equal(t, "p3", jobs[1].(*priorityqueue.StaticPartitionedTableAnalysisJob).StaticPartitionName)
+	require.Equal(t, float64(1), jobs[1].GetIndicators().ChangePercentage)
+
+	// No partition is hot.
+	delete(partitionStats, priorityqueue.NewPartitionIDAndName("p1", 102))
+	delete(partitionStats, priorityqueue.NewPartitionIDAndName("p3", 104))
+	require.Empty(t, factory.CreateStaticPartitionAnalysisJobs("test", tblInfo, partitionStats))
+}
+
+func TestCreateStaticPartitionAnalysisJobWithIndexLastAnalyzedAt(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	currentTs := oracle.GoTimeToTS(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	lastUpdateTs := oracle.GoTimeToTS(time.Date(2023, 12, 31, 10, 0, 0, 0, time.UTC))
+	indexUpdateTs := oracle.GoTimeToTS(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	analyzedMap := statistics.NewColAndIndexExistenceMap(1, 1)
+	analyzedMap.InsertCol(1, true)
+	analyzedMap.InsertIndex(1, true)
+	partitionStats := &statistics.Table{
+		HistColl: *statistics.NewHistCollWithColsAndIdxs(0, false, statistics.AutoAnalyzeMinCnt+1, statistics.AutoAnalyzeMinCnt+1, map[int64]*statistics.Column{
+			1: {
+				StatsVer: 2,
+				Histogram: statistics.Histogram{
+					LastUpdateVersion: lastUpdateTs,
+				},
+			},
+		}, map[int64]*statistics.Index{
+			1: {
+				StatsVer: 2,
+				Histogram: statistics.Histogram{
+					LastUpdateVersion: indexUpdateTs,
+				},
+			},
+		}),
+		Version:               currentTs,
+		ColAndIdxExistenceMap: analyzedMap,
+		LastAnalyzeVersion:    lastUpdateTs,
+	}
+	tblInfo := &model.TableInfo{
+		ID:   100,
+		Name: pmodel.NewCIStr("t"),
+		Indices: []*model.IndexInfo{
+			{ID: 1, Name: pmodel.NewCIStr("idx1"), State: model.StatePublic},
+			{ID: 2, Name: pmodel.NewCIStr("idx2"), State: model.StatePublic},
+		},
+	}
+
+	factory := priorityqueue.NewAnalysisJobFactory(tk.Session(), 0.5, currentTs)
+	job := factory.CreateStaticPartitionAnalysisJob("test", tblInfo, 101, "p0", partitionStats).(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	// Only the analyzed index has a last analyze time, and the index without stats is analyzed.
+	require.Equal(t, []string{"idx2"}, job.Indexes)
+	require.Equal(t, map[string]time.Time{"idx1": oracle.GetTimeFromTS(indexUpdateTs)}, job.IndexLastAnalyzedAt)
+}
+
 func TestCheckNewlyAddedIndexesNeedAnalyzeForPartitionedTable(t *testing.T) {
 	tblInfo := model.TableInfo{
 		Indices: []*model.IndexInfo{
@@ -472,6 +569,20 @@ func TestAutoAnalysisTimeWindow(t *testing.T) {
 			current:    time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
 			wantWithin: false,
 		},
+		{
+			name:       "Within time window crossing midnight",
+			start:      time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+			current:    time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC),
+			wantWithin: true,
+		},
+		{
+			name:       "Outside time window crossing midnight",
+			start:      time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+			current:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			wantWithin: false,
+		},
 		{
 			name:       "Empty time window",
 			start:      time.Time{},
@@ -489,3 +600,29 @@ func TestAutoAnalysisTimeWindow(t *testing.T) {
 		})
 	}
 }
+
+func TestAutoAnalysisTimeWindowWithWeekdays(t *testing.T) {
+	// From 22:00 to 06:00 on Fridays, in UTC+8.
+	zone := time.FixedZone("", 8*60*60)
+	window := priorityqueue.NewAutoAnalysisTimeWindow(
+		time.Date(2024, 1, 1, 22, 0, 0, 0, zone),
+		time.Date(2024, 1, 1, 6, 0, 0, 0, zone),
+	).WithWeekdays(time.Friday)
+
+	// 2024-01-05 is a Friday.
+	valid, reason := window.IsValidToAnalyze(time.Date(2024, 1, 5, 23, 0, 0, 0, zone))
+	require.True(t, valid)
+	require.Empty(t, reason)
+	// The window started on Friday.
+	require.True(t, window.IsWithinTimeWindow(time.Date(2024, 1, 6, 2, 0, 0, 0, zone)))
+	// The same time in UTC is still Friday.
+	require.True(t, window.IsWithinTimeWindow(time.Date(2024, 1, 5, 18, 0, 0, 0, time.UTC)))
+	// The window started on Thursday.
+	valid, reason = window.IsValidToAnalyze(time.Date(2024, 1, 5, 2, 0, 0, 0, zone))
+	require.False(t, valid)
+	require.Equal(t, priorityqueue.OutsideAnalyzeWindowReason, reason)
+	require.False(t, window.IsWithinTimeWindow(time.Date(2024, 1, 6, 23, 0, 0, 0, zone)))
+
+	// No weekdays means every day.
+	require.True(t, window.WithWeekdays().IsWithinTimeWindow(time.Date(2024, 1, 6, 23, 0, 0, 0, zone)))
+}
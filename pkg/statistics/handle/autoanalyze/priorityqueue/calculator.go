@@ -14,13 +14,19 @@
 
 package priorityqueue
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
 const (
 	// EventNone represents no special event.
 	EventNone = 0.0
 	// EventNewIndex represents a special event for newly added indexes.
 	EventNewIndex = 2.0
+	// EventQuickAnalyze represents a special event for the quick analyze of newly created partitions.
+	// It is higher than EventNewIndex, because the partitions have no stats at all.
+	EventQuickAnalyze = 3.0
 )
 
 // TODO: make these configurable.
@@ -30,6 +36,85 @@ const (
 	analysisInterval  = 0.3
 )
 
+// HotTableWeightBoost is the weight added to the jobs of the hot tables reported by AnalysisPriorityQueue.SetHotTables,
+// because the tables that are queried heavily benefit most from fresh stats.
+// Set it to 0 to disable the boost.
+var HotTableWeightBoost = 1.0
+
+// WeightAgingCoefficient is the weight added to a job for every hour it has been waiting in the queue.
+// It prevents jobs with low weights, such as large tables with few changes, from starving.
+// The queue orders the jobs by agingOrderKey instead of AnalysisJob.GetWeight, so all jobs age at the same rate
+// and aging never reorders jobs that are already in the queue, even after GetWeight reaches MaxJobWeight.
+// Set it to 0 to disable aging. It should not be changed while there are jobs in the queue.
+var WeightAgingCoefficient = 0.1
+
+var (
+	// MinJobWeight is the lower bound of the weight of a job.
+	// NaN and infinite weights, which may be caused by degenerate indicators, are treated as MinJobWeight.
+	// Exported for testing purposes.
+	MinJobWeight = -1e6
+	// MaxJobWeight is the upper bound of the weight of a job.
+	// Exported for testing purposes.
+	MaxJobWeight = 1e6
+)
+
+// clampWeight clamps the weight into [MinJobWeight, MaxJobWeight] so that the heap ordering stays well-defined.
+func clampWeight(weight float64) float64 {
+	if math.IsNaN(weight) || math.IsInf(weight, 0) {
+		return MinJobWeight
+	}
+	return min(max(weight, MinJobWeight), MaxJobWeight)
+}
+
+// calculateAgingWeight calculates the weight boost of a job that has been waiting since enqueuedAt.
+func calculateAgingWeight(enqueuedAt time.Time) float64 {
+	if enqueuedAt.IsZero() {
+		return 0
+	}
+	return WeightAgingCoefficient * since(enqueuedAt).Hours()
+}
+
+// agingOrderKey returns the key by which the queue orders the jobs, the higher the earlier.
+// It is the weight set by SetWeight minus the aging boost the job would have got from the Unix epoch to its enqueue time.
+// At any moment, it differs from the unclamped GetWeight by the same amount for all enqueued jobs,
+// so it orders the jobs like GetWeight does, but it does not depend on the current time.
+// Therefore, the order is stable between the heap operations, and the jobs with the same weight
+// and enqueue time tie, so that the ties are broken by the table ID.
+// A job that has never been pushed is ordered by its weight only. It is only expected in a heap without pushed jobs.
+func agingOrderKey(job AnalysisJob) float64 {
+	enqueuedAt := job.GetEnqueuedAt()
+	if enqueuedAt.IsZero() {
+		return job.GetBaseWeight()
+	}
+	return job.GetBaseWeight() - WeightAgingCoefficient*float64(enqueuedAt.UnixNano())/float64(time.Hour)
+}
+
+// WeightCalculator calculates the weight of a job from its indicators.
+// Jobs with higher weights are analyzed first.
+type WeightCalculator func(indicators Indicators) float64
+
+// DefaultWeightCalculator is the default WeightCalculator.
+// It uses the same formula as PriorityCalculator except for the special events,
+// which are added by the priority queue separately.
+func DefaultWeightCalculator(indicators Indicators) float64 {
+	breakdown := calculateIndicatorsWeightBreakdown(indicators)
+	return breakdown[WeightChangeRatio] +
+		breakdown[WeightTableSize] +
+		breakdown[WeightAnalysisInterval]
+}
+
+// StalenessWeightCalculator is a WeightCalculator that prioritizes the tables by how long they have not been analyzed,
+// regardless of the change percentage and the table size. It suits the clusters where the change percentage
+// is hard to estimate but the staleness is well known.
+// The weight is the number of hours since LastAnalyzeTime, or LastAnalysisDuration if LastAnalyzeTime is unknown.
+func StalenessWeightCalculator(indicators Indicators) float64 {
+	staleness := indicators.LastAnalysisDuration
+	if !indicators.LastAnalyzeTime.IsZero() {
+		staleness = since(indicators.LastAnalyzeTime)
+	}
+	return staleness.Hours()
+}
+
 // PriorityCalculator implements the WeightCalculator interface.
 type PriorityCalculator struct{}
 
@@ -41,6 +126,18 @@ func NewPriorityCalculator() *PriorityCalculator {
 	return &PriorityCalculator{}
 }
 
+// Keys of the weight breakdown returned by CalculateWeightBreakdown.
+const (
+	// WeightChangeRatio is the contribution of the table change ratio.
+	WeightChangeRatio = "change_ratio"
+	// WeightTableSize is the contribution of the table size penalty.
+	WeightTableSize = "table_size"
+	// WeightAnalysisInterval is the contribution of the last analysis duration.
+	WeightAnalysisInterval = "analysis_interval"
+	// WeightSpecialEvent is the contribution of the special events, such as newly added indexes.
+	WeightSpecialEvent = "special_event"
+)
+
 // CalculateWeight calculates the weight based on the given rules.
 // - Table Change Ratio (Change Ratio): Accounts for 60%
 // - Table Size (Size): Accounts for 10%
@@ -48,23 +145,55 @@ func NewPriorityCalculator() *PriorityCalculator {
 // priority_score calculates the priority score based on the following formula:
 //
 //	priority_score = (0.6 * math.Log10(1 + ChangeRatio) +
-//	                  0.1 * (1 - math.Log10(1 + TableSize)) +
+//	                  0.1 * (1 - math.Log10(1 + Size)) +
 //	                  0.3 * math.Log10(1 + math.Sqrt(AnalysisInterval)) +
 //	                  special_event[event])
+//
+// Size is EstimatedRows if it is known, otherwise TableSize.
 func (pc *PriorityCalculator) CalculateWeight(job AnalysisJob) float64 {
+	breakdown := pc.CalculateWeightBreakdown(job)
+	return breakdown[WeightChangeRatio] +
+		breakdown[WeightTableSize] +
+		breakdown[WeightAnalysisInterval] +
+		breakdown[WeightSpecialEvent]
+}
+
+// CalculateWeightBreakdown calculates the individual terms of the weight.
+// The sum of all terms is the weight returned by CalculateWeight.
+func (pc *PriorityCalculator) CalculateWeightBreakdown(job AnalysisJob) map[string]float64 {
+	breakdown := calculateIndicatorsWeightBreakdown(job.GetIndicators())
+	breakdown[WeightSpecialEvent] = pc.GetSpecialEvent(job)
+	return breakdown
+}
+
+// calculateIndicatorsWeightBreakdown calculates the terms of the weight that only depend on the indicators.
+func calculateIndicatorsWeightBreakdown(indicators Indicators) map[string]float64 {
 	// We multiply the priority_score by 100 to increase its magnitude. This ensures that
 	// when we apply the log10 function, the resulting value is more meaningful and reasonable.
-	indicators := job.GetIndicators()
 	changeRatio := 100 * indicators.ChangePercentage
-	return changeRatioWeight*math.Log10(1+changeRatio) +
-		sizeWeight*(1-math.Log10(1+indicators.TableSize)) +
-		analysisInterval*math.Log10(1+math.Sqrt(indicators.LastAnalysisDuration.Seconds())) +
-		pc.GetSpecialEvent(job)
+	return map[string]float64{
+		WeightChangeRatio:      changeRatioWeight * math.Log10(1+changeRatio),
+		WeightTableSize:        sizeWeight * (1 - math.Log10(1+sizeForWeight(indicators))),
+		WeightAnalysisInterval: analysisInterval * math.Log10(1+math.Sqrt(indicators.LastAnalysisDuration.Seconds())),
+	}
+}
+
+// sizeForWeight returns the size used by the table size penalty.
+// The row count is preferred because it does not depend on the width of the table,
+// and TableSize is used for the jobs without EstimatedRows to keep their weights unchanged.
+func sizeForWeight(indicators Indicators) float64 {
+	if indicators.EstimatedRows > 0 {
+		return float64(indicators.EstimatedRows)
+	}
+	return indicators.TableSize
 }
 
 // GetSpecialEvent returns the special event weight.
 // Exported for testing purposes.
 func (*PriorityCalculator) GetSpecialEvent(job AnalysisJob) float64 {
+	if isQuickAnalysisJob(job) {
+		return EventQuickAnalyze
+	}
 	if job.HasNewlyAddedIndex() {
 		return EventNewIndex
 	}
@@ -15,6 +15,7 @@
 package priorityqueue_test
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -144,3 +145,157 @@ func TestGetSpecialEvent(t *testing.T) {
 	}
 	require.Equal(t, priorityqueue.EventNone, pc.GetSpecialEvent(jobWithoutIndex))
 }
+
+func TestCalculateWeightBreakdown(t *testing.T) {
+	pc := priorityqueue.NewPriorityCalculator()
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		Indexes: []string{"idx"},
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage:     0.6,
+			TableSize:            1000,
+			LastAnalysisDuration: time.Hour,
+		},
+	}
+	breakdown := pc.CalculateWeightBreakdown(job)
+	require.Len(t, breakdown, 4)
+	require.Equal(t, priorityqueue.EventNewIndex, breakdown[priorityqueue.WeightSpecialEvent])
+	require.Less(t, breakdown[priorityqueue.WeightTableSize], 0.0)
+
+	sum := 0.0
+	for _, v := range breakdown {
+		sum += v
+	}
+	require.InDelta(t, pc.CalculateWeight(job), sum, 1e-9)
+	require.Equal(t, breakdown, job.GetWeightBreakdown())
+}
+
+func TestCalculateWeightWithEstimatedRows(t *testing.T) {
+	indicators := priorityqueue.Indicators{
+		ChangePercentage:     0.5,
+		TableSize:            10000,
+		LastAnalysisDuration: time.Hour,
+	}
+	withoutRows := priorityqueue.DefaultWeightCalculator(indicators)
+
+	// The size penalty is based on the rows if they are known.
+	indicators.EstimatedRows = 1000
+	withRows := priorityqueue.DefaultWeightCalculator(indicators)
+	require.InDelta(t, 0.1*(math.Log10(1+10000)-math.Log10(1+1000)), withRows-withoutRows, 1e-9)
+
+	// The wider table is not penalized if the rows are the same.
+	indicators.TableSize = 100000
+	require.Equal(t, withRows, priorityqueue.DefaultWeightCalculator(indicators))
+
+	// The more rows, the lower the weight.
+	indicators.EstimatedRows = 100000
+	require.Less(t, priorityqueue.DefaultWeightCalculator(indicators), withRows)
+}
+
+func TestDefaultWeightCalculator(t *testing.T) {
+	pc := priorityqueue.NewPriorityCalculator()
+	indicators := priorityqueue.Indicators{
+		ChangePercentage:     0.5,
+		TableSize:            1000,
+		LastAnalysisDuration: time.Hour,
+	}
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators}
+	require.Equal(t, pc.CalculateWeight(job), priorityqueue.DefaultWeightCalculator(indicators))
+
+	// The special events are not included.
+	job.Indexes = []string{"idx"}
+	require.InDelta(t, pc.CalculateWeight(job)-priorityqueue.EventNewIndex, priorityqueue.DefaultWeightCalculator(indicators), 1e-9)
+}
+
+func TestStalenessWeightCalculator(t *testing.T) {
+	// The staleness dominates the change percentage and the table size.
+	stale := priorityqueue.Indicators{
+		LastAnalyzeTime:  time.Now().Add(-48 * time.Hour),
+		ChangePercentage: 0.01,
+		TableSize:        1e9,
+	}
+	fresh := priorityqueue.Indicators{
+		LastAnalyzeTime:  time.Now().Add(-time.Hour),
+		ChangePercentage: 0.9,
+		TableSize:        10,
+	}
+	require.InDelta(t, 48, priorityqueue.StalenessWeightCalculator(stale), 0.01)
+	require.InDelta(t, 1, priorityqueue.StalenessWeightCalculator(fresh), 0.01)
+	require.Greater(t, priorityqueue.DefaultWeightCalculator(fresh), priorityqueue.DefaultWeightCalculator(stale))
+
+	// LastAnalysisDuration is used if LastAnalyzeTime is unknown.
+	unknown := priorityqueue.Indicators{LastAnalysisDuration: 24 * time.Hour}
+	require.Equal(t, 24.0, priorityqueue.StalenessWeightCalculator(unknown))
+}
+
+func TestWeightWithMockClock(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	// The job ages with the clock.
+	job := priorityqueue.NewJobWithWeightForTesting(1, 1)
+	job.SetEnqueuedAt(clock.Now())
+	require.Equal(t, 1.0, job.GetWeight())
+	clock.Advance(10 * time.Hour)
+	require.InDelta(t, 1+10*priorityqueue.WeightAgingCoefficient, job.GetWeight(), 1e-9)
+
+	// The staleness is measured by the clock.
+	indicators := priorityqueue.Indicators{LastAnalyzeTime: clock.Now().Add(-48 * time.Hour)}
+	require.Equal(t, 48.0, priorityqueue.StalenessWeightCalculator(indicators))
+	clock.Set(indicators.LastAnalyzeTime.Add(72 * time.Hour))
+	require.Equal(t, 72.0, priorityqueue.StalenessWeightCalculator(indicators))
+}
+
+func TestWeightIsClamped(t *testing.T) {
+	pc := priorityqueue.NewPriorityCalculator()
+	degenerateIndicators := []priorityqueue.Indicators{
+		// Zero table size.
+		{ChangePercentage: 0.5, TableSize: 0, LastAnalysisDuration: time.Hour},
+		// Negative duration makes the analysis interval term NaN.
+		{ChangePercentage: 0.5, TableSize: 1000, LastAnalysisDuration: -time.Hour},
+		// Negative table size makes the table size term +Inf.
+		{ChangePercentage: 0.5, TableSize: -1, LastAnalysisDuration: time.Hour},
+		// Negative change percentage makes the change ratio term NaN.
+		{ChangePercentage: -1, TableSize: 1000, LastAnalysisDuration: time.Hour},
+		{ChangePercentage: math.Inf(1), TableSize: math.NaN(), LastAnalysisDuration: 0},
+	}
+	jobs := []priorityqueue.AnalysisJob{
+		&priorityqueue.NonPartitionedTableAnalysisJob{},
+		&priorityqueue.DynamicPartitionedTableAnalysisJob{},
+		&priorityqueue.StaticPartitionedTableAnalysisJob{},
+	}
+	for _, indicators := range degenerateIndicators {
+		for _, job := range jobs {
+			job.SetIndicators(indicators)
+			job.SetWeight(pc.CalculateWeight(job))
+			weight := job.GetWeight()
+			require.False(t, math.IsNaN(weight), "%+v", indicators)
+			require.False(t, math.IsInf(weight, 0), "%+v", indicators)
+			require.GreaterOrEqual(t, weight, priorityqueue.MinJobWeight)
+			require.LessOrEqual(t, weight, priorityqueue.MaxJobWeight)
+		}
+	}
+
+	defer func(minWeight, maxWeight float64) {
+		priorityqueue.MinJobWeight = minWeight
+		priorityqueue.MaxJobWeight = maxWeight
+	}(priorityqueue.MinJobWeight, priorityqueue.MaxJobWeight)
+	priorityqueue.MinJobWeight = -1
+	priorityqueue.MaxJobWeight = 1
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{}
+	job.SetWeight(10)
+	require.Equal(t, 1.0, job.GetWeight())
+	job.SetWeight(-10)
+	require.Equal(t, -1.0, job.GetWeight())
+	job.SetWeight(math.NaN())
+	require.Equal(t, -1.0, job.GetWeight())
+	job.SetWeight(math.Inf(1))
+	require.Equal(t, -1.0, job.GetWeight())
+	job.SetWeight(0.5)
+	require.Equal(t, 0.5, job.GetWeight())
+	// The aging boost is clamped too.
+	job.SetEnqueuedAt(time.Now().Add(-100 * time.Hour))
+	require.Equal(t, 1.0, job.GetWeight())
+}
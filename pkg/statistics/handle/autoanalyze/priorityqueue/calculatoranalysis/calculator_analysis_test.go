@@ -17,6 +17,7 @@ package priorityqueue_test
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
@@ -235,7 +236,7 @@ type TestJob struct {
 }
 
 // Analyze implements AnalysisJob.
-func (j *TestJob) Analyze(statsHandle types.StatsHandle, sysProcTracker sysproctrack.Tracker) error {
+func (j *TestJob) Analyze(ctx context.Context, statsHandle types.StatsHandle, sysProcTracker sysproctrack.Tracker) error {
 	panic("unimplemented")
 }
 
@@ -249,11 +250,96 @@ func (j *TestJob) RegisterFailureHook(hook priorityqueue.JobHook) {
 	panic("unimplemented")
 }
 
+// Validate implements AnalysisJob.
+func (j *TestJob) Validate() error {
+	panic("unimplemented")
+}
+
+// GetLastRunDuration implements AnalysisJob.
+func (j *TestJob) GetLastRunDuration() time.Duration {
+	panic("unimplemented")
+}
+
+// GetLastFailureReason implements AnalysisJob.
+func (j *TestJob) GetLastFailureReason() string {
+	panic("unimplemented")
+}
+
+// State implements AnalysisJob.
+func (j *TestJob) State() priorityqueue.JobState {
+	panic("unimplemented")
+}
+
+// IsLastFailureTransient implements AnalysisJob.
+func (j *TestJob) IsLastFailureTransient() bool {
+	panic("unimplemented")
+}
+
+// GetCorrelationID implements AnalysisJob.
+func (j *TestJob) GetCorrelationID() string {
+	panic("unimplemented")
+}
+
+// Equal implements AnalysisJob.
+func (j *TestJob) Equal(other priorityqueue.AnalysisJob) bool {
+	panic("unimplemented")
+}
+
+// Clone implements AnalysisJob.
+func (j *TestJob) Clone() priorityqueue.AnalysisJob {
+	panic("unimplemented")
+}
+
+// DryRun implements AnalysisJob.
+func (j *TestJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	panic("unimplemented")
+}
+
+// GenAnalyzeSQLParams implements AnalysisJob.
+func (j *TestJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]priorityqueue.AnalyzeSQLParams, error) {
+	panic("unimplemented")
+}
+
+// RegisterProgressHook implements AnalysisJob.
+func (j *TestJob) RegisterProgressHook(hook priorityqueue.ProgressHook) {
+	panic("unimplemented")
+}
+
+// RegisterValidityHook implements AnalysisJob.
+func (j *TestJob) RegisterValidityHook(hook priorityqueue.ValidityHook) {
+	panic("unimplemented")
+}
+
+// SetTracer implements AnalysisJob.
+func (j *TestJob) SetTracer(tracer priorityqueue.Tracer) {
+	panic("unimplemented")
+}
+
 // GetWeight implements AnalysisJob.
 func (j *TestJob) GetWeight() float64 {
 	panic("unimplemented")
 }
 
+// GetBaseWeight implements AnalysisJob.
+func (j *TestJob) GetBaseWeight() float64 {
+	panic("unimplemented")
+}
+
+// SetEnqueuedAt implements AnalysisJob.
+func (j *TestJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	panic("unimplemented")
+}
+
+// GetEnqueuedAt implements AnalysisJob.
+func (j *TestJob) GetEnqueuedAt() time.Time {
+	panic("unimplemented")
+}
+
+// GetWeightBreakdown implements AnalysisJob.
+func (j *TestJob) GetWeightBreakdown() map[string]float64 {
+	panic("unimplemented")
+}
+
 // IsValidToAnalyze implements AnalysisJob.
 func (j *TestJob) IsValidToAnalyze(sctx sessionctx.Context) (bool, string) {
 	panic("unimplemented")
@@ -274,6 +360,41 @@ func (j *TestJob) GetTableID() int64 {
 	return int64(j.ID)
 }
 
+// GetAnalyzeType implements AnalysisJob.
+func (j *TestJob) GetAnalyzeType() string {
+	panic("unimplemented")
+}
+
+// EstimatedCost implements AnalysisJob.
+func (j *TestJob) EstimatedCost() float64 {
+	panic("unimplemented")
+}
+
+// EstimatedMemoryBytes implements AnalysisJob.
+func (j *TestJob) EstimatedMemoryBytes() int64 {
+	panic("unimplemented")
+}
+
+// GetSchemaName implements AnalysisJob.
+func (j *TestJob) GetSchemaName() string {
+	panic("unimplemented")
+}
+
+// GetTableName implements AnalysisJob.
+func (j *TestJob) GetTableName() string {
+	panic("unimplemented")
+}
+
+// GetPartitionNames implements AnalysisJob.
+func (j *TestJob) GetPartitionNames() []string {
+	panic("unimplemented")
+}
+
+// GetGlobalTableID implements AnalysisJob.
+func (j *TestJob) GetGlobalTableID() int64 {
+	panic("unimplemented")
+}
+
 func (j *TestJob) GetIndicators() priorityqueue.Indicators {
 	return priorityqueue.Indicators{
 		ChangePercentage:     j.Changes / j.TableSize,
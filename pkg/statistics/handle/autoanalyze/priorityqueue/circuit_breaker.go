@@ -0,0 +1,197 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	statslogutil "github.com/pingcap/tidb/pkg/statistics/handle/logutil"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"github.com/pingcap/tidb/pkg/types"
+	"go.uber.org/zap"
+)
+
+var (
+	// CircuitBreakerFailureThreshold is the number of consecutive failures of a table to trip its circuit breaker.
+	// Once tripped, no job of the table is pushed into the queue until the cooldown expires or the breaker is reset.
+	// Set it to 0 to disable the circuit breaker.
+	CircuitBreakerFailureThreshold = 5
+	// CircuitBreakerCooldown is how long a tripped table is kept out of the queue.
+	// After that, the table gets one more chance, and it is tripped again immediately if it fails again.
+	CircuitBreakerCooldown = time.Hour
+)
+
+// TrippedTable is the state of a table whose circuit breaker is tripped.
+type TrippedTable struct {
+	// TrippedUntil is the time when the cooldown expires.
+	TrippedUntil time.Time
+	// TableID is the ID of the table or the static partition.
+	TableID int64
+	// ConsecutiveFailures is the number of consecutive failures of the table.
+	ConsecutiveFailures int
+}
+
+// circuitBreaker tracks the consecutive failures of the tables to stop retrying the tables that keep failing,
+// e.g. because of a corrupted index.
+// NOTE: This struct is not thread-safe.
+type circuitBreaker struct {
+	// failures is the number of consecutive failures of each table.
+	failures map[int64]int
+	// trippedUntil is the time when the cooldown of each tripped table expires.
+	trippedUntil map[int64]time.Time
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		failures:     make(map[int64]int),
+		trippedUntil: make(map[int64]time.Time),
+	}
+}
+
+// onFailure records a failure of the table and trips the breaker if the threshold is reached.
+func (b *circuitBreaker) onFailure(tableID int64, now time.Time) {
+	b.failures[tableID]++
+	if CircuitBreakerFailureThreshold <= 0 || b.failures[tableID] < CircuitBreakerFailureThreshold {
+		return
+	}
+	b.trippedUntil[tableID] = now.Add(CircuitBreakerCooldown)
+	statslogutil.StatsLogger().Warn(
+		"Stop analyzing the table for a while because it keeps failing",
+		zap.Int64("tableID", tableID),
+		zap.Int("consecutiveFailures", b.failures[tableID]),
+		zap.Duration("cooldown", CircuitBreakerCooldown),
+	)
+}
+
+// restore sets the consecutive failures of the table loaded from mysql.analyze_outcomes,
+// and trips the breaker as if the last failure had just been recorded by onFailure.
+func (b *circuitBreaker) restore(tableID int64, failures int, lastFailure time.Time) {
+	b.failures[tableID] = failures
+	if CircuitBreakerFailureThreshold <= 0 || failures < CircuitBreakerFailureThreshold {
+		return
+	}
+	b.trippedUntil[tableID] = lastFailure.Add(CircuitBreakerCooldown)
+}
+
+// reset clears the failures of the table.
+func (b *circuitBreaker) reset(tableID int64) {
+	delete(b.failures, tableID)
+	delete(b.trippedUntil, tableID)
+}
+
+// isTripped checks whether the table is still in the cooldown.
+// It is safe to call it on a nil breaker, e.g. while the queue is being initialized.
+func (b *circuitBreaker) isTripped(tableID int64, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	until, ok := b.trippedUntil[tableID]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	// The cooldown expires. Keep the failure count, so that another failure trips the breaker again.
+	delete(b.trippedUntil, tableID)
+	return false
+}
+
+// tripped returns the tables that are still in the cooldown, ordered by the table ID.
+func (b *circuitBreaker) tripped(now time.Time) []TrippedTable {
+	tables := make([]TrippedTable, 0, len(b.trippedUntil))
+	for tableID, until := range b.trippedUntil {
+		if !now.Before(until) {
+			continue
+		}
+		tables = append(tables, TrippedTable{
+			TrippedUntil:        until,
+			TableID:             tableID,
+			ConsecutiveFailures: b.failures[tableID],
+		})
+	}
+	slices.SortFunc(tables, func(a, b TrippedTable) int {
+		return cmp.Compare(a.TableID, b.TableID)
+	})
+	return tables
+}
+
+// loadCircuitBreaker creates a circuit breaker with the consecutive failures restored from mysql.analyze_outcomes,
+// so that the tables that keep failing are not retried from scratch after the owner changes.
+// The outcomes are recorded by the success and failure hooks of the jobs, see recordAnalysisOutcome.
+func loadCircuitBreaker(sctx sessionctx.Context) (*circuitBreaker, error) {
+	breaker := newCircuitBreaker()
+	if CircuitBreakerFailureThreshold <= 0 {
+		return breaker, nil
+	}
+	rows, _, err := statsutil.ExecRows(
+		sctx,
+		"SELECT table_id, consecutive_failures, CONVERT_TZ(last_failure_time, @@TIME_ZONE, '+00:00') FROM mysql.analyze_outcomes WHERE consecutive_failures > 0",
+	)
+	if err != nil {
+		return breaker, errors.Trace(err)
+	}
+	for _, row := range rows {
+		// Usually, it should not be NULL, because the failure time is recorded with the failure.
+		if row.IsNull(2) {
+			continue
+		}
+		lastFailure, err := row.GetTime(2).GoTime(time.UTC)
+		if err != nil {
+			return breaker, errors.Trace(err)
+		}
+		breaker.restore(row.GetInt64(0), int(row.GetInt64(1)), lastFailure)
+	}
+	return breaker, nil
+}
+
+// recordAnalysisOutcome records the outcome of a finished or failed job of the table in mysql.analyze_outcomes.
+// A success clears the consecutive failures of the table, while a failure increases them.
+func recordAnalysisOutcome(sctx sessionctx.Context, tableID int64, succeeded bool, now time.Time) error {
+	if succeeded {
+		_, _, err := statsutil.ExecRows(
+			sctx,
+			`INSERT INTO mysql.analyze_outcomes (table_id, success_count) VALUES (%?, 1)
+			ON DUPLICATE KEY UPDATE success_count = success_count + 1, consecutive_failures = 0`,
+			tableID,
+		)
+		return errors.Trace(err)
+	}
+	_, _, err := statsutil.ExecRows(
+		sctx,
+		`INSERT INTO mysql.analyze_outcomes (table_id, failure_count, consecutive_failures, last_failure_time)
+		VALUES (%?, 1, 1, CONVERT_TZ(%?, '+00:00', @@TIME_ZONE))
+		ON DUPLICATE KEY UPDATE failure_count = failure_count + 1, consecutive_failures = consecutive_failures + 1,
+		last_failure_time = VALUES(last_failure_time)`,
+		tableID,
+		now.UTC().Format(types.TimeFormat),
+	)
+	return errors.Trace(err)
+}
+
+// resetAnalysisOutcome clears the consecutive failures of the table in mysql.analyze_outcomes,
+// so that the reset of the circuit breaker survives the owner changes.
+func resetAnalysisOutcome(sctx sessionctx.Context, tableID int64) error {
+	_, _, err := statsutil.ExecRows(
+		sctx,
+		"UPDATE mysql.analyze_outcomes SET consecutive_failures = 0 WHERE table_id = %?",
+		tableID,
+	)
+	return errors.Trace(err)
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time.
+// It allows the time-based scheduling logic, such as aging, cooldowns and time windows, to be tested deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// RealClock is the Clock that returns the system time.
+type RealClock struct{}
+
+// Now implements Clock.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// DefaultClock is the Clock used by the jobs, the queue and the refresher.
+// Replace it with a MockClock before creating the queue and restore it after the test.
+// Exported for testing purposes.
+var DefaultClock Clock = RealClock{}
+
+// since returns the time elapsed since t according to DefaultClock.
+func since(t time.Time) time.Duration {
+	return DefaultClock.Now().Sub(t)
+}
+
+// MockClock is a Clock whose time only changes when it is set or advanced.
+// It is thread-safe.
+type MockClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+// NewMockClock creates a new MockClock that starts at the given time.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now implements Clock.
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the current time of the clock.
+func (c *MockClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by the given duration.
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
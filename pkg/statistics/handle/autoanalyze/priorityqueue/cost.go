@@ -0,0 +1,65 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import "math"
+
+// The cost model of the analysis jobs.
+//
+// The cost is a rough and unitless estimation of the resources used by a job, so that the jobs can be compared
+// with each other, e.g. to avoid launching several expensive jobs at once. It is not a prediction of the duration.
+// The model is based on the following assumptions:
+//  1. The cost is proportional to the amount of data to read and build statistics on.
+//     TableSize is rows * len(columns), so the column count is already part of it.
+//     One cost unit is the cost of analyzing costCellsPerUnit cells, e.g. 1M rows of a 10-column table.
+//  2. Analyzing the whole table or partition costs a full unit per costCellsPerUnit cells.
+//  3. Analyzing a subset of columns still scans all rows, but builds fewer statistics,
+//     so it costs columnsScanCostFactor plus columnCostFactor per column, and never more than the whole table.
+//  4. Analyzing newly added indexes scans each index separately, and an index is narrower than the table,
+//     so each index costs indexCostFactor of the whole table.
+//  5. Every job costs at least minJobCost, because there are fixed overheads such as
+//     loading the table metadata and saving the statistics.
+//  6. Every row has a fixed overhead besides its cells, such as reading and decoding the key,
+//     which costs as much as rowOverheadCells cells. It is only counted if EstimatedRows is known.
+const (
+	costCellsPerUnit      = 10_000_000
+	columnsScanCostFactor = 0.5
+	columnCostFactor      = 0.05
+	indexCostFactor       = 0.3
+	minJobCost            = 0.01
+	rowOverheadCells      = 1
+)
+
+// estimateCost estimates the cost of a job that analyzes the given number of indexes and columns of a table.
+// If neither indexes nor columns are specified, the whole table is analyzed.
+func estimateCost(indicators Indicators, numIndexes, numColumns int) float64 {
+	tableSize := indicators.TableSize
+	if math.IsNaN(tableSize) || tableSize < 0 {
+		tableSize = 0
+	}
+	if indicators.EstimatedRows > 0 {
+		tableSize += float64(indicators.EstimatedRows) * rowOverheadCells
+	}
+	var factor float64
+	switch {
+	case numIndexes > 0:
+		factor = indexCostFactor * float64(numIndexes)
+	case numColumns > 0:
+		factor = min(columnsScanCostFactor+columnCostFactor*float64(numColumns), 1)
+	default:
+		factor = 1
+	}
+	return max(tableSize/costCellsPerUnit*factor, minJobCost)
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/meta/model"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/statistics"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"github.com/pingcap/tidb/pkg/types"
+	"github.com/pingcap/tidb/pkg/util/codec"
+	"github.com/pingcap/tidb/pkg/util/collate"
+)
+
+var (
+	// EnableDistributionDriftCheck makes the refresher skip the tables whose data distribution
+	// does not drift meaningfully since the last analysis, even if their change percentage is high,
+	// e.g. the tables that grow uniformly. See CheckDistributionDrift for how the drift is estimated.
+	// It is disabled by default.
+	EnableDistributionDriftCheck = false
+	// MinDistributionDrift is the drift from which the change of a table is considered meaningful.
+	// The drift is in [0, 1].
+	MinDistributionDrift = 0.1
+	// DistributionDriftSampleRate is the fraction of the rows sampled to estimate the drift.
+	DistributionDriftSampleRate = 0.01
+)
+
+// maxDriftCheckPoints is the max number of histogram bounds at which the distributions are compared.
+const maxDriftCheckPoints = 16
+
+// CheckDistributionDrift estimates how much the data distribution of the table analyzed by the job
+// has drifted since the last analysis, and reports whether the drift reaches MinDistributionDrift.
+// It samples DistributionDriftSampleRate of the rows and compares the cumulative distribution of
+// the integer column with the most histogram buckets against its stats at the histogram bounds.
+// The drift is the max difference between the two cumulative distributions.
+// The drift can only be estimated for the non-partitioned tables and the static partitions with
+// loaded integer column stats. Otherwise, it always reports a meaningful change with the drift 1,
+// so the job is analyzed as usual.
+func CheckDistributionDrift(
+	sctx sessionctx.Context,
+	statsHandle statstypes.StatsHandle,
+	job AnalysisJob,
+) (meaningful bool, drift float64, err error) {
+	// The newly added indexes have no stats at all, so they always need to be analyzed.
+	if job.HasNewlyAddedIndex() {
+		return true, 1, nil
+	}
+	var (
+		schema, tableName, partitionName string
+		tableID, physicalID              int64
+	)
+	switch j := job.(type) {
+	case *NonPartitionedTableAnalysisJob:
+		schema, tableName, tableID, physicalID = j.TableSchema, j.TableName, j.TableID, j.TableID
+	case *StaticPartitionedTableAnalysisJob:
+		schema, tableName, partitionName = j.TableSchema, j.GlobalTableName, j.StaticPartitionName
+		tableID, physicalID = j.GlobalTableID, j.StaticPartitionID
+	default:
+		return true, 1, nil
+	}
+
+	is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+	tbl, ok := is.TableByID(context.Background(), tableID)
+	if !ok {
+		return true, 1, nil
+	}
+	tblInfo := tbl.Meta()
+	var tblStats *statistics.Table
+	if partitionName == "" {
+		tblStats = statsHandle.GetTableStatsForAutoAnalyze(tblInfo)
+	} else {
+		tblStats = statsHandle.GetPartitionStatsForAutoAnalyze(tblInfo, physicalID)
+	}
+	colInfo, colStats := pickDriftCheckColumn(tblInfo, tblStats)
+	if colStats == nil {
+		return true, 1, nil
+	}
+
+	bounds, expected, err := expectedCumulativeDistribution(colStats)
+	if err != nil {
+		return false, 0, err
+	}
+	actual, err := sampleCumulativeDistribution(sctx, schema, tableName, partitionName, colInfo.Name.O, bounds)
+	if err != nil {
+		return false, 0, err
+	}
+	// Nothing is sampled, so we cannot tell.
+	if actual == nil {
+		return true, 1, nil
+	}
+	for i := range expected {
+		drift = max(drift, math.Abs(expected[i]-actual[i]))
+	}
+	return drift >= MinDistributionDrift, drift, nil
+}
+
+// pickDriftCheckColumn picks the integer column with the most histogram buckets.
+// It returns nil if no such column has loaded stats.
+func pickDriftCheckColumn(tblInfo *model.TableInfo, tblStats *statistics.Table) (*model.ColumnInfo, *statistics.Column) {
+	if tblStats == nil || !tblStats.IsAnalyzed() {
+		return nil, nil
+	}
+	var (
+		pickedInfo  *model.ColumnInfo
+		pickedStats *statistics.Column
+	)
+	for _, colInfo := range tblInfo.Columns {
+		if colInfo.State != model.StatePublic || !mysql.IsIntegerType(colInfo.GetType()) {
+			continue
+		}
+		colStats := tblStats.GetCol(colInfo.ID)
+		if colStats == nil || !colStats.IsFullLoad() || colStats.Histogram.Len() == 0 {
+			continue
+		}
+		if pickedStats == nil || colStats.Histogram.Len() > pickedStats.Histogram.Len() {
+			pickedInfo, pickedStats = colInfo, colStats
+		}
+	}
+	return pickedInfo, pickedStats
+}
+
+// expectedCumulativeDistribution returns up to maxDriftCheckPoints upper bounds of the histogram buckets,
+// and the fraction of the non-null values no greater than each bound according to the stats.
+// The values in the TopN are counted as well, because they are not included in the histogram.
+func expectedCumulativeDistribution(colStats *statistics.Column) ([]types.Datum, []float64, error) {
+	hg := &colStats.Histogram
+	// The bounds are evenly picked from the buckets, including the last one.
+	n := min(hg.Len(), maxDriftCheckPoints)
+	bounds := make([]types.Datum, 0, n)
+	counts := make([]float64, 0, n)
+	for k := 1; k <= n; k++ {
+		i := k*hg.Len()/n - 1
+		bounds = append(bounds, *hg.GetUpper(i))
+		counts = append(counts, float64(hg.Buckets[i].Count))
+	}
+	total := hg.NotNullCount()
+	if colStats.TopN != nil {
+		for _, meta := range colStats.TopN.TopN {
+			_, d, err := codec.DecodeOne(meta.Encoded)
+			if err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+			for i := range bounds {
+				cmp, err := d.Compare(types.DefaultStmtNoWarningContext, &bounds[i], collate.GetBinaryCollator())
+				if err != nil {
+					return nil, nil, errors.Trace(err)
+				}
+				if cmp <= 0 {
+					counts[i] += float64(meta.Count)
+				}
+			}
+			total += float64(meta.Count)
+		}
+	}
+	for i := range counts {
+		counts[i] /= total
+	}
+	return bounds, counts, nil
+}
+
+// sampleCumulativeDistribution samples the column and returns the fraction of the non-null values
+// no greater than each bound. It returns nil if no value is sampled.
+func sampleCumulativeDistribution(
+	sctx sessionctx.Context,
+	schema, tableName, partitionName, columnName string,
+	bounds []types.Datum,
+) ([]float64, error) {
+	var sql strings.Builder
+	params := make([]any, 0, 2*len(bounds)+5)
+	sql.WriteString("select count(%n)")
+	params = append(params, columnName)
+	for _, bound := range bounds {
+		sql.WriteString(", count(if(%n <= %?, 1, null))")
+		params = append(params, columnName, bound.GetValue())
+	}
+	sql.WriteString(" from %n.%n")
+	params = append(params, schema, tableName)
+	if partitionName != "" {
+		sql.WriteString(" partition (%n)")
+		params = append(params, partitionName)
+	}
+	sql.WriteString(" where rand() < %?")
+	params = append(params, DistributionDriftSampleRate)
+
+	rows, _, err := statsutil.ExecRows(sctx, sql.String(), params...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(rows) == 0 || rows[0].GetInt64(0) == 0 {
+		return nil, nil
+	}
+	total := float64(rows[0].GetInt64(0))
+	fractions := make([]float64, 0, len(bounds))
+	for i := range bounds {
+		fractions = append(fractions, float64(rows[0].GetInt64(i+1))/total)
+	}
+	return fractions, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/parser/model"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/pingcap/tidb/pkg/testkit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDistributionDrift(t *testing.T) {
+	defer func(sampleRate float64) {
+		priorityqueue.DistributionDriftSampleRate = sampleRate
+	}(priorityqueue.DistributionDriftSampleRate)
+	// Sample all rows to make the test deterministic.
+	priorityqueue.DistributionDriftSampleRate = 1
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b varchar(10))")
+	insertRange := func(start, end int) {
+		tk.MustExec("insert into t select n, 'x' from (with recursive c(n) as (select ? union all select n + 1 from c where n < ?) select n from c) as c", start, end)
+	}
+	insertRange(1, 1000)
+	tk.MustExec("analyze table t all columns")
+	handle := dom.StatsHandle()
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	// Load the histograms of the columns.
+	tk.MustExec("set @@tidb_stats_load_sync_wait = 60000")
+	tk.MustQuery("select count(*) from t where a > 0 and b > ''").Check(testkit.Rows("1000"))
+
+	sctx := tk.Session().(sessionctx.Context)
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableID:       tbl.Meta().ID,
+		TableStatsVer: 2,
+	}
+	meaningful, drift, err := priorityqueue.CheckDistributionDrift(sctx, handle, job)
+	require.NoError(t, err)
+	require.False(t, meaningful)
+	require.InDelta(t, 0, drift, 0.01)
+
+	// The table grows uniformly, so the distribution does not change.
+	insertRange(1, 1000)
+	meaningful, drift, err = priorityqueue.CheckDistributionDrift(sctx, handle, job)
+	require.NoError(t, err)
+	require.False(t, meaningful)
+	require.InDelta(t, 0, drift, 0.01)
+
+	// Half of the values are out of the range of the histogram now.
+	insertRange(5001, 6000)
+	insertRange(6001, 7000)
+	meaningful, drift, err = priorityqueue.CheckDistributionDrift(sctx, handle, job)
+	require.NoError(t, err)
+	require.True(t, meaningful)
+	require.InDelta(t, 0.5, drift, 0.01)
+
+	// The newly added indexes always need to be analyzed.
+	job.Indexes = []string{"idx"}
+	meaningful, drift, err = priorityqueue.CheckDistributionDrift(sctx, handle, job)
+	require.NoError(t, err)
+	require.True(t, meaningful)
+	require.Equal(t, 1.0, drift)
+
+	// The drift of the dynamic partitioned tables is not estimated.
+	meaningful, drift, err = priorityqueue.CheckDistributionDrift(sctx, handle, &priorityqueue.DynamicPartitionedTableAnalysisJob{})
+	require.NoError(t, err)
+	require.True(t, meaningful)
+	require.Equal(t, 1.0, drift)
+}
@@ -15,14 +15,18 @@
 package priorityqueue
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
 	"github.com/pingcap/tidb/pkg/sessionctx/variable"
-	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/exec"
 	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
 	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
 )
@@ -44,13 +48,18 @@ type DynamicPartitionedTableAnalysisJob struct {
 	// For example, the user may analyze some partitions manually, and we don't want to analyze them again.
 	PartitionIndexes map[string][]string
 
-	successHook JobHook
-	failureHook JobHook
+	successHook  JobHook
+	failureHook  JobHook
+	progressHook ProgressHook
+	validityHook ValidityHook
+	tracer       Tracer
 
 	TableSchema     string
 	GlobalTableName string
 	// This will analyze all indexes and columns of the specified partitions.
 	Partitions []string
+	// SessionVariables is used to override the session variables while executing the analyze statements.
+	SessionVariables SessionVariables
 	// Some indicators to help us decide whether we need to analyze this table.
 	Indicators
 	GlobalTableID int64
@@ -59,6 +68,21 @@ type DynamicPartitionedTableAnalysisJob struct {
 	TableStatsVer int
 	// Weight is used to calculate the priority of the job.
 	Weight float64
+	// EnqueuedAt is the time when the job is pushed into the queue.
+	// It is used to boost the weight of the job that has been waiting for a long time.
+	EnqueuedAt time.Time
+	// LastRunDuration is the wall-clock time spent on executing the analyze statements in the last run.
+	LastRunDuration time.Duration
+
+	// lastFailureReason is the reason why the job failed last time.
+	lastFailureReason string
+	// lastFailureTransient indicates whether the job failed with a transient error last time.
+	lastFailureTransient bool
+	// completed indicates whether the job has been analyzed successfully.
+	// Analyzing a completed job again only calls the success hook.
+	completed bool
+	// state is the state of the job in its lifecycle, see AnalysisJob.State.
+	state jobState
 }
 
 // NewDynamicPartitionedTableAnalysisJob creates a new job for analyzing a dynamic partitioned table's partitions.
@@ -92,33 +116,113 @@ func (j *DynamicPartitionedTableAnalysisJob) GetTableID() int64 {
 	return j.GlobalTableID
 }
 
+// GetGlobalTableID implements AnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) GetGlobalTableID() int64 {
+	return j.GlobalTableID
+}
+
+// GetSchemaName gets the schema name of the table.
+func (j *DynamicPartitionedTableAnalysisJob) GetSchemaName() string {
+	return j.TableSchema
+}
+
+// GetTableName gets the name of the global table.
+func (j *DynamicPartitionedTableAnalysisJob) GetTableName() string {
+	return j.GlobalTableName
+}
+
+// GetPartitionNames implements AnalysisJob.
+// It returns the sorted names of the partitions to analyze, including the partitions to analyze the newly added indexes on.
+func (j *DynamicPartitionedTableAnalysisJob) GetPartitionNames() []string {
+	names := append(slices.Clone(j.Partitions), getPartitionNames(j.PartitionIndexes)...)
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
 // Analyze analyzes the partitions or partition indexes.
 func (j *DynamicPartitionedTableAnalysisJob) Analyze(
+	ctx context.Context,
 	statsHandle statstypes.StatsHandle,
 	sysProcTracker sysproctrack.Tracker,
 ) error {
-	success := true
+	// The job has been analyzed successfully, e.g. the runner retries it because the success hook fails.
+	// Only the success hook is called again, so that the table is not analyzed twice.
+	if j.completed {
+		if j.successHook != nil {
+			j.successHook(j)
+		}
+		return nil
+	}
+
+	j.setState(JobStateRunning)
+	success, canceled := true, false
 	defer func() {
+		// The state is set before calling the hooks, so that the hooks see the outcome.
+		if canceled {
+			// The interrupted job is neither a success nor a failure, so it is not counted as either.
+			// The failure hook is still called to release the table, see JobStateCanceled.
+			j.setState(JobStateCanceled)
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+			return
+		}
+		observeAnalysisResult(j, success)
 		if success {
+			j.setState(JobStateSucceeded)
+			j.completed = true
 			if j.successHook != nil {
 				j.successHook(j)
 			}
 		} else {
+			j.setState(JobStateFailed)
 			if j.failureHook != nil {
 				j.failureHook(j)
 			}
 		}
 	}()
 
-	return statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
-		switch j.getAnalyzeType() {
-		case analyzeDynamicPartition:
-			success = j.analyzePartitions(sctx, statsHandle, sysProcTracker)
-		case analyzeDynamicPartitionIndex:
-			success = j.analyzePartitionIndexes(sctx, statsHandle, sysProcTracker)
+	err := runAnalysis(ctx, j, j.progressHook, statsHandle, sysProcTracker, func(ctx context.Context, sysProcTracker sysproctrack.Tracker) error {
+		var sqls []analyzeSQL
+		if err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			sqls = j.genAnalyzeSQLs(sctx)
+			return nil
+		}); err != nil {
+			// Nothing is done without a session, so the job fails.
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return err
+		}
+		start := DefaultClock.Now()
+		err := runAnalyzeSQLs(ctx, j, statsHandle, sysProcTracker, j.tracer, j.TableStatsVer, j.SessionVariables, sqls)
+		j.LastRunDuration = since(start)
+		if err != nil {
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
 		}
 		return nil
 	})
+	if isAnalysisCanceled(err) || isAnalysisTimedOut(err) {
+		// The job is interrupted, so it is not finished.
+		// Unlike a cancellation, a timeout is a failure of the job, see AnalyzeTimeoutPerCostUnit.
+		canceled = !isAnalysisTimedOut(err)
+		success = false
+		j.lastFailureReason = err.Error()
+		j.lastFailureTransient = isTransientAnalyzeError(err)
+	}
+	return err
+}
+
+// DryRun implements AnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	return escapeAnalyzeSQLs(j.genAnalyzeSQLs(sctx))
+}
+
+// GenAnalyzeSQLParams implements AnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error) {
+	return collectAnalyzeSQLParams(j.genAnalyzeSQLs(sctx)), nil
 }
 
 // RegisterSuccessHook registers a successHook function that will be called after the job can be marked as successful.
@@ -131,6 +235,21 @@ func (j *DynamicPartitionedTableAnalysisJob) RegisterFailureHook(hook JobHook) {
 	j.failureHook = hook
 }
 
+// RegisterProgressHook registers a progressHook function that will be called periodically while the job is running.
+func (j *DynamicPartitionedTableAnalysisJob) RegisterProgressHook(hook ProgressHook) {
+	j.progressHook = hook
+}
+
+// RegisterValidityHook registers a validityHook function that is consulted by IsValidToAnalyze after its built-in checks pass.
+func (j *DynamicPartitionedTableAnalysisJob) RegisterValidityHook(hook ValidityHook) {
+	j.validityHook = hook
+}
+
+// SetTracer sets the Tracer that traces the execution of the analyze statements of the job.
+func (j *DynamicPartitionedTableAnalysisJob) SetTracer(tracer Tracer) {
+	j.tracer = tracer
+}
+
 // GetIndicators returns the indicators of the table.
 func (j *DynamicPartitionedTableAnalysisJob) GetIndicators() Indicators {
 	return j.Indicators
@@ -146,6 +265,19 @@ func (j *DynamicPartitionedTableAnalysisJob) HasNewlyAddedIndex() bool {
 	return len(j.PartitionIndexes) > 0
 }
 
+// Validate checks whether the schema, global table name and global table ID of the job are set.
+func (j *DynamicPartitionedTableAnalysisJob) Validate() error {
+	switch {
+	case j.TableSchema == "":
+		return errors.New("invalid analysis job: table schema is empty")
+	case j.GlobalTableName == "":
+		return errors.New("invalid analysis job: global table name is empty")
+	case j.GlobalTableID <= 0:
+		return errors.Errorf("invalid analysis job: global table ID %d is not positive", j.GlobalTableID)
+	}
+	return nil
+}
+
 // IsValidToAnalyze checks whether the table or partition is valid to analyze.
 // We need to check each partition to determine whether the table is valid to analyze.
 func (j *DynamicPartitionedTableAnalysisJob) IsValidToAnalyze(
@@ -162,6 +294,8 @@ func (j *DynamicPartitionedTableAnalysisJob) IsValidToAnalyze(
 			j.GlobalTableName,
 			partitions...,
 		); !valid {
+			j.setState(JobStateSkipped)
+			j.lastFailureReason = failReason
 			if j.failureHook != nil {
 				j.failureHook(j)
 			}
@@ -169,19 +303,124 @@ func (j *DynamicPartitionedTableAnalysisJob) IsValidToAnalyze(
 		}
 	}
 
+	if valid, failReason := checkValidityHook(j, j.validityHook); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
+		return false, failReason
+	}
 	return true, ""
 }
 
+// Clone returns a deep copy of the job.
+func (j *DynamicPartitionedTableAnalysisJob) Clone() AnalysisJob {
+	cloned := *j
+	cloned.Partitions = slices.Clone(j.Partitions)
+	if j.PartitionIndexes != nil {
+		cloned.PartitionIndexes = make(map[string][]string, len(j.PartitionIndexes))
+		for index, partitions := range j.PartitionIndexes {
+			cloned.PartitionIndexes[index] = slices.Clone(partitions)
+		}
+	}
+	cloned.SessionVariables = maps.Clone(j.SessionVariables)
+	return &cloned
+}
+
+// Equal checks whether the job analyzes the same table, partitions and indexes as the other job.
+// Hooks, indicators and weight are not compared.
+func (j *DynamicPartitionedTableAnalysisJob) Equal(other AnalysisJob) bool {
+	o, ok := other.(*DynamicPartitionedTableAnalysisJob)
+	if !ok || o == nil {
+		return false
+	}
+	return j.GlobalTableID == o.GlobalTableID &&
+		j.TableSchema == o.TableSchema &&
+		j.GlobalTableName == o.GlobalTableName &&
+		slices.Equal(j.Partitions, o.Partitions) &&
+		maps.EqualFunc(j.PartitionIndexes, o.PartitionIndexes, slices.Equal[[]string]) &&
+		maps.Equal(j.SessionVariables, o.SessionVariables)
+}
+
 // SetWeight sets the weight of the job.
 func (j *DynamicPartitionedTableAnalysisJob) SetWeight(weight float64) {
-	j.Weight = weight
+	j.Weight = clampWeight(weight)
 }
 
 // GetWeight gets the weight of the job.
 func (j *DynamicPartitionedTableAnalysisJob) GetWeight() float64 {
+	return clampWeight(j.Weight + calculateAgingWeight(j.EnqueuedAt))
+}
+
+// GetBaseWeight gets the weight set by SetWeight, without the aging boost.
+func (j *DynamicPartitionedTableAnalysisJob) GetBaseWeight() float64 {
 	return j.Weight
 }
 
+// SetEnqueuedAt sets the time when the job is pushed into the queue.
+func (j *DynamicPartitionedTableAnalysisJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	j.EnqueuedAt = enqueuedAt
+}
+
+// GetEnqueuedAt gets the time when the job is pushed into the queue.
+func (j *DynamicPartitionedTableAnalysisJob) GetEnqueuedAt() time.Time {
+	return j.EnqueuedAt
+}
+
+// GetLastRunDuration gets the time spent on executing the analyze statements in the last run.
+func (j *DynamicPartitionedTableAnalysisJob) GetLastRunDuration() time.Duration {
+	return j.LastRunDuration
+}
+
+// GetLastFailureReason gets the reason why the job failed last time.
+func (j *DynamicPartitionedTableAnalysisJob) GetLastFailureReason() string {
+	return j.lastFailureReason
+}
+
+// State implements AnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) State() JobState {
+	return j.state.load()
+}
+
+func (j *DynamicPartitionedTableAnalysisJob) setState(state JobState) {
+	j.state.store(state)
+}
+
+// IsLastFailureTransient checks whether the job failed with a transient error last time.
+func (j *DynamicPartitionedTableAnalysisJob) IsLastFailureTransient() bool {
+	return j.lastFailureTransient
+}
+
+// GetCorrelationID gets the ID to correlate the logs of the job.
+func (j *DynamicPartitionedTableAnalysisJob) GetCorrelationID() string {
+	return genCorrelationID(j.GlobalTableID, 0, j.EnqueuedAt)
+}
+
+// GetWeightBreakdown implements AnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) GetWeightBreakdown() map[string]float64 {
+	return NewPriorityCalculator().CalculateWeightBreakdown(j)
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The analyze type is included so that the job can be decoded by UnmarshalAnalysisJob.
+func (j *DynamicPartitionedTableAnalysisJob) MarshalJSON() ([]byte, error) {
+	type alias DynamicPartitionedTableAnalysisJob
+	return json.Marshal(struct {
+		AnalyzeType analyzeType
+		*alias
+	}{
+		AnalyzeType: j.getAnalyzeType(),
+		alias:       (*alias)(j),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (j *DynamicPartitionedTableAnalysisJob) UnmarshalJSON(data []byte) error {
+	if err := checkAnalyzeType(data, j); err != nil {
+		return err
+	}
+	type alias DynamicPartitionedTableAnalysisJob
+	return json.Unmarshal(data, (*alias)(j))
+}
+
 // String implements fmt.Stringer interface.
 func (j *DynamicPartitionedTableAnalysisJob) String() string {
 	return fmt.Sprintf(
@@ -196,30 +435,37 @@ func (j *DynamicPartitionedTableAnalysisJob) String() string {
 			"\tChangePercentage: %.6f\n"+
 			"\tTableSize: %.2f\n"+
 			"\tLastAnalysisDuration: %s\n"+
-			"\tWeight: %.6f\n",
+			"\tWeight: %.6f\n"+
+			"\tWeightBreakdown: %s\n"+
+			"\tCorrelationID: %s\n",
 		j.getAnalyzeType(),
 		strings.Join(j.Partitions, ", "),
 		j.PartitionIndexes,
 		j.TableSchema, j.GlobalTableName,
 		j.GlobalTableID, j.TableStatsVer, j.ChangePercentage,
 		j.TableSize, j.LastAnalysisDuration, j.Weight,
+		formatWeightBreakdown(j.GetWeightBreakdown()),
+		j.GetCorrelationID(),
 	)
 }
 
-// analyzePartitions performs analysis on the specified partitions.
-// This function uses a batch mode for efficiency. After analyzing the partitions,
-// it's necessary to merge their statistics. By analyzing them in batches,
-// we can reduce the overhead of this merging process.
-func (j *DynamicPartitionedTableAnalysisJob) analyzePartitions(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) bool {
-	analyzePartitionBatchSize := int(variable.AutoAnalyzePartitionBatchSize.Load())
-	needAnalyzePartitionNames := make([]any, 0, len(j.Partitions))
-	for _, partition := range j.Partitions {
-		needAnalyzePartitionNames = append(needAnalyzePartitionNames, partition)
+// genAnalyzeSQLs generates the analyze statements that need to be executed for the job.
+func (j *DynamicPartitionedTableAnalysisJob) genAnalyzeSQLs(sctx sessionctx.Context) []analyzeSQL {
+	switch j.getAnalyzeType() {
+	case analyzeDynamicPartition:
+		return j.genSQLsForAnalyzePartitions()
+	case analyzeDynamicPartitionIndex:
+		return j.genSQLsForAnalyzePartitionIndexes()
 	}
+	return nil
+}
+
+// genSQLsForAnalyzePartitions generates the analyze statements for the specified partitions in batches.
+func (j *DynamicPartitionedTableAnalysisJob) genSQLsForAnalyzePartitions() []analyzeSQL {
+	analyzePartitionBatchSize := int(variable.AutoAnalyzePartitionBatchSize.Load())
+	needAnalyzePartitionNames := j.Partitions
+	clause := j.genClause()
+	var sqls []analyzeSQL
 	for i := 0; i < len(needAnalyzePartitionNames); i += analyzePartitionBatchSize {
 		start := i
 		end := start + analyzePartitionBatchSize
@@ -227,32 +473,34 @@ func (j *DynamicPartitionedTableAnalysisJob) analyzePartitions(
 			end = len(needAnalyzePartitionNames)
 		}
 
-		sql := getPartitionSQL("analyze table %n.%n partition", "", end-start)
-		params := append([]any{j.TableSchema, j.GlobalTableName}, needAnalyzePartitionNames[start:end]...)
-		success := exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
-		if !success {
-			return false
+		sql := getPartitionSQL("analyze table %n.%n partition", clause, end-start)
+		params := AnalyzeSQLParams{
+			TableSchema: j.TableSchema,
+			TableName:   j.GlobalTableName,
+			Partitions:  needAnalyzePartitionNames[start:end],
 		}
+		sqls = append(sqls, analyzeSQL{sql: sql, params: params})
 	}
-	return true
+	return sqls
 }
 
-// analyzePartitionIndexes performs analysis on the specified partition indexes.
-func (j *DynamicPartitionedTableAnalysisJob) analyzePartitionIndexes(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) (success bool) {
+// genClause generates the WITH clause of the analyze statements with the sample rate chosen by the change percentage.
+func (j *DynamicPartitionedTableAnalysisJob) genClause() string {
+	return AnalyzeOptions{}.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer).genClause()
+}
+
+// genSQLsForAnalyzePartitionIndexes generates the analyze statements for the specified partition indexes in batches.
+func (j *DynamicPartitionedTableAnalysisJob) genSQLsForAnalyzePartitionIndexes() []analyzeSQL {
 	analyzePartitionBatchSize := int(variable.AutoAnalyzePartitionBatchSize.Load())
 	// For version 2, analyze one index will analyze all other indexes and columns.
 	// For version 1, analyze one index will only analyze the specified index.
-	analyzeVersion := sctx.GetSessionVars().AnalyzeVersion
+	// The statements are executed with the stats version of the job, see exec.RunAutoAnalyze.
+	analyzeVersion := j.TableStatsVer
 
+	clause := j.genClause()
+	var sqls []analyzeSQL
 	for indexName, partitionNames := range j.PartitionIndexes {
-		needAnalyzePartitionNames := make([]any, 0, len(partitionNames))
-		for _, partition := range partitionNames {
-			needAnalyzePartitionNames = append(needAnalyzePartitionNames, partition)
-		}
+		needAnalyzePartitionNames := partitionNames
 		for i := 0; i < len(needAnalyzePartitionNames); i += analyzePartitionBatchSize {
 			start := i
 			end := start + analyzePartitionBatchSize
@@ -260,13 +508,14 @@ func (j *DynamicPartitionedTableAnalysisJob) analyzePartitionIndexes(
 				end = len(needAnalyzePartitionNames)
 			}
 
-			sql := getPartitionSQL("analyze table %n.%n partition", " index %n", end-start)
-			params := append([]any{j.TableSchema, j.GlobalTableName}, needAnalyzePartitionNames[start:end]...)
-			params = append(params, indexName)
-			success = exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
-			if !success {
-				return false
+			sql := getPartitionSQL("analyze table %n.%n partition", " index %n"+clause, end-start)
+			params := AnalyzeSQLParams{
+				TableSchema: j.TableSchema,
+				TableName:   j.GlobalTableName,
+				Partitions:  needAnalyzePartitionNames[start:end],
+				Index:       indexName,
 			}
+			sqls = append(sqls, analyzeSQL{sql: sql, params: params})
 		}
 		// For version 1, we need to analyze all indexes.
 		if analyzeVersion != 1 {
@@ -276,7 +525,31 @@ func (j *DynamicPartitionedTableAnalysisJob) analyzePartitionIndexes(
 			break
 		}
 	}
-	return
+	return sqls
+}
+
+// EstimatedCost estimates the resources used by the job in a normalized cost unit.
+func (j *DynamicPartitionedTableAnalysisJob) EstimatedCost() float64 {
+	// The partitions are analyzed with all their indexes and columns, which dominates the cost.
+	if len(j.Partitions) > 0 {
+		return estimateCost(j.Indicators, 0, 0)
+	}
+	return estimateCost(j.Indicators, len(j.PartitionIndexes), 0)
+}
+
+// EstimatedMemoryBytes estimates the peak memory in bytes used by the job.
+// The partitions are analyzed together, so the memory is estimated from the indicators of the whole table.
+func (j *DynamicPartitionedTableAnalysisJob) EstimatedMemoryBytes() int64 {
+	options := AnalyzeOptions{}.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer)
+	if len(j.Partitions) > 0 {
+		return estimateMemoryBytes(j.Indicators, options, 0, 0)
+	}
+	return estimateMemoryBytes(j.Indicators, options, len(j.PartitionIndexes), 0)
+}
+
+// GetAnalyzeType returns whether the job analyzes the partitions or the partition indexes.
+func (j *DynamicPartitionedTableAnalysisJob) GetAnalyzeType() string {
+	return j.getAnalyzeType().label()
 }
 
 func (j *DynamicPartitionedTableAnalysisJob) getAnalyzeType() analyzeType {
@@ -50,7 +50,7 @@ func TestAnalyzeDynamicPartitionedTable(t *testing.T) {
 	tblStats := handle.GetPartitionStats(tbl.Meta(), pid)
 	require.True(t, tblStats.Pseudo)
 
-	job.Analyze(handle, dom.SysProcTracker())
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
 	// Check the result of analyze.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -90,7 +90,7 @@ func TestAnalyzeDynamicPartitionedTableIndexes(t *testing.T) {
 	require.NotNil(t, tblStats.GetIdx(1))
 	require.False(t, tblStats.GetIdx(1).IsAnalyzed())
 
-	job.Analyze(handle, dom.SysProcTracker())
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
 	// Check the result of analyze index.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -116,6 +116,57 @@ func TestAnalyzeDynamicPartitionedTableIndexes(t *testing.T) {
 	require.Len(t, rows, 5)
 }
 
+func TestDryRunDynamicPartitionedTable(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+	tk.MustExec("set global tidb_auto_analyze_partition_batch_size = 2")
+	defer tk.MustExec("set global tidb_auto_analyze_partition_batch_size = default")
+
+	job := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		TableSchema:     "test",
+		GlobalTableName: "t",
+		Partitions:      []string{"p0", "p1", "p2"},
+		TableStatsVer:   2,
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0`, `p1`",
+		"analyze table `test`.`t` partition `p2`",
+	}, sqls)
+
+	job.PartitionIndexes = map[string][]string{"idx": {"p0", "p1", "p2"}}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0`, `p1` index `idx`",
+		"analyze table `test`.`t` partition `p2` index `idx`",
+	}, sqls)
+}
+
+func TestGenAnalyzeSQLParamsForDynamicPartitionedTable(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+	tk.MustExec("set global tidb_auto_analyze_partition_batch_size = 2")
+	defer tk.MustExec("set global tidb_auto_analyze_partition_batch_size = default")
+
+	job := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		TableSchema:      "test",
+		GlobalTableName:  "t",
+		PartitionIndexes: map[string][]string{"idx": {"p0", "p1", "p2"}},
+		TableStatsVer:    2,
+	}
+	params, err := job.GenAnalyzeSQLParams(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []priorityqueue.AnalyzeSQLParams{
+		{TableSchema: "test", TableName: "t", Partitions: []string{"p0", "p1"}, Index: "idx"},
+		{TableSchema: "test", TableName: "t", Partitions: []string{"p2"}, Index: "idx"},
+	}, params)
+	require.Equal(t, []any{"test", "t", "p0", "p1", "idx"}, params[0].Args())
+}
+
 func TestIsValidToAnalyzeForDynamicPartitionedTable(t *testing.T) {
 	store := testkit.CreateMockStore(t)
 	tk := testkit.NewTestKit(t, store)
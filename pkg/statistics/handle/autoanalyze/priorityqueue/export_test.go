@@ -0,0 +1,56 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewJobWithWeightForTesting creates a minimal valid job of a non-partitioned table with the given weight.
+// The weight is kept as is when the job is pushed into a queue created with WithFixedWeightForTesting,
+// so the ordering tests do not depend on the weight formula.
+func NewJobWithWeightForTesting(tableID int64, weight float64) *NonPartitionedTableAnalysisJob {
+	return &NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     fmt.Sprintf("t%d", tableID),
+		TableID:       tableID,
+		TableStatsVer: 2,
+		Indicators: Indicators{
+			// The weight is carried by the change percentage, see WithFixedWeightForTesting.
+			ChangePercentage: weight,
+			TableSize:        1000,
+		},
+		Weight: weight,
+	}
+}
+
+// WithFixedWeightForTesting makes the queue use the weights of the jobs created by NewJobWithWeightForTesting
+// instead of calculating them from the indicators.
+func WithFixedWeightForTesting() QueueOption {
+	return WithWeightCalculator(func(indicators Indicators) float64 {
+		return indicators.ChangePercentage
+	})
+}
+
+// GetAnalysisCooldownForTesting returns the cooldown of the table after the job is finished successfully.
+func GetAnalysisCooldownForTesting(job AnalysisJob) time.Duration {
+	return analysisCooldown(job)
+}
+
+// GetStartJitterForTesting returns how long the job of the table waits after the queue is initialized, see WithStartJitter.
+func GetStartJitterForTesting(tableID int64, window time.Duration) time.Duration {
+	return startJitter(tableID, window)
+}
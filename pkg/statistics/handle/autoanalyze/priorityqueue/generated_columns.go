@@ -0,0 +1,110 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/meta/model"
+	pmodel "github.com/pingcap/tidb/pkg/parser/model"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/variable"
+	"github.com/pingcap/tidb/pkg/statistics"
+	"github.com/pingcap/tidb/pkg/statistics/handle/logutil"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"go.uber.org/zap"
+)
+
+// AnalyzeNonIndexedGeneratedColumns indicates whether the stored generated columns that are not indexed are analyzed
+// when a job analyzes all columns of a non-partitioned table or a static partition.
+// Set it to false to exclude them, since their stats are not needed by any index, to reduce the cost of analyzing
+// the tables with many expression columns. It is opt-in because the column list is saved in mysql.analyze_options
+// if tidb_persist_analyze_options is on, see columnsToAnalyze.
+// The virtual generated columns are never analyzed, because they store no data.
+var AnalyzeNonIndexedGeneratedColumns = true
+
+// columnsToAnalyze returns the columns to analyze instead of all columns of the table,
+// i.e. all columns except the stored generated columns that are not indexed.
+// The virtual generated columns and the hidden columns of the expression indexes are not returned,
+// because TiDB never analyzes the former and always analyzes the indexed columns.
+//
+// It returns nil if all columns should be analyzed, which is the case when:
+//   - AnalyzeNonIndexedGeneratedColumns is true, which is the default;
+//   - the stats version is not 2, because version 1 always analyzes all columns;
+//   - tidb_analyze_column_options is not ALL, because listing the columns would analyze more than the predicate columns;
+//   - the table has no such stored generated column;
+//   - a column choice is saved in mysql.analyze_options for the table or the partition, which is chosen by the users.
+//
+// Note that the column list is saved in mysql.analyze_options if tidb_persist_analyze_options is on,
+// so the later analysis of the table reuses the list until the users choose the columns by themselves,
+// and the columns added after that are not analyzed unless they are indexed.
+func columnsToAnalyze(sctx sessionctx.Context, tableID, physicalID int64, statsVer int) []string {
+	if AnalyzeNonIndexedGeneratedColumns || statsVer != statistics.Version2 ||
+		variable.AnalyzeColumnOptions.Load() != pmodel.AllColumns.String() {
+		return nil
+	}
+	is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+	tbl, ok := is.TableByID(context.Background(), tableID)
+	if !ok {
+		return nil
+	}
+	tblInfo := tbl.Meta()
+	indexed := indexedColumnOffsets(tblInfo)
+	columns := make([]string, 0, len(tblInfo.Columns))
+	excluded := false
+	for _, col := range tblInfo.Cols() {
+		if col.Hidden || col.IsVirtualGenerated() {
+			continue
+		}
+		if _, ok := indexed[col.Offset]; col.IsGenerated() && !ok && !mysql.HasPriKeyFlag(col.GetFlag()) {
+			excluded = true
+			continue
+		}
+		columns = append(columns, col.Name.O)
+	}
+	if !excluded || len(columns) == 0 || hasSavedColumnChoice(sctx, tableID, physicalID) {
+		return nil
+	}
+	return columns
+}
+
+// indexedColumnOffsets returns the offsets of the columns used by any index of the table.
+func indexedColumnOffsets(tblInfo *model.TableInfo) map[int]struct{} {
+	offsets := make(map[int]struct{})
+	for _, idx := range tblInfo.Indices {
+		for _, col := range idx.Columns {
+			offsets[col.Offset] = struct{}{}
+		}
+	}
+	return offsets
+}
+
+// hasSavedColumnChoice checks whether a column choice is saved in mysql.analyze_options for the table or the partition.
+// It returns true if the analyze options cannot be read, so that the saved choice is never overridden by mistake.
+func hasSavedColumnChoice(sctx sessionctx.Context, tableID, physicalID int64) bool {
+	rows, _, err := statsutil.ExecRows(
+		sctx,
+		"select 1 from mysql.analyze_options where table_id in (%?, %?) and column_choice != 'DEFAULT' limit 1",
+		tableID,
+		physicalID,
+	)
+	if err != nil {
+		logutil.StatsLogger().Warn("Failed to check the saved column choice", zap.Int64("tableID", tableID), zap.Error(err))
+		return true
+	}
+	return len(rows) > 0
+}
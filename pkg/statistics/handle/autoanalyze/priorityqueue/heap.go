@@ -20,10 +20,15 @@
 // 5. Remove the thread-safe and blocking properties.
 // 6. Add a Len API.
 // 7. Remove the BulkAdd API.
+// 8. Add a removeIf API.
+// 9. Add a forEach API.
+// 10. Break the ties of the weights by the table ID.
+// 11. Order the jobs by the aging order key instead of the weight.
 
 package priorityqueue
 
 import (
+	"cmp"
 	"container/heap"
 
 	"github.com/pingcap/errors"
@@ -58,7 +63,18 @@ func (h *heapData) Less(i, j int) bool {
 	if !ok {
 		return false
 	}
-	return itemi.obj.GetWeight() > itemj.obj.GetWeight()
+	return compareJobs(itemi.obj, itemj.obj) < 0
+}
+
+// compareJobs compares the jobs in the order they are popped, i.e. it returns a negative number if a is popped before b.
+// The jobs are ordered by agingOrderKey, which is the weight with the aging boost taken into account.
+func compareJobs(a, b AnalysisJob) int {
+	if c := cmp.Compare(agingOrderKey(b), agingOrderKey(a)); c != 0 {
+		return c
+	}
+	// Break the ties by the table ID to make the order deterministic.
+	// The table ID is the key of the heap, so no two jobs have the same one.
+	return cmp.Compare(a.GetTableID(), b.GetTableID())
 }
 
 // Len is a standard heap interface function.
@@ -128,6 +144,38 @@ func (h *pqHeapImpl) delete(obj AnalysisJob) error {
 	return errors.New("object not found")
 }
 
+// removeIf removes all objects that satisfy the predicate from the heap.
+// It rebuilds the heap once after the removal, which is O(n) no matter how many objects are removed.
+func (h *pqHeapImpl) removeIf(pred func(AnalysisJob) bool) int {
+	kept := h.data.queue[:0]
+	removed := 0
+	for _, key := range h.data.queue {
+		item := h.data.items[key]
+		if pred(item.obj) {
+			delete(h.data.items, key)
+			removed++
+			continue
+		}
+		item.index = len(kept)
+		kept = append(kept, key)
+	}
+	if removed == 0 {
+		return 0
+	}
+	h.data.queue = kept
+	heap.Init(h.data)
+	return removed
+}
+
+// updateAll calls fn for each object in the heap, which may change the weights of the objects.
+// It rebuilds the heap once after that, which is O(n) no matter how many weights are changed.
+func (h *pqHeapImpl) updateAll(fn func(AnalysisJob)) {
+	for _, item := range h.data.items {
+		fn(item.obj)
+	}
+	heap.Init(h.data)
+}
+
 // peek returns the top object from the heap without removing it.
 func (h *pqHeapImpl) peek() (AnalysisJob, error) {
 	if len(h.data.queue) == 0 {
@@ -157,6 +205,14 @@ func (h *pqHeapImpl) list() []AnalysisJob {
 	return list
 }
 
+// forEach calls fn for each object in the heap in no particular order.
+// Unlike list, it does not allocate.
+func (h *pqHeapImpl) forEach(fn func(AnalysisJob)) {
+	for _, item := range h.data.items {
+		fn(item.obj)
+	}
+}
+
 // len returns the number of objects in the heap.
 func (h *pqHeapImpl) len() int {
 	return h.data.Len()
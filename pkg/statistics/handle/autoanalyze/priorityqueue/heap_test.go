@@ -20,11 +20,14 @@
 // 5. Remove concurrency and thread-safety tests.
 // 6. Add a test for the Len API.
 // 7. Remove the BulkAdd related tests.
+// 8. Add a test for the removeIf API.
 
 package priorityqueue
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
@@ -40,7 +43,37 @@ type testHeapObject struct {
 func (t testHeapObject) IsValidToAnalyze(sctx sessionctx.Context) (bool, string) {
 	panic("implement me")
 }
-func (t testHeapObject) Analyze(statsHandle statstypes.StatsHandle, sysProcTracker sysproctrack.Tracker) error {
+func (t testHeapObject) Analyze(ctx context.Context, statsHandle statstypes.StatsHandle, sysProcTracker sysproctrack.Tracker) error {
+	panic("implement me")
+}
+func (t testHeapObject) DryRun(sctx sessionctx.Context) ([]string, error) {
+	panic("implement me")
+}
+func (t testHeapObject) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error) {
+	panic("implement me")
+}
+func (t testHeapObject) Clone() AnalysisJob {
+	panic("implement me")
+}
+func (t testHeapObject) Equal(other AnalysisJob) bool {
+	panic("implement me")
+}
+func (t testHeapObject) Validate() error {
+	panic("implement me")
+}
+func (t testHeapObject) GetLastRunDuration() time.Duration {
+	panic("implement me")
+}
+func (t testHeapObject) GetLastFailureReason() string {
+	panic("implement me")
+}
+func (t testHeapObject) State() JobState {
+	panic("implement me")
+}
+func (t testHeapObject) IsLastFailureTransient() bool {
+	panic("implement me")
+}
+func (t testHeapObject) GetCorrelationID() string {
 	panic("implement me")
 }
 func (t testHeapObject) SetWeight(weight float64) {
@@ -49,6 +82,18 @@ func (t testHeapObject) SetWeight(weight float64) {
 func (t testHeapObject) GetWeight() float64 {
 	return t.val
 }
+func (t testHeapObject) GetBaseWeight() float64 {
+	return t.val
+}
+func (t testHeapObject) SetEnqueuedAt(enqueuedAt time.Time) {
+	panic("implement me")
+}
+func (t testHeapObject) GetEnqueuedAt() time.Time {
+	return time.Time{}
+}
+func (t testHeapObject) GetWeightBreakdown() map[string]float64 {
+	panic("implement me")
+}
 func (t testHeapObject) HasNewlyAddedIndex() bool {
 	panic("implement me")
 }
@@ -61,12 +106,42 @@ func (t testHeapObject) SetIndicators(indicators Indicators) {
 func (t testHeapObject) GetTableID() int64 {
 	return t.tableID
 }
+func (t testHeapObject) GetAnalyzeType() string {
+	panic("implement me")
+}
+func (t testHeapObject) EstimatedCost() float64 {
+	panic("implement me")
+}
+func (t testHeapObject) EstimatedMemoryBytes() int64 {
+	panic("implement me")
+}
+func (t testHeapObject) GetSchemaName() string {
+	panic("implement me")
+}
+func (t testHeapObject) GetTableName() string {
+	panic("implement me")
+}
+func (t testHeapObject) GetPartitionNames() []string {
+	panic("implement me")
+}
+func (t testHeapObject) GetGlobalTableID() int64 {
+	panic("implement me")
+}
 func (t testHeapObject) RegisterSuccessHook(hook JobHook) {
 	panic("implement me")
 }
 func (t testHeapObject) RegisterFailureHook(hook JobHook) {
 	panic("implement me")
 }
+func (t testHeapObject) RegisterProgressHook(hook ProgressHook) {
+	panic("implement me")
+}
+func (t testHeapObject) RegisterValidityHook(hook ValidityHook) {
+	panic("implement me")
+}
+func (t testHeapObject) SetTracer(tracer Tracer) {
+	panic("implement me")
+}
 func (t testHeapObject) String() string {
 	panic("implement me")
 }
@@ -115,6 +190,22 @@ func TestHeap_AddOrUpdate(t *testing.T) {
 	require.Equal(t, int64(2), item.GetTableID())
 }
 
+func TestHeapEqualWeights(t *testing.T) {
+	h := newHeap()
+	for _, tableID := range []int64{5, 3, 8, 1, 4} {
+		require.NoError(t, h.addOrUpdate(mkHeapObj(tableID, 10)))
+	}
+	require.NoError(t, h.addOrUpdate(mkHeapObj(7, 20)))
+
+	popped := make([]int64, 0, h.len())
+	for !h.isEmpty() {
+		item, err := h.pop()
+		require.NoError(t, err)
+		popped = append(popped, item.GetTableID())
+	}
+	require.Equal(t, []int64{7, 1, 3, 4, 5, 8}, popped)
+}
+
 func TestHeapEmptyPop(t *testing.T) {
 	h := newHeap()
 	_, err := h.pop()
@@ -315,3 +406,33 @@ func TestHeap_Len(t *testing.T) {
 	require.NoError(t, err)
 	require.Zero(t, h.len())
 }
+
+func TestHeap_RemoveIf(t *testing.T) {
+	h := newHeap()
+	require.Zero(t, h.removeIf(func(AnalysisJob) bool { return true }))
+	for i := int64(1); i <= 10; i++ {
+		err := h.addOrUpdate(mkHeapObj(i, float64(i)))
+		require.NoError(t, err)
+	}
+
+	// Remove all jobs with even table IDs.
+	removed := h.removeIf(func(job AnalysisJob) bool {
+		return job.GetTableID()%2 == 0
+	})
+	require.Equal(t, 5, removed)
+	require.Equal(t, 5, h.len())
+	_, exists, err := h.getByKey(2)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Zero(t, h.removeIf(func(AnalysisJob) bool { return false }))
+
+	// The heap invariant is restored and the objects can still be updated by key.
+	err = h.update(mkHeapObj(1, 100))
+	require.NoError(t, err)
+	for _, expected := range []int64{1, 9, 7, 5, 3} {
+		item, err := h.pop()
+		require.NoError(t, err)
+		require.Equal(t, expected, item.GetTableID())
+	}
+	require.True(t, h.isEmpty())
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// startJitter returns how long the job of the table waits after the queue is initialized
+// before it can be popped, see WithStartJitter.
+// It is in [0, window) and deterministic per table, so that the start order is reproducible.
+func startJitter(tableID int64, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	r := rand.New(rand.NewPCG(uint64(tableID), 0))
+	return time.Duration(r.Int64N(int64(window)))
+}
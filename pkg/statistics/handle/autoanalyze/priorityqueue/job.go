@@ -15,34 +15,384 @@
 package priorityqueue
 
 import (
+	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
+	"github.com/pingcap/tidb/pkg/sessionctx/variable"
+	"github.com/pingcap/tidb/pkg/statistics"
 	"github.com/pingcap/tidb/pkg/statistics/handle/logutil"
 	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"github.com/pingcap/tidb/pkg/util"
+	"github.com/pingcap/tidb/pkg/util/sqlescape"
 	"go.uber.org/zap"
 )
 
+// IndexAnalysisConcurrency is the max number of the index analyze statements of a job that run concurrently
+// under version 1, where each index is analyzed by a separate statement. It is also capped by
+// tidb_auto_analyze_concurrency, so that a job does not use more sessions than the whole auto analyze.
+// Set it to 1 to analyze the indexes one by one.
+var IndexAnalysisConcurrency = 4
+
 // defaultFailedAnalysisWaitTime is the default wait time for the next analysis after a failed analysis.
 // NOTE: this is only used when the average analysis duration is not available.(No successful analysis before)
 const defaultFailedAnalysisWaitTime = 30 * time.Minute
 
 type analyzeType string
 
+// analyzeTypeLabels maps the analyze types to the stable strings returned by AnalysisJob.GetAnalyzeType.
+// Do not change them, because they are used as metric labels.
+var analyzeTypeLabels = map[analyzeType]string{
+	analyzeTable:                  "table",
+	analyzeIndex:                  "index",
+	analyzeColumns:                "columns",
+	analyzeDynamicPartition:       "dynamic_partition",
+	analyzeDynamicPartitionIndex:  "dynamic_partition_index",
+	analyzeStaticPartition:        "static_partition",
+	analyzeStaticPartitionIndex:   "static_partition_index",
+	analyzeStaticPartitionColumns: "static_partition_columns",
+
+	analyzeStaticPartitionPredicateColumns: "static_partition_predicate_columns",
+	analyzeStaticPartitionQuick:            "static_partition_quick",
+
+	analyzeStaticPartitionedTableIndex: "static_partitioned_table_index",
+}
+
+func (t analyzeType) label() string {
+	return analyzeTypeLabels[t]
+}
+
 // Indicators contains some indicators to evaluate the table priority.
 type Indicators struct {
+	// LastAnalyzeTime is the time of the last analysis. Unlike LastAnalysisDuration, it does not change over time.
+	// It is the zero time if it is unknown, e.g. the job is not created from the stats of the table.
+	// For the unanalyzed tables, it is set to a short while ago, see unanalyzedTableDefaultLastUpdateDuration.
+	LastAnalyzeTime time.Time
 	// ChangePercentage is the percentage of the changed rows.
 	// Usually, the more the changed rows, the higher the priority.
 	// It is calculated by modifiedCount / last time analysis count.
 	ChangePercentage float64
 	// TableSize is the table size in rows * len(columns).
 	TableSize float64
+	// EstimatedRows is the estimated row count of the table, i.e. TableSize without the column factor.
+	// It is 0 if it is unknown, e.g. the job is created by an older version, then TableSize is used instead.
+	EstimatedRows int64
 	// LastAnalysisDuration is the duration from the last analysis to now.
 	LastAnalysisDuration time.Duration
 }
 
+// MergeIndicators combines the indicators of the partitions into the indicators of the whole table:
+//   - TableSize and EstimatedRows are the sums of the sizes and the rows of the partitions.
+//   - ChangePercentage is the average of the change percentages weighted by the sizes of the partitions.
+//     If all the partitions are empty, it is the plain average.
+//   - LastAnalysisDuration is the max one, i.e. the table is as stale as its stalest partition.
+//   - LastAnalyzeTime is the earliest known one, consistently with LastAnalysisDuration.
+//
+// It returns the zero Indicators if there is no partition.
+func MergeIndicators(parts []Indicators) Indicators {
+	var merged Indicators
+	if len(parts) == 0 {
+		return merged
+	}
+	weightedChange, totalChange := 0.0, 0.0
+	for _, part := range parts {
+		merged.TableSize += part.TableSize
+		merged.EstimatedRows += part.EstimatedRows
+		weightedChange += part.ChangePercentage * part.TableSize
+		totalChange += part.ChangePercentage
+		merged.LastAnalysisDuration = max(merged.LastAnalysisDuration, part.LastAnalysisDuration)
+		if !part.LastAnalyzeTime.IsZero() &&
+			(merged.LastAnalyzeTime.IsZero() || part.LastAnalyzeTime.Before(merged.LastAnalyzeTime)) {
+			merged.LastAnalyzeTime = part.LastAnalyzeTime
+		}
+	}
+	if merged.TableSize > 0 {
+		merged.ChangePercentage = weightedChange / merged.TableSize
+	} else {
+		merged.ChangePercentage = totalChange / float64(len(parts))
+	}
+	return merged
+}
+
+// mergeAnalysisJobs merges the incoming job into the existing job for the same table.
+// The incoming job carries the latest indicators, so it is used as the base
+// and the newly added indexes of the existing job are unioned into it.
+// If the two jobs are of different types, the incoming job is returned as is.
+func mergeAnalysisJobs(existing, incoming AnalysisJob) AnalysisJob {
+	switch in := incoming.(type) {
+	case *NonPartitionedTableAnalysisJob:
+		if ex, ok := existing.(*NonPartitionedTableAnalysisJob); ok {
+			merged := in.Clone().(*NonPartitionedTableAnalysisJob)
+			merged.Indexes = unionStrings(ex.Indexes, in.Indexes)
+			return merged
+		}
+	case *StaticPartitionedTableAnalysisJob:
+		if ex, ok := existing.(*StaticPartitionedTableAnalysisJob); ok {
+			merged := in.Clone().(*StaticPartitionedTableAnalysisJob)
+			merged.Indexes = unionStrings(ex.Indexes, in.Indexes)
+			return merged
+		}
+	case *StaticPartitionedTableIndexAnalysisJob:
+		if ex, ok := existing.(*StaticPartitionedTableIndexAnalysisJob); ok {
+			merged := in.Clone().(*StaticPartitionedTableIndexAnalysisJob)
+			merged.Indexes = unionStrings(ex.Indexes, in.Indexes)
+			for _, partition := range ex.Partitions {
+				if !slices.Contains(merged.Partitions, partition) {
+					merged.Partitions = append(merged.Partitions, partition)
+				}
+			}
+			return merged
+		}
+	case *DynamicPartitionedTableAnalysisJob:
+		if ex, ok := existing.(*DynamicPartitionedTableAnalysisJob); ok {
+			merged := in.Clone().(*DynamicPartitionedTableAnalysisJob)
+			merged.Partitions = unionStrings(ex.Partitions, in.Partitions)
+			for index, partitions := range ex.PartitionIndexes {
+				if merged.PartitionIndexes == nil {
+					merged.PartitionIndexes = make(map[string][]string, len(ex.PartitionIndexes))
+				}
+				merged.PartitionIndexes[index] = unionStrings(partitions, merged.PartitionIndexes[index])
+			}
+			return merged
+		}
+	}
+	return incoming
+}
+
+// unionStrings returns the union of a and b, keeping the order of the first occurrence.
+func unionStrings(a, b []string) []string {
+	if len(a) == 0 {
+		return slices.Clone(b)
+	}
+	result := slices.Clone(a)
+	for _, s := range b {
+		if !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// AnalyzeSQLParams is the typed form of the parameters of an analyze statement generated by the jobs.
+// The positional parameters of the statement are derived from it by Args,
+// so that the consumers do not depend on the order of the placeholders.
+type AnalyzeSQLParams struct {
+	TableSchema string
+	TableName   string
+	// Partitions are the partitions to analyze. It is empty if the whole table is analyzed.
+	Partitions []string
+	// Index is the index to analyze. It is empty if no index is specified.
+	Index string
+	// Columns are the columns to analyze. It is empty if the columns are not specified.
+	Columns []string
+}
+
+// Args returns the positional parameters of the analyze statement in the order of the placeholders,
+// i.e. the schema, the table, the partitions, the index and the columns.
+func (p AnalyzeSQLParams) Args() []any {
+	args := make([]any, 0, 3+len(p.Partitions)+len(p.Columns))
+	args = append(args, p.TableSchema, p.TableName)
+	for _, partition := range p.Partitions {
+		args = append(args, partition)
+	}
+	if p.Index != "" {
+		args = append(args, p.Index)
+	}
+	for _, column := range p.Columns {
+		args = append(args, column)
+	}
+	return args
+}
+
+// analyzeSQL is an analyze statement with its parameters.
+type analyzeSQL struct {
+	sql    string
+	params AnalyzeSQLParams
+}
+
+// collectAnalyzeSQLParams returns the typed parameters of the analyze statements.
+func collectAnalyzeSQLParams(sqls []analyzeSQL) []AnalyzeSQLParams {
+	params := make([]AnalyzeSQLParams, 0, len(sqls))
+	for _, s := range sqls {
+		params = append(params, s.params)
+	}
+	return params
+}
+
+// runAnalyzeSQLs executes the analyze statements of the job one by one in a span of the tracer.
+// Each statement is executed in a session from the pool with the session variables of the job, see autoAnalyze.
+// It stops at the first failed statement and returns its error, which is recorded in the span as well.
+func runAnalyzeSQLs(
+	ctx context.Context,
+	job AnalysisJob,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+	tracer Tracer,
+	statsVer int,
+	sessionVars SessionVariables,
+	sqls []analyzeSQL,
+) (err error) {
+	_, span := startAnalysisSpan(ctx, tracer, job)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+	logger := jobLogger(job)
+	if concurrency := indexAnalysisConcurrency(statsVer, sqls); concurrency > 1 {
+		return runIndexAnalyzeSQLsConcurrently(ctx, logger, statsHandle, sysProcTracker, statsVer, sessionVars, sqls, concurrency)
+	}
+	for _, s := range sqls {
+		if err := autoAnalyze(ctx, logger, statsHandle, sysProcTracker, statsVer, sessionVars, s.sql, s.params.Args()...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexAnalysisConcurrency returns how many analyze statements can run concurrently, see IndexAnalysisConcurrency.
+// Only the index analyze statements under version 1 are independent of each other.
+// Under version 2, analyzing an index analyzes the whole table or partitions as well.
+func indexAnalysisConcurrency(statsVer int, sqls []analyzeSQL) int {
+	if len(sqls) <= 1 || statsVer != statistics.Version1 {
+		return 1
+	}
+	for _, s := range sqls {
+		if s.params.Index == "" {
+			return 1
+		}
+	}
+	return max(min(len(sqls), IndexAnalysisConcurrency, int(variable.AutoAnalyzeConcurrency.Load())), 1)
+}
+
+// runIndexAnalyzeSQLsConcurrently executes the independent index analyze statements with the given concurrency.
+// Like the sequential execution, each statement is executed in a session from the pool with the session variables.
+// Unlike the sequential execution, a failed statement does not stop the others.
+// The first error is returned after all statements finish.
+func runIndexAnalyzeSQLsConcurrently(
+	ctx context.Context,
+	logger *zap.Logger,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+	statsVer int,
+	sessionVars SessionVariables,
+	sqls []analyzeSQL,
+	concurrency int,
+) error {
+	pending := make(chan analyzeSQL, len(sqls))
+	for _, s := range sqls {
+		pending <- s
+	}
+	close(pending)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	work := func() {
+		for s := range pending {
+			if err := autoAnalyze(ctx, logger, statsHandle, sysProcTracker, statsVer, sessionVars, s.sql, s.params.Args()...); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}
+	}
+	var wg util.WaitGroupWrapper
+	for range concurrency - 1 {
+		wg.Run(work)
+	}
+	work()
+	wg.Wait()
+	return firstErr
+}
+
+// SessionVariables is the session variables to override in the session that executes the analyze statements of a job,
+// e.g. {"tidb_analyze_partition_concurrency": "4"}. It maps the variable names to the values.
+type SessionVariables map[string]string
+
+// apply sets the session variables of the session and returns a function to restore the previous values.
+// If any variable fails to be set, the variables that have been set are restored and the error is returned.
+func (v SessionVariables) apply(logger *zap.Logger, sctx sessionctx.Context) (restore func(), err error) {
+	sessionVars := sctx.GetSessionVars()
+	names := slices.Sorted(maps.Keys(v))
+	oldValues := make([]string, 0, len(names))
+	restore = func() {
+		for i, oldValue := range oldValues {
+			if err := sessionVars.SetSystemVar(names[i], oldValue); err != nil {
+				logger.Error("Failed to restore the session variable",
+					zap.String("name", names[i]),
+					zap.String("value", oldValue),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+	for _, name := range names {
+		oldValue, err := sessionVars.SetSystemVarWithOldValAsRet(name, v[name])
+		if err != nil {
+			restore()
+			return nil, errors.Annotatef(err, "failed to set session variable %s", name)
+		}
+		oldValues = append(oldValues, oldValue)
+	}
+	return restore, nil
+}
+
+// genCorrelationID generates the correlation ID of a job.
+func genCorrelationID(tableID, partitionID int64, enqueuedAt time.Time) string {
+	var enqueuedAtNano int64
+	if !enqueuedAt.IsZero() {
+		enqueuedAtNano = enqueuedAt.UnixNano()
+	}
+	return fmt.Sprintf("%d-%d-%d", tableID, partitionID, enqueuedAtNano)
+}
+
+// jobLogger returns the stats logger with the correlation ID of the job attached.
+func jobLogger(job AnalysisJob) *zap.Logger {
+	return logutil.StatsLogger().With(zap.String("correlationID", job.GetCorrelationID()))
+}
+
+// escapeAnalyzeSQLs resolves the placeholders of the analyze statements.
+func escapeAnalyzeSQLs(sqls []analyzeSQL) ([]string, error) {
+	escaped := make([]string, 0, len(sqls))
+	for _, s := range sqls {
+		sql, err := sqlescape.EscapeSQL(s.sql, s.params.Args()...)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		escaped = append(escaped, sql)
+	}
+	return escaped, nil
+}
+
+// hasPredicateColumns checks whether any predicate column has been collected for the table.
+// It returns false if the column stats usage cannot be read.
+func hasPredicateColumns(sctx sessionctx.Context, tableID int64) bool {
+	rows, _, err := statsutil.ExecRows(
+		sctx,
+		"select 1 from mysql.column_stats_usage where table_id = %? and last_used_at is not null limit 1",
+		tableID,
+	)
+	if err != nil {
+		logutil.StatsLogger().Warn("Failed to check the predicate columns", zap.Int64("tableID", tableID), zap.Error(err))
+		return false
+	}
+	return len(rows) > 0
+}
+
 // JobHook is the successHook function that will be called after the job is completed.
 type JobHook func(job AnalysisJob)
 
@@ -52,43 +402,216 @@ type AnalysisJob interface {
 	// It checks the last failed analysis duration and the average analysis duration.
 	// If the last failed analysis duration is less than 2 times the average analysis duration,
 	// we skip this table to avoid too much failed analysis.
+	// After the built-in checks pass, the validity hook registered by RegisterValidityHook can veto the job with a custom reason.
 	IsValidToAnalyze(
 		sctx sessionctx.Context,
 	) (bool, string)
 
 	// Analyze executes the analyze statement within a transaction.
+	// If the context is canceled or expires, the running analyze statements are killed and
+	// the context error is returned. The job is marked as canceled so that it can be retried later, see JobStateCanceled.
+	// If the job runs longer than the timeout derived from EstimatedCost, the statements are killed as well,
+	// and ErrAnalyzeTimeout is returned. The job is marked as failed in this case.
+	// Once the job is analyzed successfully, analyzing it again only calls the success hook and returns nil,
+	// so that the caller can safely retry the job.
 	Analyze(
+		ctx context.Context,
 		statsHandle statstypes.StatsHandle,
 		sysProcTracker sysproctrack.Tracker,
 	) error
 
+	// DryRun returns the analyze statements that Analyze would execute, without executing them.
+	// The placeholders are resolved, so the statements can be executed directly.
+	DryRun(sctx sessionctx.Context) ([]string, error)
+
+	// GenAnalyzeSQLParams returns the typed parameters of the analyze statements that Analyze would execute,
+	// in the same order as the statements returned by DryRun.
+	GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error)
+
+	// Clone returns a deep copy of the job.
+	// Modifying the returned job does not affect the original one.
+	Clone() AnalysisJob
+
+	// Equal checks whether the job analyzes the same target as the other job.
+	// The type of the job, the table and partition identities, the indexes and the columns are compared.
+	// Hooks, indicators and weight are not compared.
+	Equal(other AnalysisJob) bool
+
+	// Validate checks whether the required fields of the job are set.
+	// It returns a descriptive error if the job is not valid to be pushed into the queue.
+	Validate() error
+
+	// GetLastRunDuration gets the wall-clock time spent on executing the analyze statements in the last run.
+	// It is set before the success or failure hook is called, so the hooks can use it.
+	GetLastRunDuration() time.Duration
+
+	// GetLastFailureReason gets the reason why the job failed last time.
+	// It is set when the analyze statements fail or IsValidToAnalyze rejects the job.
+	// It returns an empty string if the job has never failed.
+	GetLastFailureReason() string
+
+	// State gets the state of the job in its lifecycle.
+	// A job is queued when it is pushed into the queue, running when it is popped or analyzed,
+	// and then succeeded or failed depending on the analyze statements, or skipped if IsValidToAnalyze rejects it.
+	// It is safe to call concurrently with the state transitions.
+	State() JobState
+
+	// IsLastFailureTransient checks whether the analyze statements failed with a transient error last time,
+	// such as lock conflicts or a busy server, which is likely to disappear by itself.
+	IsLastFailureTransient() bool
+
+	// GetCorrelationID gets the ID to correlate all logs of the job, from being queued to being finished.
+	// It is derived from the table ID, the partition ID and the enqueue time, so it is stable during the lifetime of the job.
+	GetCorrelationID() string
+
 	// SetWeight sets the weight of the job.
+	// The weight is clamped into [MinJobWeight, MaxJobWeight].
 	SetWeight(weight float64)
 
 	// GetWeight gets the weight of the job.
+	// It is the weight set by SetWeight plus a boost proportional to the time the job has been waiting in the queue,
+	// clamped into [MinJobWeight, MaxJobWeight].
+	// The queue does not order the jobs by it, because it depends on the current time, see WeightAgingCoefficient.
 	GetWeight() float64
 
+	// GetBaseWeight gets the weight set by SetWeight, without the aging boost.
+	GetBaseWeight() float64
+
+	// SetEnqueuedAt sets the time when the job is pushed into the queue.
+	SetEnqueuedAt(enqueuedAt time.Time)
+
+	// GetEnqueuedAt gets the time when the job is pushed into the queue.
+	// It returns the zero time if the job has never been pushed.
+	GetEnqueuedAt() time.Time
+
+	// GetWeightBreakdown gets the individual contributions to the weight of the job.
+	// It is calculated from the current indicators, so it is useful to explain the priority of the job.
+	GetWeightBreakdown() map[string]float64
+
 	// HasNewlyAddedIndex checks whether the job has newly added index.
 	HasNewlyAddedIndex() bool
 
 	// GetIndicators gets the indicators of the job.
 	GetIndicators() Indicators
 
-	// SetIndicators sets the indicators of the job.
+	// SetIndicators sets the indicators of the job. It does not recalculate the weight,
+	// because the weight depends on the calculator and the hot tables of the queue.
+	// The queue recalculates the weight when the job is pushed, so do not call it on a job in the queue,
+	// use AnalysisPriorityQueue.Update instead to recalculate the weight and keep the queue ordered.
 	SetIndicators(indicators Indicators)
 
 	// GetTableID gets the table ID of the job.
 	GetTableID() int64
 
+	// GetGlobalTableID gets the ID of the table that the job belongs to, so that the jobs of the partitions
+	// can be grouped by their table without knowing the type of the jobs.
+	// For the non-partitioned tables, it is the same as the table ID.
+	GetGlobalTableID() int64
+
+	// EstimatedCost estimates the resources used by the job in a normalized cost unit.
+	// It is derived from the table size, the estimated rows, the number of indexes and the number of columns to analyze.
+	// See estimateCost for the cost model.
+	EstimatedCost() float64
+
+	// EstimatedMemoryBytes estimates the peak memory in bytes used by the job, e.g. to keep the running jobs
+	// within a memory quota. It is derived from the table size, the estimated rows, the number of columns
+	// and the number of histogram buckets and TopN values. See estimateMemoryBytes for the memory model and its limitations.
+	EstimatedMemoryBytes() int64
+
+	// GetAnalyzeType returns what the job analyzes, e.g. "static_partition" or "static_partition_index".
+	// The returned string is stable and can be used as a metric label.
+	GetAnalyzeType() string
+
+	// GetSchemaName gets the schema name of the table.
+	GetSchemaName() string
+
+	// GetTableName gets the table name of the job.
+	// For the partitioned tables, it is the name of the global table.
+	GetTableName() string
+
+	// GetPartitionNames gets the names of the partitions analyzed by the job, so that the jobs
+	// analyzing one or many partitions can be handled in the same way.
+	// It returns nil for the non-partitioned tables.
+	GetPartitionNames() []string
+
 	// RegisterSuccessHook registers a successHook function that will be called after the job can be marked as successful.
 	RegisterSuccessHook(hook JobHook)
 
 	// RegisterFailureHook registers a successHook function that will be called after the job is marked as failed.
+	// It is also called after the job is marked as canceled, and the hook can tell it by State.
 	RegisterFailureHook(hook JobHook)
 
+	// RegisterProgressHook registers a progressHook function that will be called periodically while the job is running.
+	// It is also called once after the job is finished.
+	RegisterProgressHook(hook ProgressHook)
+
+	// RegisterValidityHook registers a validityHook function that is consulted by IsValidToAnalyze
+	// after its built-in checks pass.
+	RegisterValidityHook(hook ValidityHook)
+
+	// SetTracer sets the Tracer that traces the execution of the analyze statements of the job.
+	// nil means the execution is not traced.
+	SetTracer(tracer Tracer)
+
 	fmt.Stringer
 }
 
+// ValidationResult is the result of checking whether a job is valid to analyze, see ValidateJobs.
+type ValidationResult struct {
+	// FailReason is the reason why the job is invalid. It is empty if the job is valid.
+	FailReason string
+	// Valid indicates whether the job is valid to analyze.
+	Valid bool
+}
+
+// infoSchemaValidator is implemented by the jobs that look up the info schema to check whether they are valid to analyze,
+// so that ValidateJobs can share one info schema snapshot among them.
+type infoSchemaValidator interface {
+	isValidToAnalyzeWithInfoSchema(sctx sessionctx.Context, is infoschema.InfoSchema) (bool, string)
+}
+
+// ValidateJobs checks whether each job is valid to analyze like AnalysisJob.IsValidToAnalyze,
+// and returns the results in the same order as the jobs.
+// All jobs are checked against the same info schema snapshot, which is fetched only once,
+// so it is much cheaper than checking the jobs one by one when there are many partitions, e.g. after the owner changes.
+func ValidateJobs(sctx sessionctx.Context, jobs []AnalysisJob) []ValidationResult {
+	is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+	results := make([]ValidationResult, 0, len(jobs))
+	for _, job := range jobs {
+		var result ValidationResult
+		if v, ok := job.(infoSchemaValidator); ok {
+			result.Valid, result.FailReason = v.isValidToAnalyzeWithInfoSchema(sctx, is)
+		} else {
+			result.Valid, result.FailReason = job.IsValidToAnalyze(sctx)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ValidityHook is an additional predicate of whether the job is valid to analyze, see WithValidityHook.
+// It returns false with a custom reason to veto the job.
+type ValidityHook func(job AnalysisJob) (bool, string)
+
+// checkValidityHook checks the job with the validity hook registered to it. nil means no additional check.
+func checkValidityHook(job AnalysisJob, hook ValidityHook) (bool, string) {
+	if hook == nil {
+		return true, ""
+	}
+	valid, failReason := hook(job)
+	if !valid {
+		logutil.SingletonStatsSamplerLogger().Info(
+			"Skip analysis because the job is vetoed by the validity hook",
+			zap.String("reason", failReason),
+			zap.String("schema", job.GetSchemaName()),
+			zap.String("table", job.GetTableName()),
+			zap.Strings("partitions", job.GetPartitionNames()),
+			zap.String("correlationID", job.GetCorrelationID()),
+		)
+	}
+	return valid, failReason
+}
+
 // isValidToAnalyze checks whether the table is valid to analyze.
 // It checks the last failed analysis duration and the average analysis duration.
 // If the last failed analysis duration is less than 2 times the average analysis duration,
@@ -169,6 +692,20 @@ func isValidToAnalyze(
 	return true, ""
 }
 
+// formatWeightBreakdown formats the weight breakdown in a stable order.
+func formatWeightBreakdown(breakdown map[string]float64) string {
+	keys := make([]string, 0, len(breakdown))
+	for key := range breakdown {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %.6f", key, breakdown[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // IsDynamicPartitionedTableAnalysisJob checks whether the job is a dynamic partitioned table analysis job.
 func IsDynamicPartitionedTableAnalysisJob(job AnalysisJob) bool {
 	_, ok := job.(*DynamicPartitionedTableAnalysisJob)
@@ -0,0 +1,80 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pingcap/errors"
+)
+
+// analysisJobRegistry maps the analyze type to the constructor of the concrete job.
+// It is used to decode a serialized job back to the right struct.
+var analysisJobRegistry = map[analyzeType]func() AnalysisJob{
+	analyzeTable:                  func() AnalysisJob { return &NonPartitionedTableAnalysisJob{} },
+	analyzeIndex:                  func() AnalysisJob { return &NonPartitionedTableAnalysisJob{} },
+	analyzeColumns:                func() AnalysisJob { return &NonPartitionedTableAnalysisJob{} },
+	analyzeDynamicPartition:       func() AnalysisJob { return &DynamicPartitionedTableAnalysisJob{} },
+	analyzeDynamicPartitionIndex:  func() AnalysisJob { return &DynamicPartitionedTableAnalysisJob{} },
+	analyzeStaticPartition:        func() AnalysisJob { return &StaticPartitionedTableAnalysisJob{} },
+	analyzeStaticPartitionIndex:   func() AnalysisJob { return &StaticPartitionedTableAnalysisJob{} },
+	analyzeStaticPartitionColumns: func() AnalysisJob { return &StaticPartitionedTableAnalysisJob{} },
+
+	analyzeStaticPartitionPredicateColumns: func() AnalysisJob { return &StaticPartitionedTableAnalysisJob{} },
+	analyzeStaticPartitionQuick:            func() AnalysisJob { return &StaticPartitionedTableAnalysisJob{} },
+
+	analyzeStaticPartitionedTableIndex: func() AnalysisJob { return &StaticPartitionedTableIndexAnalysisJob{} },
+}
+
+// jobTypeHeader is the common header of all serialized jobs.
+type jobTypeHeader struct {
+	AnalyzeType analyzeType
+}
+
+// UnmarshalAnalysisJob decodes a job serialized by json.Marshal.
+// It uses the analyze type of the serialized job to decide which job type to create.
+// Note: The hooks are not serialized, so they must be registered again.
+func UnmarshalAnalysisJob(data []byte) (AnalysisJob, error) {
+	var header jobTypeHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	newJob, ok := analysisJobRegistry[header.AnalyzeType]
+	if !ok {
+		return nil, errors.Errorf("unknown analyze type %q", header.AnalyzeType)
+	}
+	job := newJob()
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return job, nil
+}
+
+// checkAnalyzeType checks whether the serialized analyze type belongs to the job.
+func checkAnalyzeType(data []byte, job AnalysisJob) error {
+	var header jobTypeHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return errors.Trace(err)
+	}
+	newJob, ok := analysisJobRegistry[header.AnalyzeType]
+	if !ok {
+		return errors.Errorf("unknown analyze type %q", header.AnalyzeType)
+	}
+	if reflect.TypeOf(newJob()) != reflect.TypeOf(job) {
+		return errors.Errorf("analyze type %q does not match the job type %T", header.AnalyzeType, job)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalysisJobJSONRoundTrip(t *testing.T) {
+	indicators := priorityqueue.Indicators{
+		ChangePercentage:     0.5,
+		TableSize:            1000,
+		LastAnalysisDuration: time.Hour,
+	}
+	jobs := []priorityqueue.AnalysisJob{
+		&priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   "test",
+			TableName:     "t",
+			TableID:       1,
+			TableStatsVer: 2,
+			Indicators:    indicators,
+			Weight:        1.5,
+		},
+		&priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   "test",
+			TableName:     "t",
+			TableID:       1,
+			Indexes:       []string{"idx"},
+			TableStatsVer: 1,
+			Indicators:    indicators,
+			Weight:        2,
+		},
+		&priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   "test",
+			TableName:     "t",
+			TableID:       1,
+			Columns:       []string{"a"},
+			TableStatsVer: 2,
+			Indicators:    indicators,
+			Weight:        2.5,
+		},
+		&priorityqueue.DynamicPartitionedTableAnalysisJob{
+			TableSchema:     "test",
+			GlobalTableName: "t",
+			GlobalTableID:   2,
+			Partitions:      []string{"p0", "p1"},
+			TableStatsVer:   2,
+			Indicators:      indicators,
+			Weight:          3,
+		},
+		&priorityqueue.DynamicPartitionedTableAnalysisJob{
+			TableSchema:      "test",
+			GlobalTableName:  "t",
+			GlobalTableID:    2,
+			PartitionIndexes: map[string][]string{"idx": {"p0"}},
+			TableStatsVer:    2,
+			Indicators:       indicators,
+			Weight:           4,
+		},
+		&priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			GlobalTableID:       3,
+			StaticPartitionName: "p0",
+			StaticPartitionID:   4,
+			Columns:             []string{"a", "b"},
+			TableStatsVer:       2,
+			Indicators:          indicators,
+			Weight:              5,
+		},
+		&priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+			TableSchema:     "test",
+			GlobalTableName: "t",
+			GlobalTableID:   3,
+			Indexes:         []string{"idx"},
+			Partitions: []priorityqueue.PartitionIDAndName{
+				priorityqueue.NewPartitionIDAndName("p0", 4),
+				priorityqueue.NewPartitionIDAndName("p1", 5),
+			},
+			TableStatsVer: 2,
+			Indicators:    indicators,
+			Weight:        6,
+		},
+	}
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		require.NoError(t, err)
+		decoded, err := priorityqueue.UnmarshalAnalysisJob(data)
+		require.NoError(t, err)
+		require.Equal(t, job, decoded)
+		require.Equal(t, job.GetIndicators(), decoded.GetIndicators())
+		require.Equal(t, job.GetWeight(), decoded.GetWeight())
+		require.Equal(t, job.String(), decoded.String())
+	}
+}
+
+func TestUnmarshalAnalysisJobWithWrongType(t *testing.T) {
+	_, err := priorityqueue.UnmarshalAnalysisJob([]byte(`{"AnalyzeType":"unknown"}`))
+	require.ErrorContains(t, err, `unknown analyze type "unknown"`)
+
+	data, err := json.Marshal(&priorityqueue.NonPartitionedTableAnalysisJob{TableSchema: "test", TableName: "t"})
+	require.NoError(t, err)
+	var job priorityqueue.StaticPartitionedTableAnalysisJob
+	err = json.Unmarshal(data, &job)
+	require.ErrorContains(t, err, `analyze type "analyzeTable" does not match the job type`)
+}
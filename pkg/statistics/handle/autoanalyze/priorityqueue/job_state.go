@@ -0,0 +1,81 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import "sync/atomic"
+
+// JobState is the state of an analysis job in its lifecycle, see AnalysisJob.State.
+type JobState int32
+
+const (
+	// JobStateQueued means the job waits to run. It is the initial state,
+	// and the job is back to it whenever it is pushed into the queue again.
+	JobStateQueued JobState = iota
+	// JobStateRunning means the job is popped from the queue or being analyzed.
+	JobStateRunning
+	// JobStateSucceeded means the job is analyzed successfully.
+	JobStateSucceeded
+	// JobStateFailed means the analyze statements of the job failed.
+	JobStateFailed
+	// JobStateSkipped means the job is rejected by AnalysisJob.IsValidToAnalyze without running.
+	JobStateSkipped
+	// JobStateCanceled means the job is interrupted by its context, e.g. when the owner steps down.
+	// It is neither a success nor a failure. The failure hook is called, and the queue requeues the job
+	// without counting the failure towards the circuit breaker.
+	JobStateCanceled
+)
+
+// String implements fmt.Stringer.
+func (s JobState) String() string {
+	switch s {
+	case JobStateQueued:
+		return "queued"
+	case JobStateRunning:
+		return "running"
+	case JobStateSucceeded:
+		return "succeeded"
+	case JobStateFailed:
+		return "failed"
+	case JobStateSkipped:
+		return "skipped"
+	case JobStateCanceled:
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// jobState holds the state of a job.
+// The state is read and written atomically, because the hooks and the inspecting APIs
+// may access the job from other goroutines while it is running.
+// It is a plain int32 rather than atomic.Int32, so that the jobs can still be cloned by copying.
+type jobState struct {
+	state int32
+}
+
+func (s *jobState) load() JobState {
+	return JobState(atomic.LoadInt32(&s.state))
+}
+
+func (s *jobState) store(state JobState) {
+	atomic.StoreInt32(&s.state, int32(state))
+}
+
+// setJobState sets the state of the job if the job maintains its state, see AnalysisJob.State.
+func setJobState(job AnalysisJob, state JobState) {
+	if j, ok := job.(interface{ setState(JobState) }); ok {
+		j.setState(state)
+	}
+}
@@ -16,6 +16,7 @@ package priorityqueue_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
 	"github.com/stretchr/testify/require"
@@ -39,7 +40,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "NonPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeTable\n\tIndexes: \n\tSchema: test_schema\n\tTable: test_table\n\tTableID: 1\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "NonPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeTable\n\tIndexes: \n\tColumns: \n\tSchema: test_schema\n\tTable: test_table\n\tTableID: 1\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 0.000000, table_size: 0.100000\n\tCorrelationID: 1-0-0\n",
 		},
 		{
 			name: "analyze non-partitioned table index",
@@ -54,7 +55,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "NonPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeIndex\n\tIndexes: idx\n\tSchema: test_schema\n\tTable: test_table\n\tTableID: 2\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "NonPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeIndex\n\tIndexes: idx\n\tColumns: \n\tSchema: test_schema\n\tTable: test_table\n\tTableID: 2\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 2.000000, table_size: 0.100000\n\tCorrelationID: 2-0-0\n",
 		},
 		{
 			name: "analyze dynamic partition",
@@ -69,7 +70,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "DynamicPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeDynamicPartition\n\tPartitions: p0, p1\n\tPartitionIndexes: map[]\n\tSchema: test_schema\n\tGlobal Table: test_table\n\tGlobal TableID: 3\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "DynamicPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeDynamicPartition\n\tPartitions: p0, p1\n\tPartitionIndexes: map[]\n\tSchema: test_schema\n\tGlobal Table: test_table\n\tGlobal TableID: 3\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 0.000000, table_size: 0.100000\n\tCorrelationID: 3-0-0\n",
 		},
 		{
 			name: "analyze dynamic partition's indexes",
@@ -86,7 +87,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "DynamicPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeDynamicPartitionIndex\n\tPartitions: \n\tPartitionIndexes: map[idx:[p0 p1]]\n\tSchema: test_schema\n\tGlobal Table: test_table\n\tGlobal TableID: 4\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "DynamicPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeDynamicPartitionIndex\n\tPartitions: \n\tPartitionIndexes: map[idx:[p0 p1]]\n\tSchema: test_schema\n\tGlobal Table: test_table\n\tGlobal TableID: 4\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 2.000000, table_size: 0.100000\n\tCorrelationID: 4-0-0\n",
 		},
 		{
 			name: "analyze static partition",
@@ -102,7 +103,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "StaticPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeStaticPartition\n\tIndexes: \n\tSchema: test_schema\n\tGlobalTable: test_table\n\tGlobalTableID: 5\n\tStaticPartition: p0\n\tStaticPartitionID: 6\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "StaticPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeStaticPartition\n\tIndexes: \n\tGlobalIndexes: \n\tColumns: \n\tSchema: test_schema\n\tGlobalTable: test_table\n\tGlobalTableID: 5\n\tStaticPartition: p0\n\tStaticPartitionID: 6\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 0.000000, table_size: 0.100000\n\tCorrelationID: 5-6-0\n",
 		},
 		{
 			name: "analyze static partition's index",
@@ -119,7 +120,7 @@ func TestStringer(t *testing.T) {
 					ChangePercentage: 0.5,
 				},
 			},
-			want: "StaticPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeStaticPartitionIndex\n\tIndexes: idx\n\tSchema: test_schema\n\tGlobalTable: test_table\n\tGlobalTableID: 7\n\tStaticPartition: p0\n\tStaticPartitionID: 8\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n",
+			want: "StaticPartitionedTableAnalysisJob:\n\tAnalyzeType: analyzeStaticPartitionIndex\n\tIndexes: idx\n\tGlobalIndexes: \n\tColumns: \n\tSchema: test_schema\n\tGlobalTable: test_table\n\tGlobalTableID: 7\n\tStaticPartition: p0\n\tStaticPartitionID: 8\n\tTableStatsVer: 1\n\tChangePercentage: 0.500000\n\tTableSize: 0.00\n\tLastAnalysisDuration: 0s\n\tWeight: 1.999999\n\tWeightBreakdown: analysis_interval: 0.000000, change_ratio: 1.024542, special_event: 2.000000, table_size: 0.100000\n\tCorrelationID: 7-8-0\n",
 		},
 	}
 	for _, tt := range tests {
@@ -159,3 +160,347 @@ func TestIsDynamicPartitionedTableAnalysisJob(t *testing.T) {
 		})
 	}
 }
+
+func TestClone(t *testing.T) {
+	indicators := priorityqueue.Indicators{ChangePercentage: 0.5, TableSize: 100}
+
+	nonPartitioned := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test",
+		TableName:   "t",
+		Indexes:     []string{"idx"},
+		Indicators:  indicators,
+		Weight:      1,
+	}
+	cloned := nonPartitioned.Clone().(*priorityqueue.NonPartitionedTableAnalysisJob)
+	require.Equal(t, nonPartitioned, cloned)
+	cloned.Indexes[0] = "idx1"
+	cloned.Indexes = append(cloned.Indexes, "idx2")
+	cloned.ChangePercentage = 1
+	cloned.SetWeight(2)
+	require.Equal(t, []string{"idx"}, nonPartitioned.Indexes)
+	require.Equal(t, indicators, nonPartitioned.GetIndicators())
+	require.Equal(t, float64(1), nonPartitioned.GetWeight())
+
+	static := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		Indexes:             []string{"idx"},
+		Columns:             []string{"a"},
+		Indicators:          indicators,
+	}
+	clonedStatic := static.Clone().(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	require.Equal(t, static, clonedStatic)
+	clonedStatic.Indexes[0] = "idx1"
+	clonedStatic.Columns[0] = "b"
+	clonedStatic.SetIndicators(priorityqueue.Indicators{})
+	require.Equal(t, []string{"idx"}, static.Indexes)
+	require.Equal(t, []string{"a"}, static.Columns)
+	require.Equal(t, indicators, static.GetIndicators())
+
+	dynamic := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		TableSchema:      "test",
+		GlobalTableName:  "t",
+		Partitions:       []string{"p0"},
+		PartitionIndexes: map[string][]string{"idx": {"p0"}},
+		Indicators:       indicators,
+	}
+	clonedDynamic := dynamic.Clone().(*priorityqueue.DynamicPartitionedTableAnalysisJob)
+	require.Equal(t, dynamic, clonedDynamic)
+	clonedDynamic.Partitions[0] = "p1"
+	clonedDynamic.PartitionIndexes["idx"][0] = "p1"
+	clonedDynamic.PartitionIndexes["idx1"] = []string{"p1"}
+	clonedDynamic.TableSize = 0
+	require.Equal(t, []string{"p0"}, dynamic.Partitions)
+	require.Equal(t, map[string][]string{"idx": {"p0"}}, dynamic.PartitionIndexes)
+	require.Equal(t, indicators, dynamic.GetIndicators())
+}
+
+func TestEqual(t *testing.T) {
+	nonPartitioned := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test",
+		TableName:   "t",
+		TableID:     1,
+		Indexes:     []string{"idx"},
+	}
+	other := nonPartitioned.Clone().(*priorityqueue.NonPartitionedTableAnalysisJob)
+	// Hooks, indicators and weight are not compared.
+	other.RegisterSuccessHook(func(priorityqueue.AnalysisJob) {})
+	other.SetIndicators(priorityqueue.Indicators{ChangePercentage: 0.5})
+	other.SetWeight(2)
+	require.True(t, nonPartitioned.Equal(other))
+	other.Indexes = append(other.Indexes, "idx1")
+	require.False(t, nonPartitioned.Equal(other))
+
+	static := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       1,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   2,
+		Columns:             []string{"a"},
+	}
+	otherStatic := static.Clone().(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	require.True(t, static.Equal(otherStatic))
+	otherStatic.StaticPartitionName = "p1"
+	require.False(t, static.Equal(otherStatic))
+	otherStatic = static.Clone().(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	otherStatic.Columns = []string{"b"}
+	require.False(t, static.Equal(otherStatic))
+
+	dynamic := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		TableSchema:      "test",
+		GlobalTableName:  "t",
+		GlobalTableID:    1,
+		Partitions:       []string{"p0"},
+		PartitionIndexes: map[string][]string{"idx": {"p0"}},
+	}
+	otherDynamic := dynamic.Clone().(*priorityqueue.DynamicPartitionedTableAnalysisJob)
+	require.True(t, dynamic.Equal(otherDynamic))
+	otherDynamic.PartitionIndexes["idx"] = []string{"p1"}
+	require.False(t, dynamic.Equal(otherDynamic))
+
+	// Jobs of different types are never equal.
+	require.False(t, nonPartitioned.Equal(dynamic))
+	require.False(t, dynamic.Equal(static))
+	require.False(t, static.Equal(nil))
+}
+
+func TestCorrelationID(t *testing.T) {
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		GlobalTableID:     1,
+		StaticPartitionID: 2,
+	}
+	require.Equal(t, "1-2-0", job.GetCorrelationID())
+
+	enqueuedAt := time.Unix(0, 1000)
+	job.SetEnqueuedAt(enqueuedAt)
+	id := job.GetCorrelationID()
+	require.Equal(t, "1-2-1000", id)
+	require.Contains(t, job.String(), "CorrelationID: 1-2-1000")
+	// The ID does not change during the lifetime of the job.
+	job.SetWeight(10)
+	job.SetIndicators(priorityqueue.Indicators{ChangePercentage: 0.5})
+	require.Equal(t, id, job.GetCorrelationID())
+	require.Equal(t, id, job.Clone().GetCorrelationID())
+
+	// Jobs of different tables or enqueued at different times have different IDs.
+	other := &priorityqueue.NonPartitionedTableAnalysisJob{TableID: 1, EnqueuedAt: enqueuedAt}
+	require.NotEqual(t, id, other.GetCorrelationID())
+	other.SetEnqueuedAt(enqueuedAt.Add(time.Second))
+	require.Equal(t, "1-0-1000001000", other.GetCorrelationID())
+}
+
+func TestValidate(t *testing.T) {
+	nonPartitioned := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test",
+		TableName:   "t",
+		TableID:     1,
+	}
+	require.NoError(t, nonPartitioned.Validate())
+	nonPartitioned.TableName = ""
+	require.ErrorContains(t, nonPartitioned.Validate(), "table name is empty")
+
+	dynamic := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		TableSchema:     "test",
+		GlobalTableName: "t",
+	}
+	require.ErrorContains(t, dynamic.Validate(), "global table ID 0 is not positive")
+	dynamic.GlobalTableID = 1
+	require.NoError(t, dynamic.Validate())
+
+	static := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		StaticPartitionID:   2,
+	}
+	require.ErrorContains(t, static.Validate(), "table schema is empty")
+	static.TableSchema = "test"
+	require.NoError(t, static.Validate())
+	static.AnalyzeOptions.SampleRate = 2
+	require.ErrorContains(t, static.Validate(), "sample rate 2 is out of range")
+}
+
+func TestGetSchemaAndTableName(t *testing.T) {
+	jobs := []priorityqueue.AnalysisJob{
+		&priorityqueue.NonPartitionedTableAnalysisJob{TableSchema: "test", TableName: "t"},
+		&priorityqueue.DynamicPartitionedTableAnalysisJob{TableSchema: "test", GlobalTableName: "t"},
+		&priorityqueue.StaticPartitionedTableAnalysisJob{TableSchema: "test", GlobalTableName: "t", StaticPartitionName: "p0"},
+	}
+	for _, job := range jobs {
+		require.Equal(t, "test", job.GetSchemaName())
+		require.Equal(t, "t", job.GetTableName())
+	}
+}
+
+func TestGetPartitionNames(t *testing.T) {
+	require.Nil(t, (&priorityqueue.NonPartitionedTableAnalysisJob{TableName: "t"}).GetPartitionNames())
+	require.Equal(t, []string{"p0"}, (&priorityqueue.StaticPartitionedTableAnalysisJob{StaticPartitionName: "p0"}).GetPartitionNames())
+	require.Equal(t, []string{"p1", "p0"}, (&priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+		Partitions: []priorityqueue.PartitionIDAndName{
+			priorityqueue.NewPartitionIDAndName("p1", 2),
+			priorityqueue.NewPartitionIDAndName("p0", 1),
+		},
+	}).GetPartitionNames())
+	dynamic := &priorityqueue.DynamicPartitionedTableAnalysisJob{
+		Partitions:       []string{"p1", "p0"},
+		PartitionIndexes: map[string][]string{"idx": {"p2", "p0"}},
+	}
+	require.Equal(t, []string{"p0", "p1", "p2"}, dynamic.GetPartitionNames())
+	// The job is not modified.
+	require.Equal(t, []string{"p1", "p0"}, dynamic.Partitions)
+}
+
+func TestGetGlobalTableID(t *testing.T) {
+	tests := []struct {
+		job           priorityqueue.AnalysisJob
+		globalTableID int64
+	}{
+		{&priorityqueue.NonPartitionedTableAnalysisJob{TableID: 1}, 1},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{GlobalTableID: 2}, 2},
+		// The job of a static partition is grouped by its table instead of the partition.
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{GlobalTableID: 3, StaticPartitionID: 4}, 3},
+		{&priorityqueue.StaticPartitionedTableIndexAnalysisJob{GlobalTableID: 5}, 5},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.globalTableID, tt.job.GetGlobalTableID())
+	}
+}
+
+func TestGetAnalyzeType(t *testing.T) {
+	tests := []struct {
+		job  priorityqueue.AnalysisJob
+		want string
+	}{
+		{&priorityqueue.NonPartitionedTableAnalysisJob{}, "table"},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indexes: []string{"idx"}}, "index"},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Columns: []string{"a"}}, "columns"},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{}, "dynamic_partition"},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{
+			PartitionIndexes: map[string][]string{"idx": {"p0"}},
+		}, "dynamic_partition_index"},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{}, "static_partition"},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{Indexes: []string{"idx"}}, "static_partition_index"},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{Columns: []string{"a"}}, "static_partition_columns"},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{PredicateColumns: true}, "static_partition_predicate_columns"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tt.job.GetAnalyzeType())
+	}
+}
+
+func TestEstimatedCost(t *testing.T) {
+	// 10M cells is one cost unit.
+	indicators := priorityqueue.Indicators{TableSize: 10_000_000}
+	tests := []struct {
+		job  priorityqueue.AnalysisJob
+		want float64
+	}{
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators}, 1},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators, Indexes: []string{"idx1", "idx2"}}, 0.6},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators, Columns: []string{"a", "b"}}, 0.6},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators, Columns: make([]string, 20)}, 1},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{Indicators: indicators, Partitions: []string{"p0"}}, 1},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{
+			Indicators:       indicators,
+			PartitionIndexes: map[string][]string{"idx": {"p0"}},
+		}, 0.3},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{Indicators: indicators}, 1},
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{Indicators: indicators, Indexes: []string{"idx"}}, 0.3},
+		// Every job has a minimum cost.
+		{&priorityqueue.NonPartitionedTableAnalysisJob{}, 0.01},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: priorityqueue.Indicators{TableSize: -1}}, 0.01},
+		// Every row costs one more cell if the estimated rows are known.
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: priorityqueue.Indicators{
+			TableSize:     9_000_000,
+			EstimatedRows: 1_000_000,
+		}}, 1},
+	}
+	for _, tt := range tests {
+		require.InDelta(t, tt.want, tt.job.EstimatedCost(), 1e-9, tt.job.GetAnalyzeType())
+	}
+	// The bigger the table, the higher the cost.
+	small := &priorityqueue.NonPartitionedTableAnalysisJob{Indicators: priorityqueue.Indicators{TableSize: 1_000_000}}
+	big := &priorityqueue.NonPartitionedTableAnalysisJob{Indicators: priorityqueue.Indicators{TableSize: 100_000_000}}
+	require.Less(t, small.EstimatedCost(), big.EstimatedCost())
+}
+
+func TestEstimatedMemoryBytes(t *testing.T) {
+	// 1M rows of a 10-column table.
+	indicators := priorityqueue.Indicators{TableSize: 10_000_000, EstimatedRows: 1_000_000}
+	tests := []struct {
+		job  priorityqueue.AnalysisJob
+		want int64
+	}{
+		// 110K sampled rows * 10 columns * 64 bytes + 10 columns * (256 buckets * 128 + 100 TopN * 64 + 80K sketches).
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators}, 71_610_880},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: indicators, Columns: []string{"a", "b"}}, 14_322_176},
+		{&priorityqueue.DynamicPartitionedTableAnalysisJob{Indicators: indicators, Partitions: []string{"p0"}}, 71_610_880},
+		// The quick analyze samples 1000 rows with 16 buckets and 10 TopN values.
+		{&priorityqueue.StaticPartitionedTableAnalysisJob{Indicators: indicators, Quick: true}, 1_486_080},
+		// The partitions are analyzed one by one, and the index builds its own statistics.
+		{&priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+			Indicators: indicators,
+			Indexes:    []string{"idx"},
+			Partitions: []priorityqueue.PartitionIDAndName{{Name: "p0", ID: 1}, {Name: "p1", ID: 2}},
+		}, 71_731_968},
+		// Every job uses at least 1MB.
+		{&priorityqueue.NonPartitionedTableAnalysisJob{}, 1 << 20},
+		{&priorityqueue.NonPartitionedTableAnalysisJob{Indicators: priorityqueue.Indicators{TableSize: -1}}, 1 << 20},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tt.job.EstimatedMemoryBytes(), tt.job.GetAnalyzeType())
+	}
+	// The more rows are sampled, the more memory is used.
+	small := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		Indicators:     indicators,
+		AnalyzeOptions: priorityqueue.AnalyzeOptions{SampleRate: 0.01},
+	}
+	big := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		Indicators:     indicators,
+		AnalyzeOptions: priorityqueue.AnalyzeOptions{SampleRate: 0.5},
+	}
+	require.Less(t, small.EstimatedMemoryBytes(), big.EstimatedMemoryBytes())
+}
+
+func TestMergeIndicators(t *testing.T) {
+	require.Equal(t, priorityqueue.Indicators{}, priorityqueue.MergeIndicators(nil))
+
+	now := time.Now()
+	merged := priorityqueue.MergeIndicators([]priorityqueue.Indicators{
+		{
+			LastAnalyzeTime:      now.Add(-time.Hour),
+			ChangePercentage:     0.5,
+			TableSize:            1000,
+			EstimatedRows:        100,
+			LastAnalysisDuration: time.Hour,
+		},
+		{
+			LastAnalyzeTime:      now.Add(-3 * time.Hour),
+			ChangePercentage:     1,
+			TableSize:            3000,
+			EstimatedRows:        300,
+			LastAnalysisDuration: 3 * time.Hour,
+		},
+		{
+			// The unknown last analyze time is ignored.
+			ChangePercentage:     0.2,
+			TableSize:            0,
+			LastAnalysisDuration: 2 * time.Hour,
+		},
+	})
+	require.Equal(t, float64(4000), merged.TableSize)
+	require.Equal(t, int64(400), merged.EstimatedRows)
+	require.InDelta(t, (0.5*1000+1*3000)/4000, merged.ChangePercentage, 1e-9)
+	require.Equal(t, 3*time.Hour, merged.LastAnalysisDuration)
+	require.Equal(t, now.Add(-3*time.Hour), merged.LastAnalyzeTime)
+
+	// All the partitions are empty.
+	merged = priorityqueue.MergeIndicators([]priorityqueue.Indicators{
+		{ChangePercentage: 0.2},
+		{ChangePercentage: 0.4},
+	})
+	require.Zero(t, merged.TableSize)
+	require.InDelta(t, 0.3, merged.ChangePercentage, 1e-9)
+	require.True(t, merged.LastAnalyzeTime.IsZero())
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/metrics"
+	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	"github.com/pingcap/tidb/pkg/util"
+)
+
+// ErrAnalyzeTimeout is returned by AnalysisJob.Analyze if the job runs longer than its timeout.
+var ErrAnalyzeTimeout = errors.New("analyze timeout exceeded")
+
+var (
+	// AnalyzeTimeoutPerCostUnit is the time allowed to analyze one cost unit, see AnalysisJob.EstimatedCost.
+	// The timeout of a job is its estimated cost multiplied by it, but no less than MinAnalyzeTimeout,
+	// so that the analyze statements are killed rather than running unbounded, e.g. because of data skew.
+	// A job that times out fails, so the tables that keep timing out are held back by the circuit breaker.
+	// It is 0 by default, which disables the timeout.
+	AnalyzeTimeoutPerCostUnit time.Duration
+	// MinAnalyzeTimeout is the floor of the timeout of a job, which covers the fixed overheads of small jobs.
+	MinAnalyzeTimeout = time.Hour
+)
+
+// analyzeTimeout calculates the timeout of the job from its estimated cost.
+// It returns 0 if the timeout is disabled.
+func analyzeTimeout(job AnalysisJob) time.Duration {
+	if AnalyzeTimeoutPerCostUnit <= 0 {
+		return 0
+	}
+	timeout := time.Duration(job.EstimatedCost() * float64(AnalyzeTimeoutPerCostUnit))
+	return max(timeout, MinAnalyzeTimeout)
+}
+
+// jobProcTracker wraps a sysproctrack.Tracker to record the processes of one analysis job.
+// So that we can pull the progress of the running analyze statements or kill them.
+type jobProcTracker struct {
+	sysproctrack.Tracker
+
+	mu    sync.Mutex
+	procs map[uint64]sysproctrack.TrackProc
+	// killed indicates whether the job has been killed.
+	// The processes tracked after that will be killed immediately.
+	killed bool
+}
+
+func newJobProcTracker(tracker sysproctrack.Tracker) *jobProcTracker {
+	return &jobProcTracker{
+		Tracker: tracker,
+		procs:   make(map[uint64]sysproctrack.TrackProc),
+	}
+}
+
+// Track implements sysproctrack.Tracker.
+func (t *jobProcTracker) Track(id uint64, proc sysproctrack.TrackProc) error {
+	if err := t.Tracker.Track(id, proc); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.procs[id] = proc
+	if t.killed {
+		t.Tracker.KillSysProcess(id)
+	}
+	return nil
+}
+
+// UnTrack implements sysproctrack.Tracker.
+func (t *jobProcTracker) UnTrack(id uint64) {
+	t.mu.Lock()
+	delete(t.procs, id)
+	t.mu.Unlock()
+	t.Tracker.UnTrack(id)
+}
+
+// killAll kills all the running analyze statements of the job.
+func (t *jobProcTracker) killAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.killed = true
+	for id := range t.procs {
+		t.Tracker.KillSysProcess(id)
+	}
+}
+
+// runAnalysis runs the analysis of the job.
+// Once the context is done, the running analyze statements are killed and the context error is returned.
+// If the analysis runs longer than the timeout of the job, the statements are killed and ErrAnalyzeTimeout is returned.
+// The analysis is called with the context that is done in both cases, so that it stops waiting to retry as well.
+// If the progress hook is set, it is called periodically and at least once after the analysis is finished.
+func runAnalysis(
+	ctx context.Context,
+	job AnalysisJob,
+	progressHook ProgressHook,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+	analyze func(ctx context.Context, sysProcTracker sysproctrack.Tracker) error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if timeout := analyzeTimeout(job); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrAnalyzeTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	tracker := newJobProcTracker(sysProcTracker)
+	stop := context.AfterFunc(ctx, tracker.killAll)
+	defer stop()
+
+	if progressHook != nil {
+		done := make(chan struct{})
+		var wg util.WaitGroupWrapper
+		wg.Run(func() {
+			reportProgress(job, progressHook, statsHandle, tracker, start, done)
+		})
+		defer func() {
+			close(done)
+			wg.Wait()
+			progress := tracker.collect(statsHandle, start)
+			progress.Finished = true
+			progressHook(job, progress)
+		}()
+	}
+
+	err := analyze(ctx, tracker)
+	// If stop returns false, the context is done during the analysis and the statements have been killed.
+	if !stop() {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// isAnalysisCanceled checks whether the analysis is interrupted by the context.
+func isAnalysisCanceled(err error) bool {
+	return stderrors.Is(err, context.Canceled) ||
+		stderrors.Is(err, context.DeadlineExceeded)
+}
+
+// isAnalysisTimedOut checks whether the analysis is interrupted because it runs longer than the timeout of the job.
+func isAnalysisTimedOut(err error) bool {
+	return stderrors.Is(err, ErrAnalyzeTimeout)
+}
+
+// observeAnalysisResult counts the finished job by its analyze type and whether it succeeds,
+// so that we know which kind of analysis dominates and where the failures concentrate.
+func observeAnalysisResult(job AnalysisJob, success bool) {
+	result := "success"
+	if !success {
+		result = "fail"
+	}
+	metrics.AutoAnalyzeJobCounter.WithLabelValues(job.GetAnalyzeType(), result).Inc()
+}
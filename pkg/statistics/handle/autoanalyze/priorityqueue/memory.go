@@ -0,0 +1,98 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"math"
+
+	"github.com/pingcap/tidb/pkg/config"
+)
+
+// The memory model of the analysis jobs.
+//
+// The memory of an analyze statement is dominated by the sampled rows and the statistics built from them,
+// so the estimation only counts them:
+//  1. The sampled rows are kept in memory until the statistics are built. Every sampled cell costs memBytesPerSampleCell.
+//     The number of sampled rows is the NumSamples option, or the rows times the SampleRate option,
+//     or config.DefRowsForSampleRate rows by default, but never more than the rows of the table.
+//  2. Every analyzed column and index builds a histogram of NumBuckets buckets, a TopN of NumTopN values,
+//     and the sketches, which cost memBytesPerBucket, memBytesPerTopN and memBytesPerSketch respectively.
+//     If the options are not set, the defaults of the version 2 statistics are used.
+//     There cannot be more buckets or TopN values than the sampled rows.
+//  3. The number of columns is TableSize / EstimatedRows if not specified, or defaultMemNumColumns if unknown.
+//  4. Every job costs at least minJobMemoryBytes, e.g. for the sessions and the table metadata.
+//
+// Limitations:
+//   - The widths of the values are not known, so all cells are assumed to have the same size.
+//     Wide columns, e.g. long strings or JSON, are underestimated.
+//   - The indexes of the whole table jobs are not known, so only the columns are counted for them.
+//   - The memory used by TiKV, by the concurrent scans of the regions, and by merging the global stats
+//     of the partitioned tables is not counted.
+//
+// So the estimation is only useful to compare the jobs and to avoid launching many large jobs at once.
+const (
+	memBytesPerSampleCell = 64
+	memBytesPerBucket     = 128
+	memBytesPerTopN       = 64
+	memBytesPerSketch     = 80 << 10
+	minJobMemoryBytes     = 1 << 20
+	defaultMemNumColumns  = 10
+	defaultMemNumBuckets  = 256
+	defaultMemNumTopN     = 100
+)
+
+// estimateMemoryBytes estimates the memory of a job that analyzes the given number of indexes and columns of a table
+// with the given options. If the columns are not specified, all columns of the table are analyzed.
+func estimateMemoryBytes(indicators Indicators, options AnalyzeOptions, numIndexes, numColumns int) int64 {
+	tableSize := indicators.TableSize
+	if math.IsNaN(tableSize) || tableSize < 0 {
+		tableSize = 0
+	}
+	rows := float64(indicators.EstimatedRows)
+	if numColumns <= 0 {
+		numColumns = defaultMemNumColumns
+		if rows > 0 && tableSize > 0 {
+			numColumns = max(int(math.Round(tableSize/rows)), 1)
+		}
+	}
+	if rows <= 0 {
+		rows = tableSize / float64(numColumns)
+	}
+
+	var samples float64
+	switch {
+	case options.NumSamples > 0:
+		samples = float64(options.NumSamples)
+	case options.SampleRate > 0:
+		samples = rows * options.SampleRate
+	default:
+		samples = config.DefRowsForSampleRate
+	}
+	samples = min(samples, rows)
+
+	numBuckets, numTopN := uint64(defaultMemNumBuckets), uint64(defaultMemNumTopN)
+	if options.NumBuckets > 0 {
+		numBuckets = options.NumBuckets
+	}
+	if options.NumTopN > 0 {
+		numTopN = options.NumTopN
+	}
+	// There cannot be more buckets or TopN values than the sampled rows.
+	numBuckets, numTopN = min(numBuckets, uint64(samples)), min(numTopN, uint64(samples))
+	numStats := float64(numColumns + numIndexes)
+	statsBytes := numStats * float64(numBuckets*memBytesPerBucket+numTopN*memBytesPerTopN+memBytesPerSketch)
+	sampleBytes := samples * float64(numColumns) * memBytesPerSampleCell
+	return max(int64(sampleBytes+statsBytes), minJobMemoryBytes)
+}
@@ -15,13 +15,17 @@
 package priorityqueue
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
-	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/exec"
 	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
 	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
 )
@@ -29,22 +33,46 @@ import (
 var _ AnalysisJob = &NonPartitionedTableAnalysisJob{}
 
 const (
-	analyzeTable analyzeType = "analyzeTable"
-	analyzeIndex analyzeType = "analyzeIndex"
+	analyzeTable   analyzeType = "analyzeTable"
+	analyzeIndex   analyzeType = "analyzeIndex"
+	analyzeColumns analyzeType = "analyzeColumns"
 )
 
 // NonPartitionedTableAnalysisJob is a TableAnalysisJob for analyzing the physical table.
 type NonPartitionedTableAnalysisJob struct {
-	successHook JobHook
-	failureHook JobHook
-	TableSchema string
-	TableName   string
+	successHook  JobHook
+	failureHook  JobHook
+	progressHook ProgressHook
+	validityHook ValidityHook
+	tracer       Tracer
+	TableSchema  string
+	TableName    string
 	// This is only for newly added indexes.
 	Indexes []string
+	// Columns is the subset of columns to analyze.
+	// If it is empty, all columns of the table will be analyzed.
+	Columns []string
+	// SessionVariables is used to override the session variables while executing the analyze statements.
+	SessionVariables SessionVariables
 	Indicators
 	TableID       int64
 	TableStatsVer int
 	Weight        float64
+	// EnqueuedAt is the time when the job is pushed into the queue.
+	// It is used to boost the weight of the job that has been waiting for a long time.
+	EnqueuedAt time.Time
+	// LastRunDuration is the wall-clock time spent on executing the analyze statements in the last run.
+	LastRunDuration time.Duration
+
+	// lastFailureReason is the reason why the job failed last time.
+	lastFailureReason string
+	// lastFailureTransient indicates whether the job failed with a transient error last time.
+	lastFailureTransient bool
+	// completed indicates whether the job has been analyzed successfully.
+	// Analyzing a completed job again only calls the success hook.
+	completed bool
+	// state is the state of the job in its lifecycle, see AnalysisJob.State.
+	state jobState
 }
 
 // NewNonPartitionedTableAnalysisJob creates a new TableAnalysisJob for analyzing the physical table.
@@ -52,6 +80,7 @@ func NewNonPartitionedTableAnalysisJob(
 	schema, tableName string,
 	tableID int64,
 	indexes []string,
+	columns []string,
 	tableStatsVer int,
 	changePercentage float64,
 	tableSize float64,
@@ -62,6 +91,7 @@ func NewNonPartitionedTableAnalysisJob(
 		TableName:     tableName,
 		TableID:       tableID,
 		Indexes:       indexes,
+		Columns:       columns,
 		TableStatsVer: tableStatsVer,
 		Indicators: Indicators{
 			ChangePercentage:     changePercentage,
@@ -76,33 +106,111 @@ func (j *NonPartitionedTableAnalysisJob) GetTableID() int64 {
 	return j.TableID
 }
 
+// GetGlobalTableID implements AnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) GetGlobalTableID() int64 {
+	return j.TableID
+}
+
+// GetSchemaName gets the schema name of the table.
+func (j *NonPartitionedTableAnalysisJob) GetSchemaName() string {
+	return j.TableSchema
+}
+
+// GetTableName gets the table name of the job.
+func (j *NonPartitionedTableAnalysisJob) GetTableName() string {
+	return j.TableName
+}
+
+// GetPartitionNames implements AnalysisJob.
+// It always returns nil because the table is not partitioned.
+func (*NonPartitionedTableAnalysisJob) GetPartitionNames() []string {
+	return nil
+}
+
 // Analyze analyzes the table or indexes.
 func (j *NonPartitionedTableAnalysisJob) Analyze(
+	ctx context.Context,
 	statsHandle statstypes.StatsHandle,
 	sysProcTracker sysproctrack.Tracker,
 ) error {
-	success := true
+	// The job has been analyzed successfully, e.g. the runner retries it because the success hook fails.
+	// Only the success hook is called again, so that the table is not analyzed twice.
+	if j.completed {
+		if j.successHook != nil {
+			j.successHook(j)
+		}
+		return nil
+	}
+
+	j.setState(JobStateRunning)
+	success, canceled := true, false
 	defer func() {
+		// The state is set before calling the hooks, so that the hooks see the outcome.
+		if canceled {
+			// The interrupted job is neither a success nor a failure, so it is not counted as either.
+			// The failure hook is still called to release the table, see JobStateCanceled.
+			j.setState(JobStateCanceled)
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+			return
+		}
+		observeAnalysisResult(j, success)
 		if success {
+			j.setState(JobStateSucceeded)
+			j.completed = true
 			if j.successHook != nil {
 				j.successHook(j)
 			}
 		} else {
+			j.setState(JobStateFailed)
 			if j.failureHook != nil {
 				j.failureHook(j)
 			}
 		}
 	}()
 
-	return statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
-		switch j.getAnalyzeType() {
-		case analyzeTable:
-			success = j.analyzeTable(sctx, statsHandle, sysProcTracker)
-		case analyzeIndex:
-			success = j.analyzeIndexes(sctx, statsHandle, sysProcTracker)
+	err := runAnalysis(ctx, j, j.progressHook, statsHandle, sysProcTracker, func(ctx context.Context, sysProcTracker sysproctrack.Tracker) error {
+		var sqls []analyzeSQL
+		if err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			sqls = j.genAnalyzeSQLs(sctx)
+			return nil
+		}); err != nil {
+			// Nothing is done without a session, so the job fails.
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return err
+		}
+		start := DefaultClock.Now()
+		err := runAnalyzeSQLs(ctx, j, statsHandle, sysProcTracker, j.tracer, j.TableStatsVer, j.SessionVariables, sqls)
+		j.LastRunDuration = since(start)
+		if err != nil {
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
 		}
 		return nil
 	})
+	if isAnalysisCanceled(err) || isAnalysisTimedOut(err) {
+		// The job is interrupted, so it is not finished.
+		// Unlike a cancellation, a timeout is a failure of the job, see AnalyzeTimeoutPerCostUnit.
+		canceled = !isAnalysisTimedOut(err)
+		success = false
+		j.lastFailureReason = err.Error()
+		j.lastFailureTransient = isTransientAnalyzeError(err)
+	}
+	return err
+}
+
+// DryRun implements AnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	return escapeAnalyzeSQLs(j.genAnalyzeSQLs(sctx))
+}
+
+// GenAnalyzeSQLParams implements AnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error) {
+	return collectAnalyzeSQLParams(j.genAnalyzeSQLs(sctx)), nil
 }
 
 // RegisterSuccessHook registers a successHook function that will be called after the job can be marked as successful.
@@ -115,11 +223,54 @@ func (j *NonPartitionedTableAnalysisJob) RegisterFailureHook(hook JobHook) {
 	j.failureHook = hook
 }
 
+// RegisterProgressHook registers a progressHook function that will be called periodically while the job is running.
+func (j *NonPartitionedTableAnalysisJob) RegisterProgressHook(hook ProgressHook) {
+	j.progressHook = hook
+}
+
+// RegisterValidityHook registers a validityHook function that is consulted by IsValidToAnalyze after its built-in checks pass.
+func (j *NonPartitionedTableAnalysisJob) RegisterValidityHook(hook ValidityHook) {
+	j.validityHook = hook
+}
+
+// SetTracer sets the Tracer that traces the execution of the analyze statements of the job.
+func (j *NonPartitionedTableAnalysisJob) SetTracer(tracer Tracer) {
+	j.tracer = tracer
+}
+
+// GetIndexes gets the newly added indexes of the job.
+func (j *NonPartitionedTableAnalysisJob) GetIndexes() []string {
+	return j.Indexes
+}
+
+// AddIndex adds a newly added index to the job, so that the index is analyzed together with the pending job
+// instead of creating another job for the same table. It is a no-op if the index is already in the job.
+// Once an index is added, the job only analyzes the indexes.
+func (j *NonPartitionedTableAnalysisJob) AddIndex(name string) {
+	if slices.Contains(j.Indexes, name) {
+		return
+	}
+	j.Indexes = append(j.Indexes, name)
+}
+
 // HasNewlyAddedIndex checks whether the table has newly added indexes.
 func (j *NonPartitionedTableAnalysisJob) HasNewlyAddedIndex() bool {
 	return len(j.Indexes) > 0
 }
 
+// Validate checks whether the schema, table name and table ID of the job are set.
+func (j *NonPartitionedTableAnalysisJob) Validate() error {
+	switch {
+	case j.TableSchema == "":
+		return errors.New("invalid analysis job: table schema is empty")
+	case j.TableName == "":
+		return errors.New("invalid analysis job: table name is empty")
+	case j.TableID <= 0:
+		return errors.Errorf("invalid analysis job: table ID %d is not positive", j.TableID)
+	}
+	return nil
+}
+
 // IsValidToAnalyze checks whether the table is valid to analyze.
 // We will check the last failed job and average analyze duration to determine whether the table is valid to analyze.
 func (j *NonPartitionedTableAnalysisJob) IsValidToAnalyze(
@@ -130,6 +281,8 @@ func (j *NonPartitionedTableAnalysisJob) IsValidToAnalyze(
 		j.TableSchema,
 		j.TableName,
 	); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
 		if j.failureHook != nil {
 			j.failureHook(j)
 		}
@@ -137,19 +290,97 @@ func (j *NonPartitionedTableAnalysisJob) IsValidToAnalyze(
 		return false, failReason
 	}
 
+	if valid, failReason := checkValidityHook(j, j.validityHook); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
+		return false, failReason
+	}
 	return true, ""
 }
 
+// Clone returns a deep copy of the job.
+func (j *NonPartitionedTableAnalysisJob) Clone() AnalysisJob {
+	cloned := *j
+	cloned.Indexes = slices.Clone(j.Indexes)
+	cloned.Columns = slices.Clone(j.Columns)
+	cloned.SessionVariables = maps.Clone(j.SessionVariables)
+	return &cloned
+}
+
+// Equal checks whether the job analyzes the same table, indexes and columns as the other job.
+// Hooks, indicators and weight are not compared.
+func (j *NonPartitionedTableAnalysisJob) Equal(other AnalysisJob) bool {
+	o, ok := other.(*NonPartitionedTableAnalysisJob)
+	if !ok || o == nil {
+		return false
+	}
+	return j.TableID == o.TableID &&
+		j.TableSchema == o.TableSchema &&
+		j.TableName == o.TableName &&
+		slices.Equal(j.Indexes, o.Indexes) &&
+		slices.Equal(j.Columns, o.Columns) &&
+		maps.Equal(j.SessionVariables, o.SessionVariables)
+}
+
 // SetWeight sets the weight of the job.
 func (j *NonPartitionedTableAnalysisJob) SetWeight(weight float64) {
-	j.Weight = weight
+	j.Weight = clampWeight(weight)
 }
 
 // GetWeight gets the weight of the job.
 func (j *NonPartitionedTableAnalysisJob) GetWeight() float64 {
+	return clampWeight(j.Weight + calculateAgingWeight(j.EnqueuedAt))
+}
+
+// GetBaseWeight gets the weight set by SetWeight, without the aging boost.
+func (j *NonPartitionedTableAnalysisJob) GetBaseWeight() float64 {
 	return j.Weight
 }
 
+// SetEnqueuedAt sets the time when the job is pushed into the queue.
+func (j *NonPartitionedTableAnalysisJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	j.EnqueuedAt = enqueuedAt
+}
+
+// GetEnqueuedAt gets the time when the job is pushed into the queue.
+func (j *NonPartitionedTableAnalysisJob) GetEnqueuedAt() time.Time {
+	return j.EnqueuedAt
+}
+
+// GetLastRunDuration gets the time spent on executing the analyze statements in the last run.
+func (j *NonPartitionedTableAnalysisJob) GetLastRunDuration() time.Duration {
+	return j.LastRunDuration
+}
+
+// GetLastFailureReason gets the reason why the job failed last time.
+func (j *NonPartitionedTableAnalysisJob) GetLastFailureReason() string {
+	return j.lastFailureReason
+}
+
+// State implements AnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) State() JobState {
+	return j.state.load()
+}
+
+func (j *NonPartitionedTableAnalysisJob) setState(state JobState) {
+	j.state.store(state)
+}
+
+// IsLastFailureTransient checks whether the job failed with a transient error last time.
+func (j *NonPartitionedTableAnalysisJob) IsLastFailureTransient() bool {
+	return j.lastFailureTransient
+}
+
+// GetCorrelationID gets the ID to correlate the logs of the job.
+func (j *NonPartitionedTableAnalysisJob) GetCorrelationID() string {
+	return genCorrelationID(j.TableID, 0, j.EnqueuedAt)
+}
+
+// GetWeightBreakdown implements AnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) GetWeightBreakdown() map[string]float64 {
+	return NewPriorityCalculator().CalculateWeightBreakdown(j)
+}
+
 // GetIndicators returns the indicators of the table.
 func (j *NonPartitionedTableAnalysisJob) GetIndicators() Indicators {
 	return j.Indicators
@@ -160,12 +391,35 @@ func (j *NonPartitionedTableAnalysisJob) SetIndicators(indicators Indicators) {
 	j.Indicators = indicators
 }
 
+// MarshalJSON implements json.Marshaler interface.
+// The analyze type is included so that the job can be decoded by UnmarshalAnalysisJob.
+func (j *NonPartitionedTableAnalysisJob) MarshalJSON() ([]byte, error) {
+	type alias NonPartitionedTableAnalysisJob
+	return json.Marshal(struct {
+		AnalyzeType analyzeType
+		*alias
+	}{
+		AnalyzeType: j.getAnalyzeType(),
+		alias:       (*alias)(j),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (j *NonPartitionedTableAnalysisJob) UnmarshalJSON(data []byte) error {
+	if err := checkAnalyzeType(data, j); err != nil {
+		return err
+	}
+	type alias NonPartitionedTableAnalysisJob
+	return json.Unmarshal(data, (*alias)(j))
+}
+
 // String implements fmt.Stringer interface.
 func (j *NonPartitionedTableAnalysisJob) String() string {
 	return fmt.Sprintf(
 		"NonPartitionedTableAnalysisJob:\n"+
 			"\tAnalyzeType: %s\n"+
 			"\tIndexes: %s\n"+
+			"\tColumns: %s\n"+
 			"\tSchema: %s\n"+
 			"\tTable: %s\n"+
 			"\tTableID: %d\n"+
@@ -173,69 +427,130 @@ func (j *NonPartitionedTableAnalysisJob) String() string {
 			"\tChangePercentage: %.6f\n"+
 			"\tTableSize: %.2f\n"+
 			"\tLastAnalysisDuration: %v\n"+
-			"\tWeight: %.6f\n",
+			"\tWeight: %.6f\n"+
+			"\tWeightBreakdown: %s\n"+
+			"\tCorrelationID: %s\n",
 		j.getAnalyzeType(),
 		strings.Join(j.Indexes, ", "),
+		strings.Join(j.Columns, ", "),
 		j.TableSchema, j.TableName, j.TableID, j.TableStatsVer,
 		j.ChangePercentage, j.TableSize, j.LastAnalysisDuration, j.Weight,
+		formatWeightBreakdown(j.GetWeightBreakdown()),
+		j.GetCorrelationID(),
 	)
 }
+
+// EstimatedCost estimates the resources used by the job in a normalized cost unit.
+func (j *NonPartitionedTableAnalysisJob) EstimatedCost() float64 {
+	return estimateCost(j.Indicators, len(j.Indexes), len(j.Columns))
+}
+
+// EstimatedMemoryBytes estimates the peak memory in bytes used by the job.
+func (j *NonPartitionedTableAnalysisJob) EstimatedMemoryBytes() int64 {
+	options := AnalyzeOptions{}.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer)
+	return estimateMemoryBytes(j.Indicators, options, len(j.Indexes), len(j.Columns))
+}
+
+// GetAnalyzeType returns whether the job analyzes the whole table, the indexes or the columns.
+func (j *NonPartitionedTableAnalysisJob) GetAnalyzeType() string {
+	return j.getAnalyzeType().label()
+}
+
 func (j *NonPartitionedTableAnalysisJob) getAnalyzeType() analyzeType {
-	if j.HasNewlyAddedIndex() {
+	switch {
+	case j.HasNewlyAddedIndex():
 		return analyzeIndex
+	case len(j.Columns) > 0:
+		return analyzeColumns
+	default:
+		return analyzeTable
 	}
-	return analyzeTable
-}
-
-func (j *NonPartitionedTableAnalysisJob) analyzeTable(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) bool {
-	sql, params := j.GenSQLForAnalyzeTable()
-	return exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
 }
 
 // GenSQLForAnalyzeTable generates the SQL for analyzing the specified table.
 func (j *NonPartitionedTableAnalysisJob) GenSQLForAnalyzeTable() (string, []any) {
-	sql := "analyze table %n.%n"
-	params := []any{j.TableSchema, j.TableName}
+	sql, params := j.genSQLForAnalyzeTable()
+	return sql, params.Args()
+}
+
+func (j *NonPartitionedTableAnalysisJob) genSQLForAnalyzeTable() (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n" + j.genClause()
+	params := AnalyzeSQLParams{TableSchema: j.TableSchema, TableName: j.TableName}
 
 	return sql, params
 }
 
-func (j *NonPartitionedTableAnalysisJob) analyzeIndexes(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) bool {
+// genAnalyzeSQLs generates the analyze statements that need to be executed for the job.
+func (j *NonPartitionedTableAnalysisJob) genAnalyzeSQLs(sctx sessionctx.Context) []analyzeSQL {
+	switch j.getAnalyzeType() {
+	case analyzeTable:
+		// The generated columns that are not indexed can be excluded, see AnalyzeNonIndexedGeneratedColumns.
+		if columns := columnsToAnalyze(sctx, j.TableID, j.TableID, j.TableStatsVer); len(columns) > 0 {
+			sql, params := j.genSQLForAnalyzeColumns(columns)
+			return []analyzeSQL{{sql: sql, params: params}}
+		}
+		sql, params := j.genSQLForAnalyzeTable()
+		return []analyzeSQL{{sql: sql, params: params}}
+	case analyzeIndex:
+		return j.genSQLsForAnalyzeIndexes()
+	case analyzeColumns:
+		sql, params := j.genSQLForAnalyzeColumns(j.Columns)
+		return []analyzeSQL{{sql: sql, params: params}}
+	}
+	return nil
+}
+
+func (j *NonPartitionedTableAnalysisJob) genSQLsForAnalyzeIndexes() []analyzeSQL {
 	if len(j.Indexes) == 0 {
-		return true
+		return nil
 	}
 	// For version 2, analyze one index will analyze all other indexes and columns.
 	// For version 1, analyze one index will only analyze the specified index.
-	analyzeVersion := sctx.GetSessionVars().AnalyzeVersion
+	// The statements are executed with the stats version of the job, see exec.RunAutoAnalyze.
+	analyzeVersion := j.TableStatsVer
 	if analyzeVersion == 1 {
+		sqls := make([]analyzeSQL, 0, len(j.Indexes))
 		for _, index := range j.Indexes {
-			sql, params := j.GenSQLForAnalyzeIndex(index)
-			if !exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...) {
-				return false
-			}
+			sql, params := j.genSQLForAnalyzeIndex(index)
+			sqls = append(sqls, analyzeSQL{sql: sql, params: params})
 		}
-		return true
+		return sqls
 	}
 	// Only analyze the first index.
 	// This is because analyzing a single index also analyzes all other indexes and columns.
 	// Therefore, to avoid redundancy, we prevent multiple analyses of the same table.
 	firstIndex := j.Indexes[0]
-	sql, params := j.GenSQLForAnalyzeIndex(firstIndex)
-	return exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
+	sql, params := j.genSQLForAnalyzeIndex(firstIndex)
+	return []analyzeSQL{{sql: sql, params: params}}
+}
+
+// genClause generates the WITH clause of the analyze statements with the sample rate chosen by the change percentage.
+func (j *NonPartitionedTableAnalysisJob) genClause() string {
+	return AnalyzeOptions{}.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer).genClause()
 }
 
 // GenSQLForAnalyzeIndex generates the SQL for analyzing the specified index.
 func (j *NonPartitionedTableAnalysisJob) GenSQLForAnalyzeIndex(index string) (string, []any) {
-	sql := "analyze table %n.%n index %n"
-	params := []any{j.TableSchema, j.TableName, index}
+	sql, params := j.genSQLForAnalyzeIndex(index)
+	return sql, params.Args()
+}
+
+func (j *NonPartitionedTableAnalysisJob) genSQLForAnalyzeIndex(index string) (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n index %n" + j.genClause()
+	params := AnalyzeSQLParams{TableSchema: j.TableSchema, TableName: j.TableName, Index: index}
+
+	return sql, params
+}
+
+// GenSQLForAnalyzeColumns generates the SQL for analyzing the specified columns of the table.
+func (j *NonPartitionedTableAnalysisJob) GenSQLForAnalyzeColumns() (string, []any) {
+	sql, params := j.genSQLForAnalyzeColumns(j.Columns)
+	return sql, params.Args()
+}
+
+func (j *NonPartitionedTableAnalysisJob) genSQLForAnalyzeColumns(columns []string) (string, AnalyzeSQLParams) {
+	sql := getPartitionSQL("analyze table %n.%n columns", j.genClause(), len(columns))
+	params := AnalyzeSQLParams{TableSchema: j.TableSchema, TableName: j.TableName, Columns: columns}
 
 	return sql, params
 }
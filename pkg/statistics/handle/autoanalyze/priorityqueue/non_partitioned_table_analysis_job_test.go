@@ -16,13 +16,24 @@ package priorityqueue_test
 
 import (
 	"context"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/ngaut/pools"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/metrics"
 	"github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/session"
 	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/variable"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
 	"github.com/pingcap/tidb/pkg/testkit"
+	"github.com/pingcap/tidb/pkg/util"
+	"github.com/pingcap/tidb/pkg/util/sqlescape"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,6 +52,90 @@ func TestGenSQLForNonPartitionedTable(t *testing.T) {
 	require.Equal(t, expectedParams, params)
 }
 
+func TestGenSQLForNonPartitionedTableWithAdaptiveSampleRate(t *testing.T) {
+	defer func(cutoff float64, fn func(float64) float64) {
+		priorityqueue.FullAnalyzeChangePercentageCutoff = cutoff
+		priorityqueue.SampleRateByChangePercentage = fn
+	}(priorityqueue.FullAnalyzeChangePercentageCutoff, priorityqueue.SampleRateByChangePercentage)
+	priorityqueue.FullAnalyzeChangePercentageCutoff = 0.8
+	priorityqueue.SampleRateByChangePercentage = func(changePercentage float64) float64 {
+		return changePercentage / 2
+	}
+
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test_schema",
+		TableName:   "test_table",
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 0.5,
+		},
+	}
+	sql, _ := job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.25 samplerate", sql)
+	sql, _ = job.GenSQLForAnalyzeIndex("idx")
+	require.Equal(t, "analyze table %n.%n index %n with 0.25 samplerate", sql)
+
+	// The tables changed too much are fully analyzed.
+	job.ChangePercentage = 0.8
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 1 samplerate", sql)
+
+	// An invalid sample rate falls back to the default one.
+	job.ChangePercentage = 0
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n", sql)
+}
+
+func TestGenSQLForNonPartitionedTableWithSampleRateByTableSize(t *testing.T) {
+	defer func(bySize, byChange func(float64) float64) {
+		priorityqueue.SampleRateByTableSize = bySize
+		priorityqueue.SampleRateByChangePercentage = byChange
+	}(priorityqueue.SampleRateByTableSize, priorityqueue.SampleRateByChangePercentage)
+	priorityqueue.SampleRateByTableSize = priorityqueue.DefaultSampleRateByTableSize
+
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test_schema",
+		TableName:     "test_table",
+		TableStatsVer: 2,
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 0.5,
+			TableSize:        4_000_000,
+		},
+	}
+	sql, _ := job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.25 samplerate", sql)
+	// The bigger the table, the lower the sample rate, but never lower than 0.001.
+	job.TableSize = 100_000_000
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.01 samplerate", sql)
+	job.TableSize = 1e12
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.001 samplerate", sql)
+	// The small tables are fully sampled.
+	job.TableSize = 1000
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 1 samplerate", sql)
+
+	// The sample rate chosen by the change percentage takes precedence.
+	priorityqueue.SampleRateByChangePercentage = func(changePercentage float64) float64 {
+		return changePercentage / 2
+	}
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.25 samplerate", sql)
+	// The version 1 statistics do not support the sample rate.
+	priorityqueue.SampleRateByChangePercentage = nil
+	job.TableStatsVer = 1
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n", sql)
+
+	// The curve is configurable.
+	job.TableStatsVer = 2
+	priorityqueue.SampleRateByTableSize = func(tableSize float64) float64 {
+		return 0.5
+	}
+	sql, _ = job.GenSQLForAnalyzeTable()
+	require.Equal(t, "analyze table %n.%n with 0.5 samplerate", sql)
+}
+
 func TestGenSQLForNonPartitionedTableIndex(t *testing.T) {
 	job := &priorityqueue.NonPartitionedTableAnalysisJob{
 		TableSchema: "test_schema",
@@ -58,6 +153,48 @@ func TestGenSQLForNonPartitionedTableIndex(t *testing.T) {
 	require.Equal(t, expectedParams, params)
 }
 
+func TestGenSQLForNonPartitionedTableColumns(t *testing.T) {
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test_schema",
+		TableName:   "test_table",
+		Columns:     []string{"a", "b`c"},
+	}
+
+	expectedSQL := "analyze table %n.%n columns %n, %n"
+	expectedParams := []any{"test_schema", "test_table", "a", "b`c"}
+
+	sql, params := job.GenSQLForAnalyzeColumns()
+
+	require.Equal(t, expectedSQL, sql)
+	require.Equal(t, expectedParams, params)
+
+	// Column names should be escaped as identifiers.
+	escaped, err := sqlescape.EscapeSQL(sql, params...)
+	require.NoError(t, err)
+	require.Equal(t, "analyze table `test_schema`.`test_table` columns `a`, `b``c`", escaped)
+	require.Contains(t, job.String(), "AnalyzeType: analyzeColumns")
+
+	// Newly added indexes take precedence over the column subset.
+	job.Indexes = []string{"idx"}
+	require.Contains(t, job.String(), "AnalyzeType: analyzeIndex")
+}
+
+func TestNonPartitionedTableAddIndex(t *testing.T) {
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema: "test_schema",
+		TableName:   "test_table",
+	}
+	require.Empty(t, job.GetIndexes())
+	require.Equal(t, "table", job.GetAnalyzeType())
+
+	job.AddIndex("idx")
+	job.AddIndex("idx1")
+	job.AddIndex("idx")
+	require.Equal(t, []string{"idx", "idx1"}, job.GetIndexes())
+	require.Equal(t, "index", job.GetAnalyzeType())
+	require.True(t, job.HasNewlyAddedIndex())
+}
+
 func TestAnalyzeNonPartitionedTable(t *testing.T) {
 	store, dom := testkit.CreateMockStoreAndDomain(t)
 	tk := testkit.NewTestKit(t, store)
@@ -79,7 +216,7 @@ func TestAnalyzeNonPartitionedTable(t *testing.T) {
 	tblStats := handle.GetTableStats(tbl.Meta())
 	require.True(t, tblStats.Pseudo)
 
-	job.Analyze(handle, dom.SysProcTracker())
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
 	// Check the result of analyze.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -109,7 +246,7 @@ func TestAnalyzeNonPartitionedIndexes(t *testing.T) {
 	tblStats := handle.GetTableStats(tbl.Meta())
 	require.False(t, tblStats.GetIdx(1).IsAnalyzed())
 
-	job.Analyze(handle, dom.SysProcTracker())
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
 	// Check the result of analyze.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -125,6 +262,279 @@ func TestAnalyzeNonPartitionedIndexes(t *testing.T) {
 	require.Len(t, rows, 1)
 }
 
+func TestAnalyzeNonPartitionedTableFailed(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t_not_exists",
+		TableStatsVer: 2,
+	}
+	failReason := ""
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) { failReason = j.GetLastFailureReason() })
+	require.Empty(t, job.GetLastFailureReason())
+
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Contains(t, failReason, "doesn't exist")
+	require.Equal(t, failReason, job.GetLastFailureReason())
+	// The table does not exist, which does not disappear by retrying.
+	require.False(t, job.IsLastFailureTransient())
+}
+
+// failingSessionPool is a session pool that cannot provide any session.
+type failingSessionPool struct {
+	util.SessionPool
+}
+
+func (failingSessionPool) Get() (pools.Resource, error) {
+	return nil, errors.New("no session available")
+}
+
+// statsHandleWithoutSession is a stats handle whose session pool cannot provide any session.
+type statsHandleWithoutSession struct {
+	statstypes.StatsHandle
+}
+
+func (statsHandleWithoutSession) SPool() util.SessionPool {
+	return failingSessionPool{}
+}
+
+func TestAnalyzeNonPartitionedTableWithoutSession(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+	}
+	successes, failures := 0, 0
+	job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { successes++ })
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failures++ })
+
+	handle := statsHandleWithoutSession{StatsHandle: dom.StatsHandle()}
+	require.ErrorContains(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()), "no session available")
+	require.Equal(t, 0, successes)
+	require.Equal(t, 1, failures)
+	require.Equal(t, priorityqueue.JobStateFailed, job.State())
+	require.Contains(t, job.GetLastFailureReason(), "no session available")
+}
+
+func TestAnalyzeNonPartitionedTableTwice(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+	}
+	successes := 0
+	job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { successes++ })
+
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Equal(t, 1, successes)
+	tk.MustQuery("select count(*) from mysql.analyze_jobs where table_name = 't'").Check(testkit.Rows("1"))
+
+	// Retrying the completed job only calls the success hook again.
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Equal(t, 2, successes)
+	tk.MustQuery("select count(*) from mysql.analyze_jobs where table_name = 't'").Check(testkit.Rows("1"))
+}
+
+func TestAnalyzeNonPartitionedTableMetrics(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+	}
+	successCounter := metrics.AutoAnalyzeJobCounter.WithLabelValues(job.GetAnalyzeType(), "success")
+	failCounter := metrics.AutoAnalyzeJobCounter.WithLabelValues(job.GetAnalyzeType(), "fail")
+	success, fail := testutil.ToFloat64(successCounter), testutil.ToFloat64(failCounter)
+
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Equal(t, success+1, testutil.ToFloat64(successCounter))
+	require.Equal(t, fail, testutil.ToFloat64(failCounter))
+
+	job = &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t_not_exists",
+		TableStatsVer: 2,
+	}
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Equal(t, success+1, testutil.ToFloat64(successCounter))
+	require.Equal(t, fail+1, testutil.ToFloat64(failCounter))
+}
+
+type recordedSpan struct {
+	name       string
+	attributes map[string]any
+	errs       []error
+	ended      bool
+}
+
+// recordingTracer records the spans started by the jobs.
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+// Start implements priorityqueue.Tracer.
+func (r *recordingTracer) Start(ctx context.Context, name string, attributes map[string]any) (context.Context, priorityqueue.Span) {
+	span := &recordedSpan{name: name, attributes: attributes}
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+// RecordError implements priorityqueue.Span.
+func (s *recordedSpan) RecordError(err error) {
+	s.errs = append(s.errs, err)
+}
+
+// End implements priorityqueue.Span.
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+func TestAnalyzeNonPartitionedTableWithTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		handle,
+		priorityqueue.WithTracer(tracer),
+		priorityqueue.WithFixedWeightForTesting(),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	// The tracer of the queue is set to the popped job.
+	require.NoError(t, pq.Push(&priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableID:       1,
+		TableStatsVer: 2,
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 1.5,
+			TableSize:        1000,
+		},
+	}))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Len(t, tracer.spans, 1)
+	span := tracer.spans[0]
+	require.Equal(t, job.GetAnalyzeType(), span.name)
+	require.Equal(t, "test", span.attributes["schema"])
+	require.Equal(t, "t", span.attributes["table"])
+	require.Equal(t, "", span.attributes["partitions"])
+	// The weight grows a little while the job waits in the queue.
+	require.InDelta(t, 1.5, span.attributes["weight"], 0.01)
+	require.Empty(t, span.errs)
+	require.True(t, span.ended)
+
+	// The error of the failed analysis is recorded in the span.
+	failed := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t_not_exists",
+		TableStatsVer: 2,
+		Weight:        1.5,
+	}
+	failed.SetTracer(tracer)
+	require.NoError(t, failed.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Len(t, tracer.spans, 2)
+	span = tracer.spans[1]
+	require.Equal(t, "t_not_exists", span.attributes["table"])
+	require.Len(t, span.errs, 1)
+	require.ErrorContains(t, span.errs[0], "doesn't exist")
+	require.True(t, span.ended)
+}
+
+func TestAnalyzeNonPartitionedTableTimeout(t *testing.T) {
+	defer func(perCostUnit, minTimeout time.Duration) {
+		priorityqueue.AnalyzeTimeoutPerCostUnit = perCostUnit
+		priorityqueue.MinAnalyzeTimeout = minTimeout
+	}(priorityqueue.AnalyzeTimeoutPerCostUnit, priorityqueue.MinAnalyzeTimeout)
+	priorityqueue.AnalyzeTimeoutPerCostUnit = time.Nanosecond
+	priorityqueue.MinAnalyzeTimeout = time.Nanosecond
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+	}
+	failReason := ""
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) { failReason = j.GetLastFailureReason() })
+
+	err := job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker())
+	require.ErrorIs(t, err, priorityqueue.ErrAnalyzeTimeout)
+	require.Equal(t, "analyze timeout exceeded", failReason)
+	require.Equal(t, priorityqueue.JobStateFailed, job.State())
+
+	// The timeout is disabled.
+	priorityqueue.AnalyzeTimeoutPerCostUnit = 0
+	successful := false
+	job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { successful = true })
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.True(t, successful)
+}
+
+func TestAnalyzeNonPartitionedTableWithSessionVariables(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	handle := dom.StatsHandle()
+	getPartitionConcurrency := func() string {
+		var value string
+		require.NoError(t, statsutil.CallWithSCtx(handle.SPool(), func(sctx sessionctx.Context) error {
+			var err error
+			value, err = sctx.GetSessionVars().GetSessionOrGlobalSystemVar(context.Background(), variable.TiDBAnalyzePartitionConcurrency)
+			return err
+		}))
+		return value
+	}
+	original := getPartitionConcurrency()
+
+	// The variables that have been set are restored if any variable fails to be set.
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+		SessionVariables: priorityqueue.SessionVariables{
+			variable.TiDBAnalyzePartitionConcurrency: "4",
+			variable.TiDBBuildStatsConcurrency:       "not a number",
+		},
+	}
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Contains(t, job.GetLastFailureReason(), variable.TiDBBuildStatsConcurrency)
+	require.Equal(t, original, getPartitionConcurrency())
+
+	// The variables are restored after analyzing.
+	job.SessionVariables = priorityqueue.SessionVariables{variable.TiDBAnalyzePartitionConcurrency: "4"}
+	successful := false
+	job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { successful = true })
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.True(t, successful)
+	require.Equal(t, original, getPartitionConcurrency())
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), handle.GetTableStats(tbl.Meta()).RealtimeCount)
+}
+
 func TestNonPartitionedTableIsValidToAnalyze(t *testing.T) {
 	store := testkit.CreateMockStore(t)
 	tk := testkit.NewTestKit(t, store)
@@ -158,6 +568,7 @@ func TestNonPartitionedTableIsValidToAnalyze(t *testing.T) {
 	valid, failReason = job.IsValidToAnalyze(sctx)
 	require.False(t, valid)
 	require.Equal(t, "last failed analysis duration is less than 2 times the average analysis duration", failReason)
+	require.Equal(t, failReason, job.GetLastFailureReason())
 	// Failed long long ago.
 	startTime = tk.MustQuery("select now() - interval 300 day").Rows()[0][0].(string)
 	insertFailedJobWithStartTime(tk, job.TableSchema, job.TableName, "", startTime)
@@ -166,6 +577,55 @@ func TestNonPartitionedTableIsValidToAnalyze(t *testing.T) {
 	require.Equal(t, "", failReason)
 }
 
+func TestIsValidToAnalyzeWithValidityHook(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec(session.CreateAnalyzeJobs)
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "example_schema",
+		TableName:     "example_table1",
+		TableStatsVer: 2,
+		Weight:        3,
+	}
+	failureHookCalled := false
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) {
+		failureHookCalled = true
+	})
+	initJobs(tk)
+	insertMultipleFinishedJobs(tk, job.TableName, "")
+	sctx := tk.Session().(sessionctx.Context)
+
+	replicationLagIsLow := false
+	var checked []priorityqueue.AnalysisJob
+	job.RegisterValidityHook(func(job priorityqueue.AnalysisJob) (bool, string) {
+		checked = append(checked, job)
+		if !replicationLagIsLow {
+			return false, "replication lag is high"
+		}
+		return true, ""
+	})
+	// The hook vetoes the job without calling the failure hook.
+	valid, failReason := job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Equal(t, "replication lag is high", failReason)
+	require.Equal(t, failReason, job.GetLastFailureReason())
+	require.False(t, failureHookCalled)
+	require.Equal(t, []priorityqueue.AnalysisJob{job}, checked)
+
+	replicationLagIsLow = true
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	require.Empty(t, failReason)
+
+	// The hook is consulted only after the built-in checks pass.
+	now := tk.MustQuery("select now()").Rows()[0][0].(string)
+	insertFailedJobWithStartTime(tk, job.TableSchema, job.TableName, "", now)
+	valid, _ = job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Len(t, checked, 2)
+}
+
 func TestIsValidToAnalyzeWhenOnlyHasFailedAnalysisRecords(t *testing.T) {
 	store := testkit.CreateMockStore(t)
 	tk := testkit.NewTestKit(t, store)
@@ -195,3 +655,124 @@ func TestIsValidToAnalyzeWhenOnlyHasFailedAnalysisRecords(t *testing.T) {
 	require.False(t, valid)
 	require.Equal(t, "last failed analysis duration is less than 30m0s", failReason)
 }
+
+func TestDryRunNonPartitionedTable(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t`"}, sqls)
+
+	job.Columns = []string{"a", "b"}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` columns `a`, `b`"}, sqls)
+
+	job.Indexes = []string{"idx", "idx1"}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` index `idx`"}, sqls)
+
+	// For version 1, all indexes are analyzed one by one.
+	job.TableStatsVer = 1
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` index `idx`",
+		"analyze table `test`.`t` index `idx1`",
+	}, sqls)
+}
+
+func TestDryRunNonPartitionedTableWithGeneratedColumns(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, c int as (a + 1) stored, d int as (a + 2), e int as (b * 2) stored, index idx_e(e), index idx_expr((a + b)))")
+	tk.MustExec("insert into t (a, b) values (1, 1), (2, 2)")
+	defer func(options string) {
+		variable.AnalyzeColumnOptions.Store(options)
+	}(variable.AnalyzeColumnOptions.Load())
+	variable.AnalyzeColumnOptions.Store(model.AllColumns.String())
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableID:       tbl.Meta().ID,
+		TableStatsVer: 2,
+	}
+	// All columns are analyzed by default.
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t`"}, sqls)
+
+	defer func() {
+		priorityqueue.AnalyzeNonIndexedGeneratedColumns = true
+	}()
+	priorityqueue.AnalyzeNonIndexedGeneratedColumns = false
+	// The stored generated column c is not indexed. The virtual generated column d is never analyzed.
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` columns `a`, `b`, `e`"}, sqls)
+
+	// Listing the columns would analyze more than the predicate columns.
+	variable.AnalyzeColumnOptions.Store(model.PredicateColumns.String())
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t`"}, sqls)
+	variable.AnalyzeColumnOptions.Store(model.AllColumns.String())
+
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	require.Empty(t, job.GetLastFailureReason())
+	var analyzed []string
+	for _, col := range tbl.Meta().Columns {
+		if !col.IsGenerated() || col.Name.L == "e" {
+			analyzed = append(analyzed, strconv.FormatInt(col.ID, 10))
+		}
+	}
+	tk.MustQuery(
+		"select hist_id from mysql.stats_histograms where table_id = ? and is_index = 0 order by hist_id", tbl.Meta().ID,
+	).Check(testkit.Rows(analyzed...))
+	// The column list is saved, so it is not generated again.
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t`"}, sqls)
+}
+
+func TestGenAnalyzeSQLParamsForNonPartitionedTable(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t",
+		TableStatsVer: 2,
+		Columns:       []string{"a", "b"},
+	}
+	params, err := job.GenAnalyzeSQLParams(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []priorityqueue.AnalyzeSQLParams{
+		{TableSchema: "test", TableName: "t", Columns: []string{"a", "b"}},
+	}, params)
+	// The positional form is the same as the one passed to the analyze statement.
+	_, args := job.GenSQLForAnalyzeColumns()
+	require.Equal(t, args, params[0].Args())
+
+	job.Indexes = []string{"idx"}
+	params, err = job.GenAnalyzeSQLParams(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []priorityqueue.AnalyzeSQLParams{
+		{TableSchema: "test", TableName: "t", Index: "idx"},
+	}, params)
+	require.Equal(t, []any{"test", "t", "idx"}, params[0].Args())
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	statslogutil "github.com/pingcap/tidb/pkg/statistics/handle/logutil"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"go.uber.org/zap"
+)
+
+// ProgressReportInterval is the interval to report the progress of a running analysis job.
+var ProgressReportInterval = 30 * time.Second
+
+// AnalyzeProgress is the progress of a running analysis job.
+type AnalyzeProgress struct {
+	// Elapsed is the duration since the job started.
+	Elapsed time.Duration
+	// RowsScanned is the number of rows processed by the running analyze statements.
+	// It is read from mysql.analyze_jobs, so it is only refreshed when the executor dumps the progress.
+	RowsScanned int64
+	// MemoryUsage is the memory consumed by the running analyze statements in bytes.
+	MemoryUsage int64
+	// Finished indicates whether the job is finished. Only the last report is marked as finished.
+	Finished bool
+}
+
+// ProgressHook is the function that will be called periodically while the job is running
+// and once after the job is finished.
+type ProgressHook func(job AnalysisJob, progress AnalyzeProgress)
+
+const processedRowsQuery = "SELECT SUM(processed_rows) FROM mysql.analyze_jobs WHERE process_id IN (%?) AND state = 'running'"
+
+// collect collects the progress of all running analyze statements of the job.
+func (t *jobProcTracker) collect(statsHandle statstypes.StatsHandle, start time.Time) AnalyzeProgress {
+	progress := AnalyzeProgress{Elapsed: time.Since(start)}
+	t.mu.Lock()
+	procIDs := make([]string, 0, len(t.procs))
+	for id, proc := range t.procs {
+		procIDs = append(procIDs, strconv.FormatUint(id, 10))
+		if info := proc.ShowProcess(); info != nil && info.MemTracker != nil {
+			progress.MemoryUsage += info.MemTracker.BytesConsumed()
+		}
+	}
+	t.mu.Unlock()
+	if len(procIDs) == 0 {
+		return progress
+	}
+
+	err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		rows, _, err := statsutil.ExecRows(sctx, processedRowsQuery, procIDs)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 && !rows[0].IsNull(0) {
+			rowsScanned, err := rows[0].GetMyDecimal(0).ToInt()
+			if err != nil {
+				return err
+			}
+			progress.RowsScanned = rowsScanned
+		}
+		return nil
+	})
+	if err != nil {
+		statslogutil.StatsLogger().Warn("Failed to get the progress of analyze statements", zap.Error(err))
+	}
+	return progress
+}
+
+// reportProgress reports the progress of the job to the hook periodically until done is closed.
+func reportProgress(
+	job AnalysisJob,
+	hook ProgressHook,
+	statsHandle statstypes.StatsHandle,
+	tracker *jobProcTracker,
+	start time.Time,
+	done <-chan struct{},
+) {
+	ticker := time.NewTicker(ProgressReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			hook(job, tracker.collect(statsHandle, start))
+		}
+	}
+}
@@ -16,6 +16,10 @@ package priorityqueue
 
 import (
 	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,12 +42,77 @@ import (
 
 const notInitializedErrMsg = "priority queue not initialized"
 
+// ErrConcurrencyLimitReached is returned by Pop when popping another job would exceed the max concurrency.
+var ErrConcurrencyLimitReached = errors.New("would exceed the max concurrency of analysis jobs")
+
+// ErrQueueDraining is returned by Pop after Drain is called.
+var ErrQueueDraining = errors.New("priority queue is draining")
+
+// ErrQueuePaused is returned by Pop while the queue is paused.
+var ErrQueuePaused = errors.New("priority queue is paused")
+
+// ErrTablePaused is returned by Push when the table of the job is paused, see PauseTable.
+var ErrTablePaused = errors.New("auto analyze of the table is paused")
+
+// ErrStartRateLimited is returned by Pop when popping another job would exceed the start rate limit.
+var ErrStartRateLimited = errors.New("would exceed the start rate limit of analysis jobs")
+
+// ErrQueueFull is returned by Push when the queue reaches its max capacity and the pushed job is rejected.
+var ErrQueueFull = errors.New("priority queue is full")
+
+// ErrAnalysisCooldown is returned by Push when the table of the job is still in the cooldown after its last successful analysis.
+var ErrAnalysisCooldown = errors.New("the table is analyzed too recently")
+
+// ErrTableFiltered is returned by Push when the table of the job is excluded by the table filter, see WithTableFilter.
+var ErrTableFiltered = errors.New("the table is excluded from auto analyze")
+
+// ErrTableTooSmall is returned by Push when the table of the job is too small to analyze, see MinTableSizeToAnalyze.
+var ErrTableTooSmall = errors.New("the table is too small to analyze")
+
+// ErrTableChangesTooLittle is returned by Push when the table of the job changes too little to analyze, see MinChangePercentageToAnalyze.
+var ErrTableChangesTooLittle = errors.New("the table changes too little to analyze")
+
+// ErrTableMustRetry is returned by Push when the table of the job is waiting for the must retry jobs to be requeued.
+var ErrTableMustRetry = errors.New("the table is waiting to be retried")
+
+// ErrTableRunning is returned by Push when the table of the job is being analyzed.
+// The table is marked as must retry, so it is requeued after the running job is finished.
+var ErrTableRunning = errors.New("the table is being analyzed")
+
+// ErrCircuitBreakerTripped is returned by Push when the circuit breaker of the table of the job is tripped, see TrippedTables.
+var ErrCircuitBreakerTripped = errors.New("the circuit breaker of the table is tripped")
+
 const (
 	lastAnalysisDurationRefreshInterval = time.Minute * 10
 	dmlChangesFetchInterval             = time.Minute * 2
 	mustRetryJobRequeueInterval         = time.Minute * 5
+	drainCheckInterval                  = time.Millisecond * 100
 )
 
+// MinTableSizeToAnalyze is the min table size (rows * columns, see Indicators.TableSize) of a job to be pushed into the queue.
+// Analyzing very small tables or partitions brings little benefit but still takes a slot of the workers,
+// so the jobs of smaller tables are skipped, unless they have newly added indexes, which have no stats at all.
+// The default value is 0, which means no table is skipped.
+var MinTableSizeToAnalyze = 0.0
+
+// MinChangePercentageToAnalyze is the min change percentage (see Indicators.ChangePercentage) of a job to be pushed into the queue.
+// The tables with tiny change rates barely benefit from being analyzed again, so their jobs are skipped,
+// unless they have newly added indexes, which have no stats at all.
+// The default value is 0, which means no table is skipped, and the jobs found by the queue itself
+// are still limited by tidb_auto_analyze_ratio.
+var MinChangePercentageToAnalyze = 0.0
+
+// TransientFailureWeightPenalty is the weight penalty of a job rescheduled after a transient failure.
+// The job is requeued right away instead of waiting for the must retry jobs to be requeued,
+// but with a lower weight, so that it does not retry immediately and block the other jobs.
+var TransientFailureWeightPenalty = 1.0
+
+// AnalysisCooldown is the min time between the end of a successful analysis of a table or a partition
+// and the next push of its job, so that a churny table is not analyzed back to back.
+// The default value is 0, which means the cooldown is as long as the last analysis itself.
+// Set it to a negative value to disable the cooldown.
+var AnalysisCooldown time.Duration
+
 // If the process takes longer than this threshold, we will log it as a slow log.
 const slowLogThreshold = 150 * time.Millisecond
 
@@ -60,8 +129,14 @@ type pqHeap interface {
 	update(job AnalysisJob) error
 	// delete deletes a job from the heap.
 	delete(job AnalysisJob) error
+	// removeIf removes all jobs that satisfy the predicate from the heap and returns the number of removed jobs.
+	removeIf(pred func(AnalysisJob) bool) int
+	// updateAll calls fn for each job in the heap and then rebuilds the heap once.
+	updateAll(fn func(AnalysisJob))
 	// list returns all jobs in the heap.
 	list() []AnalysisJob
+	// forEach calls fn for each job in the heap without copying the jobs.
+	forEach(fn func(AnalysisJob))
 	// pop pops the job with the highest priority from the heap.
 	pop() (AnalysisJob, error)
 	// peek peeks the job with the highest priority from the heap without removing it.
@@ -72,6 +147,43 @@ type pqHeap interface {
 	len() int
 }
 
+// lenReportingHeap wraps a pqHeap to report the length of the heap whenever it changes.
+type lenReportingHeap struct {
+	pqHeap
+	hook func(length int)
+}
+
+func (h *lenReportingHeap) addOrUpdate(job AnalysisJob) error {
+	defer h.reportIfChanged(h.len())
+	return h.pqHeap.addOrUpdate(job)
+}
+
+func (h *lenReportingHeap) update(job AnalysisJob) error {
+	defer h.reportIfChanged(h.len())
+	return h.pqHeap.update(job)
+}
+
+func (h *lenReportingHeap) delete(job AnalysisJob) error {
+	defer h.reportIfChanged(h.len())
+	return h.pqHeap.delete(job)
+}
+
+func (h *lenReportingHeap) removeIf(pred func(AnalysisJob) bool) int {
+	defer h.reportIfChanged(h.len())
+	return h.pqHeap.removeIf(pred)
+}
+
+func (h *lenReportingHeap) pop() (AnalysisJob, error) {
+	defer h.reportIfChanged(h.len())
+	return h.pqHeap.pop()
+}
+
+func (h *lenReportingHeap) reportIfChanged(oldLen int) {
+	if newLen := h.len(); newLen != oldLen {
+		h.hook(newLen)
+	}
+}
+
 // AnalysisPriorityQueue is a priority queue for TableAnalysisJobs.
 // Testing shows that keeping all jobs in memory is feasible.
 // Memory usage for one million tables is approximately 300 to 500 MiB, which is acceptable.
@@ -82,6 +194,36 @@ type AnalysisPriorityQueue struct {
 	ctx         context.Context
 	statsHandle statstypes.StatsHandle
 	calculator  *PriorityCalculator
+	// weightCalculator calculates the weight of the jobs from their indicators.
+	weightCalculator WeightCalculator
+	// mergeDuplicateJobs indicates whether to merge the pushed job into the existing job with the same table ID.
+	mergeDuplicateJobs bool
+	// lenHook is called with the new length whenever the length of the queue changes.
+	lenHook func(length int)
+	// enqueueHook is called with the job whenever a job is pushed into the queue.
+	enqueueHook JobHook
+	// evictHook is called with the job whenever a queued job is evicted, see WithEvictHook.
+	evictHook JobHook
+	// rejectHook is called with the job and the reason whenever a pushed job is rejected, see WithRejectHook.
+	rejectHook RejectHook
+	// updateHook is called with the job and its weight delta whenever a queued job is updated, see WithUpdateHook.
+	updateHook UpdateHook
+	// completionHook is called with the job and its outcome whenever a popped job finishes, see WithCompletionHook.
+	completionHook CompletionHook
+	// maxCapacity is the max number of jobs in the queue. 0 means no limit.
+	maxCapacity int
+	// evictionPolicy decides which job is dropped when a job is pushed into a full queue.
+	evictionPolicy EvictionPolicy
+	// tableFilter decides which tables can be pushed into the queue. nil means all tables.
+	tableFilter *TableFilter
+	// startJitterWindow is the window over which the starts of the jobs are spread after the queue is initialized.
+	// 0 means no jitter, see WithStartJitter.
+	startJitterWindow time.Duration
+	// validityHook vetoes the popped jobs in addition to their built-in checks. nil means no additional check,
+	// see WithValidityHook.
+	validityHook ValidityHook
+	// tracer traces the execution of the popped jobs. nil means nothing is traced, see WithTracer.
+	tracer Tracer
 
 	wg util.WaitGroupWrapper
 
@@ -104,16 +246,253 @@ type AnalysisPriorityQueue struct {
 		//    particularly for tables with new indexes created during this process.
 		// We will requeue the must retry jobs periodically.
 		mustRetryJobs map[int64]struct{}
+		// breaker stops pushing the jobs of the tables that keep failing.
+		breaker *circuitBreaker
+		// cooldownUntil is the time until which the jobs of each recently analyzed table are rejected, see AnalysisCooldown.
+		cooldownUntil map[int64]time.Time
 		// initialized is a flag to check if the queue is initialized.
 		initialized bool
+		// initializedAt is the time when the queue is initialized, from which the start jitter is counted.
+		initializedAt time.Time
+		// draining indicates whether Drain is called. No more jobs can be popped once it is set.
+		draining bool
+		// maxConcurrency is the max number of running jobs. 0 means no limit.
+		// Unlike the other fields, it is kept when the queue is closed.
+		maxConcurrency int
+		// paused indicates whether Pause is called. No more jobs can be popped until Resume is called.
+		// Like maxConcurrency, it is kept when the queue is closed, so that a new owner does not resume the queue by accident.
+		paused bool
+		// pausedTables are the tables paused by PauseTable, whose jobs are neither pushed nor popped.
+		// Like paused, it is kept when the queue is closed.
+		pausedTables map[int64]struct{}
+		// hotTables are the tables reported by SetHotTables, whose jobs get HotTableWeightBoost.
+		// Like maxConcurrency, it is kept when the queue is closed.
+		hotTables map[int64]struct{}
+		// startLimiter limits how frequently the jobs are popped. nil means no limit.
+		// Like maxConcurrency, it is kept when the queue is closed.
+		startLimiter *startRateLimiter
+		// fairScheduling indicates whether Pop takes turns among the schemas instead of following the weights strictly.
+		// Like maxConcurrency, it is kept when the queue is closed.
+		fairScheduling bool
+		// lastPoppedSchema is the schema of the last job popped in the fair scheduling mode.
+		lastPoppedSchema string
+		// lastWeightDelta is the weight delta of the last job updated by Update. nil means no job has been updated.
+		lastWeightDelta *WeightDelta
+	}
+}
+
+// QueueOption is the option to create the AnalysisPriorityQueue.
+type QueueOption func(*AnalysisPriorityQueue)
+
+// WithoutJobMerging disables merging the jobs with the same table ID in Push.
+// The pushed job replaces the existing job instead.
+func WithoutJobMerging() QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.mergeDuplicateJobs = false
+	}
+}
+
+// WithLenHook registers a hook that is called with the new length whenever the length of the queue changes.
+// It can be used to export the depth of the auto-analyze backlog as a metric.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+func WithLenHook(hook func(length int)) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.lenHook = hook
+	}
+}
+
+// WithEnqueueHook registers a hook that is called whenever a job is pushed into the queue, with its final weight set.
+// Together with the success and failure hooks of the jobs, it can be used to trace the whole lifecycle of the jobs.
+// It is not called for the jobs that are skipped, e.g. because the table is running or too small.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+// Note: The job is owned by the queue, so the hook must not modify it or keep it after returning.
+func WithEnqueueHook(hook JobHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.enqueueHook = hook
+	}
+}
+
+// RejectReason is the stable code of the reason why a pushed job is rejected by the queue.
+type RejectReason string
+
+const (
+	// RejectReasonInvalid means the job is not valid, see AnalysisJob.Validate.
+	RejectReasonInvalid RejectReason = "invalid"
+	// RejectReasonFiltered means the table is excluded by the table filter, see WithTableFilter.
+	RejectReasonFiltered RejectReason = "filtered"
+	// RejectReasonMustRetry means the table is waiting for the must retry jobs to be requeued.
+	RejectReasonMustRetry RejectReason = "must_retry"
+	// RejectReasonRunning means the table is being analyzed. It is marked as must retry instead.
+	RejectReasonRunning RejectReason = "running"
+	// RejectReasonCircuitBreaker means the circuit breaker of the table is tripped.
+	RejectReasonCircuitBreaker RejectReason = "circuit_breaker"
+	// RejectReasonCooldown means the table is analyzed too recently, see AnalysisCooldown.
+	RejectReasonCooldown RejectReason = "cooldown"
+	// RejectReasonTooSmall means the table is too small to analyze, see MinTableSizeToAnalyze.
+	RejectReasonTooSmall RejectReason = "too_small"
+	// RejectReasonLowChange means the table changes too little to analyze, see MinChangePercentageToAnalyze.
+	RejectReasonLowChange RejectReason = "low_change"
+	// RejectReasonQueueFull means the queue is full, see WithMaxCapacity.
+	RejectReasonQueueFull RejectReason = "queue_full"
+	// RejectReasonTablePaused means the table is paused, see PauseTable.
+	RejectReasonTablePaused RejectReason = "table_paused"
+)
+
+// RejectHook is the function that is called when a pushed job is rejected by the queue.
+type RejectHook func(job AnalysisJob, reason RejectReason)
+
+// EvictionPolicy decides which job is dropped when a job is pushed into a full queue.
+type EvictionPolicy int
+
+const (
+	// EvictLowestWeight evicts the queued job with the lowest weight to make room for the pushed job.
+	// The pushed job is rejected instead if its weight is not higher than that of any queued job.
+	EvictLowestWeight EvictionPolicy = iota
+	// RejectNew always rejects the pushed job and keeps the queued jobs.
+	RejectNew
+)
+
+// WithMaxCapacity limits the number of jobs in the queue, so that the queue cannot grow unboundedly
+// and pin the memory on the clusters with a huge number of tables.
+// When a job of a table not in the queue is pushed into a full queue, the policy decides which job is dropped.
+// Push returns ErrQueueFull if the pushed job is dropped. The jobs found by the queue itself,
+// e.g. from the DML changes, are dropped silently, because they are found again later if still needed.
+// Use WithEvictHook to get notified when a queued job is evicted.
+// A non-positive capacity means no limit.
+func WithMaxCapacity(capacity int, policy EvictionPolicy) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.maxCapacity = max(capacity, 0)
+		pq.evictionPolicy = policy
+	}
+}
+
+// WithEvictHook registers a hook that is called whenever a queued job is evicted to make room for another job,
+// see WithMaxCapacity, or dropped by Reset. It can be used to alert when the queue keeps being full.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+// Note: The job is no longer in the queue, so the hook can keep it.
+func WithEvictHook(hook JobHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.evictHook = hook
+	}
+}
+
+// WithRejectHook registers a hook that is called whenever a pushed job is rejected, with the reason code.
+// It is called for the jobs pushed by Push as well as the jobs found by the queue itself, e.g. from the DML changes,
+// so that the reasons can be metered to understand why the expected analysis does not happen.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+// Note: The job is not in the queue, so the hook can keep it.
+func WithRejectHook(hook RejectHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.rejectHook = hook
+	}
+}
+
+// CompletionHook is the function that is called when a popped job finishes.
+type CompletionHook func(job AnalysisJob, succeeded bool)
+
+// WithCompletionHook registers a hook that is called with the outcome whenever a popped job finishes,
+// i.e. from the success or failure hook of the job registered by Pop.
+// A job rejected by AnalysisJob.IsValidToAnalyze also finishes as failed, see AnalysisJob.GetLastFailureReason.
+// A canceled job does not finish, so the hook is not called for it, see JobStateCanceled.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+// Note: The job is no longer in the queue, so the hook can keep it.
+func WithCompletionHook(hook CompletionHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.completionHook = hook
+	}
+}
+
+// WithWeightCalculator replaces the default formula used to calculate the weight of the jobs.
+// It allows different prioritization policies, e.g. favoring small tables or large stale tables.
+// The weight of the special events, such as newly added indexes, is still added on top of it.
+func WithWeightCalculator(calculator WeightCalculator) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.weightCalculator = calculator
+	}
+}
+
+// WithTableFilter excludes the tables rejected by the filter from the queue, see NewTableFilter.
+// It is used to skip the tables that are analyzed manually, e.g. the append-only logs or the staging tables.
+// Push returns ErrTableFiltered for the jobs of the excluded tables. The jobs found by the queue itself
+// are dropped silently.
+func WithTableFilter(filter *TableFilter) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.tableFilter = filter
+	}
+}
+
+// WithValidityHook registers a hook that is consulted by AnalysisJob.IsValidToAnalyze of the popped jobs
+// after their built-in checks pass, so that the deployments with custom rules, e.g. analyzing the tables
+// only when the replication lag is low, can veto the jobs without forking the validity logic.
+// A vetoed job is not a failure of the table, so the failure hook is not called, and the job is analyzed
+// once the hook allows it. The hook is registered to the jobs by Pop.
+func WithValidityHook(hook ValidityHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.validityHook = hook
+	}
+}
+
+// WithTracer traces the execution of the analyze statements of the popped jobs with the tracer,
+// e.g. to export the spans to OpenTelemetry. The tracer is set to the jobs by Pop.
+func WithTracer(tracer Tracer) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.tracer = tracer
+	}
+}
+
+// WithMaxConcurrency limits the number of jobs that are popped but not finished yet.
+// It can be adjusted at runtime by SetMaxConcurrency.
+func WithMaxConcurrency(maxConcurrency int) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.syncFields.maxConcurrency = maxConcurrency
+	}
+}
+
+// WithStartRateLimit limits how frequently the jobs are popped with a token bucket,
+// which holds at most burst tokens and is refilled with rate tokens per second.
+// For example, WithStartRateLimit(1.0/30, 1) allows starting at most one job every 30 seconds.
+// It smooths the load spikes when the backlog is large, e.g. after the owner restarts.
+// A non-positive rate means no limit.
+func WithStartRateLimit(rate float64, burst int) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		if rate <= 0 {
+			pq.syncFields.startLimiter = nil
+			return
+		}
+		pq.syncFields.startLimiter = newStartRateLimiter(rate, burst)
+	}
+}
+
+// WithStartJitter spreads the starts of the jobs over the window after the queue is initialized,
+// so that the jobs found by rebuilding the queue, e.g. after the owner changes, do not become runnable all at once.
+// The job of each table cannot be popped until a delay in [0, window) has passed since the initialization.
+// The delay is derived from the table ID, so the start order is reproducible.
+// The jobs are popped as usual after the window has passed. A non-positive window means no jitter.
+func WithStartJitter(window time.Duration) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.startJitterWindow = max(window, 0)
+	}
+}
+
+// WithFairScheduling makes Pop take turns among the schemas, so that a schema with a huge number of
+// frequently changed tables cannot monopolize the queue, e.g. in the multi-tenant clusters.
+// It can be toggled at runtime by SetFairScheduling.
+func WithFairScheduling() QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.syncFields.fairScheduling = true
 	}
 }
 
 // NewAnalysisPriorityQueue creates a new AnalysisPriorityQueue2.
-func NewAnalysisPriorityQueue(handle statstypes.StatsHandle) *AnalysisPriorityQueue {
+func NewAnalysisPriorityQueue(handle statstypes.StatsHandle, opts ...QueueOption) *AnalysisPriorityQueue {
 	queue := &AnalysisPriorityQueue{
-		statsHandle: handle,
-		calculator:  NewPriorityCalculator(),
+		statsHandle:        handle,
+		calculator:         NewPriorityCalculator(),
+		weightCalculator:   DefaultWeightCalculator,
+		mergeDuplicateJobs: true,
+	}
+	for _, opt := range opts {
+		opt(queue)
 	}
 
 	return queue
@@ -143,7 +522,11 @@ func (pq *AnalysisPriorityQueue) Initialize() error {
 		statslogutil.StatsLogger().Info("Priority queue initialized", zap.Duration("duration", time.Since(start)))
 	}()
 
+	// Restore the circuit breakers before building the jobs, so that the tables that keep failing are not pushed.
+	breaker := pq.loadCircuitBreaker()
+
 	pq.syncFields.mu.Lock()
+	pq.syncFields.breaker = breaker
 	if err := pq.rebuildWithoutLock(); err != nil {
 		pq.syncFields.mu.Unlock()
 		pq.Close()
@@ -155,7 +538,10 @@ func (pq *AnalysisPriorityQueue) Initialize() error {
 	pq.syncFields.cancel = cancel
 	pq.syncFields.runningJobs = make(map[int64]struct{})
 	pq.syncFields.mustRetryJobs = make(map[int64]struct{})
+	pq.syncFields.cooldownUntil = make(map[int64]time.Time)
+	pq.syncFields.draining = false
 	pq.syncFields.initialized = true
+	pq.syncFields.initializedAt = DefaultClock.Now()
 	pq.syncFields.mu.Unlock()
 
 	// Start a goroutine to maintain the priority queue.
@@ -163,6 +549,34 @@ func (pq *AnalysisPriorityQueue) Initialize() error {
 	return nil
 }
 
+// loadCircuitBreaker creates a circuit breaker with the consecutive failures restored from mysql.analyze_outcomes.
+// It falls back to an empty circuit breaker if the outcomes cannot be loaded.
+func (pq *AnalysisPriorityQueue) loadCircuitBreaker() *circuitBreaker {
+	var breaker *circuitBreaker
+	err := statsutil.CallWithSCtx(pq.statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		var err error
+		breaker, err = loadCircuitBreaker(sctx)
+		return err
+	})
+	if err != nil {
+		statslogutil.StatsLogger().Warn("Failed to restore the circuit breakers from the analyze outcomes", zap.Error(err))
+		return newCircuitBreaker()
+	}
+	return breaker
+}
+
+// recordOutcome records the outcome of the job in mysql.analyze_outcomes, so that the circuit breaker
+// of the table is restored after the owner changes. The error is only logged, because the circuit breaker
+// in memory is updated anyway.
+func (pq *AnalysisPriorityQueue) recordOutcome(job AnalysisJob, succeeded bool) {
+	err := statsutil.CallWithSCtx(pq.statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		return recordAnalysisOutcome(sctx, job.GetTableID(), succeeded, DefaultClock.Now())
+	})
+	if err != nil {
+		statslogutil.StatsLogger().Warn("Failed to record the analyze outcome", zap.Error(err), zap.Stringer("job", job))
+	}
+}
+
 // Rebuild rebuilds the priority queue.
 // Note: This function is thread-safe.
 func (pq *AnalysisPriorityQueue) Rebuild() error {
@@ -176,10 +590,20 @@ func (pq *AnalysisPriorityQueue) Rebuild() error {
 	return pq.rebuildWithoutLock()
 }
 
+// newInnerHeap creates an empty heap for the priority queue.
+func (pq *AnalysisPriorityQueue) newInnerHeap() pqHeap {
+	if pq.lenHook == nil {
+		return newHeap()
+	}
+	// The queue is reset to empty.
+	pq.lenHook(0)
+	return &lenReportingHeap{pqHeap: newHeap(), hook: pq.lenHook}
+}
+
 // rebuildWithoutLock rebuilds the priority queue without holding the lock.
 // Note: Please hold the lock before calling this function.
 func (pq *AnalysisPriorityQueue) rebuildWithoutLock() error {
-	pq.syncFields.inner = newHeap()
+	pq.syncFields.inner = pq.newInnerHeap()
 
 	// We need to fetch the next check version with offset before fetching all tables and building analysis jobs.
 	// Otherwise, we may miss some DML changes happened during the process because this operation takes time.
@@ -266,14 +690,7 @@ func (pq *AnalysisPriorityQueue) fetchAllTablesAndBuildAnalysisJobs() error {
 				partitionStats := GetPartitionStats(pq.statsHandle, tblInfo, partitionDefs)
 				// If the prune mode is static, we need to analyze every partition as a separate table.
 				if pruneMode == variable.Static {
-					for pIDAndName, stats := range partitionStats {
-						job := jobFactory.CreateStaticPartitionAnalysisJob(
-							db.O,
-							tblInfo,
-							pIDAndName.ID,
-							pIDAndName.Name,
-							stats,
-						)
+					for _, job := range jobFactory.CreateStaticPartitionAnalysisJobs(db.O, tblInfo, partitionStats) {
 						err := pq.pushWithoutLock(job)
 						if err != nil {
 							return err
@@ -591,6 +1008,7 @@ func (pq *AnalysisPriorityQueue) tryUpdateJob(
 	// Otherwise, we update the indicators of the job.
 	indicators.ChangePercentage = jobFactory.CalculateChangePercentage(stats)
 	indicators.TableSize = jobFactory.CalculateTableSize(stats)
+	indicators.EstimatedRows = stats.RealtimeCount
 	oldJob.SetIndicators(indicators)
 	return oldJob
 }
@@ -679,8 +1097,9 @@ func (pq *AnalysisPriorityQueue) RefreshLastAnalysisDuration() {
 				}
 			}
 			indicators.LastAnalysisDuration = jobFactory.GetTableLastAnalyzeDuration(tableStats)
+			indicators.LastAnalyzeTime = jobFactory.FindLastAnalyzeTime(tableStats)
 			job.SetIndicators(indicators)
-			job.SetWeight(pq.calculator.CalculateWeight(job))
+			job.SetWeight(pq.calculateWeight(job))
 			if err := pq.syncFields.inner.update(job); err != nil {
 				statslogutil.StatsLogger().Error("Failed to add job to priority queue",
 					zap.Error(err),
@@ -709,6 +1128,18 @@ func (pq *AnalysisPriorityQueue) GetRunningJobs() map[int64]struct{} {
 }
 
 // Push pushes a job into the priority queue.
+// If there is already a job with the same table ID in the queue, the two jobs are merged by default:
+// the higher weight is kept and the newly added indexes are unioned.
+// Use WithoutJobMerging to replace the existing job instead.
+// It returns an error if the job is not valid, see AnalysisJob.Validate.
+// It returns ErrQueueFull if the queue is full and the job is rejected, see WithMaxCapacity.
+// It returns ErrAnalysisCooldown if the table is analyzed too recently, see AnalysisCooldown.
+// It returns ErrTableFiltered if the table is excluded by the table filter, see WithTableFilter.
+// It returns ErrTablePaused if the table is paused, see PauseTable.
+// It returns ErrTableTooSmall if the table is too small to analyze, see MinTableSizeToAnalyze.
+// It returns ErrTableChangesTooLittle if the table changes too little to analyze, see MinChangePercentageToAnalyze.
+// It returns ErrTableMustRetry, ErrTableRunning or ErrCircuitBreakerTripped if the table is waiting to be retried,
+// being analyzed or held back by the circuit breaker.
 // Note: This function is thread-safe.
 func (pq *AnalysisPriorityQueue) Push(job AnalysisJob) error {
 	pq.syncFields.mu.Lock()
@@ -716,18 +1147,98 @@ func (pq *AnalysisPriorityQueue) Push(job AnalysisJob) error {
 	if !pq.syncFields.initialized {
 		return errors.New(notInitializedErrMsg)
 	}
+	if job != nil {
+		if err := job.Validate(); err != nil {
+			pq.rejectWithoutLock(job, RejectReasonInvalid)
+			return err
+		}
+	}
+	return pq.pushOrMergeWithoutLock(job)
+}
 
-	return pq.pushWithoutLock(job)
+// pushOrMergeWithoutLock pushes the job into the queue, merging it into the existing job of the same table if enabled.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) pushOrMergeWithoutLock(job AnalysisJob) error {
+	return pq.pushOrMergeWithPenaltyWithoutLock(job, 0)
+}
+
+// pushOrMergeWithPenaltyWithoutLock is like pushOrMergeWithoutLock, but lowers the weight of the pushed job by the penalty.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) pushOrMergeWithPenaltyWithoutLock(job AnalysisJob, penalty float64) error {
+	if !pq.mergeDuplicateJobs || job == nil {
+		return pq.pushWithMinWeightWithoutLock(job, math.Inf(-1), penalty)
+	}
+
+	existing, ok, err := pq.syncFields.inner.getByKey(job.GetTableID())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !ok {
+		return pq.pushWithMinWeightWithoutLock(job, math.Inf(-1), penalty)
+	}
+	// Keep the higher weight so that merging never lowers the priority of the table.
+	// The aging boost is excluded here because the merged job inherits the enqueue time of the existing job.
+	minWeight := existing.GetBaseWeight()
+	return pq.pushWithMinWeightWithoutLock(mergeAnalysisJobs(existing, job), minWeight, penalty)
 }
+
+// pushWithoutLock pushes the job found by the queue itself into the queue.
+// The job is dropped silently if it is rejected by the queue on purpose, e.g. the queue is full
+// or the table is in the cooldown, because it is found again later if still needed.
+// Note: Please hold the lock before calling this function.
 func (pq *AnalysisPriorityQueue) pushWithoutLock(job AnalysisJob) error {
+	return ignoreRejection(pq.pushWithMinWeightWithoutLock(job, math.Inf(-1), 0))
+}
+
+// rejectionErrors are the errors of the jobs that are rejected by the queue on purpose, one for each RejectReason
+// except RejectReasonInvalid.
+var rejectionErrors = []error{
+	ErrTableFiltered,
+	ErrTablePaused,
+	ErrTableMustRetry,
+	ErrTableRunning,
+	ErrCircuitBreakerTripped,
+	ErrAnalysisCooldown,
+	ErrTableTooSmall,
+	ErrTableChangesTooLittle,
+	ErrQueueFull,
+}
+
+// ignoreRejection ignores the errors of the jobs that are rejected by the queue on purpose.
+func ignoreRejection(err error) error {
+	if isRejection(err) {
+		return nil
+	}
+	return err
+}
+
+// isRejection checks whether the error is returned because the job is rejected by the queue on purpose.
+func isRejection(err error) bool {
+	return slices.ContainsFunc(rejectionErrors, func(target error) bool {
+		return errors.ErrorEqual(err, target)
+	})
+}
+
+// pushWithMinWeightWithoutLock pushes the job into the queue with a weight no less than minWeight,
+// and then lowers the weight by the penalty.
+func (pq *AnalysisPriorityQueue) pushWithMinWeightWithoutLock(job AnalysisJob, minWeight, penalty float64) error {
 	if job == nil {
 		return nil
 	}
+	if !pq.tableFilter.IsAllowed(job.GetSchemaName(), job.GetTableName()) {
+		pq.rejectWithoutLock(job, RejectReasonFiltered)
+		return errors.Annotatef(ErrTableFiltered, "table %s.%s", job.GetSchemaName(), job.GetTableName())
+	}
+	if pq.isTablePausedWithoutLock(job) {
+		pq.rejectWithoutLock(job, RejectReasonTablePaused)
+		return errors.Annotatef(ErrTablePaused, "table %s.%s", job.GetSchemaName(), job.GetTableName())
+	}
 	// Skip the must retry jobs.
 	// Avoiding requeueing the must retry jobs before the next must retry job requeue interval.
 	// Otherwise, we may requeue the same job multiple times in a short time.
 	if _, ok := pq.syncFields.mustRetryJobs[job.GetTableID()]; ok {
-		return nil
+		pq.rejectWithoutLock(job, RejectReasonMustRetry)
+		return errors.Annotatef(ErrTableMustRetry, "table %s.%s", job.GetSchemaName(), job.GetTableName())
 	}
 
 	// Skip the current running jobs.
@@ -743,11 +1254,50 @@ func (pq *AnalysisPriorityQueue) pushWithoutLock(job AnalysisJob) error {
 		// Because potentially the job can be analyzed in the near future.
 		// For example, the table has new indexes added when the job is running.
 		pq.syncFields.mustRetryJobs[job.GetTableID()] = struct{}{}
-		return nil
+		pq.rejectWithoutLock(job, RejectReasonRunning)
+		return errors.Annotatef(ErrTableRunning, "table %s.%s", job.GetSchemaName(), job.GetTableName())
+	}
+	// Skip the tables that keep failing until the cooldown expires.
+	if pq.syncFields.breaker.isTripped(job.GetTableID(), DefaultClock.Now()) {
+		pq.rejectWithoutLock(job, RejectReasonCircuitBreaker)
+		return errors.Annotatef(ErrCircuitBreakerTripped, "table %s.%s", job.GetSchemaName(), job.GetTableName())
+	}
+	if until, ok := pq.syncFields.cooldownUntil[job.GetTableID()]; ok {
+		if now := DefaultClock.Now(); now.Before(until) {
+			pq.rejectWithoutLock(job, RejectReasonCooldown)
+			return errors.Annotatef(ErrAnalysisCooldown, "table %d can be pushed again in %v", job.GetTableID(), until.Sub(now))
+		}
+		delete(pq.syncFields.cooldownUntil, job.GetTableID())
+	}
+	if isTooSmallToAnalyze(job) {
+		// The table may have shrunk since it was queued, so the queued job is removed as well.
+		if existing, ok, err := pq.syncFields.inner.getByKey(job.GetTableID()); err == nil && ok {
+			if err := pq.syncFields.inner.delete(existing); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		statslogutil.StatsLogger().Debug(
+			"Skip the table because it is too small",
+			zap.Float64("tableSize", job.GetIndicators().TableSize),
+			zap.Float64("minTableSize", MinTableSizeToAnalyze),
+			zap.Stringer("job", job),
+		)
+		pq.rejectWithoutLock(job, RejectReasonTooSmall)
+		return errors.Annotatef(ErrTableTooSmall, "table %s.%s", job.GetSchemaName(), job.GetTableName())
+	}
+	if changesTooLittleToAnalyze(job) {
+		statslogutil.StatsLogger().Debug(
+			"Skip the table because it changes too little",
+			zap.Float64("changePercentage", job.GetIndicators().ChangePercentage),
+			zap.Float64("minChangePercentage", MinChangePercentageToAnalyze),
+			zap.Stringer("job", job),
+		)
+		pq.rejectWithoutLock(job, RejectReasonLowChange)
+		return errors.Annotatef(ErrTableChangesTooLittle, "table %s.%s", job.GetSchemaName(), job.GetTableName())
 	}
 	// We apply a penalty to larger tables, which can potentially result in a negative weight.
 	// To prevent this, we filter out any negative weights. Under normal circumstances, table sizes should not be negative.
-	weight := pq.calculator.CalculateWeight(job)
+	weight := pq.calculateWeight(job)
 	if weight <= 0 {
 		statslogutil.SingletonStatsSamplerLogger().Warn(
 			"Table gets a negative weight",
@@ -755,85 +1305,1004 @@ func (pq *AnalysisPriorityQueue) pushWithoutLock(job AnalysisJob) error {
 			zap.Stringer("job", job),
 		)
 	}
-	job.SetWeight(weight)
-	return pq.syncFields.inner.addOrUpdate(job)
+	job.SetWeight(max(weight, minWeight) - penalty)
+	// Keep the enqueue time of the job that is already in the queue, so that re-pushing
+	// the same table does not reset its waiting time and the aging boost.
+	if existing, ok, err := pq.syncFields.inner.getByKey(job.GetTableID()); err == nil && ok {
+		if enqueuedAt := existing.GetEnqueuedAt(); !enqueuedAt.IsZero() &&
+			(job.GetEnqueuedAt().IsZero() || enqueuedAt.Before(job.GetEnqueuedAt())) {
+			job.SetEnqueuedAt(enqueuedAt)
+		}
+	}
+	if job.GetEnqueuedAt().IsZero() {
+		job.SetEnqueuedAt(DefaultClock.Now())
+	}
+	// Updating a queued job does not grow the queue, so only the jobs of the new tables need room.
+	if _, ok, err := pq.syncFields.inner.getByKey(job.GetTableID()); err == nil && !ok {
+		if err := pq.makeRoomWithoutLock(job); err != nil {
+			return err
+		}
+	}
+	setJobState(job, JobStateQueued)
+	if err := pq.syncFields.inner.addOrUpdate(job); err != nil {
+		return err
+	}
+	if pq.enqueueHook != nil {
+		pq.enqueueHook(job)
+	}
+	return nil
 }
 
-// Pop pops a job from the priority queue and marks it as running.
-// Note: This function is thread-safe.
-func (pq *AnalysisPriorityQueue) Pop() (AnalysisJob, error) {
-	pq.syncFields.mu.Lock()
-	defer pq.syncFields.mu.Unlock()
-	if !pq.syncFields.initialized {
-		return nil, errors.New(notInitializedErrMsg)
+// makeRoomWithoutLock makes room for the job if the queue is full, according to the eviction policy.
+// It returns ErrQueueFull if the job is rejected.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) makeRoomWithoutLock(job AnalysisJob) error {
+	if pq.maxCapacity <= 0 || pq.syncFields.inner.len() < pq.maxCapacity {
+		return nil
+	}
+	var lowest AnalysisJob
+	if pq.evictionPolicy == EvictLowestWeight {
+		// Find the last job in the order of the heap, see heapData.Less.
+		pq.syncFields.inner.forEach(func(j AnalysisJob) {
+			if lowest == nil || compareJobs(j, lowest) > 0 {
+				lowest = j
+			}
+		})
+	}
+	// Evicting a job with the same weight brings no benefit, so the queued job is kept.
+	if lowest == nil || agingOrderKey(job) <= agingOrderKey(lowest) {
+		statslogutil.SingletonStatsSamplerLogger().Warn(
+			"Reject the job because the priority queue is full",
+			zap.Int("maxCapacity", pq.maxCapacity),
+			zap.Stringer("job", job),
+		)
+		pq.rejectWithoutLock(job, RejectReasonQueueFull)
+		return ErrQueueFull
+	}
+	// The heap stays consistent after removing any job from the middle of it.
+	if err := pq.syncFields.inner.delete(lowest); err != nil {
+		return errors.Trace(err)
+	}
+	statslogutil.SingletonStatsSamplerLogger().Warn(
+		"Evict the job with the lowest weight because the priority queue is full",
+		zap.Int("maxCapacity", pq.maxCapacity),
+		zap.Stringer("evictedJob", lowest),
+		zap.Stringer("job", job),
+	)
+	if pq.evictHook != nil {
+		pq.evictHook(lowest)
 	}
+	return nil
+}
 
-	job, err := pq.syncFields.inner.pop()
-	if err != nil {
-		return nil, errors.Trace(err)
+// rejectWithoutLock calls the reject hook, if any, with the rejected job and the reason.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) rejectWithoutLock(job AnalysisJob, reason RejectReason) {
+	if pq.rejectHook != nil {
+		pq.rejectHook(job, reason)
 	}
-	pq.syncFields.runningJobs[job.GetTableID()] = struct{}{}
+}
 
-	job.RegisterSuccessHook(func(j AnalysisJob) {
-		pq.syncFields.mu.Lock()
-		defer pq.syncFields.mu.Unlock()
-		delete(pq.syncFields.runningJobs, j.GetTableID())
-	})
-	job.RegisterFailureHook(func(j AnalysisJob) {
-		pq.syncFields.mu.Lock()
-		defer pq.syncFields.mu.Unlock()
-		// Mark the job as failed and remove it from the running jobs.
-		delete(pq.syncFields.runningJobs, j.GetTableID())
-		pq.syncFields.mustRetryJobs[j.GetTableID()] = struct{}{}
-	})
-	return job, nil
+// isTooSmallToAnalyze checks whether the table of the job is smaller than MinTableSizeToAnalyze.
+// The jobs with newly added indexes and the quick analysis jobs are never considered too small,
+// because the size of a newly created partition is not known yet.
+func isTooSmallToAnalyze(job AnalysisJob) bool {
+	return job.GetIndicators().TableSize < MinTableSizeToAnalyze && !job.HasNewlyAddedIndex() && !isQuickAnalysisJob(job)
 }
 
-// Peek peeks the top job from the priority queue.
-func (pq *AnalysisPriorityQueue) Peek() (AnalysisJob, error) {
+// changesTooLittleToAnalyze checks whether the change percentage of the job is lower than MinChangePercentageToAnalyze.
+// The jobs with newly added indexes are always analyzed.
+func changesTooLittleToAnalyze(job AnalysisJob) bool {
+	return job.GetIndicators().ChangePercentage < MinChangePercentageToAnalyze && !job.HasNewlyAddedIndex()
+}
+
+// PushStaticPartitionsByPattern pushes a job for each static partition of the table whose name matches the pattern,
+// so that the users do not have to enumerate a large number of partitions. The pattern is resolved against
+// the current info schema. It returns the number of matching partitions.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) PushStaticPartitionsByPattern(pattern StaticPartitionPattern) (int, error) {
 	pq.syncFields.mu.Lock()
 	defer pq.syncFields.mu.Unlock()
 	if !pq.syncFields.initialized {
-		return nil, errors.New(notInitializedErrMsg)
+		return 0, errors.New(notInitializedErrMsg)
 	}
 
-	return pq.syncFields.inner.peek()
+	matched := 0
+	err := statsutil.CallWithSCtx(pq.statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		parameters := exec.GetAutoAnalyzeParameters(sctx)
+		autoAnalyzeRatio := exec.ParseAutoAnalyzeRatio(parameters[variable.TiDBAutoAnalyzeRatio])
+		currentTs, err := statsutil.GetStartTS(sctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		jobFactory := NewAnalysisJobFactory(sctx, autoAnalyzeRatio, currentTs)
+		is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+		jobs, err := jobFactory.CreateStaticPartitionAnalysisJobsByPattern(is, pq.statsHandle, pattern)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			// The partitions in the cooldown are skipped, like the other partitions that are not pushed.
+			if err := ignoreRejection(pq.pushOrMergeWithoutLock(job)); err != nil {
+				return err
+			}
+		}
+		matched = len(jobs)
+		return nil
+	}, statsutil.FlagWrapTxn)
+	return matched, err
 }
 
-// IsEmpty checks whether the priority queue is empty.
+// Update updates the indicators of the queued job for the given table and recomputes its weight,
+// so that the priority of the job stays current without popping and re-pushing it.
+// The position of the job in the queue is fixed in O(log n) time.
+// The change of the weight is recorded, see LastWeightDelta and WithUpdateHook.
+// It returns an error if there is no such job in the priority queue.
 // Note: This function is thread-safe.
-func (pq *AnalysisPriorityQueue) IsEmpty() (bool, error) {
-	pq.syncFields.mu.RLock()
-	defer pq.syncFields.mu.RUnlock()
+func (pq *AnalysisPriorityQueue) Update(tableID int64, indicators Indicators) error {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
 	if !pq.syncFields.initialized {
-		return false, errors.New(notInitializedErrMsg)
+		return errors.New(notInitializedErrMsg)
 	}
 
-	return pq.syncFields.inner.isEmpty(), nil
+	job, ok, err := pq.syncFields.inner.getByKey(tableID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !ok {
+		return errors.Errorf("job for table %d not found in the priority queue", tableID)
+	}
+	delta := WeightDelta{
+		TableID:      tableID,
+		OldWeight:    job.GetWeight(),
+		OldBreakdown: job.GetWeightBreakdown(),
+	}
+	job.SetIndicators(indicators)
+	job.SetWeight(pq.calculateWeight(job))
+	if err := pq.syncFields.inner.update(job); err != nil {
+		return errors.Trace(err)
+	}
+	delta.NewWeight = job.GetWeight()
+	delta.NewBreakdown = job.GetWeightBreakdown()
+	pq.syncFields.lastWeightDelta = &delta
+	if pq.updateHook != nil {
+		pq.updateHook(job, delta)
+	}
+	return nil
 }
 
-// Len returns the number of jobs in the priority queue.
+// WeightDelta records how the weight of a queued job changes in Update,
+// which explains why the job suddenly rises or falls in the queue after its indicators are refreshed.
+type WeightDelta struct {
+	// OldBreakdown is the weight breakdown before the update, see AnalysisJob.GetWeightBreakdown.
+	OldBreakdown map[string]float64
+	// NewBreakdown is the weight breakdown after the update.
+	NewBreakdown map[string]float64
+	TableID      int64
+	OldWeight    float64
+	NewWeight    float64
+}
+
+// Changes returns the change of each term of the weight breakdown, i.e. the new term minus the old term.
+// A term missing in one of the breakdowns is treated as 0.
+func (d WeightDelta) Changes() map[string]float64 {
+	changes := make(map[string]float64, len(d.NewBreakdown))
+	for key, value := range d.NewBreakdown {
+		changes[key] = value
+	}
+	for key, value := range d.OldBreakdown {
+		changes[key] -= value
+	}
+	return changes
+}
+
+// UpdateHook is the function that is called when a queued job is updated by Update.
+type UpdateHook func(job AnalysisJob, delta WeightDelta)
+
+// WithUpdateHook registers a hook that is called with the weight delta whenever a queued job is updated by Update,
+// which helps to debug the churn of the priorities. The last delta can also be got by LastWeightDelta.
+// Note: The hook is called with the queue lock held, so it must not call any method of the queue.
+// Note: The job is owned by the queue, so the hook must not modify it or keep it after returning.
+func WithUpdateHook(hook UpdateHook) QueueOption {
+	return func(pq *AnalysisPriorityQueue) {
+		pq.updateHook = hook
+	}
+}
+
+// LastWeightDelta returns the weight delta of the last job updated by Update.
+// It returns false if no job has been updated yet.
 // Note: This function is thread-safe.
-func (pq *AnalysisPriorityQueue) Len() (int, error) {
+func (pq *AnalysisPriorityQueue) LastWeightDelta() (WeightDelta, bool) {
 	pq.syncFields.mu.RLock()
 	defer pq.syncFields.mu.RUnlock()
-	if !pq.syncFields.initialized {
-		return 0, errors.New(notInitializedErrMsg)
+	if pq.syncFields.lastWeightDelta == nil {
+		return WeightDelta{}, false
 	}
-
-	return pq.syncFields.inner.len(), nil
+	return *pq.syncFields.lastWeightDelta, true
 }
 
-// Close closes the priority queue.
+// RecomputeAll recalculates the weights of all queued jobs with the current weight calculator and hot tables,
+// so that the jobs queued before the inputs of the weight calculator change are ordered by the same policy as the new ones.
+// The queue is rebuilt once in O(n) time, which is much cheaper than updating the jobs one by one in O(n log n) time.
+// Like Update, the weights added by Boost and the penalties of the rescheduled jobs are discarded.
 // Note: This function is thread-safe.
-func (pq *AnalysisPriorityQueue) Close() {
+func (pq *AnalysisPriorityQueue) RecomputeAll() error {
 	pq.syncFields.mu.Lock()
 	defer pq.syncFields.mu.Unlock()
 	if !pq.syncFields.initialized {
-		return
+		return errors.New(notInitializedErrMsg)
 	}
 
-	// It is possible that the priority queue is not initialized.
+	start := time.Now()
+	pq.syncFields.inner.updateAll(func(job AnalysisJob) {
+		job.SetWeight(pq.calculateWeight(job))
+	})
+	if duration := time.Since(start); duration > slowLogThreshold {
+		queueSamplerLogger().Info("Weights of all jobs recomputed",
+			zap.Duration("duration", duration),
+			zap.Int("jobs", pq.syncFields.inner.len()),
+		)
+	}
+	return nil
+}
+
+// Boost increases the weight of the queued job of the table by extra and fixes its position in the queue,
+// so that the operators can move a table that urgently needs fresh stats, e.g. after a big import, to the front.
+// If the table has no job in the queue, a job is created from the current stats of the table,
+// and its weight is increased by extra as well. The id is the same as AnalysisJob.GetTableID,
+// i.e. the ID of the static partition for the static partitioned tables.
+// It returns an error if the table is running, its circuit breaker is tripped, or no job can be created for it,
+// e.g. because the table is locked or has no changes to analyze.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Boost(id int64, extra float64) error {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return errors.New(notInitializedErrMsg)
+	}
+	if !(extra > 0) {
+		return errors.Errorf("extra weight %v must be positive", extra)
+	}
+	if _, ok := pq.syncFields.runningJobs[id]; ok {
+		return errors.Errorf("job for table %d is running", id)
+	}
+	if pq.syncFields.breaker.isTripped(id, DefaultClock.Now()) {
+		return errors.Errorf("circuit breaker of table %d is tripped", id)
+	}
+
+	job, ok, err := pq.syncFields.inner.getByKey(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if ok {
+		job.SetWeight(job.GetBaseWeight() + extra)
+		return pq.syncFields.inner.update(job)
+	}
+
+	job, err = pq.createJobWithoutLock(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if job == nil {
+		return errors.Errorf("no analysis job can be created for table %d", id)
+	}
+	// The boosted job takes the place of the must retry job of the table.
+	delete(pq.syncFields.mustRetryJobs, id)
+	// A negative penalty increases the weight.
+	return pq.pushWithMinWeightWithoutLock(job, math.Inf(-1), -extra)
+}
+
+// createJobWithoutLock creates the job of the table from its current stats, like ProcessDMLChanges.
+// It returns nil if the table does not exist or does not need to be analyzed.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) createJobWithoutLock(id int64) (AnalysisJob, error) {
+	stats, ok := pq.statsHandle.Get(id)
+	if !ok {
+		return nil, nil
+	}
+	var job AnalysisJob
+	err := statsutil.CallWithSCtx(pq.statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		parameters := exec.GetAutoAnalyzeParameters(sctx)
+		autoAnalyzeRatio := exec.ParseAutoAnalyzeRatio(parameters[variable.TiDBAutoAnalyzeRatio])
+		currentTs, err := statsutil.GetStartTS(sctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		lockedTables, err := lockstats.QueryLockedTables(statsutil.StatsCtx, sctx)
+		if err != nil {
+			return err
+		}
+		jobFactory := NewAnalysisJobFactory(sctx, autoAnalyzeRatio, currentTs)
+		is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+		pruneMode := variable.PartitionPruneMode(sctx.GetSessionVars().PartitionPruneMode.Load())
+		job = pq.tryCreateJob(is, stats, pruneMode, jobFactory, lockedTables)
+		return nil
+	}, statsutil.FlagWrapTxn)
+	return job, err
+}
+
+// calculateWeight calculates the weight of the job with the weight calculator of the queue.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) calculateWeight(job AnalysisJob) float64 {
+	weight := pq.weightCalculator(job.GetIndicators()) + pq.calculator.GetSpecialEvent(job)
+	if _, ok := pq.syncFields.hotTables[job.GetTableID()]; ok {
+		weight += HotTableWeightBoost
+	}
+	return weight
+}
+
+// SetHotTables replaces the set of the tables that are queried heavily, e.g. collected from the plan cache
+// or the statement summary, so that their jobs get HotTableWeightBoost and are analyzed earlier.
+// The table IDs are compared with AnalysisJob.GetTableID, so the IDs of the static partitions should be reported
+// for the static partitioned tables.
+// The weights of the queued jobs whose hotness changes are recalculated immediately.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) SetHotTables(tableIDs []int64) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	oldHotTables := pq.syncFields.hotTables
+	pq.syncFields.hotTables = make(map[int64]struct{}, len(tableIDs))
+	for _, tableID := range tableIDs {
+		pq.syncFields.hotTables[tableID] = struct{}{}
+	}
+	if !pq.syncFields.initialized {
+		return
+	}
+
+	changed := make([]int64, 0, len(oldHotTables)+len(tableIDs))
+	for tableID := range oldHotTables {
+		if _, ok := pq.syncFields.hotTables[tableID]; !ok {
+			changed = append(changed, tableID)
+		}
+	}
+	for tableID := range pq.syncFields.hotTables {
+		if _, ok := oldHotTables[tableID]; !ok {
+			changed = append(changed, tableID)
+		}
+	}
+	for _, tableID := range changed {
+		job, ok, err := pq.syncFields.inner.getByKey(tableID)
+		if err != nil || !ok {
+			continue
+		}
+		job.SetWeight(pq.calculateWeight(job))
+		if err := pq.syncFields.inner.update(job); err != nil {
+			statslogutil.StatsLogger().Warn("Failed to update the weight of the hot table", zap.Error(err), zap.Stringer("job", job))
+		}
+	}
+}
+
+// Pop pops a job from the priority queue and marks it as running.
+// The job is marked as finished when it succeeds or fails.
+// It returns ErrConcurrencyLimitReached without popping any job if the number of running jobs reaches the max concurrency.
+// It returns ErrStartRateLimited without popping any job if the start rate limit is reached, see WithStartRateLimit.
+// It returns ErrQueueDraining if the queue is being drained.
+// The jobs of the paused tables are skipped and kept in the queue, see PauseTable.
+// So are the jobs whose starts are delayed by the jitter, see WithStartJitter.
+// It returns ErrHeapIsEmpty if no job can be popped.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Pop() (AnalysisJob, error) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return nil, errors.New(notInitializedErrMsg)
+	}
+	if pq.syncFields.draining {
+		return nil, ErrQueueDraining
+	}
+	if pq.syncFields.paused {
+		return nil, ErrQueuePaused
+	}
+
+	if pq.syncFields.maxConcurrency > 0 && len(pq.syncFields.runningJobs) >= pq.syncFields.maxConcurrency {
+		return nil, ErrConcurrencyLimitReached
+	}
+	if pq.syncFields.startLimiter != nil {
+		// Do not take a token if there is no job to pop.
+		if _, err := pq.syncFields.inner.peek(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !pq.syncFields.startLimiter.allow(DefaultClock.Now()) {
+			return nil, ErrStartRateLimited
+		}
+	}
+
+	job, err := pq.popWithoutLock()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	pq.syncFields.runningJobs[job.GetTableID()] = struct{}{}
+	setJobState(job, JobStateRunning)
+
+	job.RegisterValidityHook(pq.validityHook)
+	job.SetTracer(pq.tracer)
+	job.RegisterSuccessHook(func(j AnalysisJob) {
+		// Record the outcome before taking the lock, so that the queue is not blocked by the write.
+		pq.recordOutcome(j, true)
+		pq.syncFields.mu.Lock()
+		defer pq.syncFields.mu.Unlock()
+		delete(pq.syncFields.runningJobs, j.GetTableID())
+		// The queue may be closed while the job is running.
+		if pq.syncFields.breaker != nil {
+			pq.syncFields.breaker.reset(j.GetTableID())
+		}
+		if pq.syncFields.cooldownUntil != nil {
+			if cooldown := analysisCooldown(j); cooldown > 0 {
+				pq.syncFields.cooldownUntil[j.GetTableID()] = DefaultClock.Now().Add(cooldown)
+			}
+		}
+		if pq.completionHook != nil {
+			pq.completionHook(j, true)
+		}
+	})
+	job.RegisterFailureHook(func(j AnalysisJob) {
+		canceled := j.State() == JobStateCanceled
+		if !canceled {
+			pq.recordOutcome(j, false)
+		}
+		pq.syncFields.mu.Lock()
+		defer pq.syncFields.mu.Unlock()
+		// Mark the job as failed and remove it from the running jobs.
+		delete(pq.syncFields.runningJobs, j.GetTableID())
+		// The canceled job is not finished, so it is not reported.
+		if pq.completionHook != nil && !canceled {
+			pq.completionHook(j, false)
+		}
+		// The queue may be closed while the job is running.
+		if pq.syncFields.mustRetryJobs == nil {
+			return
+		}
+		if canceled {
+			// The job is interrupted rather than failed, e.g. by a rolling restart,
+			// so it is requeued without counting the failure towards the circuit breaker.
+			if err := pq.rescheduleWithoutLock(j, 0); err != nil {
+				statslogutil.StatsLogger().Warn("Failed to reschedule the canceled job", zap.Error(err), zap.Stringer("job", j))
+			}
+			return
+		}
+		pq.syncFields.breaker.onFailure(j.GetTableID(), DefaultClock.Now())
+		// The stats are not refreshed, so the failed job is not held back by an earlier successful analysis.
+		delete(pq.syncFields.cooldownUntil, j.GetTableID())
+		if j.IsLastFailureTransient() {
+			err := pq.rescheduleWithoutLock(j, TransientFailureWeightPenalty)
+			// The tables held back by the circuit breaker are found again after the cooldown.
+			if err == nil || errors.ErrorEqual(err, ErrCircuitBreakerTripped) {
+				return
+			}
+			statslogutil.StatsLogger().Warn("Failed to reschedule the job", zap.Error(err), zap.Stringer("job", j))
+		}
+		pq.syncFields.mustRetryJobs[j.GetTableID()] = struct{}{}
+	})
+	return job, nil
+}
+
+// analysisCooldown returns the cooldown of the table after the job is finished successfully, see AnalysisCooldown.
+func analysisCooldown(job AnalysisJob) time.Duration {
+	if AnalysisCooldown == 0 {
+		return job.GetLastRunDuration()
+	}
+	return AnalysisCooldown
+}
+
+// popWithoutLock pops the job with the highest weight. In the fair scheduling mode, it pops the job
+// with the highest weight of the schema next to the schema of the last popped job instead,
+// in the alphabetical order of the schemas that have jobs in the queue.
+// The jobs of the paused tables and the jobs delayed by the start jitter are skipped.
+// The fair scheduling mode and skipping the jobs take O(n) time because the heap is ordered by the weight only.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) popWithoutLock() (AnalysisJob, error) {
+	now := DefaultClock.Now()
+	inJitterWindow := pq.inStartJitterWindowWithoutLock(now)
+	if !pq.syncFields.fairScheduling && len(pq.syncFields.pausedTables) == 0 && !inJitterWindow {
+		return pq.syncFields.inner.pop()
+	}
+	canPop := func(j AnalysisJob) bool {
+		if pq.isTablePausedWithoutLock(j) {
+			return false
+		}
+		return !inJitterWindow || !now.Before(pq.syncFields.initializedAt.Add(startJitter(j.GetTableID(), pq.startJitterWindow)))
+	}
+	if !pq.syncFields.fairScheduling {
+		// Find the top job that can be popped in the order of the heap, see heapData.Less.
+		var top AnalysisJob
+		pq.syncFields.inner.forEach(func(j AnalysisJob) {
+			if !canPop(j) {
+				return
+			}
+			if top == nil || compareJobs(j, top) < 0 {
+				top = j
+			}
+		})
+		if top == nil {
+			return nil, ErrHeapIsEmpty
+		}
+		if err := pq.syncFields.inner.delete(top); err != nil {
+			return nil, err
+		}
+		return top, nil
+	}
+	// Find the top job of each schema in the order of the heap, see heapData.Less.
+	topJobs := make(map[string]AnalysisJob)
+	pq.syncFields.inner.forEach(func(j AnalysisJob) {
+		if !canPop(j) {
+			return
+		}
+		top, ok := topJobs[j.GetSchemaName()]
+		if !ok || compareJobs(j, top) < 0 {
+			topJobs[j.GetSchemaName()] = j
+		}
+	})
+	if len(topJobs) == 0 {
+		return nil, ErrHeapIsEmpty
+	}
+	schemas := slices.Sorted(maps.Keys(topJobs))
+	i, found := slices.BinarySearch(schemas, pq.syncFields.lastPoppedSchema)
+	if found {
+		i++
+	}
+	// Wrap around to the first schema if no schema is after the last one.
+	if i == len(schemas) {
+		i = 0
+	}
+	next := schemas[i]
+	job := topJobs[next]
+	if err := pq.syncFields.inner.delete(job); err != nil {
+		return nil, err
+	}
+	pq.syncFields.lastPoppedSchema = next
+	return job, nil
+}
+
+// SetFairScheduling enables or disables the fair scheduling mode, see WithFairScheduling.
+// When it is disabled, Pop follows the weights strictly.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) SetFairScheduling(enabled bool) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	pq.syncFields.fairScheduling = enabled
+}
+
+// Reschedule pushes the finished job back into the queue with its weight lowered by the penalty,
+// so that a failed job is retried after the other jobs instead of waiting for a full rescan.
+// The weight is recalculated from the current indicators of the job, and the job waits in the queue as a new one.
+// It is a no-op if the table is running or skipped by the queue, e.g. because its circuit breaker is tripped.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Reschedule(job AnalysisJob, penalty float64) error {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return errors.New(notInitializedErrMsg)
+	}
+	return pq.rescheduleWithoutLock(job, penalty)
+}
+
+// rescheduleWithoutLock pushes the job back into the queue with its weight lowered by the penalty.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) rescheduleWithoutLock(job AnalysisJob, penalty float64) error {
+	if !(penalty >= 0) {
+		return errors.Errorf("penalty %v must be non-negative", penalty)
+	}
+	// The rescheduled job takes the place of the must retry job of the table.
+	delete(pq.syncFields.mustRetryJobs, job.GetTableID())
+	// Do not keep the aging boost of the previous wait.
+	job.SetEnqueuedAt(time.Time{})
+	return pq.pushOrMergeWithPenaltyWithoutLock(job, penalty)
+}
+
+// Release marks the popped job of the given table as finished without running it,
+// e.g. when the caller finds that the table is not ready for analysis.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Release(tableID int64) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	delete(pq.syncFields.runningJobs, tableID)
+}
+
+// GetTrippedTables returns the tables whose circuit breakers are tripped, ordered by the table ID.
+// No job of these tables is pushed into the queue until the cooldown expires or ResetCircuitBreaker is called.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) GetTrippedTables() ([]TrippedTable, error) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return nil, errors.New(notInitializedErrMsg)
+	}
+	return pq.syncFields.breaker.tripped(DefaultClock.Now()), nil
+}
+
+// ResetCircuitBreaker clears the consecutive failures of the table, so that its jobs can be pushed again.
+// The failures are cleared in mysql.analyze_outcomes as well, so that the reset survives the owner changes.
+// The table is requeued in the next round of processing the DML changes or requeueing the must retry jobs.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) ResetCircuitBreaker(tableID int64) error {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return errors.New(notInitializedErrMsg)
+	}
+	err := statsutil.CallWithSCtx(pq.statsHandle.SPool(), func(sctx sessionctx.Context) error {
+		return resetAnalysisOutcome(sctx, tableID)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pq.syncFields.breaker.reset(tableID)
+	return nil
+}
+
+// SetMaxConcurrency sets the max number of running jobs. 0 means no limit.
+// Lowering it does not affect the jobs that are already running.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) SetMaxConcurrency(maxConcurrency int) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	pq.syncFields.maxConcurrency = maxConcurrency
+}
+
+// GetMaxConcurrency returns the max number of running jobs. 0 means no limit.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) GetMaxConcurrency() int {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	return pq.syncFields.maxConcurrency
+}
+
+// Peek peeks the top job from the priority queue without removing it.
+// It returns ErrHeapIsEmpty if there is no job in the priority queue.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Peek() (AnalysisJob, error) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return nil, errors.New(notInitializedErrMsg)
+	}
+
+	return pq.syncFields.inner.peek()
+}
+
+// IsEmpty checks whether the priority queue is empty.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) IsEmpty() (bool, error) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return false, errors.New(notInitializedErrMsg)
+	}
+
+	return pq.syncFields.inner.isEmpty(), nil
+}
+
+// Len returns the number of jobs in the priority queue.
+// It runs in O(1) time. Use WithLenHook to get notified when the length changes.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Len() (int, error) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return 0, errors.New(notInitializedErrMsg)
+	}
+
+	return pq.syncFields.inner.len(), nil
+}
+
+// Rank returns the 1-based position of the job of the given table in the order the jobs are popped,
+// i.e. by the weight in descending order and then by the table ID, so 1 means the job is popped next.
+// It returns false if the table has no job in the queue or the queue is not initialized.
+// Because the heap is not fully sorted, the rank is computed by comparing the weight with all jobs,
+// which takes O(n) time.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Rank(tableID int64) (int, bool) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return 0, false
+	}
+
+	job, ok, err := pq.syncFields.inner.getByKey(tableID)
+	if err != nil || !ok {
+		return 0, false
+	}
+	rank := 1
+	pq.syncFields.inner.forEach(func(j AnalysisJob) {
+		if compareJobs(j, job) < 0 {
+			rank++
+		}
+	})
+	return rank, true
+}
+
+// Snapshot returns the copies of all jobs in the priority queue, ordered by the weight in descending order.
+// Jobs with the same weight are ordered by the table ID. The queue is not modified, and modifying the
+// returned jobs does not affect the queue, so it can be used to inspect the pending jobs.
+// It takes O(n log n) time, so it should not be called too frequently on a large queue.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Snapshot() ([]AnalysisJob, error) {
+	pq.syncFields.mu.RLock()
+	if !pq.syncFields.initialized {
+		pq.syncFields.mu.RUnlock()
+		return nil, errors.New(notInitializedErrMsg)
+	}
+	jobs := make([]AnalysisJob, 0, pq.syncFields.inner.len())
+	pq.syncFields.inner.forEach(func(job AnalysisJob) {
+		jobs = append(jobs, job.Clone())
+	})
+	pq.syncFields.mu.RUnlock()
+
+	slices.SortFunc(jobs, compareJobs)
+	return jobs, nil
+}
+
+// JobReport is the state of a job in the priority queue, see ExportReport.
+// It can be serialized by json.Marshal for offline analysis.
+type JobReport struct {
+	// EnqueuedAt is the time when the job was pushed into the queue.
+	EnqueuedAt time.Time
+	// WeightBreakdown is the individual contributions to the weight, see AnalysisJob.GetWeightBreakdown.
+	WeightBreakdown map[string]float64
+	Schema          string
+	Table           string
+	// Partitions are the names of the partitions analyzed by the job. It is empty for the non-partitioned tables.
+	Partitions  []string
+	AnalyzeType string
+	TableID     int64
+	Weight      float64
+}
+
+// ExportReport returns the reports of all jobs in the priority queue, in the same order as Snapshot.
+// Unlike String, the reports are structured, so that the queue can be dumped for postmortems.
+// It works on the copies of the jobs, so the queue is not modified.
+// It returns nil if the queue is not initialized.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) ExportReport() []JobReport {
+	jobs, err := pq.Snapshot()
+	if err != nil {
+		return nil
+	}
+	reports := make([]JobReport, 0, len(jobs))
+	for _, job := range jobs {
+		reports = append(reports, JobReport{
+			EnqueuedAt:      job.GetEnqueuedAt(),
+			WeightBreakdown: job.GetWeightBreakdown(),
+			Schema:          job.GetSchemaName(),
+			Table:           job.GetTableName(),
+			Partitions:      job.GetPartitionNames(),
+			AnalyzeType:     job.GetAnalyzeType(),
+			TableID:         job.GetTableID(),
+			Weight:          job.GetWeight(),
+		})
+	}
+	return reports
+}
+
+// QueueStats is the aggregate stats of the jobs in the priority queue.
+type QueueStats struct {
+	// OldestEnqueuedAt is the earliest enqueue time of the jobs. It is the zero time if the queue is empty.
+	OldestEnqueuedAt time.Time
+	// JobsByAnalyzeType is the number of jobs of each analyze type, see AnalysisJob.GetAnalyzeType.
+	JobsByAnalyzeType map[string]int
+	// TotalJobs is the number of jobs in the queue.
+	TotalJobs int
+	// WeightSum is the sum of the weights of the jobs.
+	WeightSum float64
+	// WeightMax is the max weight of the jobs. It is 0 if the queue is empty.
+	WeightMax float64
+}
+
+// QueueStats returns the aggregate stats of the jobs in the priority queue.
+// The stats are computed in one pass without copying the jobs, so it is cheap enough to be polled for metrics.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) QueueStats() (QueueStats, error) {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	if !pq.syncFields.initialized {
+		return QueueStats{}, errors.New(notInitializedErrMsg)
+	}
+
+	stats := QueueStats{
+		JobsByAnalyzeType: make(map[string]int),
+		TotalJobs:         pq.syncFields.inner.len(),
+	}
+	first := true
+	pq.syncFields.inner.forEach(func(job AnalysisJob) {
+		stats.JobsByAnalyzeType[job.GetAnalyzeType()]++
+		weight := job.GetWeight()
+		stats.WeightSum += weight
+		if first || weight > stats.WeightMax {
+			stats.WeightMax = weight
+		}
+		first = false
+		if enqueuedAt := job.GetEnqueuedAt(); stats.OldestEnqueuedAt.IsZero() || enqueuedAt.Before(stats.OldestEnqueuedAt) {
+			stats.OldestEnqueuedAt = enqueuedAt
+		}
+	})
+	return stats, nil
+}
+
+// RemoveIf removes all jobs that satisfy the predicate from the priority queue and returns the number of removed jobs.
+// It can be used to evict the jobs of dropped tables or tables whose auto-analyze is disabled.
+// Note: The predicate is called with the queue lock held, so it must not call any method of the queue.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) RemoveIf(pred func(AnalysisJob) bool) (int, error) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return 0, errors.New(notInitializedErrMsg)
+	}
+
+	return pq.syncFields.inner.removeIf(pred), nil
+}
+
+// RemoveSchema removes all jobs of the tables in the schema from the priority queue and returns the number of removed jobs.
+// The schema name is compared case-insensitively. It is called when the schema is dropped,
+// so that the jobs of the dropped tables do not fail one by one.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) RemoveSchema(schema string) (int, error) {
+	return pq.RemoveIf(isJobOfSchema(schema))
+}
+
+// isJobOfSchema returns a predicate to check whether the job belongs to the schema.
+func isJobOfSchema(schema string) func(AnalysisJob) bool {
+	return func(job AnalysisJob) bool {
+		return strings.EqualFold(job.GetSchemaName(), schema)
+	}
+}
+
+// Reset drops all queued jobs and the must retry jobs at once, leaving the queue empty.
+// The evict hook is called with each dropped queued job, see WithEvictHook.
+// The running jobs are not affected, and they are still marked as finished when they succeed or fail.
+// It is a no-op if the queue is not initialized.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Reset() {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return
+	}
+
+	var dropped []AnalysisJob
+	if pq.evictHook != nil {
+		dropped = pq.syncFields.inner.list()
+	}
+	pq.syncFields.inner = pq.newInnerHeap()
+	pq.syncFields.mustRetryJobs = make(map[int64]struct{})
+	for _, job := range dropped {
+		pq.evictHook(job)
+	}
+}
+
+// Pause stops Pop from returning new jobs until Resume is called.
+// The running jobs are not affected, and the queued jobs are kept and still updated by the DML changes.
+// Unlike disabling auto analyze globally, it does not affect the manual analyze statements.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Pause() {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.paused {
+		statslogutil.StatsLogger().Info("Pause the priority queue")
+	}
+	pq.syncFields.paused = true
+}
+
+// Resume allows Pop to return new jobs again after Pause is called.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Resume() {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if pq.syncFields.paused {
+		statslogutil.StatsLogger().Info("Resume the priority queue")
+	}
+	pq.syncFields.paused = false
+}
+
+// IsPaused checks whether the priority queue is paused.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) IsPaused() bool {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	return pq.syncFields.paused
+}
+
+// PauseTable stops analyzing the table until ResumeTable is called, e.g. while the table is being investigated.
+// The jobs of the table are neither pushed nor popped, but the queued jobs are kept, and the running job is not affected. The table ID can be the ID of a partitioned table,
+// which pauses all its partitions, or the ID of a partition.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) PauseTable(tableID int64) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if pq.syncFields.pausedTables == nil {
+		pq.syncFields.pausedTables = make(map[int64]struct{})
+	}
+	if _, ok := pq.syncFields.pausedTables[tableID]; !ok {
+		statslogutil.StatsLogger().Info("Pause auto analyze of the table", zap.Int64("tableID", tableID))
+	}
+	pq.syncFields.pausedTables[tableID] = struct{}{}
+}
+
+// ResumeTable allows the table to be analyzed again after PauseTable is called.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) ResumeTable(tableID int64) {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if _, ok := pq.syncFields.pausedTables[tableID]; ok {
+		statslogutil.StatsLogger().Info("Resume auto analyze of the table", zap.Int64("tableID", tableID))
+	}
+	delete(pq.syncFields.pausedTables, tableID)
+}
+
+// GetPausedTables returns the IDs of the tables paused by PauseTable in ascending order.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) GetPausedTables() []int64 {
+	pq.syncFields.mu.RLock()
+	defer pq.syncFields.mu.RUnlock()
+	return slices.Sorted(maps.Keys(pq.syncFields.pausedTables))
+}
+
+// inStartJitterWindowWithoutLock checks whether the starts of the jobs may still be delayed by the jitter, see WithStartJitter.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) inStartJitterWindowWithoutLock(now time.Time) bool {
+	return pq.startJitterWindow > 0 && now.Before(pq.syncFields.initializedAt.Add(pq.startJitterWindow))
+}
+
+// isTablePausedWithoutLock checks whether the table or the partitioned table of the job is paused.
+// Note: Please hold the lock before calling this function.
+func (pq *AnalysisPriorityQueue) isTablePausedWithoutLock(job AnalysisJob) bool {
+	if len(pq.syncFields.pausedTables) == 0 {
+		return false
+	}
+	if _, ok := pq.syncFields.pausedTables[job.GetTableID()]; ok {
+		return true
+	}
+	_, ok := pq.syncFields.pausedTables[job.GetGlobalTableID()]
+	return ok
+}
+
+// Drain stops Pop from returning new jobs and waits for the running jobs to finish.
+// The jobs that are still in the queue are kept, so that they are not lost if the queue is used again.
+// It returns the context error if the context is done before all running jobs finish.
+// It is usually called before Close for a graceful shutdown or owner transfer.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Drain(ctx context.Context) error {
+	pq.syncFields.mu.Lock()
+	if !pq.syncFields.initialized {
+		pq.syncFields.mu.Unlock()
+		return errors.New(notInitializedErrMsg)
+	}
+	pq.syncFields.draining = true
+	pq.syncFields.mu.Unlock()
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for {
+		pq.syncFields.mu.RLock()
+		runningJobs := len(pq.syncFields.runningJobs)
+		pq.syncFields.mu.RUnlock()
+		if runningJobs == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			statslogutil.StatsLogger().Warn(
+				"Stop waiting for the running jobs to finish",
+				zap.Int("runningJobs", runningJobs),
+				zap.Error(ctx.Err()),
+			)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the priority queue.
+// Note: This function is thread-safe.
+func (pq *AnalysisPriorityQueue) Close() {
+	pq.syncFields.mu.Lock()
+	defer pq.syncFields.mu.Unlock()
+	if !pq.syncFields.initialized {
+		return
+	}
+
+	// It is possible that the priority queue is not initialized.
 	if pq.syncFields.cancel != nil {
 		pq.syncFields.cancel()
 	}
@@ -844,8 +2313,15 @@ func (pq *AnalysisPriorityQueue) Close() {
 	// The rest fields will be reset when the priority queue is initialized.
 	// But we do it here for double safety.
 	pq.syncFields.inner = nil
+	if pq.lenHook != nil {
+		pq.lenHook(0)
+	}
 	pq.syncFields.runningJobs = nil
 	pq.syncFields.mustRetryJobs = nil
+	pq.syncFields.breaker = nil
+	pq.syncFields.cooldownUntil = nil
+	pq.syncFields.draining = false
+	pq.syncFields.lastPoppedSchema = ""
 	pq.syncFields.lastDMLUpdateFetchTimestamp = 0
 	pq.syncFields.cancel = nil
 }
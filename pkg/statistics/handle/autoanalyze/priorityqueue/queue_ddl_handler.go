@@ -55,6 +55,8 @@ func (pq *AnalysisPriorityQueue) HandleDDLEvent(_ context.Context, sctx sessionc
 	switch event.GetType() {
 	case model.ActionAddIndex:
 		err = pq.handleAddIndexEvent(sctx, event)
+	case model.ActionAddTablePartition:
+		err = pq.handleAddTablePartitionEvent(sctx, event)
 	case model.ActionTruncateTable:
 		err = pq.handleTruncateTableEvent(sctx, event)
 	case model.ActionDropTable:
@@ -343,7 +345,7 @@ func (pq *AnalysisPriorityQueue) handleReorganizePartitionEvent(
 	sctx sessionctx.Context,
 	event *notifier.SchemaChangeEvent,
 ) error {
-	globalTableInfo, _, droppedPartitionInfo := event.GetReorganizePartitionInfo()
+	globalTableInfo, addedPartitionInfo, droppedPartitionInfo := event.GetReorganizePartitionInfo()
 
 	// For static partitioned tables.
 	for _, def := range droppedPartitionInfo.Definitions {
@@ -362,7 +364,61 @@ func (pq *AnalysisPriorityQueue) handleReorganizePartitionEvent(
 	// Try to recreate the job for the partitioned table because the new partition has been added.
 	// Currently, the stats meta for the reorganized partitions is not updated.
 	// This might be improved in the future.
-	return pq.recreateAndPushJobForTable(sctx, globalTableInfo)
+	if err := pq.recreateAndPushJobForTable(sctx, globalTableInfo); err != nil {
+		return err
+	}
+	// The new partitions have no stats yet, so seed them with a quick analyze.
+	return pq.pushQuickAnalysisJobs(sctx, globalTableInfo, addedPartitionInfo)
+}
+
+func (pq *AnalysisPriorityQueue) handleAddTablePartitionEvent(
+	sctx sessionctx.Context,
+	event *notifier.SchemaChangeEvent,
+) error {
+	globalTableInfo, addedPartInfo := event.GetAddPartitionInfo()
+	return pq.pushQuickAnalysisJobs(sctx, globalTableInfo, addedPartInfo)
+}
+
+// pushQuickAnalysisJobs pushes a quick analysis job for each newly created partition that has not been analyzed yet,
+// so that the optimizer gets some stats of the partitions soon instead of none at all.
+// It only applies to static pruning mode, because the optimizer uses the global stats in dynamic pruning mode.
+// The empty partitions are skipped when the jobs are about to run, see StaticPartitionedTableAnalysisJob.IsValidToAnalyze.
+func (pq *AnalysisPriorityQueue) pushQuickAnalysisJobs(
+	sctx sessionctx.Context,
+	globalTableInfo *model.TableInfo,
+	addedPartInfo *model.PartitionInfo,
+) error {
+	pruneMode := variable.PartitionPruneMode(sctx.GetSessionVars().PartitionPruneMode.Load())
+	if pruneMode != variable.Static || addedPartInfo == nil {
+		return nil
+	}
+	is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+	schemaName, ok := is.SchemaNameByTableID(globalTableInfo.ID)
+	if !ok {
+		return nil
+	}
+	lockedTables, err := lockstats.QueryLockedTables(statsutil.StatsCtx, sctx)
+	if err != nil {
+		return err
+	}
+	currentTs, err := statsutil.GetStartTS(sctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	jobFactory := NewAnalysisJobFactory(sctx, 0, currentTs)
+	for _, def := range addedPartInfo.Definitions {
+		if _, ok := lockedTables[def.ID]; ok {
+			continue
+		}
+		if stats := pq.statsHandle.GetPartitionStatsForAutoAnalyze(globalTableInfo, def.ID); stats != nil && stats.IsAnalyzed() {
+			continue
+		}
+		job := jobFactory.CreateQuickStaticPartitionAnalysisJob(schemaName.O, globalTableInfo, def.ID, def.Name.O)
+		if err := pq.pushWithoutLock(job); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (pq *AnalysisPriorityQueue) handleAlterTablePartitioningEvent(sctx sessionctx.Context, event *notifier.SchemaChangeEvent) error {
@@ -439,5 +495,14 @@ func (pq *AnalysisPriorityQueue) handleDropSchemaEvent(_ sessionctx.Context, eve
 			)
 		}
 	}
+	// Remove the jobs by the schema name as well in case any job is missed by the IDs,
+	// so that no job of the dropped tables fails with table not found.
+	if removed := pq.syncFields.inner.removeIf(isJobOfSchema(miniDBInfo.Name.O)); removed > 0 {
+		statslogutil.StatsLogger().Info(
+			"Removed the remaining jobs of the dropped schema from priority queue",
+			zap.String("db", miniDBInfo.Name.O),
+			zap.Int("removed", removed),
+		)
+	}
 	return nil
 }
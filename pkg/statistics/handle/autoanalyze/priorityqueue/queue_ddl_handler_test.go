@@ -116,7 +116,7 @@ func TestHandleDDLEventsWithRunningJobs(t *testing.T) {
 	go func() {
 		defer close(down)
 		require.NoError(t, failpoint.Enable(fp, "return(1)"))
-		require.NoError(t, job1.Analyze(handle, dom.SysProcTracker()))
+		require.NoError(t, job1.Analyze(context.Background(), handle, dom.SysProcTracker()))
 	}()
 
 	// Create a new index on t1.
@@ -624,6 +624,86 @@ func TestReorganizeTablePartition(t *testing.T) {
 	require.True(t, isEmpty)
 }
 
+func TestNewPartitionsTriggerQuickAnalyze(t *testing.T) {
+	store, do := testkit.CreateMockStoreAndDomain(t)
+	testKit := testkit.NewTestKit(t, store)
+	testKit.MustExec("use test")
+	testKit.MustExec("set global tidb_partition_prune_mode='static'")
+	testKit.MustExec("create table t (c1 int, c2 int, index idx(c1, c2)) partition by range (c1) (partition p0 values less than (10), partition p1 values less than (20))")
+	testKit.MustExec("insert into t values (1,2),(11,12),(16,17)")
+	testKit.MustExec("analyze table t")
+	h := do.StatsHandle()
+	require.NoError(t, h.Update(context.Background(), do.InfoSchema()))
+
+	pq := priorityqueue.NewAnalysisPriorityQueue(h)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	ctx := context.Background()
+	handleEvent := func(event *notifier.SchemaChangeEvent) {
+		require.NoError(t, h.HandleDDLEvent(event))
+		require.NoError(t, statsutil.CallWithSCtx(
+			h.SPool(),
+			func(sctx sessionctx.Context) error {
+				require.NoError(t, pq.HandleDDLEvent(ctx, sctx, event))
+				return nil
+			}, statsutil.FlagWrapTxn),
+		)
+	}
+	getQuickJobs := func() map[string]*priorityqueue.StaticPartitionedTableAnalysisJob {
+		jobs, err := pq.Snapshot()
+		require.NoError(t, err)
+		quickJobs := make(map[string]*priorityqueue.StaticPartitionedTableAnalysisJob, len(jobs))
+		for _, job := range jobs {
+			staticJob := job.(*priorityqueue.StaticPartitionedTableAnalysisJob)
+			require.True(t, staticJob.Quick)
+			require.Equal(t, "static_partition_quick", staticJob.GetAnalyzeType())
+			require.GreaterOrEqual(t, staticJob.GetWeight(), priorityqueue.EventQuickAnalyze)
+			quickJobs[staticJob.StaticPartitionName] = staticJob
+		}
+		return quickJobs
+	}
+
+	// The added partition is empty, but the job is still pushed because the size of the partition is unknown.
+	testKit.MustExec("alter table t add partition (partition p2 values less than (30))")
+	handleEvent(findEvent(h.DDLEventCh(), model.ActionAddTablePartition))
+	quickJobs := getQuickJobs()
+	require.Len(t, quickJobs, 1)
+	require.Contains(t, quickJobs, "p2")
+
+	// The reorganized partitions have data but no stats.
+	testKit.MustExec("alter table t reorganize partition p1 into (partition p1 values less than (15), partition p3 values less than (20))")
+	handleEvent(findEvent(h.DDLEventCh(), model.ActionReorganizePartition))
+	quickJobs = getQuickJobs()
+	require.Len(t, quickJobs, 3)
+	job := quickJobs["p3"]
+	require.NotNil(t, job)
+
+	sctx := testKit.Session().(sessionctx.Context)
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p3` with 16 buckets, 10 topn, 1000 samples"}, sqls)
+	valid, _ := job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) {
+		require.FailNow(t, "unexpected failure", j.GetLastFailureReason())
+	})
+	require.NoError(t, job.Analyze(ctx, h, do.SysProcTracker()))
+	require.NoError(t, h.Update(ctx, do.InfoSchema()))
+	tbl, err := do.InfoSchema().TableByName(ctx, pmodel.NewCIStr("test"), pmodel.NewCIStr("t"))
+	require.NoError(t, err)
+	partitionStats := h.GetPartitionStats(tbl.Meta(), job.StaticPartitionID)
+	require.True(t, partitionStats.IsAnalyzed())
+	require.Equal(t, int64(1), partitionStats.RealtimeCount)
+
+	// The empty partition is skipped when the job is about to run.
+	valid, _ = quickJobs["p2"].IsValidToAnalyze(sctx)
+	require.False(t, valid)
+}
+
 func TestAlterTablePartitioning(t *testing.T) {
 	store, do := testkit.CreateMockStoreAndDomain(t)
 	testKit := testkit.NewTestKit(t, store)
@@ -783,6 +863,14 @@ func TestDropSchemaEventWithDynamicPartition(t *testing.T) {
 	l, err := pq.Len()
 	require.NoError(t, err)
 	require.Equal(t, l, 2)
+	// The job whose table is not in the event is removed by the schema name.
+	require.NoError(t, pq.Push(&priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     "t3",
+		TableID:       tableInfo.ID + 1000,
+		TableStatsVer: 2,
+		Indicators:    priorityqueue.Indicators{ChangePercentage: 0.5, TableSize: 1000},
+	}))
 
 	// Drop schema.
 	testKit.MustExec("drop database test")
@@ -939,7 +1027,7 @@ func TestAddIndexTriggerAutoAnalyzeWithStatsVersion1(t *testing.T) {
 	job, err := pq.Peek()
 	require.NoError(t, err)
 	require.Equal(t, tableInfo.ID, job.GetTableID())
-	require.NoError(t, job.Analyze(h, do.SysProcTracker()))
+	require.NoError(t, job.Analyze(context.Background(), h, do.SysProcTracker()))
 
 	// Check the stats of the indexes.
 	tableStats := h.GetTableStats(tableInfo)
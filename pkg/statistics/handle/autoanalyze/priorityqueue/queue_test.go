@@ -15,14 +15,23 @@
 package priorityqueue_test
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	pmodel "github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
 	"github.com/pingcap/tidb/pkg/statistics"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
 	"github.com/pingcap/tidb/pkg/testkit"
 	"github.com/stretchr/testify/require"
 )
@@ -93,26 +102,2019 @@ func TestAnalysisPriorityQueue(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("Peek", func(t *testing.T) {
+		peekedJob, err := pq.Peek()
+		require.NoError(t, err)
+		require.NotNil(t, peekedJob)
+		// The tables are not analyzed yet, so the last analyze time is a short while ago.
+		indicators := peekedJob.GetIndicators()
+		require.WithinDuration(t, time.Now().Add(-indicators.LastAnalysisDuration), indicators.LastAnalyzeTime, time.Minute)
+
+		// Peek should not remove the job from the queue.
+		l, err := pq.Len()
+		require.NoError(t, err)
+		require.Equal(t, 2, l)
+		peekedAgain, err := pq.Peek()
+		require.NoError(t, err)
+		require.Equal(t, peekedJob.GetTableID(), peekedAgain.GetTableID())
+	})
+
 	t.Run("IsEmpty And Pop", func(t *testing.T) {
 		isEmpty, err := pq.IsEmpty()
 		require.NoError(t, err)
 		require.False(t, isEmpty)
 
-		poppedJob, err := pq.Pop()
+		peekedJob, err := pq.Peek()
+		require.NoError(t, err)
+		poppedJob, err := pq.Pop()
+		require.NoError(t, err)
+		require.NotNil(t, poppedJob)
+		require.Equal(t, peekedJob.GetTableID(), poppedJob.GetTableID())
+
+		poppedJob, err = pq.Pop()
+		require.NoError(t, err)
+		require.NotNil(t, poppedJob)
+
+		isEmpty, err = pq.IsEmpty()
+		require.NoError(t, err)
+		require.True(t, isEmpty)
+
+		// Peek on an empty queue should return the sentinel error.
+		peekedJob, err = pq.Peek()
+		require.ErrorIs(t, err, priorityqueue.ErrHeapIsEmpty)
+		require.Nil(t, peekedJob)
+
+		runningJobs := pq.GetRunningJobs()
+		require.Len(t, runningJobs, 2)
+	})
+}
+
+func TestPushMergesDuplicateJobs(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	newJob := func(changePercentage float64, indexes ...string) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		return &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			GlobalTableID:       100,
+			StaticPartitionName: "p0",
+			StaticPartitionID:   101,
+			Indexes:             indexes,
+			TableStatsVer:       2,
+			Indicators: priorityqueue.Indicators{
+				ChangePercentage: changePercentage,
+				TableSize:        1000,
+			},
+		}
+	}
+
+	t.Run("column-only job", func(t *testing.T) {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+		defer pq.Close()
+		require.NoError(t, pq.Initialize())
+
+		high := newJob(0.8)
+		require.NoError(t, pq.Push(high))
+		require.NoError(t, pq.Push(newJob(0.2)))
+		l, err := pq.Len()
+		require.NoError(t, err)
+		require.Equal(t, 1, l)
+
+		job, err := pq.Peek()
+		require.NoError(t, err)
+		require.InDelta(t, high.Weight, job.(*priorityqueue.StaticPartitionedTableAnalysisJob).Weight, 1e-9)
+		require.Equal(t, high.EnqueuedAt, job.GetEnqueuedAt())
+		require.Equal(t, 0.2, job.GetIndicators().ChangePercentage)
+		require.False(t, job.HasNewlyAddedIndex())
+	})
+
+	t.Run("newly-added-index job", func(t *testing.T) {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+		defer pq.Close()
+		require.NoError(t, pq.Initialize())
+
+		require.NoError(t, pq.Push(newJob(0.2, "idx1", "idx2")))
+		require.NoError(t, pq.Push(newJob(0.8, "idx2", "idx3")))
+		l, err := pq.Len()
+		require.NoError(t, err)
+		require.Equal(t, 1, l)
+
+		job, err := pq.Peek()
+		require.NoError(t, err)
+		require.Equal(t, []string{"idx1", "idx2", "idx3"}, job.(*priorityqueue.StaticPartitionedTableAnalysisJob).Indexes)
+		require.Equal(t, 0.8, job.GetIndicators().ChangePercentage)
+	})
+
+	t.Run("without job merging", func(t *testing.T) {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithoutJobMerging())
+		defer pq.Close()
+		require.NoError(t, pq.Initialize())
+
+		high := newJob(0.8, "idx1")
+		require.NoError(t, pq.Push(high))
+		low := newJob(0.2, "idx2")
+		require.NoError(t, pq.Push(low))
+		l, err := pq.Len()
+		require.NoError(t, err)
+		require.Equal(t, 1, l)
+
+		job, err := pq.Peek()
+		require.NoError(t, err)
+		require.Same(t, low, job)
+		require.Less(t, job.GetWeight(), high.GetWeight())
+		require.Equal(t, []string{"idx2"}, low.Indexes)
+	})
+
+	t.Run("static partitioned table index job", func(t *testing.T) {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+		defer pq.Close()
+		require.NoError(t, pq.Initialize())
+
+		newIndexJob := func(index string, partitions ...priorityqueue.PartitionIDAndName) *priorityqueue.StaticPartitionedTableIndexAnalysisJob {
+			return priorityqueue.NewStaticPartitionedTableIndexAnalysisJob("test", "t", 100, []string{index}, partitions, 2, 0, 1000, 0)
+		}
+		p0 := priorityqueue.NewPartitionIDAndName("p0", 101)
+		p1 := priorityqueue.NewPartitionIDAndName("p1", 102)
+		require.NoError(t, pq.Push(newIndexJob("idx1", p0)))
+		require.NoError(t, pq.Push(newIndexJob("idx2", p1)))
+
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		indexJob := job.(*priorityqueue.StaticPartitionedTableIndexAnalysisJob)
+		require.Equal(t, []string{"idx1", "idx2"}, indexJob.Indexes)
+		require.Equal(t, []priorityqueue.PartitionIDAndName{p1, p0}, indexJob.Partitions)
+	})
+}
+
+func TestPushAgesWaitingJobs(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	newJob := func(tableID int64, changePercentage float64) *priorityqueue.NonPartitionedTableAnalysisJob {
+		return &priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   "test",
+			TableName:     fmt.Sprintf("t%d", tableID),
+			TableID:       tableID,
+			TableStatsVer: 2,
+			Indicators: priorityqueue.Indicators{
+				ChangePercentage: changePercentage,
+				TableSize:        1000,
+			},
+		}
+	}
+
+	// A fresh job with a higher weight is analyzed first.
+	starved := newJob(1, 0.2)
+	require.NoError(t, pq.Push(starved))
+	require.False(t, starved.EnqueuedAt.IsZero())
+	busy := newJob(2, 0.8)
+	require.NoError(t, pq.Push(busy))
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, busy.TableID, job.GetTableID())
+
+	// Re-pushing the same table keeps the original enqueue time.
+	enqueuedAt := time.Now().Add(-48 * time.Hour)
+	starved.EnqueuedAt = enqueuedAt
+	require.NoError(t, pq.Push(newJob(1, 0.2)))
+	job, err = pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, starved.TableID, job.GetTableID())
+	require.Equal(t, enqueuedAt, job.GetEnqueuedAt())
+	require.Greater(t, job.GetWeight(), busy.GetWeight())
+
+	// Disable aging.
+	defer func(coefficient float64) {
+		priorityqueue.WeightAgingCoefficient = coefficient
+	}(priorityqueue.WeightAgingCoefficient)
+	priorityqueue.WeightAgingCoefficient = 0
+	require.Less(t, job.GetWeight(), busy.GetWeight())
+}
+
+func TestAgingOrderAtMaxJobWeight(t *testing.T) {
+	defer func(maxWeight float64, clock priorityqueue.Clock) {
+		priorityqueue.MaxJobWeight = maxWeight
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.MaxJobWeight, priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+	// The weights of both jobs are clamped to MaxJobWeight.
+	priorityqueue.MaxJobWeight = 0.01
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.5)))
+	clock.Advance(time.Hour)
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+
+	// Both jobs report the same weight, but the one that has waited longer is still analyzed first.
+	jobs, err := pq.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, jobs[0].GetWeight(), jobs[1].GetWeight())
+	require.Equal(t, int64(2), jobs[0].GetTableID())
+	rank, ok := pq.Rank(2)
+	require.True(t, ok)
+	require.Equal(t, 1, rank)
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), job.GetTableID())
+}
+
+func TestPushEqualWeights(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	// The jobs with the same indicators and enqueue time tie, so they are popped by the table ID.
+	for _, tableID := range []int64{5, 3, 1, 4, 2} {
+		require.NoError(t, pq.Push(newNonPartitionedJob(tableID, 0.5)))
+	}
+	for _, expected := range []int64{1, 2, 3, 4, 5} {
+		// The order does not change while the jobs are aging.
+		clock.Advance(time.Hour)
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		require.Equal(t, expected, job.GetTableID())
+		pq.Release(expected)
+	}
+}
+
+func TestQueueLenHook(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t1 (a int)")
+	tk.MustExec("create table t2 (a int)")
+	tk.MustExec("insert into t1 values (1)")
+	tk.MustExec("insert into t2 values (1)")
+	statistics.AutoAnalyzeMinCnt = 0
+	defer func() {
+		statistics.AutoAnalyzeMinCnt = 1000
+	}()
+
+	handle := dom.StatsHandle()
+	require.NoError(t, handle.DumpStatsDeltaToKV(true))
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+
+	var (
+		mu      sync.Mutex
+		lengths []int
+	)
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithLenHook(func(length int) {
+		mu.Lock()
+		defer mu.Unlock()
+		lengths = append(lengths, length)
+	}))
+	defer pq.Close()
+	getLengths := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(lengths)
+	}
+
+	require.NoError(t, pq.Initialize())
+	require.Equal(t, []int{0, 1, 2}, getLengths())
+
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 1}, getLengths())
+
+	// Updating the remaining job does not change the length.
+	remaining, err := pq.Peek()
+	require.NoError(t, err)
+	require.NoError(t, pq.Push(remaining))
+	require.Equal(t, []int{0, 1, 2, 1}, getLengths())
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+	require.NotEqual(t, job.GetTableID(), remaining.GetTableID())
+
+	pq.Close()
+	require.Equal(t, []int{0, 1, 2, 1, 0}, getLengths())
+}
+
+func TestRemoveIf(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+
+	isDropped := func(job priorityqueue.AnalysisJob) bool { return job.GetTableID() == 2 }
+	_, err := pq.RemoveIf(isDropped)
+	require.Error(t, err)
+
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, pq.Push(&priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   "test",
+			TableName:     fmt.Sprintf("t%d", i),
+			TableID:       i,
+			TableStatsVer: 2,
+			Indicators: priorityqueue.Indicators{
+				ChangePercentage: float64(i) / 10,
+				TableSize:        1000,
+			},
+		}))
+	}
+
+	removed, err := pq.RemoveIf(isDropped)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	removed, err = pq.RemoveIf(isDropped)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), job.GetTableID())
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+}
+
+func TestRemoveSchema(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+
+	_, err := pq.RemoveSchema("test")
+	require.Error(t, err)
+
+	require.NoError(t, pq.Initialize())
+	for i, schema := range []string{"test", "Test", "other"} {
+		require.NoError(t, pq.Push(&priorityqueue.NonPartitionedTableAnalysisJob{
+			TableSchema:   schema,
+			TableName:     "t",
+			TableID:       int64(i + 1),
+			TableStatsVer: 2,
+			Indicators: priorityqueue.Indicators{
+				ChangePercentage: 0.5,
+				TableSize:        1000,
+			},
+		}))
+	}
+
+	// The schema name is case-insensitive.
+	removed, err := pq.RemoveSchema("TEST")
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	removed, err = pq.RemoveSchema("test")
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, "other", job.GetSchemaName())
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+}
+
+func TestUpdate(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+
+	indicators := priorityqueue.Indicators{ChangePercentage: 0.9, TableSize: 1000}
+	require.Error(t, pq.Update(1, indicators))
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/10)))
+	}
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), job.GetTableID())
+
+	// Table 1 becomes the most stale one.
+	require.NoError(t, pq.Update(1, indicators))
+	job, err = pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+	require.Equal(t, indicators, job.GetIndicators())
+	require.Equal(t, priorityqueue.NewPriorityCalculator().CalculateWeight(job), job.(*priorityqueue.NonPartitionedTableAnalysisJob).Weight)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+
+	require.ErrorContains(t, pq.Update(4, indicators), "not found")
+}
+
+func TestUpdateRecordsWeightDelta(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	var hookJobs []int64
+	var hookDeltas []priorityqueue.WeightDelta
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithUpdateHook(
+		func(job priorityqueue.AnalysisJob, delta priorityqueue.WeightDelta) {
+			hookJobs = append(hookJobs, job.GetTableID())
+			hookDeltas = append(hookDeltas, delta)
+		},
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	_, ok := pq.LastWeightDelta()
+	require.False(t, ok)
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.1)))
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	oldWeight := job.GetWeight()
+	oldBreakdown := job.GetWeightBreakdown()
+
+	// Only the change ratio term changes.
+	require.NoError(t, pq.Update(1, priorityqueue.Indicators{ChangePercentage: 0.9, TableSize: 1000}))
+	delta, ok := pq.LastWeightDelta()
+	require.True(t, ok)
+	require.Equal(t, int64(1), delta.TableID)
+	// The weights grow slowly with the waiting time, see WeightAgingCoefficient.
+	require.InDelta(t, oldWeight, delta.OldWeight, 1e-6)
+	require.InDelta(t, job.GetWeight(), delta.NewWeight, 1e-6)
+	require.Greater(t, delta.NewWeight, delta.OldWeight)
+	require.Equal(t, oldBreakdown, delta.OldBreakdown)
+	require.Equal(t, job.GetWeightBreakdown(), delta.NewBreakdown)
+	changes := delta.Changes()
+	require.Greater(t, changes[priorityqueue.WeightChangeRatio], 0.0)
+	require.Zero(t, changes[priorityqueue.WeightTableSize])
+	require.Zero(t, changes[priorityqueue.WeightAnalysisInterval])
+	require.Zero(t, changes[priorityqueue.WeightSpecialEvent])
+	require.Equal(t, []int64{1}, hookJobs)
+	require.Equal(t, []priorityqueue.WeightDelta{delta}, hookDeltas)
+
+	// The failed update does not change the last delta.
+	require.Error(t, pq.Update(2, priorityqueue.Indicators{}))
+	lastDelta, ok := pq.LastWeightDelta()
+	require.True(t, ok)
+	require.Equal(t, delta, lastDelta)
+	require.Len(t, hookDeltas, 1)
+}
+
+func TestBoost(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	priorityqueue.DefaultClock = priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithFixedWeightForTesting())
+	defer pq.Close()
+	require.Error(t, pq.Boost(1, 1))
+	require.NoError(t, pq.Initialize())
+	require.Error(t, pq.Boost(1, 0))
+
+	// The queued job is moved to the front.
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.5)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(2, 0.9)))
+	require.NoError(t, pq.Boost(1, 1))
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+	require.InDelta(t, 1.5, job.GetWeight(), 1e-9)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+
+	// The running job cannot be boosted.
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.ErrorContains(t, pq.Boost(job.GetTableID(), 1), "is running")
+	pq.Release(job.GetTableID())
+
+	// A job is created for the table that is not queued.
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int)")
+	tk.MustExec("insert into t values (1), (2), (3)")
+	statistics.AutoAnalyzeMinCnt = 0
+	defer func() {
+		statistics.AutoAnalyzeMinCnt = 1000
+	}()
+	require.NoError(t, handle.DumpStatsDeltaToKV(true))
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), pmodel.NewCIStr("test"), pmodel.NewCIStr("t"))
+	require.NoError(t, err)
+	require.NoError(t, pq.Boost(tbl.Meta().ID, 10))
+	job, err = pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, tbl.Meta().ID, job.GetTableID())
+	require.Greater(t, job.GetWeight(), 10.0)
+
+	// No job can be created for the unknown table.
+	require.ErrorContains(t, pq.Boost(1000000, 1), "no analysis job can be created")
+}
+
+func TestPushRejectsInvalidJobs(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	job := newNonPartitionedJob(1, 0.5)
+	job.TableSchema = ""
+	require.ErrorContains(t, pq.Push(job), "table schema is empty")
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	// An invalid job must not be merged into a valid one either.
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	job = newNonPartitionedJob(1, 0.9)
+	job.TableID = -1
+	require.ErrorContains(t, pq.Push(job), "table ID -1 is not positive")
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithMaxConcurrency(2))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 4; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/10)))
+	}
+
+	_, err := pq.Pop()
+	require.NoError(t, err)
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrConcurrencyLimitReached)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+
+	// A finished job frees its slot.
+	pq.Release(job.GetTableID())
+	_, err = pq.Pop()
+	require.NoError(t, err)
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrConcurrencyLimitReached)
+
+	// The limit can be adjusted at runtime.
+	pq.SetMaxConcurrency(0)
+	require.Equal(t, 0, pq.GetMaxConcurrency())
+	_, err = pq.Pop()
+	require.NoError(t, err)
+}
+
+func TestMaxConcurrencyWithConcurrentConsumers(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	const maxConcurrency = 2
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithMaxConcurrency(maxConcurrency))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	const numJobs = 20
+	for i := int64(1); i <= numJobs; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/100)))
+	}
+
+	var running, maxRunning, finished atomic.Int64
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := pq.Pop()
+				if errors.Is(err, priorityqueue.ErrHeapIsEmpty) {
+					return
+				}
+				if errors.Is(err, priorityqueue.ErrConcurrencyLimitReached) {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				require.NoError(t, err)
+				current := running.Add(1)
+				for {
+					prev := maxRunning.Load()
+					if current <= prev || maxRunning.CompareAndSwap(prev, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				finished.Add(1)
+				pq.Release(job.GetTableID())
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(numJobs), finished.Load())
+	require.LessOrEqual(t, maxRunning.Load(), int64(maxConcurrency))
+}
+
+func TestPushSkipsSmallTables(t *testing.T) {
+	defer func(minTableSize float64) {
+		priorityqueue.MinTableSizeToAnalyze = minTableSize
+	}(priorityqueue.MinTableSizeToAnalyze)
+	priorityqueue.MinTableSizeToAnalyze = 500
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	small := newNonPartitionedJob(2, 0.9)
+	small.TableSize = 100
+	require.ErrorIs(t, pq.Push(small), priorityqueue.ErrTableTooSmall)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+
+	// The job is removed if the table shrinks below the threshold.
+	shrunk := newNonPartitionedJob(1, 0.5)
+	shrunk.TableSize = 100
+	require.ErrorIs(t, pq.Push(shrunk), priorityqueue.ErrTableTooSmall)
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	// Newly added indexes are always analyzed.
+	small.Indexes = []string{"idx"}
+	require.NoError(t, pq.Push(small))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), job.GetTableID())
+}
+
+func TestPushSkipsTablesWithLowChange(t *testing.T) {
+	defer func(minChangePercentage float64) {
+		priorityqueue.MinChangePercentageToAnalyze = minChangePercentage
+	}(priorityqueue.MinChangePercentageToAnalyze)
+	priorityqueue.MinChangePercentageToAnalyze = 0.3
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	var reasons []priorityqueue.RejectReason
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithRejectHook(
+		func(_ priorityqueue.AnalysisJob, reason priorityqueue.RejectReason) {
+			reasons = append(reasons, reason)
+		},
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	// The job exactly at the threshold is kept.
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.3)))
+	lowChange := newNonPartitionedJob(3, 0.1)
+	require.ErrorIs(t, pq.Push(lowChange), priorityqueue.ErrTableChangesTooLittle)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+	require.Equal(t, []priorityqueue.RejectReason{priorityqueue.RejectReasonLowChange}, reasons)
+
+	// Newly added indexes are always analyzed.
+	lowChange.Indexes = []string{"idx"}
+	require.NoError(t, pq.Push(lowChange))
+	l, err = pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+}
+
+func TestQueueStats(t *testing.T) {
+	defer func(coefficient float64) {
+		priorityqueue.WeightAgingCoefficient = coefficient
+	}(priorityqueue.WeightAgingCoefficient)
+	priorityqueue.WeightAgingCoefficient = 0
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	_, err := pq.QueueStats()
+	require.Error(t, err)
+	require.NoError(t, pq.Initialize())
+
+	stats, err := pq.QueueStats()
+	require.NoError(t, err)
+	require.Zero(t, stats.TotalJobs)
+	require.Empty(t, stats.JobsByAnalyzeType)
+	require.True(t, stats.OldestEnqueuedAt.IsZero())
+
+	oldest := time.Now().Add(-time.Hour)
+	job1 := newNonPartitionedJob(1, 0.5)
+	job1.EnqueuedAt = oldest
+	job2 := newNonPartitionedJob(2, 0.1)
+	job2.Indexes = []string{"idx"}
+	job3 := newNonPartitionedJob(3, 0.9)
+	for _, job := range []priorityqueue.AnalysisJob{job1, job2, job3} {
+		require.NoError(t, pq.Push(job))
+	}
+
+	stats, err = pq.QueueStats()
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.TotalJobs)
+	require.Equal(t, map[string]int{"table": 2, "index": 1}, stats.JobsByAnalyzeType)
+	require.InDelta(t, job1.GetWeight()+job2.GetWeight()+job3.GetWeight(), stats.WeightSum, 1e-9)
+	require.Equal(t, job2.GetWeight(), stats.WeightMax)
+	require.Equal(t, oldest, stats.OldestEnqueuedAt)
+}
+
+func TestSnapshot(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	_, err := pq.Snapshot()
+	require.Error(t, err)
+	require.NoError(t, pq.Initialize())
+
+	jobs, err := pq.Snapshot()
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+
+	for i, changePercentage := range []float64{0.5, 0.1, 0.9, 0.5} {
+		require.NoError(t, pq.Push(newNonPartitionedJob(int64(i+1), changePercentage)))
+	}
+	jobs, err = pq.Snapshot()
+	require.NoError(t, err)
+	tableIDs := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		tableIDs = append(tableIDs, job.GetTableID())
+	}
+	require.Equal(t, []int64{3, 1, 4, 2}, tableIDs)
+
+	// Modifying the snapshot does not affect the queue.
+	jobs[0].SetWeight(-1)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 4, l)
+	top, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), top.GetTableID())
+	require.Greater(t, top.GetWeight(), 0.0)
+}
+
+func TestJobState(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t1 (a int)")
+	tk.MustExec("create table t3 (a int)")
+	handle := dom.StatsHandle()
+	// The jobs of t3 are vetoed by the validity hook.
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithValidityHook(
+		func(job priorityqueue.AnalysisJob) (bool, string) {
+			if job.GetTableID() == 3 {
+				return false, "vetoed"
+			}
+			return true, ""
+		},
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	succeeded := newNonPartitionedJob(1, 0.5)
+	require.Equal(t, priorityqueue.JobStateQueued, succeeded.State())
+	failed := newNonPartitionedJob(2, 0.1)
+	failed.TableName = "t_not_exists"
+	require.NoError(t, pq.Push(succeeded))
+	require.NoError(t, pq.Push(failed))
+
+	for _, expected := range []*priorityqueue.NonPartitionedTableAnalysisJob{succeeded, failed} {
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		require.Same(t, expected, job)
+		require.Equal(t, priorityqueue.JobStateRunning, job.State())
+		require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	}
+	require.Equal(t, priorityqueue.JobStateSucceeded, succeeded.State())
+	require.Equal(t, priorityqueue.JobStateFailed, failed.State())
+	require.Equal(t, "failed", failed.State().String())
+
+	// The job rejected by IsValidToAnalyze is skipped, and it is queued again once it is pushed back.
+	skipped := newNonPartitionedJob(3, 0.5)
+	require.NoError(t, pq.Push(skipped))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Same(t, skipped, job)
+	valid, failReason := job.IsValidToAnalyze(tk.Session().(sessionctx.Context))
+	require.False(t, valid)
+	require.Equal(t, "vetoed", failReason)
+	require.Equal(t, priorityqueue.JobStateSkipped, skipped.State())
+	pq.Release(skipped.GetTableID())
+	require.NoError(t, pq.Push(skipped))
+	jobs, err := pq.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, priorityqueue.JobStateQueued, jobs[0].State())
+}
+
+func TestExportReport(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithFixedWeightForTesting())
+	defer pq.Close()
+	require.Nil(t, pq.ExportReport())
+	require.NoError(t, pq.Initialize())
+	require.Empty(t, pq.ExportReport())
+
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.5)))
+	clock.Advance(time.Minute)
+	require.NoError(t, pq.Push(&priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "pt",
+		GlobalTableID:       2,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   3,
+		TableStatsVer:       2,
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 0.9,
+			TableSize:        1000,
+		},
+	}))
+
+	reports := pq.ExportReport()
+	require.Len(t, reports, 2)
+	require.Equal(t, "test", reports[0].Schema)
+	require.Equal(t, "pt", reports[0].Table)
+	require.Equal(t, []string{"p0"}, reports[0].Partitions)
+	require.Equal(t, int64(3), reports[0].TableID)
+	require.Equal(t, "static_partition", reports[0].AnalyzeType)
+	require.Equal(t, 0.9, reports[0].Weight)
+	require.NotEmpty(t, reports[0].WeightBreakdown)
+	require.Equal(t, clock.Now(), reports[0].EnqueuedAt)
+	require.Equal(t, "t1", reports[1].Table)
+	require.Empty(t, reports[1].Partitions)
+	require.Equal(t, int64(1), reports[1].TableID)
+	require.Equal(t, clock.Now().Add(-time.Minute), reports[1].EnqueuedAt)
+
+	// The reports can be serialized for offline analysis.
+	data, err := json.Marshal(reports)
+	require.NoError(t, err)
+	var decoded []priorityqueue.JobReport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, reports, decoded)
+
+	// Exporting the report does not modify the queue.
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+}
+
+func TestPushJobsWithFixedWeights(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	pq := priorityqueue.NewAnalysisPriorityQueue(dom.StatsHandle(), priorityqueue.WithFixedWeightForTesting())
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	for i, weight := range []float64{3, 100, 0.5, 42} {
+		require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(int64(i+1), weight)))
+	}
+	jobs, err := pq.Snapshot()
+	require.NoError(t, err)
+	tableIDs := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		tableIDs = append(tableIDs, job.GetTableID())
+	}
+	require.Equal(t, []int64{2, 4, 1, 3}, tableIDs)
+	require.InDelta(t, 100, jobs[0].GetWeight(), 0.01)
+	require.InDelta(t, 0.5, jobs[3].GetWeight(), 0.01)
+}
+
+func TestHotTables(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	pq := priorityqueue.NewAnalysisPriorityQueue(dom.StatsHandle(), priorityqueue.WithFixedWeightForTesting())
+	defer pq.Close()
+	// The hot tables can be reported before the queue is initialized.
+	pq.SetHotTables([]int64{3})
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.5)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(2, 0.3)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(3, 0.1)))
+	weights := func() map[int64]float64 {
+		jobs, err := pq.Snapshot()
+		require.NoError(t, err)
+		weights := make(map[int64]float64, len(jobs))
+		for _, job := range jobs {
+			weights[job.GetTableID()] = job.GetWeight()
+		}
+		return weights
+	}
+	top := func() int64 {
+		job, err := pq.Peek()
+		require.NoError(t, err)
+		return job.GetTableID()
+	}
+	require.Equal(t, int64(3), top())
+	require.InDelta(t, 0.1+priorityqueue.HotTableWeightBoost, weights()[3], 0.01)
+
+	// The weights of the queued jobs are recalculated when the hot tables change.
+	pq.SetHotTables([]int64{2, 4})
+	require.Equal(t, int64(2), top())
+	require.InDelta(t, 0.3+priorityqueue.HotTableWeightBoost, weights()[2], 0.01)
+	require.InDelta(t, 0.1, weights()[3], 0.01)
+
+	pq.SetHotTables(nil)
+	require.Equal(t, int64(1), top())
+	require.InDelta(t, 0.3, weights()[2], 0.01)
+}
+
+func TestMaxCapacity(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	evicted := make([]int64, 0)
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		dom.StatsHandle(),
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithMaxCapacity(3, priorityqueue.EvictLowestWeight),
+		priorityqueue.WithEvictHook(func(job priorityqueue.AnalysisJob) {
+			evicted = append(evicted, job.GetTableID())
+		}),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	for i, weight := range []float64{0.5, 0.1, 0.9} {
+		require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(int64(i+1), weight)))
+	}
+	// Updating a queued job does not need room.
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(2, 0.3)))
+	require.Empty(t, evicted)
+	// The job with the lowest weight is evicted from the middle of the heap.
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(4, 0.7)))
+	require.Equal(t, []int64{2}, evicted)
+	// The pushed job is rejected if it would be the lowest one.
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(5, 0.2)), priorityqueue.ErrQueueFull)
+	require.Equal(t, []int64{2}, evicted)
+
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+	popped := make([]int64, 0, 3)
+	for range 3 {
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		popped = append(popped, job.GetTableID())
+	}
+	require.Equal(t, []int64{3, 4, 1}, popped)
+}
+
+func TestMaxCapacityRejectNew(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	evicted := 0
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		dom.StatsHandle(),
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithMaxCapacity(2, priorityqueue.RejectNew),
+		priorityqueue.WithEvictHook(func(priorityqueue.AnalysisJob) {
+			evicted++
+		}),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.1)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(2, 0.2)))
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(3, 0.9)), priorityqueue.ErrQueueFull)
+	require.Zero(t, evicted)
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), job.GetTableID())
+
+	// There is room again after a job is popped.
+	_, err = pq.Pop()
+	require.NoError(t, err)
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(3, 0.9)))
+}
+
+func TestRejectHook(t *testing.T) {
+	defer func(minTableSize float64) {
+		priorityqueue.MinTableSizeToAnalyze = minTableSize
+	}(priorityqueue.MinTableSizeToAnalyze)
+	priorityqueue.MinTableSizeToAnalyze = 10
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	filter, err := priorityqueue.NewTableFilter(nil, []string{"test.t9"})
+	require.NoError(t, err)
+	type rejection struct {
+		tableID int64
+		reason  priorityqueue.RejectReason
+	}
+	rejections := make([]rejection, 0)
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		dom.StatsHandle(),
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithMaxCapacity(2, priorityqueue.RejectNew),
+		priorityqueue.WithTableFilter(filter),
+		priorityqueue.WithRejectHook(func(job priorityqueue.AnalysisJob, reason priorityqueue.RejectReason) {
+			rejections = append(rejections, rejection{tableID: job.GetTableID(), reason: reason})
+		}),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.1)))
+	_, err = pq.Pop()
+	require.NoError(t, err)
+	// The running table is marked as must retry, and then it is skipped until the must retry jobs are requeued.
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.1)), priorityqueue.ErrTableRunning)
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(1, 0.1)), priorityqueue.ErrTableMustRetry)
+	require.Error(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(0, 0.1)))
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(9, 0.1)), priorityqueue.ErrTableFiltered)
+	small := priorityqueue.NewJobWithWeightForTesting(4, 0.1)
+	small.Indicators.TableSize = 1
+	require.ErrorIs(t, pq.Push(small), priorityqueue.ErrTableTooSmall)
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(2, 0.2)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(3, 0.3)))
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(5, 0.5)), priorityqueue.ErrQueueFull)
+
+	require.Equal(t, []rejection{
+		{tableID: 1, reason: priorityqueue.RejectReasonRunning},
+		{tableID: 1, reason: priorityqueue.RejectReasonMustRetry},
+		{tableID: 0, reason: priorityqueue.RejectReasonInvalid},
+		{tableID: 9, reason: priorityqueue.RejectReasonFiltered},
+		{tableID: 4, reason: priorityqueue.RejectReasonTooSmall},
+		{tableID: 5, reason: priorityqueue.RejectReasonQueueFull},
+	}, rejections)
+}
+
+func TestRank(t *testing.T) {
+	// Stop the jobs from aging, so that the weights do not change between the calls.
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	priorityqueue.DefaultClock = priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	pq := priorityqueue.NewAnalysisPriorityQueue(dom.StatsHandle(), priorityqueue.WithFixedWeightForTesting())
+	defer pq.Close()
+	_, ok := pq.Rank(1)
+	require.False(t, ok)
+	require.NoError(t, pq.Initialize())
+
+	for i, weight := range []float64{0.3, 0.9, 0.5, 0.5, 0.1} {
+		require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(int64(i+1), weight)))
+	}
+	jobs, err := pq.Snapshot()
+	require.NoError(t, err)
+	for i, job := range jobs {
+		rank, ok := pq.Rank(job.GetTableID())
+		require.True(t, ok)
+		require.Equal(t, i+1, rank)
+	}
+	// The jobs with the same weight are ranked by the table ID.
+	rank, _ := pq.Rank(4)
+	require.Equal(t, 3, rank)
+	_, ok = pq.Rank(6)
+	require.False(t, ok)
+
+	_, err = pq.Pop()
+	require.NoError(t, err)
+	rank, ok = pq.Rank(5)
+	require.True(t, ok)
+	require.Equal(t, 4, rank)
+}
+
+func TestFairScheduling(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		dom.StatsHandle(),
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithFairScheduling(),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	// The schema a has a much larger backlog with higher weights than the schema b.
+	for i := range 5 {
+		job := priorityqueue.NewJobWithWeightForTesting(int64(i+1), 0.9-float64(i)*0.1)
+		job.TableSchema = "a"
+		require.NoError(t, pq.Push(job))
+	}
+	for i := range 2 {
+		job := priorityqueue.NewJobWithWeightForTesting(int64(i+11), 0.2-float64(i)*0.1)
+		job.TableSchema = "b"
+		require.NoError(t, pq.Push(job))
+	}
+	pop := func() int64 {
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		return job.GetTableID()
+	}
+	// The schemas take turns while both have jobs, and the jobs of each schema are popped by the weight.
+	popped := make([]int64, 0, 5)
+	for range 5 {
+		popped = append(popped, pop())
+	}
+	require.Equal(t, []int64{1, 11, 2, 12, 3}, popped)
+
+	// Fall back to the weights when it is disabled.
+	pq.SetFairScheduling(false)
+	job := priorityqueue.NewJobWithWeightForTesting(13, 0.95)
+	job.TableSchema = "b"
+	require.NoError(t, pq.Push(job))
+	require.Equal(t, int64(13), pop())
+	require.Equal(t, int64(4), pop())
+	require.Equal(t, int64(5), pop())
+	_, err := pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrHeapIsEmpty)
+}
+
+func TestReset(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	evicted := make([]int64, 0)
+	lengths := make([]int, 0)
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		dom.StatsHandle(),
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithEvictHook(func(job priorityqueue.AnalysisJob) {
+			evicted = append(evicted, job.GetTableID())
+		}),
+		priorityqueue.WithLenHook(func(length int) {
+			lengths = append(lengths, length)
+		}),
+	)
+	defer pq.Close()
+	// It is a no-op before the queue is initialized.
+	pq.Reset()
+	require.NoError(t, pq.Initialize())
+
+	for i, weight := range []float64{0.5, 0.3, 0.1} {
+		require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(int64(i+1), weight)))
+	}
+	running, err := pq.Pop()
+	require.NoError(t, err)
+	lengths = lengths[:0]
+
+	pq.Reset()
+	slices.Sort(evicted)
+	require.Equal(t, []int64{2, 3}, evicted)
+	require.Equal(t, []int{0}, lengths)
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	// The running job is not affected.
+	require.Contains(t, pq.GetRunningJobs(), running.GetTableID())
+	require.ErrorIs(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(running.GetTableID(), 0.5)), priorityqueue.ErrTableRunning)
+	isEmpty, err = pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	// The queue works as usual after it is reset.
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(4, 0.2)))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(4), job.GetTableID())
+}
+
+func TestPushStaticPartitionsByPattern(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int) partition by range (a) (" +
+		"partition p0 values less than (10), partition p1 values less than (20)," +
+		"partition p10 values less than (30), partition q0 values less than (40))")
+	tk.MustExec("create table t1 (a int)")
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	popPartitionNames := func() []string {
+		var names []string
+		_, err := pq.RemoveIf(func(job priorityqueue.AnalysisJob) bool {
+			names = append(names, job.(*priorityqueue.StaticPartitionedTableAnalysisJob).StaticPartitionName)
+			return true
+		})
+		require.NoError(t, err)
+		slices.Sort(names)
+		return names
+	}
+
+	n, err := pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t",
+		Pattern:     "p1*",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"p1", "p10"}, popPartitionNames())
+
+	// The regular expression must match the whole partition name.
+	n, err = pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t",
+		Pattern:     "[pq][0-9]",
+		IsRegexp:    true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, []string{"p0", "p1", "q0"}, popPartitionNames())
+
+	// Dropped partitions are not matched.
+	tk.MustExec("alter table t drop partition p10")
+	n, err = pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t",
+		Pattern:     "p1*",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []string{"p1"}, popPartitionNames())
+
+	_, err = pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t",
+		Pattern:     "p[",
+		IsRegexp:    true,
+	})
+	require.ErrorContains(t, err, "invalid partition pattern")
+	_, err = pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t1",
+		Pattern:     "*",
+	})
+	require.ErrorContains(t, err, "is not partitioned")
+	_, err = pq.PushStaticPartitionsByPattern(priorityqueue.StaticPartitionPattern{
+		TableSchema: "test",
+		TableName:   "t2",
+		Pattern:     "*",
+	})
+	require.Error(t, err)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(threshold int) {
+		priorityqueue.CircuitBreakerFailureThreshold = threshold
+	}(priorityqueue.CircuitBreakerFailureThreshold)
+	priorityqueue.CircuitBreakerFailureThreshold = 2
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	_, err := pq.GetTrippedTables()
+	require.Error(t, err)
+	require.NoError(t, pq.Initialize())
+
+	// The table does not exist, so the analysis always fails.
+	analyzeOnce := func() {
+		job := newNonPartitionedJob(1, 0.5)
+		job.TableName = "t_not_exists"
+		require.NoError(t, pq.Push(job))
+		popped, err := pq.Pop()
+		require.NoError(t, err)
+		require.NoError(t, popped.Analyze(context.Background(), handle, dom.SysProcTracker()))
+		// Allow the table to be requeued.
+		pq.RequeueMustRetryJobs()
+	}
+	analyzeOnce()
+	tripped, err := pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Empty(t, tripped)
+
+	analyzeOnce()
+	tripped, err = pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Len(t, tripped, 1)
+	require.Equal(t, int64(1), tripped[0].TableID)
+	require.Equal(t, 2, tripped[0].ConsecutiveFailures)
+	require.True(t, tripped[0].TrippedUntil.After(time.Now()))
+
+	// The tripped table cannot be pushed.
+	require.ErrorIs(t, pq.Push(newNonPartitionedJob(1, 0.5)), priorityqueue.ErrCircuitBreakerTripped)
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+
+	// The table can be pushed again after the breaker is reset.
+	require.NoError(t, pq.ResetCircuitBreaker(1))
+	tripped, err = pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Empty(t, tripped)
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+}
+
+func TestCancelDoesNotTripCircuitBreaker(t *testing.T) {
+	defer func(threshold int) {
+		priorityqueue.CircuitBreakerFailureThreshold = threshold
+	}(priorityqueue.CircuitBreakerFailureThreshold)
+	priorityqueue.CircuitBreakerFailureThreshold = 1
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	completed := 0
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithCompletionHook(
+		func(priorityqueue.AnalysisJob, bool) { completed++ },
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	job := newNonPartitionedJob(1, 0.5)
+	job.TableName = "t_not_exists"
+	require.NoError(t, pq.Push(job))
+	popped, err := pq.Pop()
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, popped.Analyze(ctx, handle, dom.SysProcTracker()), context.Canceled)
+	require.Equal(t, priorityqueue.JobStateQueued, popped.State())
+
+	// The canceled job is requeued without being counted as a failure.
+	tripped, err := pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Empty(t, tripped)
+	require.Empty(t, pq.GetRunningJobs())
+	require.Zero(t, completed)
+	popped, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), popped.GetTableID())
+
+	// A real failure still trips the breaker.
+	require.NoError(t, popped.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	tripped, err = pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Len(t, tripped, 1)
+	require.Equal(t, 1, tripped[0].ConsecutiveFailures)
+	require.Equal(t, 1, completed)
+}
+
+func TestCircuitBreakerCooldownWithMockClock(t *testing.T) {
+	defer func(threshold int, clock priorityqueue.Clock) {
+		priorityqueue.CircuitBreakerFailureThreshold = threshold
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.CircuitBreakerFailureThreshold, priorityqueue.DefaultClock)
+	priorityqueue.CircuitBreakerFailureThreshold = 1
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	// The table does not exist, so the analysis fails and trips the breaker.
+	job := newNonPartitionedJob(1, 0.5)
+	job.TableName = "t_not_exists"
+	require.NoError(t, pq.Push(job))
+	popped, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, clock.Now(), popped.(*priorityqueue.NonPartitionedTableAnalysisJob).EnqueuedAt)
+	require.NoError(t, popped.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	pq.RequeueMustRetryJobs()
+	tripped, err := pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Len(t, tripped, 1)
+	require.Equal(t, clock.Now().Add(priorityqueue.CircuitBreakerCooldown), tripped[0].TrippedUntil)
+
+	// The table is kept out of the queue until the cooldown expires.
+	clock.Advance(priorityqueue.CircuitBreakerCooldown - time.Second)
+	require.ErrorIs(t, pq.Push(newNonPartitionedJob(1, 0.5)), priorityqueue.ErrCircuitBreakerTripped)
+	isEmpty, err := pq.IsEmpty()
+	require.NoError(t, err)
+	require.True(t, isEmpty)
+	clock.Advance(time.Second)
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	isEmpty, err = pq.IsEmpty()
+	require.NoError(t, err)
+	require.False(t, isEmpty)
+}
+
+func TestAnalysisCooldown(t *testing.T) {
+	defer func(cooldown time.Duration, clock priorityqueue.Clock) {
+		priorityqueue.AnalysisCooldown = cooldown
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.AnalysisCooldown, priorityqueue.DefaultClock)
+	priorityqueue.AnalysisCooldown = time.Minute
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t1 (a int)")
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	analyzeOnce := func(job *priorityqueue.NonPartitionedTableAnalysisJob) {
+		require.NoError(t, pq.Push(job))
+		popped, err := pq.Pop()
 		require.NoError(t, err)
-		require.NotNil(t, poppedJob)
+		require.NoError(t, popped.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	}
+	analyzeOnce(newNonPartitionedJob(1, 0.5))
+
+	// The table is rejected until the cooldown expires.
+	clock.Advance(time.Minute - time.Second)
+	err := pq.Push(newNonPartitionedJob(1, 0.5))
+	require.ErrorIs(t, err, priorityqueue.ErrAnalysisCooldown)
+	require.ErrorContains(t, err, "table 1 can be pushed again in 1s")
+	// The other tables are not affected.
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.5)))
+	clock.Advance(time.Second)
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+	pq.Reset()
 
-		poppedJob, err = pq.Pop()
+	// A failed analysis does not start the cooldown.
+	job := newNonPartitionedJob(3, 0.5)
+	job.TableName = "t_not_exists"
+	analyzeOnce(job)
+	pq.RequeueMustRetryJobs()
+	require.NoError(t, pq.Push(newNonPartitionedJob(3, 0.5)))
+
+	// By default, the cooldown is as long as the last analysis.
+	priorityqueue.AnalysisCooldown = 0
+	job = newNonPartitionedJob(4, 0.5)
+	job.LastRunDuration = 10 * time.Minute
+	require.Equal(t, 10*time.Minute, priorityqueue.GetAnalysisCooldownForTesting(job))
+	// A negative value disables the cooldown.
+	priorityqueue.AnalysisCooldown = -1
+	require.LessOrEqual(t, priorityqueue.GetAnalysisCooldownForTesting(job), time.Duration(0))
+}
+
+func TestRestoreCircuitBreakerFromOutcomes(t *testing.T) {
+	defer func(threshold int) {
+		priorityqueue.CircuitBreakerFailureThreshold = threshold
+	}(priorityqueue.CircuitBreakerFailureThreshold)
+	priorityqueue.CircuitBreakerFailureThreshold = 2
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t1 (a int)")
+	tk.MustExec("create table t2 (a int)")
+	is := dom.InfoSchema()
+	tableID := func(name string) int64 {
+		tbl, err := is.TableByName(context.Background(), pmodel.NewCIStr("test"), pmodel.NewCIStr(name))
 		require.NoError(t, err)
-		require.NotNil(t, poppedJob)
+		return tbl.Meta().ID
+	}
+	t1ID, t2ID := tableID("t1"), tableID("t2")
 
-		isEmpty, err = pq.IsEmpty()
+	// Each queue is a new owner, which restores the circuit breakers from the recorded outcomes.
+	newQueue := func() *priorityqueue.AnalysisPriorityQueue {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+		require.NoError(t, pq.Initialize())
+		return pq
+	}
+	analyze := func(pq *priorityqueue.AnalysisPriorityQueue, id int64, tableName string) {
+		job := newNonPartitionedJob(id, 0.5)
+		job.TableName = tableName
+		require.NoError(t, pq.Push(job))
+		popped, err := pq.Pop()
 		require.NoError(t, err)
-		require.True(t, isEmpty)
+		require.NoError(t, popped.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	}
 
-		runningJobs := pq.GetRunningJobs()
-		require.Len(t, runningJobs, 2)
+	// t2 failed before, and then it is analyzed successfully.
+	tk.MustExec("insert into mysql.analyze_outcomes (table_id, failure_count, consecutive_failures, last_failure_time) values (?, 1, 1, now())", t2ID)
+	pq := newQueue()
+	analyze(pq, t1ID, "t_not_exists")
+	analyze(pq, t2ID, "t2")
+	pq.Close()
+	tk.MustQuery("select table_id, success_count, failure_count, consecutive_failures from mysql.analyze_outcomes order by table_id").Check(testkit.Rows(
+		fmt.Sprintf("%d 0 1 1", t1ID),
+		fmt.Sprintf("%d 1 1 0", t2ID),
+	))
+
+	// The failure is kept after the owner changes, so another failure trips the breaker.
+	pq = newQueue()
+	tripped, err := pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Empty(t, tripped)
+	analyze(pq, t1ID, "t_not_exists")
+	pq.Close()
+
+	pq = newQueue()
+	tripped, err = pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Equal(t, []priorityqueue.TrippedTable{{
+		TrippedUntil:        clock.Now().Add(priorityqueue.CircuitBreakerCooldown),
+		TableID:             t1ID,
+		ConsecutiveFailures: 2,
+	}}, tripped)
+
+	// The reset survives the owner changes.
+	require.NoError(t, pq.ResetCircuitBreaker(t1ID))
+	pq.Close()
+	pq = newQueue()
+	defer pq.Close()
+	tripped, err = pq.GetTrippedTables()
+	require.NoError(t, err)
+	require.Empty(t, tripped)
+	tk.MustQuery("select consecutive_failures from mysql.analyze_outcomes where table_id = ?", t1ID).Check(testkit.Rows("0"))
+}
+
+func TestPauseAndResume(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/10)))
+	}
+	job, err := pq.Pop()
+	require.NoError(t, err)
+
+	require.False(t, pq.IsPaused())
+	pq.Pause()
+	require.True(t, pq.IsPaused())
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrQueuePaused)
+	// The running job is not affected and the queued jobs are kept.
+	require.Contains(t, pq.GetRunningJobs(), job.GetTableID())
+	pq.Release(job.GetTableID())
+	require.NoError(t, pq.Push(newNonPartitionedJob(4, 0.4)))
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+
+	// The paused state is kept after the queue is re-initialized.
+	pq.Close()
+	require.True(t, pq.IsPaused())
+	require.NoError(t, pq.Initialize())
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.1)))
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrQueuePaused)
+
+	pq.Resume()
+	require.False(t, pq.IsPaused())
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+}
+
+func TestPauseTable(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/10)))
+	}
+
+	pq.PauseTable(3)
+	pq.PauseTable(4)
+	require.Equal(t, []int64{3, 4}, pq.GetPausedTables())
+	// The jobs of the paused tables are not pushed, but the queued jobs are kept.
+	require.ErrorIs(t, pq.Push(newNonPartitionedJob(4, 0.4)), priorityqueue.ErrTablePaused)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+	// The job of the paused table is skipped, though it has the highest weight.
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), job.GetTableID())
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrHeapIsEmpty)
+	l, err = pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+
+	pq.ResumeTable(3)
+	require.Equal(t, []int64{4}, pq.GetPausedTables())
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), job.GetTableID())
+	pq.ResumeTable(4)
+	require.Empty(t, pq.GetPausedTables())
+	require.NoError(t, pq.Push(newNonPartitionedJob(4, 0.4)))
+
+	// Pausing a partitioned table pauses all its partitions.
+	pq.PauseTable(100)
+	require.ErrorIs(t, pq.Push(&priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "pt",
+		GlobalTableID:       100,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   101,
+		TableStatsVer:       2,
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 0.9,
+			TableSize:        1000,
+		},
+	}), priorityqueue.ErrTablePaused)
+}
+
+func TestStartJitter(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	const window = 10 * time.Minute
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(
+		handle,
+		priorityqueue.WithFixedWeightForTesting(),
+		priorityqueue.WithStartJitter(window),
+	)
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	tableIDs := []int64{1, 2, 3, 4, 5}
+	jitters := make(map[int64]time.Duration, len(tableIDs))
+	for _, tableID := range tableIDs {
+		// The jitter is deterministic per table.
+		jitter := priorityqueue.GetStartJitterForTesting(tableID, window)
+		require.Equal(t, jitter, priorityqueue.GetStartJitterForTesting(tableID, window))
+		require.GreaterOrEqual(t, jitter, time.Duration(0))
+		require.Less(t, jitter, window)
+		jitters[tableID] = jitter
+		require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(tableID, float64(tableID)/10)))
+	}
+	// The jobs become runnable one by one in the order of their jitters, regardless of their weights.
+	slices.SortFunc(tableIDs, func(a, b int64) int {
+		return cmp.Compare(jitters[a], jitters[b])
 	})
+	require.NotZero(t, jitters[tableIDs[0]])
+	_, err := pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrHeapIsEmpty)
+	start := clock.Now()
+	for _, tableID := range tableIDs {
+		clock.Set(start.Add(jitters[tableID]))
+		job, err := pq.Pop()
+		require.NoError(t, err)
+		require.Equal(t, tableID, job.GetTableID())
+	}
+
+	// The jobs are popped by their weights after the window.
+	clock.Set(start.Add(window))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(6, 0.1)))
+	require.NoError(t, pq.Push(priorityqueue.NewJobWithWeightForTesting(7, 0.2)))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(7), job.GetTableID())
+}
+
+func TestDrain(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.Error(t, pq.Drain(context.Background()))
+	require.NoError(t, pq.Initialize())
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(i, float64(i)/10)))
+	}
+	job, err := pq.Pop()
+	require.NoError(t, err)
+
+	// The running job blocks the drain until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pq.Drain(ctx), context.DeadlineExceeded)
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrQueueDraining)
+
+	// The drain finishes once the running job is finished.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		pq.Release(job.GetTableID())
+	}()
+	require.NoError(t, pq.Drain(context.Background()))
+	require.Empty(t, pq.GetRunningJobs())
+
+	// The queued jobs are kept.
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+
+	// The queue can be used again after being re-initialized.
+	pq.Close()
+	require.NoError(t, pq.Initialize())
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.1)))
+	_, err = pq.Pop()
+	require.NoError(t, err)
+}
+
+func TestWithWeightCalculator(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	// Favor small tables for quick wins.
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithWeightCalculator(
+		func(indicators priorityqueue.Indicators) float64 {
+			return -indicators.TableSize
+		},
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	large := newNonPartitionedJob(1, 0.9)
+	large.TableSize = 10000
+	require.NoError(t, pq.Push(large))
+	small := newNonPartitionedJob(2, 0.1)
+	small.TableSize = 10
+	require.NoError(t, pq.Push(small))
+	require.Equal(t, float64(-10), small.Weight)
+
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, small.TableID, job.GetTableID())
+
+	// Special events are still taken into account.
+	withIndex := newNonPartitionedJob(3, 0.1)
+	withIndex.TableSize = 10000
+	withIndex.Indexes = []string{"idx"}
+	require.NoError(t, pq.Push(withIndex))
+	require.Equal(t, priorityqueue.EventNewIndex-10000, withIndex.Weight)
+}
+
+func TestUpdateWithWeightCalculator(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithWeightCalculator(
+		func(indicators priorityqueue.Indicators) float64 {
+			return indicators.ChangePercentage * 10
+		},
+	))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	pq.SetHotTables([]int64{1})
+
+	job := newNonPartitionedJob(1, 0.5)
+	require.NoError(t, pq.Push(job))
+	require.Equal(t, 5+priorityqueue.HotTableWeightBoost, job.Weight)
+
+	// Setting the indicators does not change the weight, the queue recalculates it.
+	indicators := job.GetIndicators()
+	indicators.ChangePercentage = 0.8
+	job.SetIndicators(indicators)
+	require.Equal(t, 5+priorityqueue.HotTableWeightBoost, job.Weight)
+
+	// The weight is recalculated by the calculator of the queue with the hot table boost.
+	indicators.ChangePercentage = 0.9
+	require.NoError(t, pq.Update(1, indicators))
+	require.Equal(t, 9+priorityqueue.HotTableWeightBoost, job.Weight)
+}
+
+func TestRecomputeAll(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	favorSmallTables := false
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithWeightCalculator(
+		func(indicators priorityqueue.Indicators) float64 {
+			if favorSmallTables {
+				return -indicators.TableSize
+			}
+			return indicators.TableSize
+		},
+	))
+	defer pq.Close()
+	require.Error(t, pq.RecomputeAll())
+	require.NoError(t, pq.Initialize())
+
+	for i := 1; i <= 5; i++ {
+		job := newNonPartitionedJob(int64(i), 0.5)
+		job.TableSize = float64(i * 100)
+		require.NoError(t, pq.Push(job))
+	}
+	tableIDs := func() []int64 {
+		jobs, err := pq.Snapshot()
+		require.NoError(t, err)
+		ids := make([]int64, 0, len(jobs))
+		for _, job := range jobs {
+			ids = append(ids, job.GetTableID())
+		}
+		return ids
+	}
+	require.Equal(t, []int64{5, 4, 3, 2, 1}, tableIDs())
+
+	// The queued jobs keep the old weights until they are recomputed.
+	favorSmallTables = true
+	require.Equal(t, []int64{5, 4, 3, 2, 1}, tableIDs())
+	require.NoError(t, pq.RecomputeAll())
+	require.Equal(t, []int64{1, 2, 3, 4, 5}, tableIDs())
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+	require.Equal(t, float64(-100), job.(*priorityqueue.NonPartitionedTableAnalysisJob).Weight)
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 4, l)
+}
+
+func TestReschedule(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+	defer pq.Close()
+	require.Error(t, pq.Reschedule(newNonPartitionedJob(1, 0.5), 1))
+	require.NoError(t, pq.Initialize())
+	require.Error(t, pq.Reschedule(newNonPartitionedJob(1, 0.5), -1))
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.4)))
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), job.GetTableID())
+	weight := job.GetWeight()
+
+	// The rescheduled job is queued after the job with a lower weight.
+	pq.Release(job.GetTableID())
+	require.NoError(t, pq.Reschedule(job, 1))
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, l)
+	require.InDelta(t, weight-1, job.GetWeight(), 1e-6)
+	peek, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), peek.GetTableID())
+
+	// The job is rescheduled automatically after a transient failure.
+	defer func(penalty float64) {
+		priorityqueue.TransientFailureWeightPenalty = penalty
+	}(priorityqueue.TransientFailureWeightPenalty)
+	priorityqueue.TransientFailureWeightPenalty = 2
+	require.NoError(t, pq.Push(&transientFailureJob{NonPartitionedTableAnalysisJob: newNonPartitionedJob(3, 0.9)}))
+	job, err = pq.Pop()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), job.GetTableID())
+	weight = job.GetWeight()
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Empty(t, pq.GetRunningJobs())
+	l, err = pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+	require.InDelta(t, weight-2, job.GetWeight(), 1e-6)
+	peek, err = pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), peek.GetTableID())
+}
+
+func TestEnqueueHook(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	handle := dom.StatsHandle()
+	var (
+		tableIDs []int64
+		weights  []float64
+	)
+	pq := priorityqueue.NewAnalysisPriorityQueue(handle, priorityqueue.WithEnqueueHook(func(job priorityqueue.AnalysisJob) {
+		tableIDs = append(tableIDs, job.GetTableID())
+		weights = append(weights, job.GetWeight())
+	}))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	require.NoError(t, pq.Push(newNonPartitionedJob(1, 0.5)))
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.4)))
+	// The merged job is reported again.
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.6)))
+	require.Equal(t, []int64{1, 2, 2}, tableIDs)
+	queued, err := pq.Snapshot()
+	require.NoError(t, err)
+	require.InDelta(t, queued[0].GetWeight(), weights[2], 1e-6)
+
+	// The skipped job is not reported.
+	job, err := pq.Pop()
+	require.NoError(t, err)
+	require.ErrorIs(t, pq.Push(newNonPartitionedJob(job.GetTableID(), 0.9)), priorityqueue.ErrTableRunning)
+	require.Len(t, tableIDs, 3)
+
+	// The rescheduled job is reported with the penalty applied.
+	pq.Release(job.GetTableID())
+	require.NoError(t, pq.Reschedule(job, 1))
+	require.Len(t, tableIDs, 4)
+	require.Equal(t, job.GetTableID(), tableIDs[3])
+	require.InDelta(t, job.GetWeight(), weights[3], 1e-6)
+}
+
+// transientFailureJob is a job that always fails with a transient error.
+type transientFailureJob struct {
+	*priorityqueue.NonPartitionedTableAnalysisJob
+	failureHook priorityqueue.JobHook
+}
+
+func (j *transientFailureJob) RegisterFailureHook(hook priorityqueue.JobHook) {
+	j.failureHook = hook
+}
+
+func (j *transientFailureJob) Analyze(context.Context, statstypes.StatsHandle, sysproctrack.Tracker) error {
+	j.failureHook(j)
+	return nil
+}
+
+func (*transientFailureJob) IsLastFailureTransient() bool {
+	return true
+}
+
+func newNonPartitionedJob(tableID int64, changePercentage float64) *priorityqueue.NonPartitionedTableAnalysisJob {
+	return &priorityqueue.NonPartitionedTableAnalysisJob{
+		TableSchema:   "test",
+		TableName:     fmt.Sprintf("t%d", tableID),
+		TableID:       tableID,
+		TableStatsVer: 2,
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: changePercentage,
+			TableSize:        1000,
+		},
+	}
+}
+
+// BenchmarkUpdate checks that updating a job costs O(log n) time,
+// i.e. the time per operation grows slowly as the queue grows.
+func BenchmarkUpdate(b *testing.B) {
+	_, dom := testkit.CreateMockStoreAndDomain(b)
+	handle := dom.StatsHandle()
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+			defer pq.Close()
+			require.NoError(b, pq.Initialize())
+			for i := 1; i <= size; i++ {
+				require.NoError(b, pq.Push(newNonPartitionedJob(int64(i), float64(i%100)/100)))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tableID := int64(i%size + 1)
+				indicators := priorityqueue.Indicators{ChangePercentage: float64(i%97) / 100, TableSize: 1000}
+				if err := pq.Update(tableID, indicators); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRecomputeAll compares recomputing the weights of all jobs at once, which rebuilds the queue in O(n) time,
+// with updating the jobs one by one, which costs O(n log n) time.
+func BenchmarkRecomputeAll(b *testing.B) {
+	_, dom := testkit.CreateMockStoreAndDomain(b)
+	handle := dom.StatsHandle()
+	for _, size := range []int{1000, 10000, 100000} {
+		pq := priorityqueue.NewAnalysisPriorityQueue(handle)
+		require.NoError(b, pq.Initialize())
+		for i := 1; i <= size; i++ {
+			require.NoError(b, pq.Push(newNonPartitionedJob(int64(i), float64(i%100)/100)))
+		}
+		b.Run(fmt.Sprintf("size=%d/RecomputeAll", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := pq.RecomputeAll(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("size=%d/UpdateEach", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for tableID := 1; tableID <= size; tableID++ {
+					indicators := priorityqueue.Indicators{ChangePercentage: float64(tableID%100) / 100, TableSize: 1000}
+					if err := pq.Update(int64(tableID), indicators); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		pq.Close()
+	}
 }
 
 func TestRefreshLastAnalysisDuration(t *testing.T) {
@@ -217,8 +2219,8 @@ func testProcessDMLChanges(t *testing.T, partitioned bool) {
 	job2, err := pq.Pop()
 	require.NoError(t, err)
 	require.Equal(t, tbl2.Meta().ID, job2.GetTableID())
-	require.NoError(t, job1.Analyze(handle, dom.SysProcTracker()))
-	require.NoError(t, job2.Analyze(handle, dom.SysProcTracker()))
+	require.NoError(t, job1.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.NoError(t, job2.Analyze(context.Background(), handle, dom.SysProcTracker()))
 	require.NoError(t, handle.Update(ctx, dom.InfoSchema()))
 
 	// Insert 9 rows into t1.
@@ -267,6 +2269,12 @@ func TestProcessDMLChangesPartitioned(t *testing.T) {
 }
 
 func TestProcessDMLChangesWithRunningJobs(t *testing.T) {
+	// Requeue the analyzed table right away, see TestAnalysisCooldown.
+	defer func(cooldown time.Duration) {
+		priorityqueue.AnalysisCooldown = cooldown
+	}(priorityqueue.AnalysisCooldown)
+	priorityqueue.AnalysisCooldown = -1
+
 	store, dom := testkit.CreateMockStoreAndDomain(t)
 	handle := dom.StatsHandle()
 	tk := testkit.NewTestKit(t, store)
@@ -330,7 +2338,7 @@ func TestProcessDMLChangesWithRunningJobs(t *testing.T) {
 	require.Equal(t, tbl2.Meta().ID, job2.GetTableID(), "t1 should not be in the queue since it's a running job")
 
 	// Analyze the job.
-	require.NoError(t, job1.Analyze(handle, dom.SysProcTracker()))
+	require.NoError(t, job1.Analyze(context.Background(), handle, dom.SysProcTracker()))
 
 	// Add more rows to t1.
 	tk.MustExec("insert into t1 values (4), (5), (6), (7), (8), (9), (10), (11), (12), (13)")
@@ -602,3 +2610,53 @@ func TestPQCanBeClosedAndReInitialized(t *testing.T) {
 	// Check if the priority queue is initialized.
 	require.True(t, pq.IsInitialized())
 }
+
+func TestStartRateLimit(t *testing.T) {
+	defer func(clock priorityqueue.Clock) {
+		priorityqueue.DefaultClock = clock
+	}(priorityqueue.DefaultClock)
+	clock := priorityqueue.NewMockClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	priorityqueue.DefaultClock = clock
+
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	// At most one job every 30 seconds, and two jobs at once.
+	pq := priorityqueue.NewAnalysisPriorityQueue(dom.StatsHandle(), priorityqueue.WithStartRateLimit(1.0/30, 2))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, pq.Push(newNonPartitionedJob(int64(i), 0.5)))
+	}
+
+	// The burst is allowed at once.
+	for range 2 {
+		_, err := pq.Pop()
+		require.NoError(t, err)
+	}
+	_, err := pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrStartRateLimited)
+	// The rate limited jobs are not dropped.
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 3, l)
+
+	// The starts are spaced by 30 seconds.
+	for range 3 {
+		clock.Advance(29 * time.Second)
+		_, err = pq.Pop()
+		require.ErrorIs(t, err, priorityqueue.ErrStartRateLimited)
+		clock.Advance(time.Second)
+		_, err = pq.Pop()
+		require.NoError(t, err)
+	}
+
+	// No token is taken if there is no job.
+	clock.Advance(time.Minute)
+	_, err = pq.Pop()
+	require.ErrorIs(t, err, priorityqueue.ErrHeapIsEmpty)
+	require.NoError(t, pq.Push(newNonPartitionedJob(6, 0.5)))
+	require.NoError(t, pq.Push(newNonPartitionedJob(7, 0.5)))
+	for range 2 {
+		_, err = pq.Pop()
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import "time"
+
+// startRateLimiter is a token bucket that limits how frequently the jobs are popped,
+// so that a large backlog, e.g. after the owner restarts, does not start all at once.
+// The bucket starts full, holds at most burst tokens and is refilled with rate tokens per second.
+// NOTE: This struct is not thread-safe.
+type startRateLimiter struct {
+	// last is the time when the tokens were refilled last time.
+	last   time.Time
+	rate   float64
+	tokens float64
+	burst  int
+}
+
+func newStartRateLimiter(rate float64, burst int) *startRateLimiter {
+	burst = max(burst, 1)
+	return &startRateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+	}
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (l *startRateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	if l.last.IsZero() || now.After(l.last) {
+		l.last = now
+	}
+}
+
+// allow takes a token if there is one.
+func (l *startRateLimiter) allow(now time.Time) bool {
+	l.refill(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
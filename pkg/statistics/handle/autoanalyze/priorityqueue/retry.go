@@ -0,0 +1,109 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/exec"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"github.com/pingcap/tidb/pkg/util/sqlescape"
+	"go.uber.org/zap"
+)
+
+var (
+	// AnalyzeMaxRetryCount is the max number of retries for an analyze statement failed with a transient error.
+	AnalyzeMaxRetryCount = 3
+	// AnalyzeRetryBaseBackoff is the backoff before the first retry. It is doubled for each subsequent retry.
+	AnalyzeRetryBaseBackoff = time.Second
+)
+
+// isTransientAnalyzeError checks whether the analyze statement failed with an error
+// that is likely to disappear by itself, such as lock conflicts or a busy server, see exec.AnalyzeFailureKind.
+// All other errors, e.g. the table is dropped or the statement is killed, are considered permanent.
+func isTransientAnalyzeError(err error) bool {
+	return exec.GetAnalyzeFailureKind(err).IsTransient()
+}
+
+// retryOnTransientError runs the function and retries it with exponential backoff
+// if it fails with a transient error. It returns the last error.
+// If the context is done while waiting to retry, it returns the cause of the context immediately.
+func retryOnTransientError(ctx context.Context, logger *zap.Logger, run func() error) error {
+	backoff := AnalyzeRetryBaseBackoff
+	for retry := 0; ; retry++ {
+		err := run()
+		if retry >= AnalyzeMaxRetryCount || !isTransientAnalyzeError(err) {
+			return err
+		}
+		logger.Warn(
+			"Analyze failed with a transient error, retry later",
+			zap.Int("retry", retry+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// autoAnalyze executes the analyze statement with the session variables and retries it on transient errors.
+// Each attempt gets a session from the pool, so that no session is held while waiting to retry.
+// It returns the last error if the analyze statement fails eventually.
+func autoAnalyze(
+	ctx context.Context,
+	logger *zap.Logger,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+	statsVer int,
+	sessionVars SessionVariables,
+	sql string,
+	params ...any,
+) error {
+	err := retryOnTransientError(ctx, logger, func() error {
+		var analyzeErr error
+		// The failed statement does not break the session, so the session is put back into the pool anyway.
+		err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			restore, err := sessionVars.apply(logger, sctx)
+			if err != nil {
+				return err
+			}
+			// Restore the session variables even if the analyze statement panics,
+			// because the session is put back into the pool and reused by others.
+			defer restore()
+			analyzeErr = exec.RunAutoAnalyze(sctx, statsHandle, sysProcTracker, statsVer, sql, params...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return analyzeErr
+	})
+	if err != nil {
+		escaped, err1 := sqlescape.EscapeSQL(sql, params...)
+		if err1 != nil {
+			escaped = ""
+		}
+		logger.Error("Analysis job failed", zap.String("sql", escaped), zap.Error(err))
+	}
+	return err
+}
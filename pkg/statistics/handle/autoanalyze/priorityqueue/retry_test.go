@@ -0,0 +1,88 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/kv"
+	storeerr "github.com/pingcap/tidb/pkg/store/driver/error"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestIsTransientAnalyzeError(t *testing.T) {
+	require.False(t, isTransientAnalyzeError(nil))
+	require.True(t, isTransientAnalyzeError(storeerr.ErrLockWaitTimeout))
+	require.True(t, isTransientAnalyzeError(errors.Trace(storeerr.ErrTiKVServerBusy)))
+	require.True(t, isTransientAnalyzeError(kv.ErrWriteConflict))
+	require.False(t, isTransientAnalyzeError(infoschema.ErrTableNotExists.GenWithStackByArgs("test", "t")))
+	require.False(t, isTransientAnalyzeError(storeerr.ErrQueryInterrupted))
+	require.False(t, isTransientAnalyzeError(errors.New("unknown error")))
+}
+
+func TestRetryOnTransientError(t *testing.T) {
+	originCount, originBackoff := AnalyzeMaxRetryCount, AnalyzeRetryBaseBackoff
+	AnalyzeMaxRetryCount, AnalyzeRetryBaseBackoff = 3, time.Millisecond
+	defer func() {
+		AnalyzeMaxRetryCount, AnalyzeRetryBaseBackoff = originCount, originBackoff
+	}()
+
+	// Succeed after retrying transient errors.
+	calls := 0
+	err := retryOnTransientError(context.Background(), zap.NewNop(), func() error {
+		calls++
+		if calls < 3 {
+			return storeerr.ErrLockWaitTimeout
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// Give up after the max retry count.
+	calls = 0
+	err = retryOnTransientError(context.Background(), zap.NewNop(), func() error {
+		calls++
+		return storeerr.ErrTiKVServerBusy
+	})
+	require.ErrorIs(t, err, storeerr.ErrTiKVServerBusy)
+	require.Equal(t, AnalyzeMaxRetryCount+1, calls)
+
+	// Fail immediately on permanent errors.
+	calls = 0
+	err = retryOnTransientError(context.Background(), zap.NewNop(), func() error {
+		calls++
+		return infoschema.ErrTableNotExists.GenWithStackByArgs("test", "t")
+	})
+	require.True(t, infoschema.ErrTableNotExists.Equal(err))
+	require.Equal(t, 1, calls)
+
+	// Stop waiting once the context is done.
+	AnalyzeRetryBaseBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = retryOnTransientError(ctx, zap.NewNop(), func() error {
+		calls++
+		cancel()
+		return storeerr.ErrLockWaitTimeout
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import "github.com/pingcap/tidb/pkg/statistics"
+
+var (
+	// FullAnalyzeChangePercentageCutoff is the change percentage from which the tables are fully analyzed,
+	// i.e. with the sample rate 1, because their stats are too stale to be estimated from a few samples.
+	// Set it to 0 to disable the full analysis.
+	FullAnalyzeChangePercentageCutoff = 0.0
+	// SampleRateByChangePercentage maps the change percentage of a table below FullAnalyzeChangePercentageCutoff
+	// to the sample rate used to analyze it, so that the tables with moderate changes are analyzed more cheaply.
+	// The returned sample rate must be in (0, 1]. Otherwise, the default sample rate of the session is used.
+	// nil means always using the default sample rate of the session.
+	SampleRateByChangePercentage func(changePercentage float64) float64
+	// SampleRateByTableSize maps the size of a table, see Indicators.TableSize, to the sample rate used to analyze it,
+	// so that the bigger tables are analyzed with lower sample rates to keep the analysis affordable.
+	// It is only used if no sample rate is chosen by the change percentage.
+	// The returned sample rate must be in (0, 1]. Otherwise, the default sample rate of the session is used.
+	// nil means always using the default sample rate of the session. See DefaultSampleRateByTableSize for a curve.
+	SampleRateByTableSize func(tableSize float64) float64
+)
+
+const (
+	// fullSampleTableSize is the table size up to which DefaultSampleRateByTableSize samples the whole table.
+	fullSampleTableSize = 1_000_000
+	// minSampleRateByTableSize is the lowest sample rate returned by DefaultSampleRateByTableSize.
+	minSampleRateByTableSize = 0.001
+)
+
+// DefaultSampleRateByTableSize is a curve for SampleRateByTableSize, which samples about fullSampleTableSize cells,
+// e.g. 100K rows of a 10-column table, no matter how big the table is.
+// The tables not bigger than that are fully sampled, and the sample rate never drops below minSampleRateByTableSize,
+// so that the stats of the huge tables are still built from enough samples.
+func DefaultSampleRateByTableSize(tableSize float64) float64 {
+	if !(tableSize > fullSampleTableSize) {
+		return 1
+	}
+	return max(fullSampleTableSize/tableSize, minSampleRateByTableSize)
+}
+
+// adaptToIndicators returns the options with the sample rate chosen by the change percentage of the table,
+// see FullAnalyzeChangePercentageCutoff and SampleRateByChangePercentage, or by the size of the table,
+// see SampleRateByTableSize.
+// The options are returned as is if the sample rate or the number of samples is set explicitly,
+// or the table uses the version 1 statistics, which do not support the sample rate.
+func (o AnalyzeOptions) adaptToIndicators(changePercentage, tableSize float64, statsVer int) AnalyzeOptions {
+	if o.SampleRate > 0 || o.NumSamples > 0 || statsVer == statistics.Version1 {
+		return o
+	}
+	if FullAnalyzeChangePercentageCutoff > 0 && changePercentage >= FullAnalyzeChangePercentageCutoff {
+		o.SampleRate = 1
+		return o
+	}
+	if SampleRateByChangePercentage != nil {
+		if rate := SampleRateByChangePercentage(changePercentage); rate > 0 && rate <= 1 {
+			o.SampleRate = rate
+			return o
+		}
+	}
+	if SampleRateByTableSize != nil {
+		if rate := SampleRateByTableSize(tableSize); rate > 0 && rate <= 1 {
+			o.SampleRate = rate
+		}
+	}
+	return o
+}
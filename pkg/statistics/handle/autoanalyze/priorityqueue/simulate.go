@@ -0,0 +1,52 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import "github.com/pingcap/errors"
+
+// SimulatePopOrder returns the order in which the jobs would be popped from a queue that weighs them with the calculator,
+// so that a change of the weight formula can be evaluated offline against the recorded indicators of real jobs,
+// e.g. the ones exported by AnalysisPriorityQueue.Snapshot, without a live session.
+// The weight of a job is calculated like AnalysisPriorityQueue.Push does, i.e. the special events are added,
+// and the aging boost is applied according to EnqueuedAt. The hot tables are not taken into account.
+// If calculator is nil, DefaultWeightCalculator is used.
+// Like the queue, it keeps only the last one of the jobs with the same table ID.
+// The passed jobs are not modified, and the returned ones are their clones.
+func SimulatePopOrder(jobs []AnalysisJob, calculator WeightCalculator) ([]AnalysisJob, error) {
+	if calculator == nil {
+		calculator = DefaultWeightCalculator
+	}
+	priorityCalculator := NewPriorityCalculator()
+	h := newHeap()
+	for _, job := range jobs {
+		if job == nil {
+			continue
+		}
+		cloned := job.Clone()
+		cloned.SetWeight(calculator(cloned.GetIndicators()) + priorityCalculator.GetSpecialEvent(cloned))
+		if err := h.addOrUpdate(cloned); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	order := make([]AnalysisJob, 0, h.len())
+	for !h.isEmpty() {
+		job, err := h.pop()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		order = append(order, job)
+	}
+	return order, nil
+}
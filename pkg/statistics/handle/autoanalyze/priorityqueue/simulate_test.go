@@ -0,0 +1,79 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulatePopOrder(t *testing.T) {
+	now := time.Now()
+	newJob := func(tableID int64, changePercentage float64, lastAnalyzeTime time.Time) *priorityqueue.NonPartitionedTableAnalysisJob {
+		job := newNonPartitionedJob(tableID, changePercentage)
+		job.LastAnalyzeTime = lastAnalyzeTime
+		job.LastAnalysisDuration = now.Sub(lastAnalyzeTime)
+		return job
+	}
+	jobs := []priorityqueue.AnalysisJob{
+		newJob(1, 0.2, now.Add(-time.Hour)),
+		newJob(2, 0.9, now.Add(-time.Hour)),
+		newJob(3, 0.5, now.Add(-time.Hour)),
+	}
+	tableIDs := func(order []priorityqueue.AnalysisJob) []int64 {
+		ids := make([]int64, 0, len(order))
+		for _, job := range order {
+			ids = append(ids, job.GetTableID())
+		}
+		return ids
+	}
+
+	// The tables are analyzed at the same time, so the change percentage decides the order.
+	order, err := priorityqueue.SimulatePopOrder(jobs, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 3, 1}, tableIDs(order))
+	for _, job := range order {
+		require.Equal(t, priorityqueue.DefaultWeightCalculator(job.GetIndicators()), job.GetWeight())
+	}
+	// The passed jobs are not modified.
+	for _, job := range jobs {
+		require.Zero(t, job.GetWeight())
+	}
+
+	// The staleness decides the order with another calculator.
+	staleJobs := []priorityqueue.AnalysisJob{
+		newJob(1, 0.2, now.Add(-72*time.Hour)),
+		newJob(2, 0.9, now.Add(-time.Hour)),
+		newJob(3, 0.5, now.Add(-24*time.Hour)),
+	}
+	order, err = priorityqueue.SimulatePopOrder(staleJobs, priorityqueue.StalenessWeightCalculator)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 3, 2}, tableIDs(order))
+
+	// The special events are added, and the last job of the same table is kept.
+	withIndex := newJob(1, 0.2, now.Add(-time.Hour))
+	withIndex.Indexes = []string{"idx"}
+	order, err = priorityqueue.SimulatePopOrder(append(jobs, withIndex, nil), nil)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3}, tableIDs(order))
+	require.Equal(t, []string{"idx"}, order[0].(*priorityqueue.NonPartitionedTableAnalysisJob).Indexes)
+
+	order, err = priorityqueue.SimulatePopOrder(nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, order)
+}
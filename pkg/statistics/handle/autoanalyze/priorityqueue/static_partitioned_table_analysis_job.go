@@ -15,33 +15,148 @@
 package priorityqueue
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/parser/ast"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
-	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/exec"
+	"github.com/pingcap/tidb/pkg/sessionctx/variable"
+	"github.com/pingcap/tidb/pkg/statistics"
+	"github.com/pingcap/tidb/pkg/statistics/handle/logutil"
 	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
 	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"github.com/pingcap/tidb/pkg/types"
+	"go.uber.org/zap"
 )
 
 var _ AnalysisJob = &StaticPartitionedTableAnalysisJob{}
 
+// IndexStalenessThreshold is how long the stats of an index stay fresh after it is analyzed.
+// The indexes of the static partition jobs analyzed more recently are skipped, see IndexLastAnalyzedAt.
+// Set it to 0 to analyze all indexes regardless of when they are analyzed.
+var IndexStalenessThreshold time.Duration
+
+// QuickAnalyzeOptions are the options of the quick analyze, see StaticPartitionedTableAnalysisJob.Quick.
+// They collect only a few samples, buckets and TopN values, which are enough to seed the basic stats cheaply.
+var QuickAnalyzeOptions = AnalyzeOptions{
+	NumBuckets: 16,
+	NumTopN:    10,
+	NumSamples: 1000,
+}
+
 const (
-	analyzeStaticPartition      analyzeType = "analyzeStaticPartition"
-	analyzeStaticPartitionIndex analyzeType = "analyzeStaticPartitionIndex"
+	analyzeStaticPartition        analyzeType = "analyzeStaticPartition"
+	analyzeStaticPartitionIndex   analyzeType = "analyzeStaticPartitionIndex"
+	analyzeStaticPartitionColumns analyzeType = "analyzeStaticPartitionColumns"
+
+	analyzeStaticPartitionPredicateColumns analyzeType = "analyzeStaticPartitionPredicateColumns"
+	analyzeStaticPartitionQuick            analyzeType = "analyzeStaticPartitionQuick"
 )
 
+// AnalyzeOptions is the options of the analyze statements.
+// The zero value of each option means using the default value of the session.
+type AnalyzeOptions struct {
+	// SampleRate is the sample rate of the analyze statements. It must be in (0, 1].
+	SampleRate float64
+	// NumBuckets is the max number of histogram buckets.
+	NumBuckets uint64
+	// NumTopN is the max number of TopN values.
+	NumTopN uint64
+	// NumSamples is the number of the sampled rows. It cannot be set together with SampleRate.
+	NumSamples uint64
+}
+
+// Validate checks whether the options are valid.
+func (o AnalyzeOptions) Validate() error {
+	// Zero means using the default sample rate.
+	if !(o.SampleRate >= 0 && o.SampleRate <= 1) {
+		return errors.Errorf("sample rate %v is out of range (0, 1]", o.SampleRate)
+	}
+	if o.SampleRate > 0 && o.NumSamples > 0 {
+		return errors.Errorf("sample rate %v and sample number %d cannot be set together", o.SampleRate, o.NumSamples)
+	}
+	return nil
+}
+
+// genClause generates the WITH clause of the analyze statements.
+// It returns an empty string if all options are zero values.
+func (o AnalyzeOptions) genClause() string {
+	opts := make([]string, 0, 4)
+	if o.NumBuckets > 0 {
+		opts = append(opts, fmt.Sprintf("%d buckets", o.NumBuckets))
+	}
+	if o.NumTopN > 0 {
+		opts = append(opts, fmt.Sprintf("%d topn", o.NumTopN))
+	}
+	if o.NumSamples > 0 {
+		opts = append(opts, fmt.Sprintf("%d samples", o.NumSamples))
+	}
+	if o.SampleRate > 0 {
+		opts = append(opts, strconv.FormatFloat(o.SampleRate, 'f', -1, 64)+" samplerate")
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return " with " + strings.Join(opts, ", ")
+}
+
 // StaticPartitionedTableAnalysisJob is a job for analyzing a static partitioned table.
 type StaticPartitionedTableAnalysisJob struct {
 	successHook         JobHook
 	failureHook         JobHook
+	progressHook        ProgressHook
+	validityHook        ValidityHook
+	tracer              Tracer
 	TableSchema         string
 	GlobalTableName     string
 	StaticPartitionName string
 	// This is only for newly added indexes.
 	Indexes []string
+	// ExcludedIndexes are the indexes to skip temporarily, e.g. the indexes being rebuilt, to avoid contention.
+	// They are filtered out of Indexes when generating the analyze statements.
+	// If all indexes are excluded, the partition is analyzed as if it had no newly added index.
+	ExcludedIndexes []string
+	// IndexLastAnalyzedAt is the time when the stats of each index were analyzed last time, keyed by the index name.
+	// The indexes analyzed within IndexStalenessThreshold are skipped when generating the analyze statements,
+	// e.g. when the job is requeued after only some of its indexes are analyzed.
+	// The indexes without a time are always analyzed.
+	// It is filled from the index stats of the partition, see AnalysisJobFactory.FindIndexLastAnalyzeTimes.
+	IndexLastAnalyzedAt map[string]time.Time
+	// GlobalIndexes are the global indexes of the table to analyze together with the partition.
+	// The analyze of a partition does not refresh the stats of a global index, which belong to the whole table,
+	// so each of them is analyzed by a separate statement on the whole table after the partition.
+	GlobalIndexes []string
+	// Columns is the subset of columns to analyze.
+	// If it is empty, all columns of the partition will be analyzed.
+	Columns []string
+	// PredicateColumns analyzes only the predicate columns and the columns needed by the indexes of the partition,
+	// which are selected by TiDB automatically. It is ignored if Columns is set.
+	// If no predicate column has been collected for the table yet, all columns of the partition are analyzed.
+	PredicateColumns bool
+	// AnalyzeOptions is used to override the default options of the analyze statements.
+	AnalyzeOptions AnalyzeOptions
+	// AnalyzeEachIndex forces analyzing the newly added indexes one by one even for version 2,
+	// so that only the listed indexes are refreshed instead of all indexes and columns of the partition.
+	AnalyzeEachIndex bool
+	// SessionVariables is used to override the session variables while executing the analyze statements.
+	SessionVariables SessionVariables
+	// Quick analyzes the partition with QuickAnalyzeOptions instead of AnalyzeOptions, e.g. for a newly created partition
+	// that has no stats at all, where some stats are much better than none. It takes precedence over the indexes and
+	// columns to analyze. The partition is analyzed as usual later once it changes enough.
+	Quick bool
+	// MergeGlobalStats merges the stats of all partitions into the global stats of the table after the partition is analyzed,
+	// for the clusters migrating to dynamic pruning. Leave it false for the clusters in pure static pruning mode,
+	// which do not use the global stats at all.
+	MergeGlobalStats bool
 
 	Indicators
 	GlobalTableID     int64
@@ -49,6 +164,21 @@ type StaticPartitionedTableAnalysisJob struct {
 
 	TableStatsVer int
 	Weight        float64
+	// EnqueuedAt is the time when the job is pushed into the queue.
+	// It is used to boost the weight of the job that has been waiting for a long time.
+	EnqueuedAt time.Time
+	// LastRunDuration is the wall-clock time spent on executing the analyze statements in the last run.
+	LastRunDuration time.Duration
+
+	// lastFailureReason is the reason why the job failed last time.
+	lastFailureReason string
+	// lastFailureTransient indicates whether the job failed with a transient error last time.
+	lastFailureTransient bool
+	// completed indicates whether the job has been analyzed successfully.
+	// Analyzing a completed job again only calls the success hook.
+	completed bool
+	// state is the state of the job in its lifecycle, see AnalysisJob.State.
+	state jobState
 }
 
 // NewStaticPartitionTableAnalysisJob creates a job for analyzing a static partitioned table.
@@ -58,6 +188,7 @@ func NewStaticPartitionTableAnalysisJob(
 	partitionName string,
 	partitionID int64,
 	indexes []string,
+	columns []string,
 	tableStatsVer int,
 	changePercentage float64,
 	tableSize float64,
@@ -70,6 +201,7 @@ func NewStaticPartitionTableAnalysisJob(
 		StaticPartitionID:   partitionID,
 		StaticPartitionName: partitionName,
 		Indexes:             indexes,
+		Columns:             columns,
 		TableStatsVer:       tableStatsVer,
 		Indicators: Indicators{
 			ChangePercentage:     changePercentage,
@@ -85,33 +217,221 @@ func (j *StaticPartitionedTableAnalysisJob) GetTableID() int64 {
 	return j.StaticPartitionID
 }
 
+// GetGlobalTableID implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetGlobalTableID() int64 {
+	return j.GlobalTableID
+}
+
+// GetSchemaName implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetSchemaName() string {
+	return j.TableSchema
+}
+
+// GetTableName implements AnalysisJob.
+// It returns the name of the global table rather than the static partition.
+func (j *StaticPartitionedTableAnalysisJob) GetTableName() string {
+	return j.GlobalTableName
+}
+
+// GetPartitionNames implements AnalysisJob.
+// It returns the name of the static partition.
+func (j *StaticPartitionedTableAnalysisJob) GetPartitionNames() []string {
+	return []string{j.StaticPartitionName}
+}
+
 // Analyze analyzes the specified static partition or indexes.
 func (j *StaticPartitionedTableAnalysisJob) Analyze(
+	ctx context.Context,
 	statsHandle statstypes.StatsHandle,
 	sysProcTracker sysproctrack.Tracker,
 ) error {
-	success := true
+	// The job has been analyzed successfully, e.g. the runner retries it because the success hook fails.
+	// Only the success hook is called again, so that the table is not analyzed twice.
+	if j.completed {
+		if j.successHook != nil {
+			j.successHook(j)
+		}
+		return nil
+	}
+
+	j.setState(JobStateRunning)
+	success, canceled := true, false
 	defer func() {
+		// The state is set before calling the hooks, so that the hooks see the outcome.
+		if canceled {
+			// The interrupted job is neither a success nor a failure, so it is not counted as either.
+			// The failure hook is still called to release the table, see JobStateCanceled.
+			j.setState(JobStateCanceled)
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+			return
+		}
+		observeAnalysisResult(j, success)
 		if success {
+			j.setState(JobStateSucceeded)
+			j.completed = true
 			if j.successHook != nil {
 				j.successHook(j)
 			}
 		} else {
+			j.setState(JobStateFailed)
 			if j.failureHook != nil {
 				j.failureHook(j)
 			}
 		}
 	}()
 
-	return statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
-		switch j.getAnalyzeType() {
-		case analyzeStaticPartition:
-			success = j.analyzeStaticPartition(sctx, statsHandle, sysProcTracker)
-		case analyzeStaticPartitionIndex:
-			success = j.analyzeStaticPartitionIndexes(sctx, statsHandle, sysProcTracker)
+	err := runAnalysis(ctx, j, j.progressHook, statsHandle, sysProcTracker, func(ctx context.Context, sysProcTracker sysproctrack.Tracker) error {
+		var sqls []analyzeSQL
+		var genErr error
+		if err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			sqls, genErr = j.genAnalyzeSQLs(sctx)
+			return nil
+		}); err != nil {
+			// Nothing is done without a session, so the job fails.
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return err
+		}
+		if genErr != nil {
+			success = false
+			j.lastFailureReason = genErr.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(genErr)
+			return genErr
+		}
+		start := DefaultClock.Now()
+		err := runAnalyzeSQLs(ctx, j, statsHandle, sysProcTracker, j.tracer, j.TableStatsVer, j.SessionVariables, sqls)
+		j.LastRunDuration = since(start)
+		if err != nil {
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return nil
+		}
+		if !j.MergeGlobalStats {
+			return nil
+		}
+		var mergeErr error
+		if err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			mergeErr = j.mergeGlobalStats(sctx, statsHandle)
+			return nil
+		}); err != nil {
+			// The global stats are not merged without a session, so the job fails.
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return err
+		}
+		if mergeErr != nil {
+			success = false
+			j.lastFailureReason = mergeErr.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(mergeErr)
 		}
 		return nil
 	})
+	if isAnalysisCanceled(err) || isAnalysisTimedOut(err) {
+		// The job is interrupted, so it is not finished.
+		// Unlike a cancellation, a timeout is a failure of the job, see AnalyzeTimeoutPerCostUnit.
+		canceled = !isAnalysisTimedOut(err)
+		success = false
+		j.lastFailureReason = err.Error()
+		j.lastFailureTransient = isTransientAnalyzeError(err)
+	}
+	return err
+}
+
+// globalStatsMergeOptions are the options to merge the global stats if they are not specified by AnalyzeOptions.
+// They are the same as the default options of the analyze statements of version 2.
+var globalStatsMergeOptions = map[ast.AnalyzeOptionType]uint64{
+	ast.AnalyzeOptNumBuckets: 256,
+	ast.AnalyzeOptNumTopN:    100,
+}
+
+// mergeGlobalStats merges the stats of all partitions into the global stats of the table.
+// It is a separate step after the analyze statements, and is only executed if MergeGlobalStats is set.
+// If some partitions have not been analyzed yet, e.g. the table has no global stats yet
+// and is still being analyzed partition by partition, the merge follows tidb_skip_missing_partition_stats:
+// either the missing partitions are skipped, or the merge is skipped without failing the job,
+// and the global stats are created once all partitions are analyzed.
+func (j *StaticPartitionedTableAnalysisJob) mergeGlobalStats(
+	sctx sessionctx.Context,
+	statsHandle statstypes.StatsHandle,
+) error {
+	is := sctx.GetDomainInfoSchema().(infoschema.InfoSchema)
+	tbl, ok := statsHandle.TableInfoByID(is, j.GlobalTableID)
+	if !ok {
+		return errors.Errorf("table %d not found when merging global stats", j.GlobalTableID)
+	}
+	tblInfo := tbl.Meta()
+
+	opts := maps.Clone(globalStatsMergeOptions)
+	if j.AnalyzeOptions.NumBuckets > 0 {
+		opts[ast.AnalyzeOptNumBuckets] = j.AnalyzeOptions.NumBuckets
+	}
+	if j.AnalyzeOptions.NumTopN > 0 {
+		opts[ast.AnalyzeOptNumTopN] = j.AnalyzeOptions.NumTopN
+	}
+
+	// Only merge the columns and indexes analyzed in the partition like the analyze statements in dynamic pruning mode,
+	// because some columns are never analyzed, e.g. the non-predicate columns.
+	partitionStats := statsHandle.GetPartitionStats(tblInfo, j.StaticPartitionID)
+	columnIDs := make([]int64, 0, partitionStats.ColNum())
+	partitionStats.ForEachColumnImmutable(func(id int64, col *statistics.Column) bool {
+		if col.IsAnalyzed() {
+			columnIDs = append(columnIDs, id)
+		}
+		return false
+	})
+	indexIDs := make([]int64, 0, partitionStats.IdxNum())
+	partitionStats.ForEachIndexImmutable(func(id int64, idx *statistics.Index) bool {
+		if idx.IsAnalyzed() {
+			indexIDs = append(indexIDs, id)
+		}
+		return false
+	})
+	slices.Sort(columnIDs)
+	slices.Sort(indexIDs)
+	infos := make([]statstypes.GlobalStatsInfo, 0, len(indexIDs)+1)
+	if len(columnIDs) > 0 {
+		infos = append(infos, statstypes.GlobalStatsInfo{HistIDs: columnIDs, StatsVersion: j.TableStatsVer})
+	}
+	for _, id := range indexIDs {
+		infos = append(infos, statstypes.GlobalStatsInfo{HistIDs: []int64{id}, IsIndex: 1, StatsVersion: j.TableStatsVer})
+	}
+
+	for i := range infos {
+		err := statsHandle.MergePartitionStats2GlobalStatsByTableID(sctx, opts, is, &infos[i], j.GlobalTableID)
+		if types.ErrPartitionStatsMissing.Equal(err) || types.ErrPartitionColumnStatsMissing.Equal(err) {
+			jobLogger(j).Info("Skip merging global stats because some partitions have not been analyzed yet",
+				zap.Error(err),
+			)
+			return nil
+		}
+		if err != nil {
+			return errors.Annotate(err, "failed to merge global stats")
+		}
+	}
+	return nil
+}
+
+// DryRun implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	sqls, err := j.genAnalyzeSQLs(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return escapeAnalyzeSQLs(sqls)
+}
+
+// GenAnalyzeSQLParams implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error) {
+	sqls, err := j.genAnalyzeSQLs(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return collectAnalyzeSQLParams(sqls), nil
 }
 
 // RegisterSuccessHook registers a successHook function that will be called after the job can be marked as successful.
@@ -124,6 +444,21 @@ func (j *StaticPartitionedTableAnalysisJob) RegisterFailureHook(hook JobHook) {
 	j.failureHook = hook
 }
 
+// RegisterProgressHook registers a progressHook function that will be called periodically while the job is running.
+func (j *StaticPartitionedTableAnalysisJob) RegisterProgressHook(hook ProgressHook) {
+	j.progressHook = hook
+}
+
+// RegisterValidityHook registers a validityHook function that is consulted by IsValidToAnalyze after its built-in checks pass.
+func (j *StaticPartitionedTableAnalysisJob) RegisterValidityHook(hook ValidityHook) {
+	j.validityHook = hook
+}
+
+// SetTracer sets the Tracer that traces the execution of the analyze statements of the job.
+func (j *StaticPartitionedTableAnalysisJob) SetTracer(tracer Tracer) {
+	j.tracer = tracer
+}
+
 // GetIndicators implements AnalysisJob.
 func (j *StaticPartitionedTableAnalysisJob) GetIndicators() Indicators {
 	return j.Indicators
@@ -134,16 +469,133 @@ func (j *StaticPartitionedTableAnalysisJob) SetIndicators(indicators Indicators)
 	j.Indicators = indicators
 }
 
+// GetIndexes gets the newly added indexes of the job.
+func (j *StaticPartitionedTableAnalysisJob) GetIndexes() []string {
+	return j.Indexes
+}
+
+// AddIndex adds a newly added index to the job, so that the index is analyzed together with the pending job
+// instead of creating another job for the same partition. It is a no-op if the index is already in the job.
+// Once an index is added, the job only analyzes the indexes.
+func (j *StaticPartitionedTableAnalysisJob) AddIndex(name string) {
+	if slices.Contains(j.Indexes, name) {
+		return
+	}
+	j.Indexes = append(j.Indexes, name)
+}
+
+// analyzedIndexes returns the newly added indexes to analyze, i.e. Indexes without ExcludedIndexes.
+func (j *StaticPartitionedTableAnalysisJob) analyzedIndexes() []string {
+	if len(j.ExcludedIndexes) == 0 {
+		return j.Indexes
+	}
+	indexes := make([]string, 0, len(j.Indexes))
+	for _, index := range j.Indexes {
+		if !slices.ContainsFunc(j.ExcludedIndexes, func(excluded string) bool {
+			return strings.EqualFold(excluded, index)
+		}) {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// staleIndexes filters out the indexes analyzed within IndexStalenessThreshold.
+func (j *StaticPartitionedTableAnalysisJob) staleIndexes(indexes []string) []string {
+	if IndexStalenessThreshold <= 0 || len(j.IndexLastAnalyzedAt) == 0 {
+		return indexes
+	}
+	now := DefaultClock.Now()
+	stale := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		lastAnalyzedAt, ok := j.IndexLastAnalyzedAt[index]
+		if ok && now.Sub(lastAnalyzedAt) < IndexStalenessThreshold {
+			jobLogger(j).Info("Skip analyzing the index because its stats are still fresh",
+				zap.String("partition", j.StaticPartitionName),
+				zap.String("index", index),
+				zap.Time("lastAnalyzedAt", lastAnalyzedAt),
+				zap.Duration("stalenessThreshold", IndexStalenessThreshold),
+			)
+			continue
+		}
+		stale = append(stale, index)
+	}
+	return stale
+}
+
 // HasNewlyAddedIndex implements AnalysisJob.
 func (j *StaticPartitionedTableAnalysisJob) HasNewlyAddedIndex() bool {
 	return len(j.Indexes) > 0
 }
 
+// isQuickAnalysisJob checks whether the job is a quick analysis job, see StaticPartitionedTableAnalysisJob.Quick.
+func isQuickAnalysisJob(job AnalysisJob) bool {
+	j, ok := job.(*StaticPartitionedTableAnalysisJob)
+	return ok && j.Quick
+}
+
+// Validate implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) Validate() error {
+	switch {
+	case j.TableSchema == "":
+		return errors.New("invalid analysis job: table schema is empty")
+	case j.GlobalTableName == "":
+		return errors.New("invalid analysis job: global table name is empty")
+	case j.StaticPartitionName == "":
+		return errors.New("invalid analysis job: static partition name is empty")
+	case j.StaticPartitionID <= 0:
+		return errors.Errorf("invalid analysis job: static partition ID %d is not positive", j.StaticPartitionID)
+	}
+	return j.AnalyzeOptions.Validate()
+}
+
 // IsValidToAnalyze checks whether the partition is valid to analyze.
 // Only the specified static partition is checked.
 func (j *StaticPartitionedTableAnalysisJob) IsValidToAnalyze(
 	sctx sessionctx.Context,
 ) (bool, string) {
+	return j.isValidToAnalyzeWithInfoSchema(sctx, sctx.GetDomainInfoSchema().(infoschema.InfoSchema))
+}
+
+func (j *StaticPartitionedTableAnalysisJob) isValidToAnalyzeWithInfoSchema(
+	sctx sessionctx.Context,
+	is infoschema.InfoSchema,
+) (bool, string) {
+	// The partition may be dropped after the job is created.
+	// Check it with the latest info schema to avoid analyzing a non-existent partition.
+	if j.StaticPartitionID != 0 {
+		if tblInfo, _, _ := is.FindTableInfoByPartitionID(j.StaticPartitionID); tblInfo == nil {
+			logutil.SingletonStatsSamplerLogger().Info(
+				"Skip analysis because the partition no longer exists",
+				zap.String("schema", j.TableSchema),
+				zap.String("table", j.GlobalTableName),
+				zap.String("partition", j.StaticPartitionName),
+				zap.Int64("partitionID", j.StaticPartitionID),
+				zap.String("correlationID", j.GetCorrelationID()),
+			)
+			j.setState(JobStateSkipped)
+			j.lastFailureReason = "partition no longer exists"
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+			return false, "partition no longer exists"
+		}
+	}
+
+	// Analyzing an empty partition is pure overhead, e.g. for the newly created partitions.
+	// It is not a failure, so the failure hook is not called.
+	if j.isEmptyPartition(sctx) {
+		logutil.SingletonStatsSamplerLogger().Info(
+			"Skip analysis because the partition is empty",
+			zap.String("schema", j.TableSchema),
+			zap.String("table", j.GlobalTableName),
+			zap.String("partition", j.StaticPartitionName),
+			zap.String("correlationID", j.GetCorrelationID()),
+		)
+		j.setState(JobStateSkipped)
+		return false, "empty partition"
+	}
+
 	// Check whether the partition is valid to analyze.
 	// For static partition table we only need to check the specified static partition.
 	if j.StaticPartitionName != "" {
@@ -154,6 +606,8 @@ func (j *StaticPartitionedTableAnalysisJob) IsValidToAnalyze(
 			j.GlobalTableName,
 			partitionNames...,
 		); !valid {
+			j.setState(JobStateSkipped)
+			j.lastFailureReason = failReason
 			if j.failureHook != nil {
 				j.failureHook(j)
 			}
@@ -161,25 +615,165 @@ func (j *StaticPartitionedTableAnalysisJob) IsValidToAnalyze(
 		}
 	}
 
+	if valid, failReason := checkValidityHook(j, j.validityHook); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
+		return false, failReason
+	}
 	return true, ""
 }
 
+// isEmptyPartition checks whether the partition has no rows.
+// A partition with a positive table size is known to have rows when the job is created, so only
+// the partitions without a known size are checked by reading at most one row of the partition.
+func (j *StaticPartitionedTableAnalysisJob) isEmptyPartition(sctx sessionctx.Context) bool {
+	if j.TableSize > 0 || j.StaticPartitionName == "" {
+		return false
+	}
+	rows, _, err := statsutil.ExecRows(
+		sctx,
+		"select 1 from %n.%n partition(%n) limit 1",
+		j.TableSchema, j.GlobalTableName, j.StaticPartitionName,
+	)
+	if err != nil {
+		// Let the analysis report the error if the partition cannot be read.
+		logutil.SingletonStatsSamplerLogger().Warn(
+			"Fail to check whether the partition is empty",
+			zap.String("schema", j.TableSchema),
+			zap.String("table", j.GlobalTableName),
+			zap.String("partition", j.StaticPartitionName),
+			zap.Error(err),
+		)
+		return false
+	}
+	return len(rows) == 0
+}
+
+// Clone implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) Clone() AnalysisJob {
+	cloned := *j
+	cloned.Indexes = slices.Clone(j.Indexes)
+	cloned.ExcludedIndexes = slices.Clone(j.ExcludedIndexes)
+	cloned.IndexLastAnalyzedAt = maps.Clone(j.IndexLastAnalyzedAt)
+	cloned.GlobalIndexes = slices.Clone(j.GlobalIndexes)
+	cloned.Columns = slices.Clone(j.Columns)
+	cloned.SessionVariables = maps.Clone(j.SessionVariables)
+	return &cloned
+}
+
+// Equal implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) Equal(other AnalysisJob) bool {
+	o, ok := other.(*StaticPartitionedTableAnalysisJob)
+	if !ok || o == nil {
+		return false
+	}
+	return j.GlobalTableID == o.GlobalTableID &&
+		j.StaticPartitionID == o.StaticPartitionID &&
+		j.TableSchema == o.TableSchema &&
+		j.GlobalTableName == o.GlobalTableName &&
+		j.StaticPartitionName == o.StaticPartitionName &&
+		slices.Equal(j.Indexes, o.Indexes) &&
+		slices.Equal(j.ExcludedIndexes, o.ExcludedIndexes) &&
+		maps.EqualFunc(j.IndexLastAnalyzedAt, o.IndexLastAnalyzedAt, time.Time.Equal) &&
+		slices.Equal(j.GlobalIndexes, o.GlobalIndexes) &&
+		slices.Equal(j.Columns, o.Columns) &&
+		j.PredicateColumns == o.PredicateColumns &&
+		j.AnalyzeOptions == o.AnalyzeOptions &&
+		j.AnalyzeEachIndex == o.AnalyzeEachIndex &&
+		j.Quick == o.Quick &&
+		j.MergeGlobalStats == o.MergeGlobalStats &&
+		maps.Equal(j.SessionVariables, o.SessionVariables)
+}
+
 // SetWeight implements AnalysisJob.
 func (j *StaticPartitionedTableAnalysisJob) SetWeight(weight float64) {
-	j.Weight = weight
+	j.Weight = clampWeight(weight)
 }
 
 // GetWeight implements AnalysisJob.
 func (j *StaticPartitionedTableAnalysisJob) GetWeight() float64 {
+	return clampWeight(j.Weight + calculateAgingWeight(j.EnqueuedAt))
+}
+
+// GetBaseWeight gets the weight set by SetWeight, without the aging boost.
+func (j *StaticPartitionedTableAnalysisJob) GetBaseWeight() float64 {
 	return j.Weight
 }
 
+// SetEnqueuedAt implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	j.EnqueuedAt = enqueuedAt
+}
+
+// GetEnqueuedAt implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetEnqueuedAt() time.Time {
+	return j.EnqueuedAt
+}
+
+// GetLastRunDuration implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetLastRunDuration() time.Duration {
+	return j.LastRunDuration
+}
+
+// GetLastFailureReason implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetLastFailureReason() string {
+	return j.lastFailureReason
+}
+
+// State implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) State() JobState {
+	return j.state.load()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) setState(state JobState) {
+	j.state.store(state)
+}
+
+// IsLastFailureTransient implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) IsLastFailureTransient() bool {
+	return j.lastFailureTransient
+}
+
+// GetCorrelationID implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetCorrelationID() string {
+	return genCorrelationID(j.GlobalTableID, j.StaticPartitionID, j.EnqueuedAt)
+}
+
+// GetWeightBreakdown implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetWeightBreakdown() map[string]float64 {
+	return NewPriorityCalculator().CalculateWeightBreakdown(j)
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The analyze type is included so that the job can be decoded by UnmarshalAnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) MarshalJSON() ([]byte, error) {
+	type alias StaticPartitionedTableAnalysisJob
+	return json.Marshal(struct {
+		AnalyzeType analyzeType
+		*alias
+	}{
+		AnalyzeType: j.getAnalyzeType(),
+		alias:       (*alias)(j),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (j *StaticPartitionedTableAnalysisJob) UnmarshalJSON(data []byte) error {
+	if err := checkAnalyzeType(data, j); err != nil {
+		return err
+	}
+	type alias StaticPartitionedTableAnalysisJob
+	return json.Unmarshal(data, (*alias)(j))
+}
+
 // String implements fmt.Stringer interface.
 func (j *StaticPartitionedTableAnalysisJob) String() string {
 	return fmt.Sprintf(
 		"StaticPartitionedTableAnalysisJob:\n"+
 			"\tAnalyzeType: %s\n"+
 			"\tIndexes: %s\n"+
+			"\tGlobalIndexes: %s\n"+
+			"\tColumns: %s\n"+
 			"\tSchema: %s\n"+
 			"\tGlobalTable: %s\n"+
 			"\tGlobalTableID: %d\n"+
@@ -189,74 +783,301 @@ func (j *StaticPartitionedTableAnalysisJob) String() string {
 			"\tChangePercentage: %.6f\n"+
 			"\tTableSize: %.2f\n"+
 			"\tLastAnalysisDuration: %s\n"+
-			"\tWeight: %.6f\n",
+			"\tWeight: %.6f\n"+
+			"\tWeightBreakdown: %s\n"+
+			"\tCorrelationID: %s\n",
 		j.getAnalyzeType(),
 		strings.Join(j.Indexes, ", "),
+		strings.Join(j.GlobalIndexes, ", "),
+		strings.Join(j.Columns, ", "),
 		j.TableSchema, j.GlobalTableName, j.GlobalTableID,
 		j.StaticPartitionName, j.StaticPartitionID,
 		j.TableStatsVer, j.ChangePercentage, j.TableSize,
 		j.LastAnalysisDuration, j.Weight,
+		formatWeightBreakdown(j.GetWeightBreakdown()),
+		j.GetCorrelationID(),
 	)
 }
 
+// EstimatedCost implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) EstimatedCost() float64 {
+	return estimateCost(j.Indicators, len(j.Indexes)+len(j.GlobalIndexes), len(j.Columns))
+}
+
+// EstimatedMemoryBytes implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) EstimatedMemoryBytes() int64 {
+	options := QuickAnalyzeOptions
+	if !j.Quick {
+		options = j.AnalyzeOptions.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer)
+	}
+	return estimateMemoryBytes(j.Indicators, options, len(j.Indexes)+len(j.GlobalIndexes), len(j.Columns))
+}
+
+// GetAnalyzeType implements AnalysisJob.
+func (j *StaticPartitionedTableAnalysisJob) GetAnalyzeType() string {
+	return j.getAnalyzeType().label()
+}
+
 func (j *StaticPartitionedTableAnalysisJob) getAnalyzeType() analyzeType {
 	switch {
-	case j.HasNewlyAddedIndex():
+	case j.Quick:
+		return analyzeStaticPartitionQuick
+	case len(j.analyzedIndexes()) > 0:
 		return analyzeStaticPartitionIndex
+	case len(j.Columns) > 0:
+		return analyzeStaticPartitionColumns
+	case j.PredicateColumns:
+		return analyzeStaticPartitionPredicateColumns
 	default:
 		return analyzeStaticPartition
 	}
 }
 
-func (j *StaticPartitionedTableAnalysisJob) analyzeStaticPartition(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) bool {
-	sql, params := j.GenSQLForAnalyzeStaticPartition()
-	return exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
+// genAnalyzeSQLs generates the analyze statements that need to be executed for the job.
+// The statements of the global indexes follow the statements of the partition.
+// It returns an error if the analyze options are invalid.
+func (j *StaticPartitionedTableAnalysisJob) genAnalyzeSQLs(sctx sessionctx.Context) ([]analyzeSQL, error) {
+	if err := j.AnalyzeOptions.Validate(); err != nil {
+		return nil, err
+	}
+	sqls := j.genPartitionAnalyzeSQLs(sctx)
+	for _, index := range j.GlobalIndexes {
+		sql, params := j.genSQLForAnalyzeGlobalIndex(index)
+		sqls = append(sqls, analyzeSQL{sql: sql, params: params})
+	}
+	return sqls, nil
 }
 
-func (j *StaticPartitionedTableAnalysisJob) analyzeStaticPartitionIndexes(
-	sctx sessionctx.Context,
-	statsHandle statstypes.StatsHandle,
-	sysProcTracker sysproctrack.Tracker,
-) bool {
-	if len(j.Indexes) == 0 {
-		return true
+// genPartitionAnalyzeSQLs generates the analyze statements of the partition itself.
+func (j *StaticPartitionedTableAnalysisJob) genPartitionAnalyzeSQLs(sctx sessionctx.Context) []analyzeSQL {
+	switch j.getAnalyzeType() {
+	case analyzeStaticPartition:
+		return j.genSQLsForAnalyzeWholeStaticPartition(sctx)
+	case analyzeStaticPartitionIndex:
+		return j.genSQLsForAnalyzeStaticPartitionIndexes()
+	case analyzeStaticPartitionColumns:
+		sql, params := j.genSQLForAnalyzeStaticPartitionColumns(j.Columns)
+		return []analyzeSQL{{sql: sql, params: params}}
+	case analyzeStaticPartitionPredicateColumns:
+		// Without any predicate column, TiDB only analyzes the columns needed by the indexes,
+		// so we fall back to analyzing all columns instead.
+		if !hasPredicateColumns(sctx, j.GlobalTableID) {
+			return j.genSQLsForAnalyzeWholeStaticPartition(sctx)
+		}
+		sql, params := j.genSQLForAnalyzeStaticPartitionPredicateColumns()
+		return []analyzeSQL{{sql: sql, params: params}}
+	case analyzeStaticPartitionQuick:
+		sql, params := j.genSQLForQuickAnalyzeStaticPartition()
+		return []analyzeSQL{{sql: sql, params: params}}
+	}
+	return nil
+}
+
+// genSQLsForAnalyzeWholeStaticPartition generates the statement to analyze all columns and indexes of the partition.
+// The generated columns that are not indexed can be excluded, see AnalyzeNonIndexedGeneratedColumns.
+func (j *StaticPartitionedTableAnalysisJob) genSQLsForAnalyzeWholeStaticPartition(sctx sessionctx.Context) []analyzeSQL {
+	if columns := columnsToAnalyze(sctx, j.GlobalTableID, j.StaticPartitionID, j.TableStatsVer); len(columns) > 0 {
+		sql, params := j.genSQLForAnalyzeStaticPartitionColumns(columns)
+		return []analyzeSQL{{sql: sql, params: params}}
+	}
+	sql, params := j.genSQLForAnalyzeStaticPartition()
+	return []analyzeSQL{{sql: sql, params: params}}
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLsForAnalyzeStaticPartitionIndexes() []analyzeSQL {
+	indexes := j.staleIndexes(j.analyzedIndexes())
+	if len(indexes) == 0 {
+		return nil
 	}
 	// For version 2, analyze one index will analyze all other indexes and columns.
 	// For version 1, analyze one index will only analyze the specified index.
-	analyzeVersion := sctx.GetSessionVars().AnalyzeVersion
-	if analyzeVersion == 1 {
-		for _, index := range j.Indexes {
-			sql, params := j.GenSQLForAnalyzeStaticPartitionIndex(index)
-			if !exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...) {
-				return false
-			}
+	// AnalyzeEachIndex makes version 2 behave like version 1.
+	// The statements are executed with the stats version of the job, see exec.RunAutoAnalyze.
+	analyzeVersion := j.TableStatsVer
+	if analyzeVersion == 1 || j.AnalyzeEachIndex {
+		sqls := make([]analyzeSQL, 0, len(indexes))
+		for _, index := range indexes {
+			sql, params := j.genSQLForAnalyzeStaticPartitionIndex(index)
+			sqls = append(sqls, analyzeSQL{sql: sql, params: params})
 		}
-		return true
+		return sqls
 	}
 	// Only analyze the first index.
 	// This is because analyzing a single index also analyzes all other indexes and columns.
 	// Therefore, to avoid redundancy, we prevent multiple analyses of the same partition.
-	firstIndex := j.Indexes[0]
-	sql, params := j.GenSQLForAnalyzeStaticPartitionIndex(firstIndex)
-	return exec.AutoAnalyze(sctx, statsHandle, sysProcTracker, j.TableStatsVer, sql, params...)
+	firstIndex := indexes[0]
+	sql, params := j.genSQLForAnalyzeStaticPartitionIndex(firstIndex)
+	return []analyzeSQL{{sql: sql, params: params}}
+}
+
+// genClause generates the WITH clause of the analyze statements from the analyze options.
+// The sample rate is chosen by the change percentage if it is not set explicitly.
+func (j *StaticPartitionedTableAnalysisJob) genClause() string {
+	return j.AnalyzeOptions.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer).genClause()
 }
 
 // GenSQLForAnalyzeStaticPartition generates the SQL for analyzing the specified static partition.
+// The analyze options are appended as a WITH clause if they are set.
 func (j *StaticPartitionedTableAnalysisJob) GenSQLForAnalyzeStaticPartition() (string, []any) {
-	sql := "analyze table %n.%n partition %n"
-	params := []any{j.TableSchema, j.GlobalTableName, j.StaticPartitionName}
+	sql, params := j.genSQLForAnalyzeStaticPartition()
+	return sql, params.Args()
+}
 
-	return sql, params
+func (j *StaticPartitionedTableAnalysisJob) genSQLForAnalyzeStaticPartition() (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n partition %n" + j.genClause()
+	return sql, j.genAnalyzeSQLParams()
+}
+
+// GenSQLForQuickAnalyzeStaticPartition generates the SQL for analyzing the specified static partition with QuickAnalyzeOptions.
+func (j *StaticPartitionedTableAnalysisJob) GenSQLForQuickAnalyzeStaticPartition() (string, []any) {
+	sql, params := j.genSQLForQuickAnalyzeStaticPartition()
+	return sql, params.Args()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLForQuickAnalyzeStaticPartition() (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n partition %n" + QuickAnalyzeOptions.genClause()
+	return sql, j.genAnalyzeSQLParams()
+}
+
+// genAnalyzeSQLParams returns the parameters of the analyze statements of the static partition.
+func (j *StaticPartitionedTableAnalysisJob) genAnalyzeSQLParams() AnalyzeSQLParams {
+	return AnalyzeSQLParams{
+		TableSchema: j.TableSchema,
+		TableName:   j.GlobalTableName,
+		Partitions:  []string{j.StaticPartitionName},
+	}
 }
 
 // GenSQLForAnalyzeStaticPartitionIndex generates the SQL for analyzing the specified static partition index.
 func (j *StaticPartitionedTableAnalysisJob) GenSQLForAnalyzeStaticPartitionIndex(index string) (string, []any) {
-	sql := "analyze table %n.%n partition %n index %n"
-	params := []any{j.TableSchema, j.GlobalTableName, j.StaticPartitionName, index}
+	sql, params := j.genSQLForAnalyzeStaticPartitionIndex(index)
+	return sql, params.Args()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLForAnalyzeStaticPartitionIndex(index string) (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n partition %n index %n" + j.genClause()
+	params := j.genAnalyzeSQLParams()
+	params.Index = index
+
+	return sql, params
+}
+
+// GenSQLForAnalyzeGlobalIndex generates the SQL for analyzing the specified global index of the table.
+// The whole table is analyzed instead of the partition, because the global index does not belong to any partition.
+func (j *StaticPartitionedTableAnalysisJob) GenSQLForAnalyzeGlobalIndex(index string) (string, []any) {
+	sql, params := j.genSQLForAnalyzeGlobalIndex(index)
+	return sql, params.Args()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLForAnalyzeGlobalIndex(index string) (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n index %n" + j.genClause()
+	params := AnalyzeSQLParams{
+		TableSchema: j.TableSchema,
+		TableName:   j.GlobalTableName,
+		Index:       index,
+	}
 
 	return sql, params
 }
+
+// GenSQLForAnalyzeStaticPartitionColumns generates the SQL for analyzing the specified columns of the static partition.
+func (j *StaticPartitionedTableAnalysisJob) GenSQLForAnalyzeStaticPartitionColumns() (string, []any) {
+	sql, params := j.genSQLForAnalyzeStaticPartitionColumns(j.Columns)
+	return sql, params.Args()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLForAnalyzeStaticPartitionColumns(columns []string) (string, AnalyzeSQLParams) {
+	sql := getPartitionSQL("analyze table %n.%n partition %n columns", j.genClause(), len(columns))
+	params := j.genAnalyzeSQLParams()
+	params.Columns = columns
+
+	return sql, params
+}
+
+// GenSQLForAnalyzeStaticPartitionPredicateColumns generates the SQL for analyzing the predicate columns of the static partition.
+func (j *StaticPartitionedTableAnalysisJob) GenSQLForAnalyzeStaticPartitionPredicateColumns() (string, []any) {
+	sql, params := j.genSQLForAnalyzeStaticPartitionPredicateColumns()
+	return sql, params.Args()
+}
+
+func (j *StaticPartitionedTableAnalysisJob) genSQLForAnalyzeStaticPartitionPredicateColumns() (string, AnalyzeSQLParams) {
+	sql := "analyze table %n.%n partition %n predicate columns" + j.genClause()
+	return sql, j.genAnalyzeSQLParams()
+}
+
+// GenSQLsForAnalyzeStaticPartitions generates the SQLs for analyzing the static partitions of the jobs in batches,
+// e.g. `analyze table %n.%n partition %n, %n, %n`. It reduces the number of statements when many partitions
+// of the same table need to be analyzed at once.
+// Each statement covers at most maxPartitionsPerSQL partitions. If maxPartitionsPerSQL is not positive,
+// tidb_auto_analyze_partition_batch_size is used.
+// All jobs must belong to the same table and have the same analyze options. The whole partitions are analyzed,
+// so the indexes and columns of the jobs are covered as well.
+func GenSQLsForAnalyzeStaticPartitions(
+	jobs []*StaticPartitionedTableAnalysisJob,
+	maxPartitionsPerSQL int,
+) ([]string, [][]any, error) {
+	sqls, err := genSQLsForAnalyzeStaticPartitions(jobs, maxPartitionsPerSQL)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlStrs := make([]string, 0, len(sqls))
+	params := make([][]any, 0, len(sqls))
+	for _, sql := range sqls {
+		sqlStrs = append(sqlStrs, sql.sql)
+		params = append(params, sql.params.Args())
+	}
+	return sqlStrs, params, nil
+}
+
+func genSQLsForAnalyzeStaticPartitions(
+	jobs []*StaticPartitionedTableAnalysisJob,
+	maxPartitionsPerSQL int,
+) ([]analyzeSQL, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	if maxPartitionsPerSQL <= 0 {
+		maxPartitionsPerSQL = int(variable.AutoAnalyzePartitionBatchSize.Load())
+	}
+	first := jobs[0]
+	if err := first.AnalyzeOptions.Validate(); err != nil {
+		return nil, err
+	}
+	partitionNames := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		if job.GlobalTableID != first.GlobalTableID {
+			return nil, errors.Errorf(
+				"cannot batch partitions of different tables: %d and %d",
+				first.GlobalTableID, job.GlobalTableID,
+			)
+		}
+		if job.AnalyzeOptions != first.AnalyzeOptions {
+			return nil, errors.Errorf(
+				"cannot batch partitions %s and %s with different analyze options",
+				first.StaticPartitionName, job.StaticPartitionName,
+			)
+		}
+		partitionNames = append(partitionNames, job.StaticPartitionName)
+	}
+
+	// The partitions are analyzed together, so the sample rate is chosen by the most changed one
+	// or by the biggest one, which is the most expensive to analyze.
+	changePercentage, tableSize := 0.0, 0.0
+	for _, job := range jobs {
+		changePercentage = max(changePercentage, job.ChangePercentage)
+		tableSize = max(tableSize, job.TableSize)
+	}
+	clause := first.AnalyzeOptions.adaptToIndicators(changePercentage, tableSize, first.TableStatsVer).genClause()
+	sqls := make([]analyzeSQL, 0, (len(partitionNames)+maxPartitionsPerSQL-1)/maxPartitionsPerSQL)
+	for start := 0; start < len(partitionNames); start += maxPartitionsPerSQL {
+		end := min(start+maxPartitionsPerSQL, len(partitionNames))
+		sql := getPartitionSQL("analyze table %n.%n partition", clause, end-start)
+		params := AnalyzeSQLParams{
+			TableSchema: first.TableSchema,
+			TableName:   first.GlobalTableName,
+			Partitions:  partitionNames[start:end],
+		}
+		sqls = append(sqls, analyzeSQL{sql: sql, params: params})
+	}
+	return sqls, nil
+}
@@ -16,13 +16,20 @@ package priorityqueue_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/session"
 	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
+	"github.com/pingcap/tidb/pkg/sessionctx/variable"
+	"github.com/pingcap/tidb/pkg/statistics"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
 	"github.com/pingcap/tidb/pkg/testkit"
+	"github.com/pingcap/tidb/pkg/util/sqlescape"
 	"github.com/stretchr/testify/require"
 )
 
@@ -60,6 +67,272 @@ func TestGenSQLForAnalyzeStaticPartitionedTableIndex(t *testing.T) {
 	require.Equal(t, expectedParams, params)
 }
 
+func TestGenSQLForAnalyzeStaticPartitionedTableColumns(t *testing.T) {
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test_schema",
+		GlobalTableName:     "test_table",
+		StaticPartitionName: "p0",
+		Columns:             []string{"a", "b`c"},
+	}
+
+	expectedSQL := "analyze table %n.%n partition %n columns %n, %n"
+	expectedParams := []any{"test_schema", "test_table", "p0", "a", "b`c"}
+
+	sql, params := job.GenSQLForAnalyzeStaticPartitionColumns()
+
+	require.Equal(t, expectedSQL, sql)
+	require.Equal(t, expectedParams, params)
+
+	// Column names should be escaped as identifiers.
+	escaped, err := sqlescape.EscapeSQL(sql, params...)
+	require.NoError(t, err)
+	require.Equal(t, "analyze table `test_schema`.`test_table` partition `p0` columns `a`, `b``c`", escaped)
+	require.Contains(t, job.String(), "AnalyzeType: analyzeStaticPartitionColumns")
+
+	// Newly added indexes take precedence over the column subset.
+	job.Indexes = []string{"idx"}
+	require.Contains(t, job.String(), "AnalyzeType: analyzeStaticPartitionIndex")
+}
+
+func TestAnalyzeStaticPartitionedTablePredicateColumns(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, c int) partition by range (a) (partition p0 values less than (10), partition p1 values less than (20))")
+	tk.MustExec("insert into t values (1, 1, 1), (2, 2, 2), (11, 11, 11)")
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       tbl.Meta().ID,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   tbl.Meta().GetPartitionInfo().Definitions[0].ID,
+		PredicateColumns:    true,
+		TableStatsVer:       2,
+	}
+	require.Equal(t, "static_partition_predicate_columns", job.GetAnalyzeType())
+	sql, params := job.GenSQLForAnalyzeStaticPartitionPredicateColumns()
+	require.Equal(t, "analyze table %n.%n partition %n predicate columns", sql)
+	require.Equal(t, []any{"test", "t", "p0"}, params)
+
+	// Fall back to analyzing all columns if no predicate column has been collected.
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0`"}, sqls)
+
+	tk.MustQuery("select * from t where b > 1").Sort().Check(testkit.Rows("11 11 11", "2 2 2"))
+	require.NoError(t, dom.StatsHandle().DumpColStatsUsageToKV())
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` predicate columns"}, sqls)
+
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) {
+		require.FailNow(t, "unexpected failure", j.GetLastFailureReason())
+	})
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+	tk.MustQuery("select job_info from mysql.analyze_jobs where partition_name = 'p0' order by id desc limit 1").Check(
+		testkit.Rows("auto analyze table column b with 256 buckets, 100 topn, 1 samplerate"),
+	)
+
+	// The column subset and the newly added indexes take precedence over the predicate columns.
+	job.Columns = []string{"c"}
+	require.Equal(t, "static_partition_columns", job.GetAnalyzeType())
+	job.Indexes = []string{"idx"}
+	require.Equal(t, "static_partition_index", job.GetAnalyzeType())
+}
+
+func TestStaticPartitionedTableAddIndex(t *testing.T) {
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test_schema",
+		GlobalTableName:     "test_table",
+		StaticPartitionName: "p0",
+		Columns:             []string{"a"},
+	}
+	require.Empty(t, job.GetIndexes())
+	require.Equal(t, "static_partition_columns", job.GetAnalyzeType())
+
+	job.AddIndex("idx")
+	job.AddIndex("idx")
+	require.Equal(t, []string{"idx"}, job.GetIndexes())
+	require.Equal(t, "static_partition_index", job.GetAnalyzeType())
+}
+
+func TestGenSQLForAnalyzeStaticPartitionedTableWithOptions(t *testing.T) {
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test_schema",
+		GlobalTableName:     "test_table",
+		StaticPartitionName: "p0",
+		AnalyzeOptions: priorityqueue.AnalyzeOptions{
+			SampleRate: 0.5,
+			NumBuckets: 256,
+			NumTopN:    100,
+		},
+	}
+
+	sql, params := job.GenSQLForAnalyzeStaticPartition()
+	require.Equal(t, "analyze table %n.%n partition %n with 256 buckets, 100 topn, 0.5 samplerate", sql)
+	require.Equal(t, []any{"test_schema", "test_table", "p0"}, params)
+
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{SampleRate: 0.01}
+	sql, _ = job.GenSQLForAnalyzeStaticPartitionIndex("idx")
+	require.Equal(t, "analyze table %n.%n partition %n index %n with 0.01 samplerate", sql)
+
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{NumBuckets: 64}
+	job.Columns = []string{"a", "b"}
+	sql, _ = job.GenSQLForAnalyzeStaticPartitionColumns()
+	require.Equal(t, "analyze table %n.%n partition %n columns %n, %n with 64 buckets", sql)
+
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{NumTopN: 10, NumSamples: 5000}
+	sql, _ = job.GenSQLForAnalyzeStaticPartition()
+	require.Equal(t, "analyze table %n.%n partition %n with 10 topn, 5000 samples", sql)
+}
+
+func TestGenSQLForAnalyzeStaticPartitionedTableWithAdaptiveSampleRate(t *testing.T) {
+	defer func(cutoff float64) {
+		priorityqueue.FullAnalyzeChangePercentageCutoff = cutoff
+	}(priorityqueue.FullAnalyzeChangePercentageCutoff)
+	priorityqueue.FullAnalyzeChangePercentageCutoff = 0.8
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test_schema",
+		GlobalTableName:     "test_table",
+		StaticPartitionName: "p0",
+		AnalyzeOptions:      priorityqueue.AnalyzeOptions{NumBuckets: 64},
+		Indicators: priorityqueue.Indicators{
+			ChangePercentage: 0.9,
+		},
+	}
+	sql, _ := job.GenSQLForAnalyzeStaticPartition()
+	require.Equal(t, "analyze table %n.%n partition %n with 64 buckets, 1 samplerate", sql)
+
+	// The explicit options take precedence.
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{NumSamples: 100}
+	sql, _ = job.GenSQLForAnalyzeStaticPartition()
+	require.Equal(t, "analyze table %n.%n partition %n with 100 samples", sql)
+
+	// The version 1 statistics do not support the sample rate.
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{}
+	job.TableStatsVer = 1
+	sql, _ = job.GenSQLForAnalyzeStaticPartition()
+	require.Equal(t, "analyze table %n.%n partition %n", sql)
+}
+
+func TestGenSQLsForAnalyzeStaticPartitions(t *testing.T) {
+	newJob := func(partitionName string) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		return &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test_schema",
+			GlobalTableName:     "test_table",
+			GlobalTableID:       1,
+			StaticPartitionName: partitionName,
+		}
+	}
+	jobs := []*priorityqueue.StaticPartitionedTableAnalysisJob{
+		newJob("p0"), newJob("p1"), newJob("p2"), newJob("p`3"),
+	}
+
+	sqls, params, err := priorityqueue.GenSQLsForAnalyzeStaticPartitions(jobs, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table %n.%n partition %n, %n, %n",
+		"analyze table %n.%n partition %n",
+	}, sqls)
+	require.Equal(t, [][]any{
+		{"test_schema", "test_table", "p0", "p1", "p2"},
+		{"test_schema", "test_table", "p`3"},
+	}, params)
+	escaped, err := sqlescape.EscapeSQL(sqls[1], params[1]...)
+	require.NoError(t, err)
+	require.Equal(t, "analyze table `test_schema`.`test_table` partition `p``3`", escaped)
+
+	// The analyze options are appended to every statement.
+	for _, job := range jobs {
+		job.AnalyzeOptions = priorityqueue.AnalyzeOptions{NumBuckets: 64}
+	}
+	sqls, _, err = priorityqueue.GenSQLsForAnalyzeStaticPartitions(jobs, 4)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table %n.%n partition %n, %n, %n, %n with 64 buckets"}, sqls)
+
+	// Jobs with different analyze options cannot be batched.
+	jobs[1].AnalyzeOptions = priorityqueue.AnalyzeOptions{}
+	_, _, err = priorityqueue.GenSQLsForAnalyzeStaticPartitions(jobs, 4)
+	require.ErrorContains(t, err, "different analyze options")
+
+	// Jobs of different tables cannot be batched.
+	other := newJob("p0")
+	other.GlobalTableID = 2
+	_, _, err = priorityqueue.GenSQLsForAnalyzeStaticPartitions(
+		[]*priorityqueue.StaticPartitionedTableAnalysisJob{newJob("p0"), other}, 4,
+	)
+	require.ErrorContains(t, err, "different tables")
+}
+
+func TestAnalyzeOptionsValidate(t *testing.T) {
+	require.NoError(t, priorityqueue.AnalyzeOptions{}.Validate())
+	require.NoError(t, priorityqueue.AnalyzeOptions{SampleRate: 1}.Validate())
+	require.NoError(t, priorityqueue.AnalyzeOptions{SampleRate: 0.1, NumBuckets: 1, NumTopN: 1}.Validate())
+	require.ErrorContains(t, priorityqueue.AnalyzeOptions{SampleRate: 1.5}.Validate(), "sample rate 1.5 is out of range (0, 1]")
+	require.ErrorContains(t, priorityqueue.AnalyzeOptions{SampleRate: -0.1}.Validate(), "out of range")
+	require.NoError(t, priorityqueue.AnalyzeOptions{NumSamples: 100, NumTopN: 1}.Validate())
+	require.ErrorContains(t, priorityqueue.AnalyzeOptions{SampleRate: 0.1, NumSamples: 100}.Validate(), "cannot be set together")
+
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		AnalyzeOptions:      priorityqueue.AnalyzeOptions{SampleRate: 2},
+	}
+	_, err := job.DryRun(tk.Session().(sessionctx.Context))
+	require.ErrorContains(t, err, "out of range")
+}
+
+func TestAnalyzeStaticPartitionedTableWithOptions(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+
+	tk.MustExec("create table t (a int, b int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	newJob := func(options priorityqueue.AnalyzeOptions) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		return &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			StaticPartitionName: "p0",
+			TableStatsVer:       2,
+			AnalyzeOptions:      options,
+		}
+	}
+	job := newJob(priorityqueue.AnalyzeOptions{
+		SampleRate: 1,
+		NumBuckets: 4,
+		NumTopN:    1,
+	})
+	handle := dom.StatsHandle()
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	is := dom.InfoSchema()
+	tbl, err := is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	pid := tbl.Meta().GetPartitionInfo().Definitions[0].ID
+	tblStats := handle.GetPartitionStats(tbl.Meta(), pid)
+	require.False(t, tblStats.Pseudo)
+	require.Empty(t, job.GetLastFailureReason())
+
+	job = newJob(priorityqueue.AnalyzeOptions{NumTopN: 1, NumSamples: 100})
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Empty(t, job.GetLastFailureReason())
+
+	// Invalid options fail the job without running any statement.
+	failReason := ""
+	job = newJob(priorityqueue.AnalyzeOptions{NumTopN: 1, NumSamples: 100, SampleRate: 2})
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) { failReason = j.GetLastFailureReason() })
+	require.ErrorContains(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()), "out of range")
+	require.Contains(t, failReason, "out of range")
+}
+
 func TestAnalyzeStaticPartitionedTable(t *testing.T) {
 	store, dom := testkit.CreateMockStoreAndDomain(t)
 	tk := testkit.NewTestKit(t, store)
@@ -84,7 +357,12 @@ func TestAnalyzeStaticPartitionedTable(t *testing.T) {
 	tblStats := handle.GetPartitionStats(tbl.Meta(), pid)
 	require.True(t, tblStats.Pseudo)
 
-	job.Analyze(handle, dom.SysProcTracker())
+	require.Zero(t, job.GetLastRunDuration())
+	var runDuration time.Duration
+	job.RegisterSuccessHook(func(j priorityqueue.AnalysisJob) { runDuration = j.GetLastRunDuration() })
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
+	require.Positive(t, runDuration)
+	require.Equal(t, runDuration, job.GetLastRunDuration())
 	// Check the result of analyze.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -95,6 +373,212 @@ func TestAnalyzeStaticPartitionedTable(t *testing.T) {
 	require.Equal(t, int64(1), tblStats.RealtimeCount)
 }
 
+func TestAnalyzeStaticPartitionedTableMergeGlobalStats(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	handle := dom.StatsHandle()
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	newJob := func(partition string, mergeGlobalStats bool) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			GlobalTableID:       tbl.Meta().ID,
+			StaticPartitionName: partition,
+			StaticPartitionID:   tbl.Meta().GetPartitionInfo().GetPartitionIDByName(partition),
+			TableStatsVer:       2,
+			MergeGlobalStats:    mergeGlobalStats,
+			// Otherwise, the analyze statement merges the global stats by itself in dynamic pruning mode.
+			SessionVariables: priorityqueue.SessionVariables{
+				variable.TiDBPartitionPruneMode: string(variable.Static),
+			},
+		}
+		job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) {
+			require.FailNow(t, "unexpected failure", j.GetLastFailureReason())
+		})
+		return job
+	}
+	getGlobalStats := func() *statistics.Table {
+		require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+		return handle.GetTableStats(tbl.Meta())
+	}
+
+	// The merge step is skipped for pure static pruning mode.
+	require.NoError(t, newJob("p0", false).Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.False(t, getGlobalStats().IsAnalyzed())
+	// The table has no global stats yet, so they are created from the analyzed partitions.
+	require.NoError(t, newJob("p0", true).Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.True(t, getGlobalStats().IsAnalyzed())
+	// The global stats are refreshed after another partition is analyzed.
+	require.NoError(t, newJob("p1", true).Analyze(context.Background(), handle, dom.SysProcTracker()))
+	globalStats := getGlobalStats()
+	require.True(t, globalStats.IsAnalyzed())
+	require.Equal(t, int64(3), globalStats.RealtimeCount)
+	require.True(t, globalStats.GetIdx(tbl.Meta().Indices[0].ID).IsAnalyzed())
+}
+
+func TestAnalyzeStaticPartitionedTableGlobalIndexes(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("set @@tidb_enable_global_index = 1")
+	tk.MustExec("set @@tidb_partition_prune_mode = 'static'")
+	tk.MustExec("create table t (a int, b int, c int, index ia(a), unique key ic1((c + 1)) global, unique key ic(c) global) partition by hash(b) partitions 2")
+	tk.MustExec("insert into t values (1, 1, 1), (2, 2, 2), (3, 3, 3)")
+	handle := dom.StatsHandle()
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	tblInfo := tbl.Meta()
+
+	// The partitions never collect the stats of the global indexes for version 1,
+	// and only the special global indexes are left out for version 2.
+	sctx := tk.Session().(sessionctx.Context)
+	factory := priorityqueue.NewAnalysisJobFactory(sctx, 0.5, 0)
+	require.Equal(t, []string{"ic1", "ic"}, factory.CheckGlobalIndexesNeedAnalyze(tblInfo, statistics.Version1))
+	require.Equal(t, []string{"ic1"}, factory.CheckGlobalIndexesNeedAnalyze(tblInfo, statistics.Version2))
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       tblInfo.ID,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   tblInfo.GetPartitionInfo().Definitions[0].ID,
+		GlobalIndexes:       []string{"ic1"},
+		TableStatsVer:       2,
+		SessionVariables: priorityqueue.SessionVariables{
+			variable.TiDBPartitionPruneMode: string(variable.Static),
+		},
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0`",
+		"analyze table `test`.`t` index `ic1`",
+	}, sqls)
+	sql, params := job.GenSQLForAnalyzeGlobalIndex("ic1")
+	require.Equal(t, "analyze table %n.%n index %n", sql)
+	require.Equal(t, []any{"test", "t", "ic1"}, params)
+
+	job.RegisterFailureHook(func(j priorityqueue.AnalysisJob) {
+		require.FailNow(t, "unexpected failure", j.GetLastFailureReason())
+	})
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+	globalStats := handle.GetTableStats(tblInfo)
+	require.True(t, globalStats.GetIdx(tblInfo.FindIndexByName("ic1").ID).IsAnalyzed())
+	require.False(t, handle.GetPartitionStats(tblInfo, job.StaticPartitionID).Pseudo)
+}
+
+func TestAnalyzeStaticPartitionedTableWithProgressHook(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+
+	tk.MustExec("create table t (a int, b int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+
+	origin := priorityqueue.ProgressReportInterval
+	priorityqueue.ProgressReportInterval = time.Millisecond
+	defer func() {
+		priorityqueue.ProgressReportInterval = origin
+	}()
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		TableStatsVer:       2,
+	}
+	var (
+		mu       sync.Mutex
+		progress []priorityqueue.AnalyzeProgress
+	)
+	job.RegisterProgressHook(func(j priorityqueue.AnalysisJob, p priorityqueue.AnalyzeProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, job, j)
+		progress = append(progress, p)
+	})
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), dom.SysProcTracker()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, progress)
+	last := progress[len(progress)-1]
+	require.True(t, last.Finished)
+	require.Greater(t, last.Elapsed, time.Duration(0))
+	for _, p := range progress[:len(progress)-1] {
+		require.False(t, p.Finished)
+	}
+}
+
+// cancelOnTrackTracker cancels the context once an analyze statement starts running.
+type cancelOnTrackTracker struct {
+	sysproctrack.Tracker
+	cancel context.CancelFunc
+}
+
+func (t *cancelOnTrackTracker) Track(id uint64, proc sysproctrack.TrackProc) error {
+	if err := t.Tracker.Track(id, proc); err != nil {
+		return err
+	}
+	t.cancel()
+	return nil
+}
+
+func TestAnalyzeStaticPartitionedTableWithCanceledContext(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+
+	tk.MustExec("create table t (a int, b int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+
+	newJob := func(succeeded, failed *bool) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			StaticPartitionName: "p0",
+			TableStatsVer:       2,
+		}
+		job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { *succeeded = true })
+		job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { *failed = true })
+		return job
+	}
+	handle := dom.StatsHandle()
+	is := dom.InfoSchema()
+	tbl, err := is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	pid := tbl.Meta().GetPartitionInfo().Definitions[0].ID
+
+	// Cancel the job before it starts.
+	var succeeded, failed bool
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job := newJob(&succeeded, &failed)
+	err = job.Analyze(ctx, handle, dom.SysProcTracker())
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, succeeded)
+	require.True(t, failed)
+	require.Equal(t, priorityqueue.JobStateCanceled, job.State())
+	require.True(t, handle.GetPartitionStats(tbl.Meta(), pid).Pseudo)
+
+	// Cancel the job while the analyze statement is running.
+	succeeded, failed = false, false
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	tracker := &cancelOnTrackTracker{Tracker: dom.SysProcTracker(), cancel: cancel}
+	job = newJob(&succeeded, &failed)
+	err = job.Analyze(ctx, handle, tracker)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, succeeded)
+	require.True(t, failed)
+	require.Equal(t, priorityqueue.JobStateCanceled, job.State())
+}
+
 func TestAnalyzeStaticPartitionedTableIndexes(t *testing.T) {
 	store, dom := testkit.CreateMockStoreAndDomain(t)
 	tk := testkit.NewTestKit(t, store)
@@ -118,7 +602,7 @@ func TestAnalyzeStaticPartitionedTableIndexes(t *testing.T) {
 	tblStats := handle.GetPartitionStats(tbl.Meta(), pid)
 	require.False(t, tblStats.GetIdx(1).IsAnalyzed())
 
-	job.Analyze(handle, dom.SysProcTracker())
+	job.Analyze(context.Background(), handle, dom.SysProcTracker())
 	// Check the result of analyze.
 	is = dom.InfoSchema()
 	tbl, err = is.TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
@@ -186,3 +670,403 @@ func TestStaticPartitionedTableIsValidToAnalyze(t *testing.T) {
 	require.True(t, valid)
 	require.Equal(t, "", failReason)
 }
+
+func TestDryRunStaticPartitionedTable(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		TableStatsVer:       2,
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0`"}, sqls)
+
+	job.Columns = []string{"a", "b"}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` columns `a`, `b`"}, sqls)
+
+	job.Indexes = []string{"idx", "idx1"}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` index `idx`"}, sqls)
+
+	// AnalyzeEachIndex analyzes all listed indexes one by one even for version 2.
+	job.AnalyzeEachIndex = true
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx`",
+		"analyze table `test`.`t` partition `p0` index `idx1`",
+	}, sqls)
+	job.AnalyzeEachIndex = false
+
+	// For version 1, all indexes are analyzed one by one.
+	job.TableStatsVer = 1
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx`",
+		"analyze table `test`.`t` partition `p0` index `idx1`",
+	}, sqls)
+}
+
+func TestDryRunStaticPartitionedTableWithGeneratedColumns(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("set @@tidb_partition_prune_mode = 'static'")
+	tk.MustExec("create table t (a int, b int as (a + 1) stored, c int as (a + 2) stored, index idx(c)) partition by hash(a) partitions 2")
+	defer func(options string) {
+		variable.AnalyzeColumnOptions.Store(options)
+	}(variable.AnalyzeColumnOptions.Load())
+	variable.AnalyzeColumnOptions.Store(model.AllColumns.String())
+	defer func() {
+		priorityqueue.AnalyzeNonIndexedGeneratedColumns = true
+	}()
+	priorityqueue.AnalyzeNonIndexedGeneratedColumns = false
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       tbl.Meta().ID,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   tbl.Meta().Partition.Definitions[0].ID,
+		TableStatsVer:       2,
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` columns `a`, `c`"}, sqls)
+
+	// The column choice of the users is respected.
+	tk.MustExec("analyze table t all columns")
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0`"}, sqls)
+}
+
+func TestDryRunStaticPartitionedTableWithExcludedIndexes(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		TableStatsVer:       2,
+		Indexes:             []string{"idx", "idx1", "idx2"},
+		ExcludedIndexes:     []string{"IDX"},
+		AnalyzeEachIndex:    true,
+	}
+	// The excluded indexes are skipped.
+	require.Equal(t, "static_partition_index", job.GetAnalyzeType())
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx1`",
+		"analyze table `test`.`t` partition `p0` index `idx2`",
+	}, sqls)
+	// The job itself is not modified.
+	require.Equal(t, []string{"idx", "idx1", "idx2"}, job.Indexes)
+
+	job.AnalyzeEachIndex = false
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` index `idx1`"}, sqls)
+
+	// Fall back to analyzing the partition if all indexes are excluded.
+	job.ExcludedIndexes = []string{"idx", "idx1", "idx2"}
+	require.Equal(t, "static_partition", job.GetAnalyzeType())
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0`"}, sqls)
+
+	cloned := job.Clone().(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	require.True(t, job.Equal(cloned))
+	cloned.ExcludedIndexes[0] = "idx3"
+	require.Equal(t, "idx", job.ExcludedIndexes[0])
+	require.False(t, job.Equal(cloned))
+}
+
+func TestDryRunStaticPartitionedTableWithFreshIndexes(t *testing.T) {
+	defer func(threshold time.Duration) {
+		priorityqueue.IndexStalenessThreshold = threshold
+	}(priorityqueue.IndexStalenessThreshold)
+	priorityqueue.IndexStalenessThreshold = time.Hour
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	now := time.Now()
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		StaticPartitionName: "p0",
+		TableStatsVer:       2,
+		Indexes:             []string{"idx", "idx1", "idx2"},
+		IndexLastAnalyzedAt: map[string]time.Time{
+			"idx":  now.Add(-time.Minute),
+			"idx1": now.Add(-2 * time.Hour),
+		},
+	}
+	// The fresh index is skipped, and the index without a time is analyzed.
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` index `idx1`"}, sqls)
+
+	// The fresh indexes are skipped for version 1 as well.
+	job.TableStatsVer = 1
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx1`",
+		"analyze table `test`.`t` partition `p0` index `idx2`",
+	}, sqls)
+
+	// Nothing is analyzed if all indexes are fresh.
+	job.Indexes = []string{"idx"}
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Empty(t, sqls)
+
+	// All indexes are analyzed if the threshold is disabled.
+	priorityqueue.IndexStalenessThreshold = 0
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"analyze table `test`.`t` partition `p0` index `idx`"}, sqls)
+
+	cloned := job.Clone().(*priorityqueue.StaticPartitionedTableAnalysisJob)
+	require.True(t, job.Equal(cloned))
+	cloned.IndexLastAnalyzedAt["idx"] = now
+	require.False(t, job.Equal(cloned))
+}
+
+func TestStaticPartitionedTableIsValidToAnalyzeAfterPartitionDropped(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1), (3)")
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       tbl.Meta().ID,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   tbl.Meta().GetPartitionInfo().Definitions[0].ID,
+	}
+	failed := false
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failed = true })
+
+	sctx := tk.Session().(sessionctx.Context)
+	valid, failReason := job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	require.Equal(t, "", failReason)
+	require.False(t, failed)
+
+	tk.MustExec("alter table t drop partition p0")
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Equal(t, "partition no longer exists", failReason)
+	require.True(t, failed)
+}
+
+func TestStaticPartitionedTableIsValidToAnalyzeWhenEmpty(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec(session.CreateAnalyzeJobs)
+	tk.MustExec("create table t (a int) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	job := &priorityqueue.StaticPartitionedTableAnalysisJob{
+		TableSchema:         "test",
+		GlobalTableName:     "t",
+		GlobalTableID:       tbl.Meta().ID,
+		StaticPartitionName: "p0",
+		StaticPartitionID:   tbl.Meta().GetPartitionInfo().Definitions[0].ID,
+	}
+	failed := false
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failed = true })
+
+	// The empty partition is skipped, which is not a failure.
+	sctx := tk.Session().(sessionctx.Context)
+	valid, failReason := job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Equal(t, "empty partition", failReason)
+	require.False(t, failed)
+	require.Empty(t, job.GetLastFailureReason())
+
+	// The rows in the other partitions do not matter.
+	tk.MustExec("insert into t values (3)")
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Equal(t, "empty partition", failReason)
+
+	tk.MustExec("insert into t values (1)")
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	require.Equal(t, "", failReason)
+
+	// The partition is not read if it is known to have rows.
+	tk.MustExec("delete from t")
+	job.TableSize = 1
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	require.Equal(t, "", failReason)
+}
+
+func TestValidateJobs(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1), (3)")
+	tk.MustExec("create table t1 (a int)")
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	definitions := tbl.Meta().GetPartitionInfo().Definitions
+	newJob := func(i int) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		return &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			GlobalTableID:       tbl.Meta().ID,
+			StaticPartitionName: definitions[i].Name.O,
+			StaticPartitionID:   definitions[i].ID,
+		}
+	}
+	jobs := []priorityqueue.AnalysisJob{
+		newJob(0),
+		newJob(1),
+		&priorityqueue.NonPartitionedTableAnalysisJob{TableSchema: "test", TableName: "t1"},
+	}
+	tk.MustExec("alter table t drop partition p0")
+
+	results := priorityqueue.ValidateJobs(tk.Session().(sessionctx.Context), jobs)
+	require.Equal(t, []priorityqueue.ValidationResult{
+		{Valid: false, FailReason: "partition no longer exists"},
+		{Valid: true},
+		{Valid: true},
+	}, results)
+	// The results are the same as validating the jobs one by one.
+	for i, job := range jobs {
+		valid, failReason := job.IsValidToAnalyze(tk.Session().(sessionctx.Context))
+		require.Equal(t, results[i], priorityqueue.ValidationResult{Valid: valid, FailReason: failReason})
+	}
+}
+
+// concurrencyTracker records the max number of the analyze statements running at the same time.
+// Each statement waits for a while until another one starts, so that the concurrent statements overlap.
+// If failFirst is set, the first statement fails to start.
+type concurrencyTracker struct {
+	sysproctrack.Tracker
+	failFirst bool
+
+	mu      sync.Mutex
+	running int
+	maxRun  int
+}
+
+func (t *concurrencyTracker) Track(id uint64, proc sysproctrack.TrackProc) error {
+	t.mu.Lock()
+	if t.failFirst {
+		t.failFirst = false
+		t.mu.Unlock()
+		return errors.New("mock track failure")
+	}
+	t.mu.Unlock()
+	if err := t.Tracker.Track(id, proc); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.running++
+	t.maxRun = max(t.maxRun, t.running)
+	t.mu.Unlock()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		t.mu.Lock()
+		overlapped := t.maxRun > 1
+		t.mu.Unlock()
+		if overlapped {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func (t *concurrencyTracker) UnTrack(id uint64) {
+	t.mu.Lock()
+	t.running--
+	t.mu.Unlock()
+	t.Tracker.UnTrack(id)
+}
+
+func TestAnalyzeStaticPartitionIndexesConcurrently(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	defer func(concurrency int, autoAnalyzeConcurrency int32) {
+		priorityqueue.IndexAnalysisConcurrency = concurrency
+		variable.AutoAnalyzeConcurrency.Store(autoAnalyzeConcurrency)
+	}(priorityqueue.IndexAnalysisConcurrency, variable.AutoAnalyzeConcurrency.Load())
+	priorityqueue.IndexAnalysisConcurrency = 4
+	// Auto analyze is disabled in the tests, so tidb_auto_analyze_concurrency cannot be set by SQL.
+	variable.AutoAnalyzeConcurrency.Store(2)
+	tk.MustExec("create table t (a int, b int, c int, index idx_a(a), index idx_b(b), index idx_c(c)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1, 1), (2, 2, 2), (3, 3, 3)")
+	// AnalyzeEachIndex generates one statement per index regardless of the analyze version of the session,
+	// and the statements are executed under version 1 because of TableStatsVer.
+	newJob := func(indexes ...string) *priorityqueue.StaticPartitionedTableAnalysisJob {
+		return &priorityqueue.StaticPartitionedTableAnalysisJob{
+			TableSchema:         "test",
+			GlobalTableName:     "t",
+			StaticPartitionName: "p0",
+			TableStatsVer:       1,
+			Indexes:             indexes,
+			AnalyzeEachIndex:    true,
+		}
+	}
+	analyzedIndexes := func(partition string) [][]any {
+		return tk.MustQuery("select i.key_name from mysql.stats_histograms h " +
+			"join information_schema.partitions p on h.table_id = p.tidb_partition_id " +
+			"join information_schema.tidb_indexes i on i.table_schema = p.table_schema and i.table_name = p.table_name and i.index_id = h.hist_id " +
+			"where p.table_name = 't' and p.partition_name = '" + partition + "' and h.is_index = 1 order by i.key_name").Rows()
+	}
+
+	// The indexes are analyzed concurrently, capped by tidb_auto_analyze_concurrency.
+	tracker := &concurrencyTracker{Tracker: dom.SysProcTracker()}
+	job := newJob("idx_a", "idx_b", "idx_c")
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), tracker))
+	require.Empty(t, job.GetLastFailureReason())
+	require.Equal(t, 2, tracker.maxRun)
+	require.Equal(t, [][]any{{"idx_a"}, {"idx_b"}, {"idx_c"}}, analyzedIndexes("p0"))
+
+	// A failed index fails the job, but the other indexes are still analyzed.
+	job = newJob("idx_a", "idx_b", "idx_c")
+	job.StaticPartitionName = "p1"
+	var failed bool
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failed = true })
+	tracker = &concurrencyTracker{Tracker: dom.SysProcTracker(), failFirst: true}
+	require.NoError(t, job.Analyze(context.Background(), dom.StatsHandle(), tracker))
+	require.True(t, failed)
+	require.Contains(t, job.GetLastFailureReason(), "mock track failure")
+	require.Equal(t, 2, tracker.maxRun)
+	require.Len(t, analyzedIndexes("p1"), 2)
+
+	// The indexes are analyzed one by one if the concurrency is 1.
+	priorityqueue.IndexAnalysisConcurrency = 1
+	tracker = &concurrencyTracker{Tracker: dom.SysProcTracker()}
+	require.NoError(t, newJob("idx_a", "idx_b").Analyze(context.Background(), dom.StatsHandle(), tracker))
+	require.Equal(t, 1, tracker.maxRun)
+}
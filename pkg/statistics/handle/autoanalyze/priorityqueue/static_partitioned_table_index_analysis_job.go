@@ -0,0 +1,566 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/infoschema"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/sessionctx/sysproctrack"
+	"github.com/pingcap/tidb/pkg/statistics/handle/logutil"
+	statstypes "github.com/pingcap/tidb/pkg/statistics/handle/types"
+	statsutil "github.com/pingcap/tidb/pkg/statistics/handle/util"
+	"go.uber.org/zap"
+)
+
+var _ AnalysisJob = &StaticPartitionedTableIndexAnalysisJob{}
+
+const analyzeStaticPartitionedTableIndex analyzeType = "analyzeStaticPartitionedTableIndex"
+
+// StaticPartitionedTableIndexAnalysisJob is a job for analyzing the newly added indexes on the static partitions of a table.
+// Unlike StaticPartitionedTableAnalysisJob, it covers many partitions at once, so that adding an index
+// to a static partitioned table is tracked as a single job with a single weight and a single outcome.
+// The partitions are analyzed one by one, and the job fails as soon as any partition fails.
+type StaticPartitionedTableIndexAnalysisJob struct {
+	successHook     JobHook
+	failureHook     JobHook
+	progressHook    ProgressHook
+	validityHook    ValidityHook
+	tracer          Tracer
+	TableSchema     string
+	GlobalTableName string
+	// Indexes are the newly added indexes to analyze.
+	Indexes []string
+	// Partitions are the static partitions to analyze the indexes on.
+	Partitions []PartitionIDAndName
+	// AnalyzeOptions is used to override the default options of the analyze statements.
+	AnalyzeOptions AnalyzeOptions
+	// AnalyzeEachIndex forces analyzing the indexes one by one even for version 2,
+	// see StaticPartitionedTableAnalysisJob.AnalyzeEachIndex.
+	AnalyzeEachIndex bool
+	// SessionVariables is used to override the session variables while executing the analyze statements.
+	SessionVariables SessionVariables
+
+	// Some indicators to help us decide whether we need to analyze this table.
+	// TableSize is the total size of the partitions.
+	Indicators
+	GlobalTableID int64
+
+	TableStatsVer int
+	Weight        float64
+	// EnqueuedAt is the time when the job is pushed into the queue.
+	// It is used to boost the weight of the job that has been waiting for a long time.
+	EnqueuedAt time.Time
+	// LastRunDuration is the wall-clock time spent on executing the analyze statements in the last run.
+	LastRunDuration time.Duration
+
+	// lastFailureReason is the reason why the job failed last time.
+	lastFailureReason string
+	// lastFailureTransient indicates whether the job failed with a transient error last time.
+	lastFailureTransient bool
+	// completed indicates whether the job has been analyzed successfully.
+	// Analyzing a completed job again only calls the success hook.
+	completed bool
+	// state is the state of the job in its lifecycle, see AnalysisJob.State.
+	state jobState
+}
+
+// NewStaticPartitionedTableIndexAnalysisJob creates a job for analyzing the indexes on the static partitions of a table.
+func NewStaticPartitionedTableIndexAnalysisJob(
+	schema, globalTableName string,
+	globalTableID int64,
+	indexes []string,
+	partitions []PartitionIDAndName,
+	tableStatsVer int,
+	changePercentage float64,
+	tableSize float64,
+	lastAnalysisDuration time.Duration,
+) *StaticPartitionedTableIndexAnalysisJob {
+	return &StaticPartitionedTableIndexAnalysisJob{
+		GlobalTableID:   globalTableID,
+		TableSchema:     schema,
+		GlobalTableName: globalTableName,
+		Indexes:         indexes,
+		Partitions:      partitions,
+		TableStatsVer:   tableStatsVer,
+		Indicators: Indicators{
+			ChangePercentage:     changePercentage,
+			TableSize:            tableSize,
+			LastAnalysisDuration: lastAnalysisDuration,
+		},
+	}
+}
+
+// GetTableID gets the table ID of the job.
+// It is the ID of the global table, so the job does not conflict with the jobs of the single partitions.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetTableID() int64 {
+	return j.GlobalTableID
+}
+
+// GetGlobalTableID implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetGlobalTableID() int64 {
+	return j.GlobalTableID
+}
+
+// GetSchemaName implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetSchemaName() string {
+	return j.TableSchema
+}
+
+// GetTableName implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetTableName() string {
+	return j.GlobalTableName
+}
+
+// GetPartitionNames implements AnalysisJob.
+// It returns the names of the partitions in the order they are analyzed.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetPartitionNames() []string {
+	names := make([]string, 0, len(j.Partitions))
+	for _, partition := range j.Partitions {
+		names = append(names, partition.Name)
+	}
+	return names
+}
+
+// PartitionJobs expands the job into a job for each partition, which analyzes the indexes on that partition.
+// The expanded jobs share the options of the job, but not the hooks, the weight or the enqueue time.
+func (j *StaticPartitionedTableIndexAnalysisJob) PartitionJobs() []*StaticPartitionedTableAnalysisJob {
+	jobs := make([]*StaticPartitionedTableAnalysisJob, 0, len(j.Partitions))
+	for _, partition := range j.Partitions {
+		job := NewStaticPartitionTableAnalysisJob(
+			j.TableSchema,
+			j.GlobalTableName,
+			j.GlobalTableID,
+			partition.Name,
+			partition.ID,
+			slices.Clone(j.Indexes),
+			nil,
+			j.TableStatsVer,
+			j.ChangePercentage,
+			j.TableSize,
+			j.LastAnalysisDuration,
+		)
+		job.AnalyzeOptions = j.AnalyzeOptions
+		job.AnalyzeEachIndex = j.AnalyzeEachIndex
+		job.SessionVariables = maps.Clone(j.SessionVariables)
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Analyze analyzes the indexes on all partitions.
+// The success hook is called only if all partitions are analyzed, otherwise the failure hook is called once.
+func (j *StaticPartitionedTableIndexAnalysisJob) Analyze(
+	ctx context.Context,
+	statsHandle statstypes.StatsHandle,
+	sysProcTracker sysproctrack.Tracker,
+) error {
+	// The job has been analyzed successfully, e.g. the runner retries it because the success hook fails.
+	// Only the success hook is called again, so that the table is not analyzed twice.
+	if j.completed {
+		if j.successHook != nil {
+			j.successHook(j)
+		}
+		return nil
+	}
+
+	j.setState(JobStateRunning)
+	success, canceled := true, false
+	defer func() {
+		// The state is set before calling the hooks, so that the hooks see the outcome.
+		if canceled {
+			// The interrupted job is neither a success nor a failure, so it is not counted as either.
+			// The failure hook is still called to release the table, see JobStateCanceled.
+			j.setState(JobStateCanceled)
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+			return
+		}
+		observeAnalysisResult(j, success)
+		if success {
+			j.setState(JobStateSucceeded)
+			j.completed = true
+			if j.successHook != nil {
+				j.successHook(j)
+			}
+		} else {
+			j.setState(JobStateFailed)
+			if j.failureHook != nil {
+				j.failureHook(j)
+			}
+		}
+	}()
+
+	err := runAnalysis(ctx, j, j.progressHook, statsHandle, sysProcTracker, func(ctx context.Context, sysProcTracker sysproctrack.Tracker) error {
+		var sqls []analyzeSQL
+		var genErr error
+		if err := statsutil.CallWithSCtx(statsHandle.SPool(), func(sctx sessionctx.Context) error {
+			sqls, genErr = j.genAnalyzeSQLs(sctx)
+			return nil
+		}); err != nil {
+			// Nothing is done without a session, so the job fails.
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+			return err
+		}
+		if genErr != nil {
+			success = false
+			j.lastFailureReason = genErr.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(genErr)
+			return genErr
+		}
+		start := DefaultClock.Now()
+		err := runAnalyzeSQLs(ctx, j, statsHandle, sysProcTracker, j.tracer, j.TableStatsVer, j.SessionVariables, sqls)
+		j.LastRunDuration = since(start)
+		if err != nil {
+			success = false
+			j.lastFailureReason = err.Error()
+			j.lastFailureTransient = isTransientAnalyzeError(err)
+		}
+		return nil
+	})
+	if isAnalysisCanceled(err) || isAnalysisTimedOut(err) {
+		// The job is interrupted, so it is not finished.
+		// Unlike a cancellation, a timeout is a failure of the job, see AnalyzeTimeoutPerCostUnit.
+		canceled = !isAnalysisTimedOut(err)
+		success = false
+		j.lastFailureReason = err.Error()
+		j.lastFailureTransient = isTransientAnalyzeError(err)
+	}
+	return err
+}
+
+// DryRun implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	sqls, err := j.genAnalyzeSQLs(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return escapeAnalyzeSQLs(sqls)
+}
+
+// GenAnalyzeSQLParams implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]AnalyzeSQLParams, error) {
+	sqls, err := j.genAnalyzeSQLs(sctx)
+	if err != nil {
+		return nil, err
+	}
+	return collectAnalyzeSQLParams(sqls), nil
+}
+
+// RegisterSuccessHook registers a successHook function that will be called after the job can be marked as successful.
+func (j *StaticPartitionedTableIndexAnalysisJob) RegisterSuccessHook(hook JobHook) {
+	j.successHook = hook
+}
+
+// RegisterFailureHook registers a failureHook function that will be called after the job can be marked as failed.
+func (j *StaticPartitionedTableIndexAnalysisJob) RegisterFailureHook(hook JobHook) {
+	j.failureHook = hook
+}
+
+// RegisterProgressHook registers a progressHook function that will be called periodically while the job is running.
+func (j *StaticPartitionedTableIndexAnalysisJob) RegisterProgressHook(hook ProgressHook) {
+	j.progressHook = hook
+}
+
+// RegisterValidityHook registers a validityHook function that is consulted by IsValidToAnalyze after its built-in checks pass.
+func (j *StaticPartitionedTableIndexAnalysisJob) RegisterValidityHook(hook ValidityHook) {
+	j.validityHook = hook
+}
+
+// SetTracer sets the Tracer that traces the execution of the analyze statements of the job.
+func (j *StaticPartitionedTableIndexAnalysisJob) SetTracer(tracer Tracer) {
+	j.tracer = tracer
+}
+
+// GetIndicators implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetIndicators() Indicators {
+	return j.Indicators
+}
+
+// SetIndicators implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) SetIndicators(indicators Indicators) {
+	j.Indicators = indicators
+}
+
+// HasNewlyAddedIndex implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) HasNewlyAddedIndex() bool {
+	return len(j.Indexes) > 0
+}
+
+// Validate implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) Validate() error {
+	switch {
+	case j.TableSchema == "":
+		return errors.New("invalid analysis job: table schema is empty")
+	case j.GlobalTableName == "":
+		return errors.New("invalid analysis job: global table name is empty")
+	case j.GlobalTableID <= 0:
+		return errors.Errorf("invalid analysis job: global table ID %d is not positive", j.GlobalTableID)
+	case len(j.Indexes) == 0:
+		return errors.New("invalid analysis job: no index to analyze")
+	case len(j.Partitions) == 0:
+		return errors.New("invalid analysis job: no partition to analyze")
+	}
+	for _, partition := range j.Partitions {
+		if partition.Name == "" || partition.ID <= 0 {
+			return errors.Errorf("invalid analysis job: invalid partition %q with ID %d", partition.Name, partition.ID)
+		}
+	}
+	return j.AnalyzeOptions.Validate()
+}
+
+// IsValidToAnalyze checks whether the partitions are valid to analyze.
+// The partitions dropped after the job is created are removed from the job.
+// Like the dynamic partitioned tables, if any partition is invalid to analyze, the whole job is invalid.
+func (j *StaticPartitionedTableIndexAnalysisJob) IsValidToAnalyze(
+	sctx sessionctx.Context,
+) (bool, string) {
+	return j.isValidToAnalyzeWithInfoSchema(sctx, sctx.GetDomainInfoSchema().(infoschema.InfoSchema))
+}
+
+func (j *StaticPartitionedTableIndexAnalysisJob) isValidToAnalyzeWithInfoSchema(
+	sctx sessionctx.Context,
+	is infoschema.InfoSchema,
+) (bool, string) {
+	j.Partitions = slices.DeleteFunc(j.Partitions, func(partition PartitionIDAndName) bool {
+		tblInfo, _, _ := is.FindTableInfoByPartitionID(partition.ID)
+		return tblInfo == nil
+	})
+	if len(j.Partitions) == 0 {
+		logutil.SingletonStatsSamplerLogger().Info(
+			"Skip analysis because all partitions no longer exist",
+			zap.String("schema", j.TableSchema),
+			zap.String("table", j.GlobalTableName),
+			zap.Int64("tableID", j.GlobalTableID),
+			zap.String("correlationID", j.GetCorrelationID()),
+		)
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = "partitions no longer exist"
+		if j.failureHook != nil {
+			j.failureHook(j)
+		}
+		return false, "partitions no longer exist"
+	}
+
+	partitionNames := make([]string, 0, len(j.Partitions))
+	for _, partition := range j.Partitions {
+		partitionNames = append(partitionNames, partition.Name)
+	}
+	if valid, failReason := isValidToAnalyze(
+		sctx,
+		j.TableSchema,
+		j.GlobalTableName,
+		partitionNames...,
+	); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
+		if j.failureHook != nil {
+			j.failureHook(j)
+		}
+		return false, failReason
+	}
+
+	if valid, failReason := checkValidityHook(j, j.validityHook); !valid {
+		j.setState(JobStateSkipped)
+		j.lastFailureReason = failReason
+		return false, failReason
+	}
+	return true, ""
+}
+
+// Clone implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) Clone() AnalysisJob {
+	cloned := *j
+	cloned.Indexes = slices.Clone(j.Indexes)
+	cloned.Partitions = slices.Clone(j.Partitions)
+	cloned.SessionVariables = maps.Clone(j.SessionVariables)
+	return &cloned
+}
+
+// Equal implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) Equal(other AnalysisJob) bool {
+	o, ok := other.(*StaticPartitionedTableIndexAnalysisJob)
+	if !ok || o == nil {
+		return false
+	}
+	return j.GlobalTableID == o.GlobalTableID &&
+		j.TableSchema == o.TableSchema &&
+		j.GlobalTableName == o.GlobalTableName &&
+		slices.Equal(j.Indexes, o.Indexes) &&
+		slices.Equal(j.Partitions, o.Partitions) &&
+		j.AnalyzeOptions == o.AnalyzeOptions &&
+		j.AnalyzeEachIndex == o.AnalyzeEachIndex &&
+		maps.Equal(j.SessionVariables, o.SessionVariables)
+}
+
+// SetWeight implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) SetWeight(weight float64) {
+	j.Weight = clampWeight(weight)
+}
+
+// GetWeight implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetWeight() float64 {
+	return clampWeight(j.Weight + calculateAgingWeight(j.EnqueuedAt))
+}
+
+// GetBaseWeight gets the weight set by SetWeight, without the aging boost.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetBaseWeight() float64 {
+	return j.Weight
+}
+
+// SetEnqueuedAt implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	j.EnqueuedAt = enqueuedAt
+}
+
+// GetEnqueuedAt implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetEnqueuedAt() time.Time {
+	return j.EnqueuedAt
+}
+
+// GetLastRunDuration implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetLastRunDuration() time.Duration {
+	return j.LastRunDuration
+}
+
+// GetLastFailureReason implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetLastFailureReason() string {
+	return j.lastFailureReason
+}
+
+// State implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) State() JobState {
+	return j.state.load()
+}
+
+func (j *StaticPartitionedTableIndexAnalysisJob) setState(state JobState) {
+	j.state.store(state)
+}
+
+// IsLastFailureTransient implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) IsLastFailureTransient() bool {
+	return j.lastFailureTransient
+}
+
+// GetCorrelationID implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetCorrelationID() string {
+	return genCorrelationID(j.GlobalTableID, 0, j.EnqueuedAt)
+}
+
+// GetWeightBreakdown implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) GetWeightBreakdown() map[string]float64 {
+	return NewPriorityCalculator().CalculateWeightBreakdown(j)
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The analyze type is included so that the job can be decoded by UnmarshalAnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) MarshalJSON() ([]byte, error) {
+	type alias StaticPartitionedTableIndexAnalysisJob
+	return json.Marshal(struct {
+		AnalyzeType analyzeType
+		*alias
+	}{
+		AnalyzeType: analyzeStaticPartitionedTableIndex,
+		alias:       (*alias)(j),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (j *StaticPartitionedTableIndexAnalysisJob) UnmarshalJSON(data []byte) error {
+	if err := checkAnalyzeType(data, j); err != nil {
+		return err
+	}
+	type alias StaticPartitionedTableIndexAnalysisJob
+	return json.Unmarshal(data, (*alias)(j))
+}
+
+// String implements fmt.Stringer interface.
+func (j *StaticPartitionedTableIndexAnalysisJob) String() string {
+	partitionNames := make([]string, 0, len(j.Partitions))
+	for _, partition := range j.Partitions {
+		partitionNames = append(partitionNames, partition.Name)
+	}
+	return fmt.Sprintf(
+		"StaticPartitionedTableIndexAnalysisJob:\n"+
+			"\tAnalyzeType: %s\n"+
+			"\tIndexes: %s\n"+
+			"\tPartitions: %s\n"+
+			"\tSchema: %s\n"+
+			"\tGlobalTable: %s\n"+
+			"\tGlobalTableID: %d\n"+
+			"\tTableStatsVer: %d\n"+
+			"\tChangePercentage: %.6f\n"+
+			"\tTableSize: %.2f\n"+
+			"\tLastAnalysisDuration: %s\n"+
+			"\tWeight: %.6f\n"+
+			"\tWeightBreakdown: %s\n"+
+			"\tCorrelationID: %s\n",
+		analyzeStaticPartitionedTableIndex,
+		strings.Join(j.Indexes, ", "),
+		strings.Join(partitionNames, ", "),
+		j.TableSchema, j.GlobalTableName, j.GlobalTableID,
+		j.TableStatsVer, j.ChangePercentage, j.TableSize,
+		j.LastAnalysisDuration, j.Weight,
+		formatWeightBreakdown(j.GetWeightBreakdown()),
+		j.GetCorrelationID(),
+	)
+}
+
+// EstimatedCost implements AnalysisJob.
+func (j *StaticPartitionedTableIndexAnalysisJob) EstimatedCost() float64 {
+	return estimateCost(j.Indicators, len(j.Indexes), 0)
+}
+
+// EstimatedMemoryBytes implements AnalysisJob.
+// The partitions are analyzed one by one, so the memory is estimated from the average size of the partitions.
+func (j *StaticPartitionedTableIndexAnalysisJob) EstimatedMemoryBytes() int64 {
+	indicators := j.Indicators
+	if n := len(j.Partitions); n > 1 {
+		indicators.TableSize /= float64(n)
+		indicators.EstimatedRows /= int64(n)
+	}
+	options := j.AnalyzeOptions.adaptToIndicators(j.ChangePercentage, j.TableSize, j.TableStatsVer)
+	return estimateMemoryBytes(indicators, options, len(j.Indexes), 0)
+}
+
+// GetAnalyzeType implements AnalysisJob.
+func (*StaticPartitionedTableIndexAnalysisJob) GetAnalyzeType() string {
+	return analyzeStaticPartitionedTableIndex.label()
+}
+
+// genAnalyzeSQLs generates the analyze statements of all partitions in the order of the partitions.
+// The statements of each partition are the same as those of the expanded job of the partition.
+func (j *StaticPartitionedTableIndexAnalysisJob) genAnalyzeSQLs(sctx sessionctx.Context) ([]analyzeSQL, error) {
+	if err := j.AnalyzeOptions.Validate(); err != nil {
+		return nil, err
+	}
+	partitionJobs := j.PartitionJobs()
+	sqls := make([]analyzeSQL, 0, len(partitionJobs))
+	for _, job := range partitionJobs {
+		sqls = append(sqls, job.genSQLsForAnalyzeStaticPartitionIndexes()...)
+	}
+	return sqls, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/parser/model"
+	"github.com/pingcap/tidb/pkg/sessionctx"
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/pingcap/tidb/pkg/testkit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticPartitionedTableIndexAnalysisJobPartitionJobs(t *testing.T) {
+	job := priorityqueue.NewStaticPartitionedTableIndexAnalysisJob(
+		"test", "t", 1, []string{"idx"},
+		[]priorityqueue.PartitionIDAndName{
+			priorityqueue.NewPartitionIDAndName("p0", 2),
+			priorityqueue.NewPartitionIDAndName("p1", 3),
+		},
+		2, 0.5, 1000, 0,
+	)
+	job.AnalyzeOptions = priorityqueue.AnalyzeOptions{NumBuckets: 64}
+	require.NoError(t, job.Validate())
+	require.Equal(t, int64(1), job.GetTableID())
+	require.Equal(t, "static_partitioned_table_index", job.GetAnalyzeType())
+
+	partitionJobs := job.PartitionJobs()
+	require.Len(t, partitionJobs, 2)
+	for i, partitionJob := range partitionJobs {
+		require.NoError(t, partitionJob.Validate())
+		require.Equal(t, job.Partitions[i].Name, partitionJob.StaticPartitionName)
+		require.Equal(t, job.Partitions[i].ID, partitionJob.StaticPartitionID)
+		require.Equal(t, []string{"idx"}, partitionJob.Indexes)
+		require.Equal(t, job.AnalyzeOptions, partitionJob.AnalyzeOptions)
+	}
+
+	job.Partitions = nil
+	require.ErrorContains(t, job.Validate(), "no partition to analyze")
+}
+
+func TestDryRunStaticPartitionedTableIndexAnalysisJob(t *testing.T) {
+	store := testkit.CreateMockStore(t)
+	tk := testkit.NewTestKit(t, store)
+	sctx := tk.Session().(sessionctx.Context)
+
+	job := &priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+		TableSchema:     "test",
+		GlobalTableName: "t",
+		GlobalTableID:   1,
+		Indexes:         []string{"idx", "idx1"},
+		Partitions: []priorityqueue.PartitionIDAndName{
+			priorityqueue.NewPartitionIDAndName("p0", 2),
+			priorityqueue.NewPartitionIDAndName("p1", 3),
+		},
+		TableStatsVer: 2,
+	}
+	sqls, err := job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx`",
+		"analyze table `test`.`t` partition `p1` index `idx`",
+	}, sqls)
+
+	job.AnalyzeEachIndex = true
+	sqls, err = job.DryRun(sctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"analyze table `test`.`t` partition `p0` index `idx`",
+		"analyze table `test`.`t` partition `p0` index `idx1`",
+		"analyze table `test`.`t` partition `p1` index `idx`",
+		"analyze table `test`.`t` partition `p1` index `idx1`",
+	}, sqls)
+}
+
+func TestAnalyzeStaticPartitionedTableIndexAnalysisJob(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, b int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tk.MustExec("insert into t values (1, 1), (2, 2), (3, 3)")
+	handle := dom.StatsHandle()
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	tblInfo := tbl.Meta()
+	defs := tblInfo.GetPartitionInfo().Definitions
+	idxID := tblInfo.Indices[0].ID
+
+	newJob := func(partitions ...priorityqueue.PartitionIDAndName) (*priorityqueue.StaticPartitionedTableIndexAnalysisJob, *int, *int) {
+		job := &priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+			TableSchema:     "test",
+			GlobalTableName: "t",
+			GlobalTableID:   tblInfo.ID,
+			Indexes:         []string{"idx"},
+			Partitions:      partitions,
+			TableStatsVer:   2,
+		}
+		var succeeded, failed int
+		job.RegisterSuccessHook(func(priorityqueue.AnalysisJob) { succeeded++ })
+		job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failed++ })
+		return job, &succeeded, &failed
+	}
+
+	// All partitions are analyzed as one job.
+	job, succeeded, failed := newJob(
+		priorityqueue.NewPartitionIDAndName(defs[0].Name.O, defs[0].ID),
+		priorityqueue.NewPartitionIDAndName(defs[1].Name.O, defs[1].ID),
+	)
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Equal(t, 1, *succeeded)
+	require.Zero(t, *failed)
+	for _, def := range defs {
+		idxStats := handle.GetPartitionStats(tblInfo, def.ID).GetIdx(idxID)
+		require.NotNil(t, idxStats)
+		require.True(t, idxStats.IsAnalyzed())
+	}
+
+	// The failure of any partition fails the whole job once.
+	job, succeeded, failed = newJob(
+		priorityqueue.NewPartitionIDAndName(defs[0].Name.O, defs[0].ID),
+		priorityqueue.NewPartitionIDAndName("p_not_exist", defs[1].ID+100),
+	)
+	require.NoError(t, job.Analyze(context.Background(), handle, dom.SysProcTracker()))
+	require.Zero(t, *succeeded)
+	require.Equal(t, 1, *failed)
+	require.NotEmpty(t, job.GetLastFailureReason())
+}
+
+func TestStaticPartitionedTableIndexAnalysisJobIsValidToAnalyzeAfterPartitionDropped(t *testing.T) {
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("create table t (a int, index idx(a)) partition by range (a) (partition p0 values less than (2), partition p1 values less than (4))")
+	tbl, err := dom.InfoSchema().TableByName(context.Background(), model.NewCIStr("test"), model.NewCIStr("t"))
+	require.NoError(t, err)
+	defs := tbl.Meta().GetPartitionInfo().Definitions
+	job := &priorityqueue.StaticPartitionedTableIndexAnalysisJob{
+		TableSchema:     "test",
+		GlobalTableName: "t",
+		GlobalTableID:   tbl.Meta().ID,
+		Indexes:         []string{"idx"},
+		Partitions: []priorityqueue.PartitionIDAndName{
+			priorityqueue.NewPartitionIDAndName(defs[0].Name.O, defs[0].ID),
+			priorityqueue.NewPartitionIDAndName(defs[1].Name.O, defs[1].ID),
+		},
+	}
+	failed := false
+	job.RegisterFailureHook(func(priorityqueue.AnalysisJob) { failed = true })
+
+	// The dropped partitions are removed from the job.
+	sctx := tk.Session().(sessionctx.Context)
+	tk.MustExec("alter table t drop partition p0")
+	valid, failReason := job.IsValidToAnalyze(sctx)
+	require.True(t, valid)
+	require.Equal(t, "", failReason)
+	require.Equal(t, []priorityqueue.PartitionIDAndName{priorityqueue.NewPartitionIDAndName("p1", defs[1].ID)}, job.Partitions)
+	require.False(t, failed)
+
+	job.Partitions = []priorityqueue.PartitionIDAndName{priorityqueue.NewPartitionIDAndName(defs[0].Name.O, defs[0].ID)}
+	valid, failReason = job.IsValidToAnalyze(sctx)
+	require.False(t, valid)
+	require.Equal(t, "partitions no longer exist", failReason)
+	require.True(t, failed)
+}
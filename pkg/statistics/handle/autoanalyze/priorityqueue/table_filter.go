@@ -0,0 +1,101 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// TableFilter decides which tables can be auto analyzed, by the allowlist and the denylist of the tables.
+// A pattern is in the form of `schema.table`, where both parts are shell globs, such as `logs.*` or `*.staging_*`,
+// see path.Match for the syntax. The patterns are matched case-insensitively, like the names of the tables.
+// A table is allowed if it matches any pattern of the allowlist, or the allowlist is empty,
+// and it does not match any pattern of the denylist. That is, the denylist takes precedence over the allowlist.
+type TableFilter struct {
+	allowlist []tablePattern
+	denylist  []tablePattern
+}
+
+// tablePattern is a compiled pattern of the TableFilter.
+type tablePattern struct {
+	schema string
+	table  string
+}
+
+// NewTableFilter creates a TableFilter from the patterns of the allowlist and the denylist.
+// It returns an error if any pattern is malformed.
+func NewTableFilter(allowlist, denylist []string) (*TableFilter, error) {
+	allow, err := compileTablePatterns(allowlist)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := compileTablePatterns(denylist)
+	if err != nil {
+		return nil, err
+	}
+	return &TableFilter{allowlist: allow, denylist: deny}, nil
+}
+
+func compileTablePatterns(patterns []string) ([]tablePattern, error) {
+	compiled := make([]tablePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		schema, table, ok := strings.Cut(strings.ToLower(pattern), ".")
+		if !ok || schema == "" || table == "" {
+			return nil, errors.Errorf("invalid table pattern %q, it must be in the form of schema.table", pattern)
+		}
+		// Check the syntax of the pattern once, so that the errors can be ignored in match.
+		if _, err := path.Match(schema, ""); err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %q", pattern)
+		}
+		if _, err := path.Match(table, ""); err != nil {
+			return nil, errors.Annotatef(err, "invalid table pattern %q", pattern)
+		}
+		compiled = append(compiled, tablePattern{schema: schema, table: table})
+	}
+	return compiled, nil
+}
+
+func (p tablePattern) match(schema, table string) bool {
+	if matched, _ := path.Match(p.schema, schema); !matched {
+		return false
+	}
+	matched, _ := path.Match(p.table, table)
+	return matched
+}
+
+func matchAnyTablePattern(patterns []tablePattern, schema, table string) bool {
+	for _, p := range patterns {
+		if p.match(schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowed checks whether the table can be auto analyzed.
+// It is safe to call it on a nil filter, which allows all tables.
+func (f *TableFilter) IsAllowed(schema, table string) bool {
+	if f == nil {
+		return true
+	}
+	schema, table = strings.ToLower(schema), strings.ToLower(table)
+	if matchAnyTablePattern(f.denylist, schema, table) {
+		return false
+	}
+	return len(f.allowlist) == 0 || matchAnyTablePattern(f.allowlist, schema, table)
+}
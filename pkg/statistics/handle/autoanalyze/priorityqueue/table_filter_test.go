@@ -0,0 +1,75 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue_test
+
+import (
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+	"github.com/pingcap/tidb/pkg/testkit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableFilter(t *testing.T) {
+	// A nil filter allows all tables.
+	var filter *priorityqueue.TableFilter
+	require.True(t, filter.IsAllowed("test", "t"))
+
+	filter, err := priorityqueue.NewTableFilter(nil, []string{"logs.*", "*.staging_*"})
+	require.NoError(t, err)
+	require.True(t, filter.IsAllowed("test", "t"))
+	require.False(t, filter.IsAllowed("logs", "t"))
+	require.False(t, filter.IsAllowed("test", "staging_orders"))
+	// The names are matched case-insensitively.
+	require.False(t, filter.IsAllowed("LOGS", "t"))
+	require.False(t, filter.IsAllowed("test", "Staging_Orders"))
+
+	// The denylist takes precedence over the allowlist.
+	filter, err = priorityqueue.NewTableFilter([]string{"test.*", "Sales.Orders"}, []string{"test.tmp?"})
+	require.NoError(t, err)
+	require.True(t, filter.IsAllowed("test", "t"))
+	require.True(t, filter.IsAllowed("sales", "orders"))
+	require.False(t, filter.IsAllowed("sales", "customers"))
+	require.False(t, filter.IsAllowed("test", "tmp1"))
+	require.True(t, filter.IsAllowed("test", "tmp10"))
+
+	// The malformed patterns are rejected.
+	_, err = priorityqueue.NewTableFilter([]string{"test"}, nil)
+	require.ErrorContains(t, err, `invalid table pattern "test"`)
+	_, err = priorityqueue.NewTableFilter(nil, []string{"test."})
+	require.ErrorContains(t, err, `invalid table pattern "test."`)
+	_, err = priorityqueue.NewTableFilter(nil, []string{"test.[a"})
+	require.ErrorContains(t, err, `invalid table pattern "test.[a"`)
+}
+
+func TestPushWithTableFilter(t *testing.T) {
+	_, dom := testkit.CreateMockStoreAndDomain(t)
+	filter, err := priorityqueue.NewTableFilter(nil, []string{"test.t1"})
+	require.NoError(t, err)
+	pq := priorityqueue.NewAnalysisPriorityQueue(dom.StatsHandle(), priorityqueue.WithTableFilter(filter))
+	defer pq.Close()
+	require.NoError(t, pq.Initialize())
+
+	err = pq.Push(newNonPartitionedJob(1, 0.5))
+	require.ErrorIs(t, err, priorityqueue.ErrTableFiltered)
+	require.ErrorContains(t, err, "table test.t1")
+	require.NoError(t, pq.Push(newNonPartitionedJob(2, 0.5)))
+	l, err := pq.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, l)
+	job, err := pq.Peek()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), job.GetTableID())
+}
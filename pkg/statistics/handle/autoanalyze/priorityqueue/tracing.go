@@ -0,0 +1,78 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priorityqueue
+
+import (
+	"context"
+	"strings"
+)
+
+// Tracer starts the spans around the execution of the analysis jobs,
+// so that the slow analysis can be correlated with the rest of the cluster in the distributed traces.
+// It is small enough to be implemented on top of any tracing library, e.g. OpenTelemetry.
+type Tracer interface {
+	// Start starts a span with the attributes as a child of the span in the context, if any.
+	// It returns the context that carries the new span.
+	Start(ctx context.Context, name string, attributes map[string]any) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// RecordError records the error that fails the traced operation.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// NoopTracer is the Tracer that traces nothing.
+type NoopTracer struct{}
+
+// Start implements Tracer.
+func (NoopTracer) Start(ctx context.Context, _ string, _ map[string]any) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+// RecordError implements Span.
+func (noopSpan) RecordError(error) {}
+
+// End implements Span.
+func (noopSpan) End() {}
+
+// The attributes of the span of an analysis job.
+const (
+	spanAttrSchema     = "schema"
+	spanAttrTable      = "table"
+	spanAttrPartitions = "partitions"
+	spanAttrWeight     = "weight"
+)
+
+// startAnalysisSpan starts the span of the job, which is named after its analyze type.
+// It does not build the attributes if the spans are not traced at all.
+func startAnalysisSpan(ctx context.Context, tracer Tracer, job AnalysisJob) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	if _, ok := tracer.(NoopTracer); ok {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, job.GetAnalyzeType(), map[string]any{
+		spanAttrSchema:     job.GetSchemaName(),
+		spanAttrTable:      job.GetTableName(),
+		spanAttrPartitions: strings.Join(job.GetPartitionNames(), ","),
+		spanAttrWeight:     job.GetWeight(),
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refresher
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
+)
+
+// DefaultCompletedJobsCapacity is the default number of the completed jobs kept by the refresher.
+const DefaultCompletedJobsCapacity = 100
+
+// CompletedJob is the outcome of a finished analysis job, see Refresher.GetRecentCompletedJobs.
+type CompletedJob struct {
+	// FinishedAt is the time when the job finished.
+	FinishedAt time.Time
+	Schema     string
+	Table      string
+	// Partitions are the partitions analyzed by the job. It is nil for the non-partitioned tables.
+	Partitions []string
+	// AnalyzeType is what the job analyzes, see priorityqueue.AnalysisJob.GetAnalyzeType.
+	AnalyzeType string
+	// FailReason is the reason why the job failed. It is empty if the job succeeded.
+	FailReason string
+	// Duration is the time spent on executing the analyze statements.
+	// It is 0 if the job failed before running any statement, e.g. because it is not valid to analyze.
+	Duration time.Duration
+	TableID  int64
+	// Succeeded indicates whether the job is analyzed successfully.
+	Succeeded bool
+}
+
+// completedJobs is a bounded ring buffer of the latest completed jobs.
+// Once it is full, recording a job overwrites the oldest one.
+// It is thread-safe.
+type completedJobs struct {
+	mu sync.Mutex
+	// jobs holds the recorded jobs. Once it is full, next is the index of the oldest job.
+	jobs     []CompletedJob
+	next     int
+	capacity int
+}
+
+func newCompletedJobs(capacity int) *completedJobs {
+	return &completedJobs{capacity: max(capacity, 0)}
+}
+
+// record records the outcome of the job. It is used as the priorityqueue.CompletionHook.
+func (c *completedJobs) record(job priorityqueue.AnalysisJob, succeeded bool) {
+	completed := CompletedJob{
+		FinishedAt:  priorityqueue.DefaultClock.Now(),
+		Schema:      job.GetSchemaName(),
+		Table:       job.GetTableName(),
+		Partitions:  slices.Clone(job.GetPartitionNames()),
+		AnalyzeType: job.GetAnalyzeType(),
+		Duration:    job.GetLastRunDuration(),
+		TableID:     job.GetTableID(),
+		Succeeded:   succeeded,
+	}
+	if !succeeded {
+		completed.FailReason = job.GetLastFailureReason()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity == 0 {
+		return
+	}
+	if len(c.jobs) < c.capacity {
+		c.jobs = append(c.jobs, completed)
+		return
+	}
+	c.jobs[c.next] = completed
+	c.next = (c.next + 1) % c.capacity
+}
+
+// latest returns at most n latest completed jobs, the latest first.
+// All recorded jobs are returned if n is not positive.
+func (c *completedJobs) latest(n int) []CompletedJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n <= 0 {
+		n = len(c.jobs)
+	}
+	return c.latestWithoutLock(n)
+}
+
+func (c *completedJobs) latestWithoutLock(n int) []CompletedJob {
+	n = min(n, len(c.jobs))
+	result := make([]CompletedJob, 0, n)
+	// The latest job is right before next.
+	for i := 1; i <= n; i++ {
+		result = append(result, c.jobs[(c.next-i+len(c.jobs))%len(c.jobs)])
+	}
+	return result
+}
+
+// resize changes the capacity of the buffer, keeping the latest jobs that fit.
+func (c *completedJobs) resize(capacity int) {
+	capacity = max(capacity, 0)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := c.latestWithoutLock(capacity)
+	slices.Reverse(jobs)
+	c.jobs = jobs
+	c.next = 0
+	c.capacity = capacity
+}
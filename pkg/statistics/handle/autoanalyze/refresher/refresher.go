@@ -15,8 +15,8 @@
 package refresher
 
 import (
+	"context"
 	stderrors "errors"
-	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/pkg/ddl/notifier"
@@ -46,6 +46,9 @@ type Refresher struct {
 	// worker is the worker that runs the analysis jobs.
 	worker *worker
 
+	// completedJobs records the latest completed jobs, see GetRecentCompletedJobs.
+	completedJobs *completedJobs
+
 	// lastSeenPruneMode is the last seen value of the partition prune mode.
 	// Used to detect changes in the partition prune mode.
 	lastSeenPruneMode variable.PartitionPruneMode
@@ -56,17 +59,28 @@ type Refresher struct {
 }
 
 // NewRefresher creates a new Refresher and starts the goroutine.
+// The options are applied to the priority queue after the built-in ones, e.g. priorityqueue.WithTracer.
+// The queue, the jobs and the worker are also tuned by the package variables of priorityqueue and refresher,
+// e.g. priorityqueue.CircuitBreakerFailureThreshold and RunningJobsCostBudget. They are read without any lock,
+// so set them before the refresher is created.
 func NewRefresher(
 	statsHandle statstypes.StatsHandle,
 	sysProcTracker sysproctrack.Tracker,
 	ddlNotifier *notifier.DDLNotifier,
+	opts ...priorityqueue.QueueOption,
 ) *Refresher {
 	maxConcurrency := int(variable.AutoAnalyzeConcurrency.Load())
+	completedJobs := newCompletedJobs(DefaultCompletedJobsCapacity)
+	opts = append([]priorityqueue.QueueOption{
+		priorityqueue.WithMaxConcurrency(maxConcurrency),
+		priorityqueue.WithCompletionHook(completedJobs.record),
+	}, opts...)
 	r := &Refresher{
 		statsHandle:    statsHandle,
 		sysProcTracker: sysProcTracker,
-		jobs:           priorityqueue.NewAnalysisPriorityQueue(statsHandle),
+		jobs:           priorityqueue.NewAnalysisPriorityQueue(statsHandle, opts...),
 		worker:         NewWorker(statsHandle, sysProcTracker, maxConcurrency),
+		completedJobs:  completedJobs,
 	}
 	if ddlNotifier != nil {
 		ddlNotifier.RegisterHandler(notifier.PriorityQueueHandlerID, r.jobs.HandleDDLEvent)
@@ -79,6 +93,7 @@ func NewRefresher(
 func (r *Refresher) UpdateConcurrency() {
 	newConcurrency := int(variable.AutoAnalyzeConcurrency.Load())
 	r.worker.UpdateConcurrency(newConcurrency)
+	r.jobs.SetMaxConcurrency(newConcurrency)
 }
 
 // AnalyzeHighestPriorityTables picks tables with the highest priority and analyzes them.
@@ -128,13 +143,46 @@ func (r *Refresher) AnalyzeHighestPriorityTables(sctx sessionctx.Context) bool {
 	}
 
 	analyzedCount := 0
+	// The jobs of the tables at MaxRunningJobsPerTable wait in the queue while the jobs of other tables proceed.
+	// They are pushed back after the loop, otherwise they would be popped again and again.
+	var waitingJobs []priorityqueue.AnalysisJob
+	defer func() {
+		for _, job := range waitingJobs {
+			r.jobs.Release(job.GetTableID())
+			if err := r.jobs.Push(job); err != nil {
+				statslogutil.StatsLogger().Error("Failed to push the job back to the queue", zap.Error(err), zap.Stringer("job", job))
+			}
+		}
+	}()
 	for analyzedCount < remainConcurrency {
+		// The time window may be closed while submitting the jobs.
+		// Leave the remaining jobs in the queue until the window opens again.
+		if valid, failReason := r.autoAnalysisTimeWindow.IsValidToAnalyze(priorityqueue.DefaultClock.Now()); !valid {
+			statslogutil.SingletonStatsSamplerLogger().Info("Stop submitting jobs", zap.String("reason", failReason))
+			break
+		}
 		job, err := r.jobs.Pop()
 		if err != nil {
 			// No more jobs to analyze.
 			if stderrors.Is(err, priorityqueue.ErrHeapIsEmpty) {
 				break
 			}
+			// Too many jobs are running, try again later.
+			if stderrors.Is(err, priorityqueue.ErrConcurrencyLimitReached) {
+				break
+			}
+			// Too many jobs are started recently, try again later.
+			if stderrors.Is(err, priorityqueue.ErrStartRateLimited) {
+				break
+			}
+			// The queue is shutting down, do not start new jobs.
+			if stderrors.Is(err, priorityqueue.ErrQueueDraining) {
+				break
+			}
+			// The queue is paused, do not start new jobs until it is resumed.
+			if stderrors.Is(err, priorityqueue.ErrQueuePaused) {
+				break
+			}
 			intest.Assert(false, "Failed to pop job from the queue", zap.Error(err))
 			statslogutil.StatsLogger().Error("Failed to pop job from the queue", zap.Error(err))
 			return false
@@ -142,6 +190,7 @@ func (r *Refresher) AnalyzeHighestPriorityTables(sctx sessionctx.Context) bool {
 
 		if _, isRunning := currentRunningJobs[job.GetTableID()]; isRunning {
 			statslogutil.StatsLogger().Debug("Job already running, skipping", zap.Int64("tableID", job.GetTableID()))
+			r.jobs.Release(job.GetTableID())
 			continue
 		}
 		if valid, failReason := job.IsValidToAnalyze(sctx); !valid {
@@ -150,6 +199,62 @@ func (r *Refresher) AnalyzeHighestPriorityTables(sctx sessionctx.Context) bool {
 				zap.String("reason", failReason),
 				zap.Stringer("job", job),
 			)
+			r.jobs.Release(job.GetTableID())
+			continue
+		}
+		if priorityqueue.EnableDistributionDriftCheck {
+			meaningful, drift, err := priorityqueue.CheckDistributionDrift(sctx, r.statsHandle, job)
+			if err != nil {
+				// Analyze the table as usual if the drift cannot be estimated.
+				statslogutil.StatsLogger().Warn("Failed to check the distribution drift", zap.Error(err), zap.Stringer("job", job))
+			} else if !meaningful {
+				statslogutil.SingletonStatsSamplerLogger().Info(
+					"Skip the table because its data distribution does not change meaningfully",
+					zap.Float64("drift", drift),
+					zap.Stringer("job", job),
+				)
+				r.jobs.Release(job.GetTableID())
+				continue
+			}
+		}
+
+		// Leave the job in the queue until the running jobs release enough cost budget.
+		if cost := job.EstimatedCost(); !r.worker.HasCostBudget(cost) {
+			statslogutil.SingletonStatsSamplerLogger().Info(
+				"No cost budget available",
+				zap.Stringer("job", job),
+				zap.Float64("cost", cost),
+				zap.Float64("budget", RunningJobsCostBudget),
+			)
+			r.jobs.Release(job.GetTableID())
+			if err := r.jobs.Push(job); err != nil {
+				statslogutil.StatsLogger().Error("Failed to push the job back to the queue", zap.Error(err), zap.Stringer("job", job))
+			}
+			break
+		}
+
+		// Leave the job in the queue until the running jobs release enough memory.
+		if memoryBytes := job.EstimatedMemoryBytes(); !r.worker.HasMemoryQuota(memoryBytes) {
+			statslogutil.SingletonStatsSamplerLogger().Info(
+				"No memory quota available",
+				zap.Stringer("job", job),
+				zap.Int64("memoryBytes", memoryBytes),
+				zap.Int64("quota", RunningJobsMemoryQuota),
+			)
+			r.jobs.Release(job.GetTableID())
+			if err := r.jobs.Push(job); err != nil {
+				statslogutil.StatsLogger().Error("Failed to push the job back to the queue", zap.Error(err), zap.Stringer("job", job))
+			}
+			break
+		}
+
+		if !r.worker.HasTableConcurrency(job.GetGlobalTableID()) {
+			statslogutil.SingletonStatsSamplerLogger().Info(
+				"No concurrency available for the table",
+				zap.Stringer("job", job),
+				zap.Int("maxRunningJobsPerTable", MaxRunningJobsPerTable),
+			)
+			waitingJobs = append(waitingJobs, job)
 			continue
 		}
 
@@ -169,6 +274,7 @@ func (r *Refresher) AnalyzeHighestPriorityTables(sctx sessionctx.Context) bool {
 			)
 			analyzedCount++
 		} else {
+			r.jobs.Release(job.GetTableID())
 			statslogutil.StatsLogger().Warn("Failed to submit job",
 				zap.Stringer("job", job),
 				zap.Int("remainConcurrency", remainConcurrency),
@@ -204,7 +310,7 @@ func (r *Refresher) setAutoAnalysisTimeWindow(
 
 // isWithinTimeWindow checks if the current time is within the auto analyze time window.
 func (r *Refresher) isWithinTimeWindow() bool {
-	return r.autoAnalysisTimeWindow.IsWithinTimeWindow(time.Now())
+	return r.autoAnalysisTimeWindow.IsWithinTimeWindow(priorityqueue.DefaultClock.Now())
 }
 
 // WaitAutoAnalyzeFinishedForTest waits for the auto analyze job to be finished.
@@ -233,6 +339,24 @@ func (r *Refresher) RequeueMustRetryJobsForTest() {
 	r.jobs.RequeueMustRetryJobs()
 }
 
+// OnStart registers a hook that is called with the job right before it is analyzed.
+// See worker.OnStart for more details.
+func (r *Refresher) OnStart(hook priorityqueue.JobHook) {
+	r.worker.OnStart(hook)
+}
+
+// GetRecentCompletedJobs returns at most n latest completed jobs with their outcomes, the latest first.
+// All the kept jobs are returned if n is not positive, see SetCompletedJobsCapacity.
+func (r *Refresher) GetRecentCompletedJobs(n int) []CompletedJob {
+	return r.completedJobs.latest(n)
+}
+
+// SetCompletedJobsCapacity changes how many latest completed jobs are kept, DefaultCompletedJobsCapacity by default.
+// The latest jobs that fit are kept. 0 means not keeping any job.
+func (r *Refresher) SetCompletedJobsCapacity(capacity int) {
+	r.completedJobs.resize(capacity)
+}
+
 // Len returns the length of the analysis job queue.
 func (r *Refresher) Len() int {
 	l, err := r.jobs.Len()
@@ -240,6 +364,31 @@ func (r *Refresher) Len() int {
 	return l
 }
 
+// Pause stops submitting new jobs until Resume is called.
+// The running jobs are allowed to finish, and the jobs that are still in the queue are kept.
+func (r *Refresher) Pause() {
+	r.jobs.Pause()
+}
+
+// Resume resumes submitting new jobs after Pause is called.
+func (r *Refresher) Resume() {
+	r.jobs.Resume()
+}
+
+// IsPaused checks whether submitting new jobs is paused.
+func (r *Refresher) IsPaused() bool {
+	return r.jobs.IsPaused()
+}
+
+// Drain stops submitting new jobs and waits for the running jobs to finish.
+// The jobs that are still in the queue are kept. It returns the context error if the context is done first.
+func (r *Refresher) Drain(ctx context.Context) error {
+	if !r.jobs.IsInitialized() {
+		return nil
+	}
+	return r.jobs.Drain(ctx)
+}
+
 // Close stops all running jobs and releases resources.
 func (r *Refresher) Close() {
 	r.worker.Stop()
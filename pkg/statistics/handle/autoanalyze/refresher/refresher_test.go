@@ -16,11 +16,13 @@ package refresher_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	pmodel "github.com/pingcap/tidb/pkg/parser/model"
 	"github.com/pingcap/tidb/pkg/sessionctx"
 	"github.com/pingcap/tidb/pkg/statistics"
+	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/priorityqueue"
 	"github.com/pingcap/tidb/pkg/statistics/handle/autoanalyze/refresher"
 	"github.com/pingcap/tidb/pkg/statistics/handle/util"
 	"github.com/pingcap/tidb/pkg/testkit"
@@ -297,6 +299,63 @@ func TestAnalyzeHighestPriorityTables(t *testing.T) {
 	require.Equal(t, int64(8), tblStats2.RealtimeCount)
 }
 
+func TestGetRecentCompletedJobs(t *testing.T) {
+	statistics.AutoAnalyzeMinCnt = 0
+	defer func() {
+		statistics.AutoAnalyzeMinCnt = 1000
+	}()
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("set global tidb_enable_auto_analyze=true")
+	tk.MustExec("set global tidb_auto_analyze_concurrency=1")
+	for i := 1; i <= 3; i++ {
+		tk.MustExec(fmt.Sprintf("create table t%d (a int, b int)", i))
+		tk.MustExec(fmt.Sprintf("insert into t%d values (1, 1), (2, 2), (3, 3)", i))
+	}
+	handle := dom.StatsHandle()
+	require.NoError(t, handle.DumpStatsDeltaToKV(true))
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+	r := refresher.NewRefresher(handle, dom.SysProcTracker(), dom.DDLNotifier())
+	defer r.Close()
+	r.SetCompletedJobsCapacity(2)
+	require.Empty(t, r.GetRecentCompletedJobs(0))
+
+	// Analyze one table in each round.
+	var analyzed []string
+	for i := 0; i < 3; i++ {
+		require.NoError(t, util.CallWithSCtx(handle.SPool(), func(sctx sessionctx.Context) error {
+			require.True(t, r.AnalyzeHighestPriorityTables(sctx))
+			return nil
+		}))
+		r.WaitAutoAnalyzeFinishedForTest()
+		latest := r.GetRecentCompletedJobs(1)
+		require.Len(t, latest, 1)
+		require.True(t, latest[0].Succeeded)
+		require.Empty(t, latest[0].FailReason)
+		require.Equal(t, "test", latest[0].Schema)
+		require.Equal(t, "table", latest[0].AnalyzeType)
+		require.False(t, latest[0].FinishedAt.IsZero())
+		analyzed = append(analyzed, latest[0].Table)
+	}
+	require.ElementsMatch(t, []string{"t1", "t2", "t3"}, analyzed)
+
+	// Only the latest 2 jobs are kept, the latest first.
+	jobs := r.GetRecentCompletedJobs(0)
+	require.Len(t, jobs, 2)
+	require.Equal(t, analyzed[2], jobs[0].Table)
+	require.Equal(t, analyzed[1], jobs[1].Table)
+	require.Len(t, r.GetRecentCompletedJobs(5), 2)
+
+	r.SetCompletedJobsCapacity(1)
+	jobs = r.GetRecentCompletedJobs(0)
+	require.Len(t, jobs, 1)
+	require.Equal(t, analyzed[2], jobs[0].Table)
+	r.SetCompletedJobsCapacity(0)
+	require.Empty(t, r.GetRecentCompletedJobs(0))
+}
+
 func TestAnalyzeHighestPriorityTablesConcurrently(t *testing.T) {
 	statistics.AutoAnalyzeMinCnt = 0
 	defer func() {
@@ -377,6 +436,57 @@ func TestAnalyzeHighestPriorityTablesConcurrently(t *testing.T) {
 	require.Equal(t, int64(6), tblStats3.RealtimeCount)
 }
 
+func TestAnalyzeHighestPriorityTablesWithTableConcurrency(t *testing.T) {
+	statistics.AutoAnalyzeMinCnt = 0
+	defer func() {
+		statistics.AutoAnalyzeMinCnt = 1000
+	}()
+	defer func(limit int) {
+		refresher.MaxRunningJobsPerTable = limit
+	}(refresher.MaxRunningJobsPerTable)
+	refresher.MaxRunningJobsPerTable = 1
+
+	store, dom := testkit.CreateMockStoreAndDomain(t)
+	tk := testkit.NewTestKit(t, store)
+	tk.MustExec("use test")
+	tk.MustExec("set global tidb_enable_auto_analyze=true")
+	tk.MustExec("set global tidb_auto_analyze_concurrency=4")
+	tk.MustExec("set global tidb_partition_prune_mode='static'")
+	tk.MustExec("create table t1 (a int, b int) partition by range (a) (partition p0 values less than (10), partition p1 values less than (20), partition p2 values less than (30))")
+	tk.MustExec("create table t2 (a int, b int) partition by range (a) (partition p0 values less than (10), partition p1 values less than (20), partition p2 values less than (30))")
+	tk.MustExec("insert into t1 values (1, 1), (11, 11), (21, 21)")
+	tk.MustExec("insert into t2 values (1, 1), (11, 11), (21, 21)")
+	handle := dom.StatsHandle()
+	require.NoError(t, handle.DumpStatsDeltaToKV(true))
+	require.NoError(t, handle.Update(context.Background(), dom.InfoSchema()))
+	r := refresher.NewRefresher(handle, dom.SysProcTracker(), dom.DDLNotifier())
+	defer r.Close()
+	release := make(chan struct{})
+	r.OnStart(func(priorityqueue.AnalysisJob) {
+		<-release
+	})
+
+	// Only one partition of each table runs, though the worker can run 4 jobs.
+	require.NoError(t, util.CallWithSCtx(handle.SPool(), func(sctx sessionctx.Context) error {
+		require.True(t, r.AnalyzeHighestPriorityTables(sctx))
+		return nil
+	}))
+	globalTableIDs := make(map[int64]struct{}, 2)
+	is := dom.InfoSchema()
+	for id := range r.GetRunningJobs() {
+		tblInfo, _, _ := is.FindTableInfoByPartitionID(id)
+		require.NotNil(t, tblInfo)
+		globalTableIDs[tblInfo.ID] = struct{}{}
+	}
+	require.Len(t, r.GetRunningJobs(), 2)
+	require.Len(t, globalTableIDs, 2)
+	// The other partitions wait in the queue.
+	require.Equal(t, 4, r.Len())
+
+	close(release)
+	r.WaitAutoAnalyzeFinishedForTest()
+}
+
 func TestAnalyzeHighestPriorityTablesWithFailedAnalysis(t *testing.T) {
 	statistics.AutoAnalyzeMinCnt = 0
 	defer func() {
@@ -15,6 +15,7 @@
 package refresher
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -26,6 +27,28 @@ import (
 	"go.uber.org/zap"
 )
 
+// RunningJobsCostBudget is the maximum total estimated cost of the running jobs.
+// A new job is not started if it would exceed the budget, unless no job is running,
+// so that a single job more expensive than the budget can still run.
+// Set it to 0 to disable the budget.
+// See priorityqueue.AnalysisJob.EstimatedCost for the cost unit.
+var RunningJobsCostBudget = 0.0
+
+// RunningJobsMemoryQuota is the maximum memory in bytes used by the running jobs.
+// The used memory is the larger one of the memory tracked by the system processes in sysproctrack
+// and the total estimated memory of the running jobs, because a job does not allocate its memory right after it starts.
+// A new job is not started if its estimated memory would exceed the quota, unless no job is running.
+// Set it to 0 to disable the quota.
+// See priorityqueue.AnalysisJob.EstimatedMemoryBytes for the estimation.
+var RunningJobsMemoryQuota int64
+
+// MaxRunningJobsPerTable is the maximum number of the running jobs of the same table, keyed by
+// priorityqueue.AnalysisJob.GetGlobalTableID, e.g. the static partitions of a partitioned table.
+// It bounds the load on a single table separately from the max concurrency of the worker,
+// so that the jobs of other tables can run while the jobs of a busy table wait.
+// Set it to 0 to disable the limit.
+var MaxRunningJobsPerTable = 0
+
 // worker manages the execution of analysis jobs.
 // Fields are ordered to represent the mutex protection clearly.
 //
@@ -33,21 +56,39 @@ import (
 type worker struct {
 	statsHandle    statstypes.StatsHandle
 	sysProcTracker sysproctrack.Tracker
-	wg             util.WaitGroupWrapper
+	// ctx is used to cancel the running jobs when the worker is stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     util.WaitGroupWrapper
 
 	mu sync.Mutex
 	// mu is used to protect the following fields.
-	runningJobs    map[int64]struct{}
-	maxConcurrency int
+	// runningJobs maps the table ID of each running job to its estimated resources.
+	runningJobs map[int64]runningJob
+	// runningJobsPerTable maps the global table ID to the number of its running jobs.
+	runningJobsPerTable map[int64]int
+	maxConcurrency      int
+	// onStart is called with the job right before it is analyzed.
+	onStart priorityqueue.JobHook
+}
+
+// runningJob is the estimated resources used by a running job.
+type runningJob struct {
+	cost        float64
+	memoryBytes int64
 }
 
 // NewWorker creates a new worker.
 func NewWorker(statsHandle statstypes.StatsHandle, sysProcTracker sysproctrack.Tracker, maxConcurrency int) *worker {
+	ctx, cancel := context.WithCancel(context.Background())
 	w := &worker{
-		statsHandle:    statsHandle,
-		sysProcTracker: sysProcTracker,
-		runningJobs:    make(map[int64]struct{}),
-		maxConcurrency: maxConcurrency,
+		statsHandle:         statsHandle,
+		sysProcTracker:      sysProcTracker,
+		ctx:                 ctx,
+		cancel:              cancel,
+		runningJobs:         make(map[int64]runningJob),
+		runningJobsPerTable: make(map[int64]int),
+		maxConcurrency:      maxConcurrency,
 	}
 	return w
 }
@@ -67,8 +108,19 @@ func (w *worker) UpdateConcurrency(newConcurrency int) {
 	w.maxConcurrency = newConcurrency
 }
 
+// OnStart registers a hook that is called with the job right before it is analyzed, replacing the previous one.
+// Unlike the enqueue hook of the queue and the success and failure hooks of the job, it marks the moment
+// when the job starts running, so that the queue wait time and the execution time can be measured separately.
+// The hook is called in the goroutine running the job without holding any lock.
+func (w *worker) OnStart(hook priorityqueue.JobHook) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onStart = hook
+}
+
 // SubmitJob submits a job to the worker.
-// It returns false if the job is not submitted due to concurrency limit.
+// It returns false if the job is not submitted due to concurrency limit, per-table concurrency limit,
+// cost budget or memory quota.
 func (w *worker) SubmitJob(job priorityqueue.AnalysisJob) bool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -76,7 +128,37 @@ func (w *worker) SubmitJob(job priorityqueue.AnalysisJob) bool {
 		statslogutil.StatsLogger().Warn("Worker at maximum capacity, job discarded", zap.Stringer("job", job))
 		return false
 	}
-	w.runningJobs[job.GetTableID()] = struct{}{}
+	cost := job.EstimatedCost()
+	if !w.hasCostBudgetWithoutLock(cost) {
+		statslogutil.StatsLogger().Warn("Worker out of cost budget, job discarded",
+			zap.Stringer("job", job),
+			zap.Float64("cost", cost),
+			zap.Float64("runningJobsCost", w.runningJobsCostWithoutLock()),
+			zap.Float64("budget", RunningJobsCostBudget),
+		)
+		return false
+	}
+	memoryBytes := job.EstimatedMemoryBytes()
+	if !w.hasMemoryQuotaWithoutLock(memoryBytes) {
+		statslogutil.StatsLogger().Warn("Worker out of memory quota, job discarded",
+			zap.Stringer("job", job),
+			zap.Int64("memoryBytes", memoryBytes),
+			zap.Int64("usedMemoryBytes", w.usedMemoryBytesWithoutLock()),
+			zap.Int64("quota", RunningJobsMemoryQuota),
+		)
+		return false
+	}
+	globalTableID := job.GetGlobalTableID()
+	if !w.hasTableConcurrencyWithoutLock(globalTableID) {
+		statslogutil.StatsLogger().Warn("Table at maximum concurrency, job discarded",
+			zap.Stringer("job", job),
+			zap.Int("runningJobsOfTable", w.runningJobsPerTable[globalTableID]),
+			zap.Int("maxRunningJobsPerTable", MaxRunningJobsPerTable),
+		)
+		return false
+	}
+	w.runningJobs[job.GetTableID()] = runningJob{cost: cost, memoryBytes: memoryBytes}
+	w.runningJobsPerTable[globalTableID]++
 
 	w.wg.RunWithRecover(
 		func() {
@@ -97,9 +179,19 @@ func (w *worker) processJob(job priorityqueue.AnalysisJob) {
 		w.mu.Lock()
 		defer w.mu.Unlock()
 		delete(w.runningJobs, job.GetTableID())
+		globalTableID := job.GetGlobalTableID()
+		if w.runningJobsPerTable[globalTableID]--; w.runningJobsPerTable[globalTableID] <= 0 {
+			delete(w.runningJobsPerTable, globalTableID)
+		}
 	}()
 
-	if err := job.Analyze(w.statsHandle, w.sysProcTracker); err != nil {
+	w.mu.Lock()
+	onStart := w.onStart
+	w.mu.Unlock()
+	if onStart != nil {
+		onStart(job)
+	}
+	if err := job.Analyze(w.ctx, w.statsHandle, w.sysProcTracker); err != nil {
 		statslogutil.StatsLogger().Error(
 			"Auto analyze job execution failed",
 			zap.Stringer("job", job),
@@ -119,6 +211,78 @@ func (w *worker) GetRunningJobs() map[int64]struct{} {
 	return runningJobs
 }
 
+// HasCostBudget checks whether a job with the given estimated cost can be started within RunningJobsCostBudget.
+func (w *worker) HasCostBudget(cost float64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hasCostBudgetWithoutLock(cost)
+}
+
+func (w *worker) hasCostBudgetWithoutLock(cost float64) bool {
+	if RunningJobsCostBudget <= 0 || len(w.runningJobs) == 0 {
+		return true
+	}
+	return w.runningJobsCostWithoutLock()+cost <= RunningJobsCostBudget
+}
+
+// HasTableConcurrency checks whether another job of the table can be started within MaxRunningJobsPerTable.
+// The table is identified by priorityqueue.AnalysisJob.GetGlobalTableID.
+func (w *worker) HasTableConcurrency(globalTableID int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hasTableConcurrencyWithoutLock(globalTableID)
+}
+
+func (w *worker) hasTableConcurrencyWithoutLock(globalTableID int64) bool {
+	return MaxRunningJobsPerTable <= 0 || w.runningJobsPerTable[globalTableID] < MaxRunningJobsPerTable
+}
+
+// GetRunningJobsCost returns the total estimated cost of the running jobs.
+func (w *worker) GetRunningJobsCost() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.runningJobsCostWithoutLock()
+}
+
+func (w *worker) runningJobsCostWithoutLock() float64 {
+	var total float64
+	for _, job := range w.runningJobs {
+		total += job.cost
+	}
+	return total
+}
+
+// HasMemoryQuota checks whether a job with the given estimated memory can be started within RunningJobsMemoryQuota.
+func (w *worker) HasMemoryQuota(memoryBytes int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hasMemoryQuotaWithoutLock(memoryBytes)
+}
+
+func (w *worker) hasMemoryQuotaWithoutLock(memoryBytes int64) bool {
+	if RunningJobsMemoryQuota <= 0 || len(w.runningJobs) == 0 {
+		return true
+	}
+	return w.usedMemoryBytesWithoutLock()+memoryBytes <= RunningJobsMemoryQuota
+}
+
+// usedMemoryBytesWithoutLock returns the memory used by the running jobs, see RunningJobsMemoryQuota.
+func (w *worker) usedMemoryBytesWithoutLock() int64 {
+	var estimated int64
+	for _, job := range w.runningJobs {
+		estimated += job.memoryBytes
+	}
+	var tracked int64
+	if w.sysProcTracker != nil {
+		for _, proc := range w.sysProcTracker.GetSysProcessList() {
+			if proc.MemTracker != nil {
+				tracked += proc.MemTracker.BytesConsumed()
+			}
+		}
+	}
+	return max(estimated, tracked)
+}
+
 // GetMaxConcurrency returns the maximum concurrency for the worker.
 func (w *worker) GetMaxConcurrency() int {
 	w.mu.Lock()
@@ -127,7 +291,9 @@ func (w *worker) GetMaxConcurrency() int {
 }
 
 // Stop stops the worker.
+// It cancels all running jobs and waits for them to exit.
 func (w *worker) Stop() {
+	w.cancel()
 	w.wg.Wait()
 }
 
@@ -15,6 +15,8 @@
 package refresher_test
 
 import (
+	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,13 +31,31 @@ import (
 
 // mockAnalysisJob implements the priorityqueue.AnalysisJob interface for testing
 type mockAnalysisJob struct {
-	tableID int64
-	weight  float64
-	analyze func(statstypes.StatsHandle, sysproctrack.Tracker) error
+	tableID       int64
+	globalTableID int64
+	weight        float64
+	cost          float64
+	memoryBytes   int64
+	analyze       func(statstypes.StatsHandle, sysproctrack.Tracker) error
 }
 
 func (m *mockAnalysisJob) GetTableID() int64 { return m.tableID }
-func (m *mockAnalysisJob) Analyze(h statstypes.StatsHandle, t sysproctrack.Tracker) error {
+func (m *mockAnalysisJob) GetAnalyzeType() string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) EstimatedCost() float64      { return m.cost }
+func (m *mockAnalysisJob) EstimatedMemoryBytes() int64 { return m.memoryBytes }
+func (m *mockAnalysisJob) GetSchemaName() string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetTableName() string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetPartitionNames() []string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetGlobalTableID() int64 { return m.globalTableID }
+func (m *mockAnalysisJob) Analyze(ctx context.Context, h statstypes.StatsHandle, t sysproctrack.Tracker) error {
 	if m.analyze != nil {
 		return m.analyze(h, t)
 	}
@@ -48,6 +68,45 @@ func (m *mockAnalysisJob) RegisterSuccessHook(priorityqueue.JobHook) {
 func (m *mockAnalysisJob) RegisterFailureHook(priorityqueue.JobHook) {
 	panic("not implemented")
 }
+func (m *mockAnalysisJob) Validate() error {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetLastRunDuration() time.Duration {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetLastFailureReason() string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) State() priorityqueue.JobState {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) IsLastFailureTransient() bool {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetCorrelationID() string {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) Equal(other priorityqueue.AnalysisJob) bool {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) Clone() priorityqueue.AnalysisJob {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) DryRun(sctx sessionctx.Context) ([]string, error) {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GenAnalyzeSQLParams(sctx sessionctx.Context) ([]priorityqueue.AnalyzeSQLParams, error) {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) RegisterProgressHook(priorityqueue.ProgressHook) {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) RegisterValidityHook(priorityqueue.ValidityHook) {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) SetTracer(priorityqueue.Tracer) {
+	panic("not implemented")
+}
 func (m *mockAnalysisJob) String() string { return "mockAnalysisJob" }
 func (m *mockAnalysisJob) IsValidToAnalyze(sessionctx.Context) (bool, string) {
 	panic("not implemented")
@@ -58,6 +117,18 @@ func (m *mockAnalysisJob) SetWeight(weight float64) {
 func (m *mockAnalysisJob) GetWeight() float64 {
 	panic("not implemented")
 }
+func (m *mockAnalysisJob) GetBaseWeight() float64 {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) SetEnqueuedAt(enqueuedAt time.Time) {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetEnqueuedAt() time.Time {
+	panic("not implemented")
+}
+func (m *mockAnalysisJob) GetWeightBreakdown() map[string]float64 {
+	panic("not implemented")
+}
 func (m *mockAnalysisJob) HasNewlyAddedIndex() bool {
 	panic("not implemented")
 }
@@ -102,6 +173,124 @@ func TestWorker(t *testing.T) {
 		w.Stop()
 	})
 
+	t.Run("CostBudget", func(t *testing.T) {
+		defer func(budget float64) {
+			refresher.RunningJobsCostBudget = budget
+		}(refresher.RunningJobsCostBudget)
+		refresher.RunningJobsCostBudget = 1
+		w := refresher.NewWorker(handle, sysProcTracker, 5)
+		release := make(chan struct{})
+		blockingJob := func(id int64, cost float64) *mockAnalysisJob {
+			return &mockAnalysisJob{
+				tableID: id,
+				cost:    cost,
+				analyze: func(statstypes.StatsHandle, sysproctrack.Tracker) error {
+					<-release
+					return nil
+				},
+			}
+		}
+
+		// A job more expensive than the budget can run if no job is running.
+		require.True(t, w.HasCostBudget(2))
+		require.True(t, w.SubmitJob(blockingJob(1, 0.6)))
+		require.Equal(t, 0.6, w.GetRunningJobsCost())
+		require.False(t, w.HasCostBudget(0.5))
+		require.False(t, w.SubmitJob(blockingJob(2, 0.5))) // Should be rejected due to cost budget
+		require.True(t, w.SubmitJob(blockingJob(3, 0.4)))
+		require.InDelta(t, 1.0, w.GetRunningJobsCost(), 1e-9)
+
+		close(release)
+		w.WaitAutoAnalyzeFinishedForTest()
+		require.Zero(t, w.GetRunningJobsCost())
+		require.True(t, w.HasCostBudget(0.5))
+		w.Stop()
+	})
+
+	t.Run("MemoryQuota", func(t *testing.T) {
+		defer func(quota int64) {
+			refresher.RunningJobsMemoryQuota = quota
+		}(refresher.RunningJobsMemoryQuota)
+		refresher.RunningJobsMemoryQuota = 100 << 20
+		w := refresher.NewWorker(handle, sysProcTracker, 5)
+		release := make(chan struct{})
+		blockingJob := func(id, memoryBytes int64) *mockAnalysisJob {
+			return &mockAnalysisJob{
+				tableID:     id,
+				memoryBytes: memoryBytes,
+				analyze: func(statstypes.StatsHandle, sysproctrack.Tracker) error {
+					<-release
+					return nil
+				},
+			}
+		}
+
+		// A job larger than the quota can run if no job is running.
+		require.True(t, w.HasMemoryQuota(200<<20))
+		require.True(t, w.SubmitJob(blockingJob(1, 60<<20)))
+		require.False(t, w.HasMemoryQuota(50<<20))
+		require.False(t, w.SubmitJob(blockingJob(2, 50<<20))) // Should be rejected due to memory quota
+		require.True(t, w.SubmitJob(blockingJob(3, 40<<20)))
+		require.False(t, w.HasMemoryQuota(1))
+
+		close(release)
+		w.WaitAutoAnalyzeFinishedForTest()
+		require.True(t, w.HasMemoryQuota(50<<20))
+		w.Stop()
+	})
+
+	t.Run("TableConcurrency", func(t *testing.T) {
+		defer func(limit int) {
+			refresher.MaxRunningJobsPerTable = limit
+		}(refresher.MaxRunningJobsPerTable)
+		refresher.MaxRunningJobsPerTable = 2
+		w := refresher.NewWorker(handle, sysProcTracker, 5)
+		release := make(chan struct{})
+		blockingJob := func(id, globalTableID int64) *mockAnalysisJob {
+			return &mockAnalysisJob{
+				tableID:       id,
+				globalTableID: globalTableID,
+				analyze: func(statstypes.StatsHandle, sysproctrack.Tracker) error {
+					<-release
+					return nil
+				},
+			}
+		}
+
+		require.True(t, w.SubmitJob(blockingJob(11, 1)))
+		require.True(t, w.SubmitJob(blockingJob(12, 1)))
+		require.False(t, w.HasTableConcurrency(1))
+		require.False(t, w.SubmitJob(blockingJob(13, 1))) // Should be rejected due to per-table concurrency limit
+		require.True(t, w.HasTableConcurrency(2))
+		require.True(t, w.SubmitJob(blockingJob(21, 2)))
+		require.Len(t, w.GetRunningJobs(), 3)
+
+		close(release)
+		w.WaitAutoAnalyzeFinishedForTest()
+		require.True(t, w.HasTableConcurrency(1))
+		w.Stop()
+	})
+
+	t.Run("OnStart", func(t *testing.T) {
+		w := refresher.NewWorker(handle, sysProcTracker, 2)
+		var startedTableID atomic.Int64
+		var startedBeforeAnalyze atomic.Bool
+		w.OnStart(func(job priorityqueue.AnalysisJob) {
+			startedTableID.Store(job.GetTableID())
+		})
+		job := &mockAnalysisJob{
+			tableID: 1,
+			analyze: func(statstypes.StatsHandle, sysproctrack.Tracker) error {
+				startedBeforeAnalyze.Store(startedTableID.Load() == 1)
+				return nil
+			},
+		}
+		require.True(t, w.SubmitJob(job))
+		w.WaitAutoAnalyzeFinishedForTest()
+		require.True(t, startedBeforeAnalyze.Load())
+		w.Stop()
+	})
+
 	t.Run("GetRunningJobs", func(t *testing.T) {
 		w := refresher.NewWorker(handle, sysProcTracker, 2)
 		jobStarted := make(chan struct{}, 2)
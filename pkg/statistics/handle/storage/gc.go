@@ -162,6 +162,9 @@ func DeleteTableStatsFromKV(sctx sessionctx.Context, statsIDs []int64) (err erro
 		if _, err = util.Exec(sctx, "delete from mysql.analyze_options where table_id = %?", statsID); err != nil {
 			return err
 		}
+		if _, err = util.Exec(sctx, "delete from mysql.analyze_outcomes where table_id = %?", statsID); err != nil {
+			return err
+		}
 		if _, err = util.Exec(sctx, lockstats.DeleteLockSQL, statsID); err != nil {
 			return err
 		}